@@ -1,16 +1,42 @@
 package actions
 
 import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/gobuffalo/suite"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
 )
 
+const testMasterKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
 type ActionSuite struct {
 	*suite.Action
 }
 
 func Test_ActionSuite(t *testing.T) {
+	oyster_utils.SetEthKeyMasterKeys(testMasterKey)
+	services.SetBrokerMnemonic(testMnemonic)
+	services.SetBrokerSecret("testSecret")
+
 	as := &ActionSuite{suite.NewAction(App())}
 	suite.Run(t, as)
 }
+
+// brokerPost POSTs body to path signed the way another broker would.
+func brokerPost(as *ActionSuite, path string, body interface{}) *httptest.ResponseRecorder {
+	reqBody, err := json.Marshal(body)
+	as.Nil(err)
+
+	req := httptest.NewRequest("POST", path, bytes.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	services.SignBrokerRequest(req, reqBody)
+
+	res := httptest.NewRecorder()
+	as.App.ServeHTTP(res, req)
+	return res
+}
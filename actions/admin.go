@@ -0,0 +1,54 @@
+package actions
+
+import (
+	"crypto/subtle"
+	"os"
+	"strings"
+
+	raven "github.com/getsentry/raven-go"
+	"github.com/gobuffalo/buffalo"
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+type AdminResource struct {
+	buffalo.Resource
+}
+
+// Request Response structs
+
+type powStatsRes struct {
+	Channels  []models.PowStats `json:"channels"`
+	Providers []models.PowStats `json:"providers"`
+}
+
+// PowStats returns the rolling PoW stats of every chunk channel and PoW
+// provider.
+func (ar *AdminResource) PowStats(c buffalo.Context) error {
+	if code, msg := checkAdminRequest(c); code != 0 {
+		return c.Render(code, r.JSON(map[string]string{"error": msg}))
+	}
+
+	channels, providers, err := models.GetAllPowStats()
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return err
+	}
+
+	return c.Render(200, r.JSON(powStatsRes{Channels: channels, Providers: providers}))
+}
+
+// checkAdminRequest checks the request carries ADMIN_TOKEN as a bearer token.
+// Returns the status code and error to answer with, or 0 if it does. Admin
+// endpoints are closed when ADMIN_TOKEN is not set.
+func checkAdminRequest(c buffalo.Context) (int, string) {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		return 403, "admin endpoints are disabled, ADMIN_TOKEN is not set"
+	}
+
+	given := strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		return 401, "admin token is missing or wrong"
+	}
+	return 0, ""
+}
@@ -0,0 +1,53 @@
+package actions
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+func (as *ActionSuite) Test_AdminPowStats() {
+	os.Setenv("ADMIN_TOKEN", "secret")
+	defer os.Unsetenv("ADMIN_TOKEN")
+
+	as.Nil(as.DB.Create(&models.ChunkChannel{ChannelID: "CHANNEL", EstReadyTime: time.Now()}))
+	as.Nil(models.RecordChannelPowRun("CHANNEL", time.Now().Add(-10*time.Second), 10, false))
+	as.Nil(models.RecordProviderPowRun("local", time.Now().Add(-10*time.Second), 10, false))
+
+	req := as.JSON("/api/v2/admin/pow-stats")
+	req.Headers["Authorization"] = "Bearer secret"
+	res := req.Get()
+	as.Equal(200, res.Code)
+
+	bodyBytes, err := ioutil.ReadAll(res.Body)
+	as.Nil(err)
+	resParsed := powStatsRes{}
+	as.Nil(json.Unmarshal(bodyBytes, &resParsed))
+	as.Equal(1, len(resParsed.Channels))
+	as.Equal("CHANNEL", resParsed.Channels[0].Name)
+	as.Equal(1, resParsed.Channels[0].Runs)
+	as.Equal(1, len(resParsed.Providers))
+	as.Equal("local", resParsed.Providers[0].Name)
+}
+
+func (as *ActionSuite) Test_AdminPowStats_Token() {
+	os.Setenv("ADMIN_TOKEN", "secret")
+	defer os.Unsetenv("ADMIN_TOKEN")
+
+	as.Equal(401, as.JSON("/api/v2/admin/pow-stats").Get().Code)
+
+	req := as.JSON("/api/v2/admin/pow-stats")
+	req.Headers["Authorization"] = "Bearer secret"
+	as.Equal(200, req.Get().Code)
+}
+
+func (as *ActionSuite) Test_AdminPowStats_NoToken() {
+	os.Unsetenv("ADMIN_TOKEN")
+
+	req := as.JSON("/api/v2/admin/pow-stats")
+	req.Headers["Authorization"] = "Bearer "
+	as.Equal(403, req.Get().Code)
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/gobuffalo/x/sessions"
 	"github.com/oysterprotocol/brokernode/jobs"
 	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
 	"github.com/rs/cors"
 	"github.com/unrolled/secure"
 )
@@ -20,6 +21,10 @@ import (
 var ENV = envy.Get("GO_ENV", "development")
 var app *buffalo.App
 
+// IotaWrapper is the IOTA service transactions are broadcast with, set
+// before the app is built.
+var IotaWrapper services.IotaService
+
 // App is where all routes and middleware for buffalo
 // should be defined. This is the nerve center of your
 // application.
@@ -68,7 +73,19 @@ func App() *buffalo.App {
 		apiV2.POST("upload-sessions", uploadSessionResource.Create)
 		apiV2.PUT("upload-sessions/{id}", uploadSessionResource.Update)
 		apiV2.POST("upload-sessions/beta", uploadSessionResource.CreateBeta)
+		apiV2.POST("upload-sessions/beta/{id}/reveal", uploadSessionResource.RevealBeta)
+		apiV2.POST("upload-sessions/beta/{id}/requote", uploadSessionResource.RequoteBeta)
 		apiV2.GET("upload-sessions/{id}", uploadSessionResource.GetPaymentStatus)
+		apiV2.GET("upload-progress/{genesis_hash}", uploadSessionResource.GetProgress)
+		// Streams would hold a transaction open for as long as they are connected.
+		// Skipped on the group, which has its own copy of the app's middleware.
+		apiV2.Middleware.Skip(middleware.PopTransaction(models.DB), uploadSessionResource.GetEvents)
+		apiV2.GET("upload-sessions/{id}/events", uploadSessionResource.GetEvents)
+
+		// Brokernodes
+		brokernodeResource := BrokernodeResource{}
+		apiV2.POST("brokernodes", brokernodeResource.Register)
+		apiV2.POST("brokernodes/heartbeat", brokernodeResource.Heartbeat)
 
 		// Webnodes
 		webnodeResource := WebnodeResource{}
@@ -86,6 +103,11 @@ func App() *buffalo.App {
 		// Treasures
 		treasures := TreasuresResource{}
 		apiV2.POST("treasures", treasures.VerifyAndClaim)
+		apiV2.GET("treasures/{id}", treasures.GetClaim)
+
+		// Admin
+		adminResource := AdminResource{}
+		apiV2.GET("admin/pow-stats", adminResource.PowStats)
 	}
 
 	return app
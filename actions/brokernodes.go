@@ -0,0 +1,69 @@
+package actions
+
+import (
+	raven "github.com/getsentry/raven-go"
+	"github.com/gobuffalo/buffalo"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+type BrokernodeResource struct {
+	buffalo.Resource
+}
+
+// Request Response structs
+
+type brokernodeRes struct {
+	Brokernode models.Brokernode `json:"brokernode"`
+}
+
+// Register adds a peer broker to the registry, or updates it.
+func (br *BrokernodeResource) Register(c buffalo.Context) error {
+	if err := services.VerifyBrokerRequest(c.Request()); err != nil {
+		return c.Render(401, r.JSON(map[string]string{"error": err.Error()}))
+	}
+
+	req := services.BrokerRegistrationReq{}
+	if err := oyster_utils.ParseReqBody(c.Request(), &req); err != nil || req.Endpoint == "" {
+		return c.Render(400, r.JSON(map[string]string{"error": "endpoint is required"}))
+	}
+
+	b, vErr, err := models.RegisterBrokernode(models.Brokernode{
+		Endpoint:   req.Endpoint,
+		EthAddress: req.EthAddress,
+		Capacity:   req.Capacity,
+	})
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return err
+	}
+	if len(vErr.Errors) > 0 {
+		return c.Render(422, r.JSON(vErr.Errors))
+	}
+
+	return c.Render(200, r.JSON(brokernodeRes{Brokernode: *b}))
+}
+
+// Heartbeat records that a registered peer broker is still up.
+func (br *BrokernodeResource) Heartbeat(c buffalo.Context) error {
+	if err := services.VerifyBrokerRequest(c.Request()); err != nil {
+		return c.Render(401, r.JSON(map[string]string{"error": err.Error()}))
+	}
+
+	req := services.BrokerHeartbeatReq{}
+	if err := oyster_utils.ParseReqBody(c.Request(), &req); err != nil || req.Endpoint == "" {
+		return c.Render(400, r.JSON(map[string]string{"error": "endpoint is required"}))
+	}
+
+	b, err := models.BrokernodeHeartbeat(req.Endpoint, req.Capacity)
+	if err == models.ErrBrokernodeNotFound {
+		return c.Render(404, r.JSON(map[string]string{"error": err.Error()}))
+	}
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return err
+	}
+
+	return c.Render(200, r.JSON(brokernodeRes{Brokernode: *b}))
+}
@@ -0,0 +1,52 @@
+package actions
+
+import (
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+)
+
+func (as *ActionSuite) Test_BrokernodesRegister() {
+	res := brokerPost(as, "/api/v2/brokernodes", map[string]interface{}{
+		"endpoint":   "1.2.3.4",
+		"ethAddress": "0xabc",
+		"capacity":   10,
+	})
+	as.Equal(200, res.Code)
+
+	b, err := models.GetBrokernodeByEndpoint("1.2.3.4")
+	as.Nil(err)
+	as.Equal("0xabc", b.EthAddress)
+	as.Equal(10, b.Capacity)
+}
+
+func (as *ActionSuite) Test_BrokernodesRegister_NoSecret() {
+	// Anyone could register as a peer while there is no secret to check with.
+	services.SetBrokerSecret("")
+	defer services.SetBrokerSecret("testSecret")
+
+	res := brokerPost(as, "/api/v2/brokernodes", map[string]interface{}{"endpoint": "1.2.3.4"})
+	as.Equal(401, res.Code)
+
+	b, err := models.GetBrokernodeByEndpoint("1.2.3.4")
+	as.Nil(err)
+	as.Nil(b)
+}
+
+func (as *ActionSuite) Test_BrokernodesHeartbeat() {
+	res := brokerPost(as, "/api/v2/brokernodes/heartbeat", map[string]interface{}{
+		"endpoint": "1.2.3.4",
+		"capacity": 5,
+	})
+	as.Equal(404, res.Code)
+
+	as.Equal(200, brokerPost(as, "/api/v2/brokernodes", map[string]interface{}{"endpoint": "1.2.3.4"}).Code)
+	res = brokerPost(as, "/api/v2/brokernodes/heartbeat", map[string]interface{}{
+		"endpoint": "1.2.3.4",
+		"capacity": 5,
+	})
+	as.Equal(200, res.Code)
+
+	b, err := models.GetBrokernodeByEndpoint("1.2.3.4")
+	as.Nil(err)
+	as.Equal(5, b.Capacity)
+}
@@ -2,7 +2,6 @@ package actions
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/gobuffalo/buffalo"
@@ -47,11 +46,10 @@ func (usr *TransactionBrokernodeResource) Create(c buffalo.Context) error {
 	req := transactionBrokernodeCreateReq{}
 	oyster_utils.ParseReqBody(c.Request(), &req)
 
-	dataMap := models.DataMap{}
 	brokernode := models.Brokernode{}
 	t := models.Transaction{}
 
-	dataMapNotFound := models.DB.Limit(1).Where("status = ?", models.Unassigned).First(&dataMap)
+	dataMap, dataMapNotFound := models.DataMapQuery{Statuses: []models.DataMapStatus{models.Unassigned}}.First()
 
 	existingAddresses := oyster_utils.StringsJoin(req.CurrentList, oyster_utils.StringsJoinDelim)
 	brokernodeNotFound := models.DB.Limit(1).Where("address NOT IN (?)", existingAddresses).First(&brokernode)
@@ -112,12 +110,8 @@ func (usr *TransactionBrokernodeResource) Update(c buffalo.Context) error {
 		return c.Render(400, r.JSON(map[string]string{"error": "Transaction is invalid"}))
 	}
 
-	host_ip := os.Getenv("HOST_IP")
-	provider := "http://" + host_ip + ":14265"
-	iotaAPI := giota.NewAPI(provider, nil)
-
 	iotaTransactions := []giota.Transaction{*iotaTransaction}
-	broadcastErr := iotaAPI.BroadcastTransactions(iotaTransactions)
+	broadcastErr := IotaWrapper.BroadcastTransactions(iotaTransactions)
 
 	if broadcastErr != nil {
 		return c.Render(400, r.JSON(map[string]string{"error": "Broadcast to Tangle failed"}))
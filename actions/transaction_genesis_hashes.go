@@ -2,7 +2,6 @@ package actions
 
 import (
 	"fmt"
-	// "os"
 	"math"
 	"strings"
 
@@ -57,8 +56,10 @@ func (usr *TransactionGenesisHashResource) Create(c buffalo.Context) error {
 		return c.Render(403, r.JSON(map[string]string{"error": "No genesis hash available"}))
 	}
 
-	dataMap := models.DataMap{}
-	dataMapNotFound := models.DB.Limit(1).Where("status = ? AND genesis_hash = ?", models.Unassigned, storedGenesisHash.GenesisHash).First(&dataMap)
+	dataMap, dataMapNotFound := models.DataMapQuery{
+		GenesisHash: storedGenesisHash.GenesisHash,
+		Statuses:    []models.DataMapStatus{models.Unassigned},
+	}.First()
 
 	if dataMapNotFound != nil {
 		return c.Render(403, r.JSON(map[string]string{"error": "No proof of work available"}))
@@ -130,13 +131,8 @@ func (usr *TransactionGenesisHashResource) Update(c buffalo.Context) error {
 		return c.Render(400, r.JSON(map[string]string{"error": "Transaction is invalid"}))
 	}
 
-	// host_ip := os.Getenv("HOST_IP")
-	host_ip := "18.188.113.65"
-	provider := "http://" + host_ip + ":14265"
-	iotaAPI := giota.NewAPI(provider, nil)
-
 	iotaTransactions := []giota.Transaction{*iotaTransaction}
-	broadcastErr := iotaAPI.BroadcastTransactions(iotaTransactions)
+	broadcastErr := IotaWrapper.BroadcastTransactions(iotaTransactions)
 
 	if broadcastErr != nil {
 		return c.Render(400, r.JSON(map[string]string{"error": "Broadcast to Tangle failed"}))
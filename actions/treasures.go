@@ -1,6 +1,16 @@
 package actions
 
-import "github.com/gobuffalo/buffalo"
+import (
+	"encoding/hex"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	raven "github.com/getsentry/raven-go"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/uuid"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/utils"
+)
 
 type TreasuresResource struct {
 	buffalo.Resource
@@ -15,7 +25,87 @@ type treasureReq struct {
 	EthKey          string `json:"EthKey"`
 }
 
-// Verifies the treasure and claims such treasure.
+type treasureRes struct {
+	Success bool      `json:"success"`
+	ID      uuid.UUID `json:"id"` // Of the claim, to look up with GetClaim
+}
+
+type treasureClaimRes struct {
+	ID        uuid.UUID                  `json:"id"`
+	Status    models.TreasureClaimStatus `json:"status"`
+	GasTxHash string                     `json:"gasTxHash"`
+	TxHash    string                     `json:"txHash"`
+}
+
+// Verifies the treasure and records the claim. The claim is sent by the
+// claimTreasures job, so this returns before anything is sent on chain.
 func (t *TreasuresResource) VerifyAndClaim(c buffalo.Context) error {
-	return nil
+	req := treasureReq{}
+	oyster_utils.ParseReqBody(c.Request(), &req)
+
+	if !common.IsHexAddress(req.ReceiverEthAddr) {
+		return c.Render(400, r.JSON(map[string]string{"Error claiming treasure": "invalid receiverEthAddr"}))
+	}
+
+	treasureKey, err := crypto.HexToECDSA(req.EthKey)
+	if err != nil {
+		return c.Render(400, r.JSON(map[string]string{"Error claiming treasure": "invalid EthKey"}))
+	}
+	treasureAddr := crypto.PubkeyToAddress(treasureKey.PublicKey)
+
+	if req.EthAddr != "" && common.HexToAddress(req.EthAddr) != treasureAddr {
+		return c.Render(400, r.JSON(map[string]string{"Error claiming treasure": "EthKey does not match ethAddr"}))
+	}
+
+	treasure, err := models.GetBuriedTreasure(req.GenesisHash, req.SectorIdx)
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return err
+	}
+	if treasure == nil || common.HexToAddress(treasure.ETHAddr) != treasureAddr {
+		return c.Render(404, r.JSON(map[string]string{"Error claiming treasure": "no buried treasure for this key in this sector"}))
+	}
+
+	// The key is kept until the job has sent the claim.
+	encryptedKey, err := oyster_utils.EncryptEthKey(hex.EncodeToString(crypto.FromECDSA(treasureKey)))
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return err
+	}
+
+	claim, err := models.StartTreasureClaim(models.TreasureClaim{
+		GenesisHash:     req.GenesisHash,
+		SectorIdx:       req.SectorIdx,
+		ETHAddr:         treasure.ETHAddr,
+		ReceiverEthAddr: common.HexToAddress(req.ReceiverEthAddr).Hex(),
+		ETHPrivateKey:   encryptedKey,
+	})
+	if err == models.ErrTreasureAlreadyClaimed {
+		return c.Render(409, r.JSON(map[string]string{"Error claiming treasure": err.Error()}))
+	}
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return err
+	}
+
+	return c.Render(202, r.JSON(treasureRes{
+		Success: true,
+		ID:      claim.ID,
+	}))
+}
+
+// GetClaim returns how far the claim with id has got, with the hashes of the
+// transactions sent for it so far.
+func (t *TreasuresResource) GetClaim(c buffalo.Context) error {
+	claim := models.TreasureClaim{}
+	if err := models.DB.Find(&claim, c.Param("id")); err != nil {
+		return c.Render(404, r.JSON(map[string]string{"error": "treasure claim not found"}))
+	}
+
+	return c.Render(200, r.JSON(treasureClaimRes{
+		ID:        claim.ID,
+		Status:    claim.Status,
+		GasTxHash: claim.GasTxHash,
+		TxHash:    claim.TxHash,
+	}))
 }
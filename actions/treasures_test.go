@@ -1,7 +1,154 @@
 package actions
 
-func (as *ActionSuite) Test_VerifyAndClaim_NoError() {
-	t := TreasuresResource{}
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
 
-	as.Nil(t.VerifyAndClaim(nil))
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+const receiverEthAddr = "0x0000000000000000000000000000000000000abc"
+
+func (as *ActionSuite) Test_VerifyAndClaim_Success() {
+	treasureKey := makeBuriedTreasure(as, "genHashClaim", 1, models.TreasureBurialSuccess)
+
+	res := as.JSON("/api/v2/treasures").Post(claimReq("genHashClaim", 1, treasureKey))
+	as.Equal(202, res.Code)
+
+	resParsed := treasureRes{}
+	bodyBytes, err := ioutil.ReadAll(res.Body)
+	as.Nil(err)
+	err = json.Unmarshal(bodyBytes, &resParsed)
+	as.Nil(err)
+	as.True(resParsed.Success)
+
+	claim := models.TreasureClaim{}
+	err = as.DB.Where("eth_addr = ?", crypto.PubkeyToAddress(treasureKey.PublicKey).Hex()).First(&claim)
+	as.Nil(err)
+	as.Equal(claim.ID, resParsed.ID)
+	as.Equal(models.TreasureClaimNotStarted, claim.Status)
+	as.Equal(common.HexToAddress(receiverEthAddr).Hex(), claim.ReceiverEthAddr)
+
+	// The key is kept encrypted for the job that sends the claim.
+	as.True(oyster_utils.IsEncryptedEthKey(claim.ETHPrivateKey))
+	plainKey, err := oyster_utils.DecryptEthKey(claim.ETHPrivateKey)
+	as.Nil(err)
+	as.Equal(hex.EncodeToString(crypto.FromECDSA(treasureKey)), plainKey)
+}
+
+func (as *ActionSuite) Test_GetTreasureClaim() {
+	treasureKey := makeBuriedTreasure(as, "genHashClaimStatus", 1, models.TreasureBurialSuccess)
+
+	res := as.JSON("/api/v2/treasures").Post(claimReq("genHashClaimStatus", 1, treasureKey))
+	as.Equal(202, res.Code)
+	claimed := treasureRes{}
+	as.Nil(json.Unmarshal(res.Body.Bytes(), &claimed))
+
+	// Once the job has sent the claim.
+	claim := models.TreasureClaim{}
+	as.Nil(as.DB.Find(&claim, claimed.ID))
+	claim.Status = models.TreasureClaimSuccess
+	claim.GasTxHash = "gasTxHash"
+	claim.TxHash = "txHash"
+	as.Nil(as.DB.Save(&claim))
+
+	res = as.JSON("/api/v2/treasures/" + claimed.ID.String()).Get()
+	as.Equal(200, res.Code)
+	resParsed := treasureClaimRes{}
+	as.Nil(json.Unmarshal(res.Body.Bytes(), &resParsed))
+	as.Equal(claimed.ID, resParsed.ID)
+	as.Equal(models.TreasureClaimSuccess, resParsed.Status)
+	as.Equal("gasTxHash", resParsed.GasTxHash)
+	as.Equal("txHash", resParsed.TxHash)
+
+	res = as.JSON("/api/v2/treasures/" + claim.GenesisHash).Get()
+	as.Equal(404, res.Code)
+}
+
+func (as *ActionSuite) Test_VerifyAndClaim_AlreadyClaimed() {
+	treasureKey := makeBuriedTreasure(as, "genHashClaimTwice", 1, models.TreasureBurialSuccess)
+
+	res := as.JSON("/api/v2/treasures").Post(claimReq("genHashClaimTwice", 1, treasureKey))
+	as.Equal(202, res.Code)
+
+	res = as.JSON("/api/v2/treasures").Post(claimReq("genHashClaimTwice", 1, treasureKey))
+	as.Equal(409, res.Code)
+}
+
+func (as *ActionSuite) Test_VerifyAndClaim_RetriesFailedClaim() {
+	treasureKey := makeBuriedTreasure(as, "genHashClaimRetry", 1, models.TreasureBurialSuccess)
+
+	res := as.JSON("/api/v2/treasures").Post(claimReq("genHashClaimRetry", 1, treasureKey))
+	as.Equal(202, res.Code)
+
+	claim := models.TreasureClaim{}
+	err := as.DB.Where("eth_addr = ?", crypto.PubkeyToAddress(treasureKey.PublicKey).Hex()).First(&claim)
+	as.Nil(err)
+	claim.Status = models.TreasureClaimError
+	claim.GasTxHash = "oldGasTxHash"
+	as.DB.ValidateAndSave(&claim)
+
+	res = as.JSON("/api/v2/treasures").Post(claimReq("genHashClaimRetry", 1, treasureKey))
+	as.Equal(202, res.Code)
+
+	err = as.DB.Find(&claim, claim.ID)
+	as.Nil(err)
+	as.Equal(models.TreasureClaimNotStarted, claim.Status)
+	as.Equal("", claim.GasTxHash)
+}
+
+func (as *ActionSuite) Test_VerifyAndClaim_NotBuried() {
+	treasureKey := makeBuriedTreasure(as, "genHashNotBuried", 1, models.TreasureBurialGasSent)
+
+	res := as.JSON("/api/v2/treasures").Post(claimReq("genHashNotBuried", 1, treasureKey))
+	as.Equal(404, res.Code)
+}
+
+func (as *ActionSuite) Test_VerifyAndClaim_WrongKey() {
+	makeBuriedTreasure(as, "genHashWrongKey", 1, models.TreasureBurialSuccess)
+
+	otherKey, _ := crypto.GenerateKey()
+	res := as.JSON("/api/v2/treasures").Post(claimReq("genHashWrongKey", 1, otherKey))
+	as.Equal(404, res.Code)
+}
+
+func (as *ActionSuite) Test_VerifyAndClaim_InvalidKey() {
+	res := as.JSON("/api/v2/treasures").Post(map[string]interface{}{
+		"receiverEthAddr": receiverEthAddr,
+		"genesisHash":     "genHashInvalidKey",
+		"sectorIdx":       1,
+		"EthKey":          "notakey",
+	})
+	as.Equal(400, res.Code)
+}
+
+func makeBuriedTreasure(as *ActionSuite, genesisHash string, sector int, status models.TreasureBurialStatus) *ecdsa.PrivateKey {
+	treasureKey, err := crypto.GenerateKey()
+	as.Nil(err)
+
+	_, err = models.DB.ValidateAndCreate(&models.TreasureBurial{
+		GenesisHash: genesisHash,
+		Sector:      sector,
+		Idx:         sector * 100,
+		ETHAddr:     crypto.PubkeyToAddress(treasureKey.PublicKey).Hex(),
+		Status:      status,
+	})
+	as.Nil(err)
+
+	return treasureKey
+}
+
+func claimReq(genesisHash string, sector int, treasureKey *ecdsa.PrivateKey) map[string]interface{} {
+	return map[string]interface{}{
+		"receiverEthAddr": receiverEthAddr,
+		"genesisHash":     genesisHash,
+		"sectorIdx":       sector,
+		"ethAddr":         crypto.PubkeyToAddress(treasureKey.PublicKey).Hex(),
+		"EthKey":          hex.EncodeToString(crypto.FromECDSA(treasureKey)),
+	}
 }
@@ -1,9 +1,10 @@
 package actions
 
 import (
-	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
 	raven "github.com/getsentry/raven-go"
 	"github.com/gobuffalo/buffalo"
@@ -26,8 +27,10 @@ type uploadSessionCreateReq struct {
 	FileSizeBytes        int            `json:"fileSizeBytes"` // This is Trytes instead of Byte
 	BetaIP               string         `json:"betaIp"`
 	StorageLengthInYears int            `json:"storageLengthInYears"`
-	AlphaTreasureIndexes []int          `json:"alphaTreasureIndexes"`
 	Invoice              models.Invoice `json:"invoice"`
+
+	// Commitment to the alpha broker's treasure secret.
+	AlphaTreasureCommitment string `json:"alphaTreasureCommitment"`
 }
 
 type uploadSessionCreateRes struct {
@@ -38,11 +41,23 @@ type uploadSessionCreateRes struct {
 }
 
 type uploadSessionCreateBetaRes struct {
-	ID                  string               `json:"id"`
-	UploadSession       models.UploadSession `json:"uploadSession"`
-	BetaSessionID       string               `json:"betaSessionId"`
-	Invoice             models.Invoice       `json:"invoice"`
-	BetaTreasureIndexes []int                `json:"betaTreasureIndexes"`
+	ID                     string               `json:"id"`
+	UploadSession          models.UploadSession `json:"uploadSession"`
+	BetaSessionID          string               `json:"betaSessionId"`
+	Invoice                models.Invoice       `json:"invoice"`
+	BetaTreasureCommitment string               `json:"betaTreasureCommitment"`
+}
+
+type betaRequoteReq struct {
+	Invoice models.Invoice `json:"invoice"`
+}
+
+type treasureRevealReq struct {
+	AlphaTreasureSecret string `json:"alphaTreasureSecret"`
+}
+
+type treasureRevealRes struct {
+	BetaTreasureSecret string `json:"betaTreasureSecret"`
 }
 
 type chunkReq struct {
@@ -55,6 +70,23 @@ type UploadSessionUpdateReq struct {
 	Chunks []chunkReq `json:"chunks"`
 }
 
+// What happened to an uploaded chunk.
+const (
+	ChunkAccepted     = "accepted"
+	ChunkHashMismatch = "hash-mismatch"
+	ChunkOutOfRange   = "out-of-range"
+	ChunkDuplicate    = "duplicate"
+)
+
+type chunkRes struct {
+	Idx    int    `json:"idx"`
+	Status string `json:"status"`
+}
+
+type uploadSessionUpdateRes struct {
+	Chunks []chunkRes `json:"chunks"`
+}
+
 type paymentStatusCreateRes struct {
 	ID            string `json:"id"`
 	PaymentStatus string `json:"paymentStatus"`
@@ -65,7 +97,22 @@ func (usr *UploadSessionResource) Create(c buffalo.Context) error {
 	req := uploadSessionCreateReq{}
 	oyster_utils.ParseReqBody(c.Request(), &req)
 
-	alphaEthAddr, privKey, _ := services.EthWrapper.GenerateEthAddr()
+	// Creating a session that has not been paid for yet returns it again,
+	// re-quoted if its quote has expired.
+	unpaidSession, err := models.GetUnpaidAlphaSession(req.GenesisHash)
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return err
+	}
+	if unpaidSession != nil {
+		return requoteSession(c, unpaidSession)
+	}
+
+	alphaEthAddr, privKey, keyIndex, err := services.EthWrapper.GenerateEthAddr()
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return err
+	}
 
 	// Start Alpha Session.
 	alphaSession := models.UploadSession{
@@ -75,6 +122,7 @@ func (usr *UploadSessionResource) Create(c buffalo.Context) error {
 		NumChunks:            req.NumChunks,
 		StorageLengthInYears: req.StorageLengthInYears,
 		ETHAddrAlpha:         nulls.NewString(alphaEthAddr),
+		ETHKeyIndex:          nulls.NewInt(keyIndex),
 		ETHPrivateKey:        privKey,
 	}
 	vErr, err := alphaSession.StartUploadSession()
@@ -82,51 +130,76 @@ func (usr *UploadSessionResource) Create(c buffalo.Context) error {
 		return err
 	}
 
+	if len(vErr.Errors) > 0 {
+		c.Render(422, r.JSON(vErr.Errors))
+		return err
+	}
+
 	invoice := alphaSession.GetInvoice()
 
 	// Mutates this because copying in golang sucks...
 	req.Invoice = invoice
 
-	req.AlphaTreasureIndexes = oyster_utils.GenerateInsertedIndexesForPearl(oyster_utils.ConvertToByte(req.FileSizeBytes))
+	alphaSecret, err := oyster_utils.NewTreasureSecret()
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return err
+	}
+	req.AlphaTreasureCommitment = oyster_utils.TreasureCommitment(alphaSecret)
+	treasureSecrets := []string{alphaSecret}
 
-	// Start Beta Session.
-	var betaSessionID = ""
-	var betaTreasureIndexes []int
-	if req.BetaIP != "" {
-		betaReq, err := json.Marshal(req)
+	// Picks a beta broker from the peers when the client did not.
+	if req.BetaIP == "" {
+		beta, err := models.SelectBetaBrokernode(services.BrokerEndpoint)
 		if err != nil {
-			c.Render(400, r.JSON(map[string]string{"Error starting Beta": err.Error()}))
-			return err
+			raven.CaptureError(err, nil)
 		}
+		if beta != nil {
+			req.BetaIP = beta.Endpoint
+		}
+	}
 
-		reqBetaBody := bytes.NewBuffer(betaReq)
-
-		// Should we be hardcoding the port?
-		betaURL := req.BetaIP + ":3000/api/v2/upload-sessions/beta"
-		betaRes, err := http.Post(betaURL, "application/json", reqBetaBody)
-
+	// Start Beta Session.
+	var betaSessionID = ""
+	if req.BetaIP != "" {
+		var betaSecret string
+		betaSessionID, betaSecret, err = startBetaSession(req, alphaSecret)
+		adjustBetaReputation(req.BetaIP, err)
 		if err != nil {
-			c.Render(400, r.JSON(map[string]string{"Error starting Beta": err.Error()}))
-			return err
+			// The upload cannot go ahead without the beta session.
+			raven.CaptureError(err, nil)
+			if delErr := alphaSession.Delete(); delErr != nil {
+				raven.CaptureError(delErr, nil)
+			}
+			return c.Render(502, r.JSON(map[string]string{"Error starting Beta": err.Error()}))
 		}
-		betaSessionRes := &uploadSessionCreateBetaRes{}
-		oyster_utils.ParseResBody(betaRes, betaSessionRes)
-		betaSessionID = betaSessionRes.ID
-
-		betaTreasureIndexes = betaSessionRes.BetaTreasureIndexes
+		treasureSecrets = append(treasureSecrets, betaSecret)
+		alphaSession.BetaEndpoint = nulls.NewString(req.BetaIP)
+		alphaSession.BetaSessionID = nulls.NewString(betaSessionID)
 	}
 
 	// Update alpha treasure idx map.
-	alphaSession.TreasureIdxMap = oyster_utils.GetTreasureIdxMap(req.AlphaTreasureIndexes, betaTreasureIndexes)
-	err = models.DB.Save(&alphaSession)
+	treasureIndexes, err := oyster_utils.TreasureIndexesFromSecrets(oyster_utils.ConvertToByte(req.FileSizeBytes), treasureSecrets...)
 	if err != nil {
+		raven.CaptureError(err, nil)
 		return err
 	}
-
-	if len(vErr.Errors) > 0 {
-		c.Render(422, r.JSON(vErr.Errors))
+	alphaSession.TreasureIdxMap, err = models.NewTreasureIdxMap(treasureIndexes)
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return err
+	}
+	vErr, err = models.DB.ValidateAndSave(&alphaSession)
+	if err != nil {
 		return err
 	}
+	if len(vErr.Errors) > 0 {
+		// The file size and number of chunks disagree on the number of sectors.
+		if delErr := alphaSession.Delete(); delErr != nil {
+			raven.CaptureError(delErr, nil)
+		}
+		return c.Render(422, r.JSON(vErr.Errors))
+	}
 
 	res := uploadSessionCreateRes{
 		UploadSession: alphaSession,
@@ -138,7 +211,85 @@ func (usr *UploadSessionResource) Create(c buffalo.Context) error {
 	return c.Render(200, r.JSON(res))
 }
 
-// Update uploads a chunk associated with an upload session.
+// startBetaSession starts the beta session for req, then exchanges treasure
+// secrets with the beta broker. Returns the beta session ID and secret.
+func startBetaSession(req uploadSessionCreateReq, alphaSecret string) (string, string, error) {
+	betaSessionRes := uploadSessionCreateBetaRes{}
+	err := services.PostToBroker(req.BetaIP, "/api/v2/upload-sessions/beta", req, &betaSessionRes)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Only reveal once the beta broker has committed to its secret.
+	revealRes := treasureRevealRes{}
+	err = services.PostToBroker(req.BetaIP, "/api/v2/upload-sessions/beta/"+betaSessionRes.ID+"/reveal",
+		treasureRevealReq{AlphaTreasureSecret: alphaSecret}, &revealRes)
+	if err != nil {
+		return "", "", err
+	}
+	if !oyster_utils.VerifyTreasureReveal(revealRes.BetaTreasureSecret, betaSessionRes.BetaTreasureCommitment) {
+		return "", "", models.ErrTreasureRevealMismatch
+	}
+
+	return betaSessionRes.ID, revealRes.BetaTreasureSecret, nil
+}
+
+// adjustBetaReputation rewards a registered beta broker for starting a
+// session, and penalizes it for failing to.
+func adjustBetaReputation(betaEndpoint string, betaErr error) {
+	delta := 1
+	if betaErr != nil {
+		delta = -1
+	}
+	if err := models.AdjustBrokernodeReputation(betaEndpoint, delta); err != nil {
+		raven.CaptureError(err, nil)
+	}
+}
+
+// requoteSession responds to Create with a session created earlier. An
+// expired quote is quoted again, on the beta broker's session too so both
+// brokers expect the same payment.
+func requoteSession(c buffalo.Context, session *models.UploadSession) error {
+	if session.QuoteExpired() {
+		oldCost, oldQuotedAt := session.TotalCost, session.PriceQuotedAt
+		vErr, err := session.Requote()
+		if err != nil {
+			raven.CaptureError(err, nil)
+			return err
+		}
+		if len(vErr.Errors) > 0 {
+			c.Render(422, r.JSON(vErr.Errors))
+			return err
+		}
+
+		if session.BetaEndpoint.Valid {
+			err = services.PostToBroker(session.BetaEndpoint.String,
+				"/api/v2/upload-sessions/beta/"+session.BetaSessionID.String+"/requote",
+				betaRequoteReq{Invoice: session.GetInvoice()}, &uploadSessionCreateBetaRes{})
+			if err != nil {
+				// Keeps the quote the beta broker still has.
+				raven.CaptureError(err, nil)
+				session.TotalCost, session.PriceQuotedAt = oldCost, oldQuotedAt
+				if saveErr := models.DB.Save(session); saveErr != nil {
+					raven.CaptureError(saveErr, nil)
+				}
+				return c.Render(502, r.JSON(map[string]string{"Error requoting Beta": err.Error()}))
+			}
+		}
+	}
+
+	res := uploadSessionCreateRes{
+		UploadSession: *session,
+		ID:            session.ID.String(),
+		BetaSessionID: session.BetaSessionID.String,
+		Invoice:       session.GetInvoice(),
+	}
+
+	return c.Render(200, r.JSON(res))
+}
+
+// Update uploads a batch of chunks associated with an upload session and
+// reports what happened to each chunk. Sending a chunk again is safe.
 func (usr *UploadSessionResource) Update(c buffalo.Context) error {
 
 	req := UploadSessionUpdateReq{}
@@ -151,71 +302,134 @@ func (usr *UploadSessionResource) Update(c buffalo.Context) error {
 		c.Render(400, r.JSON(map[string]string{"Error finding session": errors.WithStack(err).Error()}))
 		return err
 	}
-	treasureIdxMap := oyster_utils.GetTreasureIdxIndexes(uploadSession.TreasureIdxMap)
-	// Update dMaps to have chunks async
-	go func() {
-		// Map over chunks from request
-		// TODO: Batch processing DB upserts.
-		dMaps := make([]models.DataMap, len(req.Chunks))
-
-		for i, chunk := range req.Chunks {
-			// Fetch DataMap
-			dm := models.DataMap{}
-
-			var chunkIdx int
-			if oyster_utils.BrokerMode == oyster_utils.TestModeNoTreasure {
-				chunkIdx = chunk.Idx
-			} else {
-				chunkIdx = oyster_utils.TransformIndexWithBuriedIndexes(chunk.Idx, treasureIdxMap)
-			}
 
-			err := models.DB.RawQuery(
-				"SELECT * from data_maps WHERE genesis_hash = ? AND chunk_idx = ?", uploadSession.GenesisHash, chunkIdx).First(&dm)
+	// The chunks have no data maps to go in until the session is prepared.
+	if uploadSession.Preparing() {
+		c.Response().Header().Set("Retry-After", "5")
+		return c.Render(503, r.JSON(map[string]string{"error": "Session is still being prepared"}))
+	}
+	if uploadSession.DataMapsFailed() {
+		return c.Render(500, r.JSON(map[string]string{"error": "Session could not be prepared"}))
+	}
+	treasureIdxMap := uploadSession.TreasureIdxMap.SectorIndexes()
+
+	// Maps each chunk to its data map's chunk idx, -1 when out of range.
+	chunkIdxs := make([]int, len(req.Chunks))
+	var validChunkIdxs []int
+	for i, chunk := range req.Chunks {
+		chunkIdxs[i] = -1
+		if chunk.Idx < 0 || chunk.Idx >= uploadSession.NumChunks {
+			continue
+		}
 
-			if err != nil {
-				raven.CaptureError(err, nil)
-			}
+		if oyster_utils.BrokerMode == oyster_utils.TestModeNoTreasure {
+			chunkIdxs[i] = chunk.Idx
+		} else {
+			chunkIdxs[i] = oyster_utils.TransformIndexWithBuriedIndexes(chunk.Idx, treasureIdxMap)
+		}
+		validChunkIdxs = append(validChunkIdxs, chunkIdxs[i])
+	}
 
-			// Simple check if hashes match.
-			if chunk.Hash == dm.GenesisHash {
-				// Updates dmap in DB.
-				dm.Message = chunk.Data
-				if oyster_utils.BrokerMode == oyster_utils.TestModeNoTreasure {
-					dm.Status = models.Unassigned
-				}
+	dataMapsByIdx, err := models.GetDataMapsByChunkIdxs(uploadSession.GenesisHash, validChunkIdxs)
+	if err != nil {
+		raven.CaptureError(err, nil)
+		c.Render(500, r.JSON(map[string]string{"Error finding chunks": err.Error()}))
+		return err
+	}
 
-				models.DB.ValidateAndSave(&dm)
+	res := uploadSessionUpdateRes{Chunks: make([]chunkRes, len(req.Chunks))}
+	var acceptedDataMaps []models.DataMap
+	for i, chunk := range req.Chunks {
+		res.Chunks[i] = chunkRes{Idx: chunk.Idx}
+
+		dm, found := dataMapsByIdx[chunkIdxs[i]]
+		switch {
+		case !found:
+			res.Chunks[i].Status = ChunkOutOfRange
+		case chunk.Hash != dm.GenesisHash:
+			res.Chunks[i].Status = ChunkHashMismatch
+		case dm.Message != "":
+			// Already received, or sent twice in this batch.
+			res.Chunks[i].Status = ChunkDuplicate
+		default:
+			dm.Message = chunk.Data
+			if oyster_utils.BrokerMode == oyster_utils.TestModeNoTreasure {
+				dm.Status = models.Unassigned
 			}
+			dataMapsByIdx[chunkIdxs[i]] = dm
 
-			dMaps[i] = dm
+			acceptedDataMaps = append(acceptedDataMaps, dm)
+			res.Chunks[i].Status = ChunkAccepted
 		}
-	}()
+	}
+
+	if err := models.UpsertDataMapMessages(acceptedDataMaps); err != nil {
+		raven.CaptureError(err, nil)
+		c.Render(500, r.JSON(map[string]string{"Error saving chunks": err.Error()}))
+		return err
+	}
 
-	return c.Render(202, r.JSON(map[string]bool{"success": true}))
+	return c.Render(200, r.JSON(res))
 }
 
 // CreateBeta creates an upload session on the beta broker.
 func (usr *UploadSessionResource) CreateBeta(c buffalo.Context) error {
+	if err := services.VerifyBrokerRequest(c.Request()); err != nil {
+		return c.Render(401, r.JSON(map[string]string{"error": err.Error()}))
+	}
+
 	req := uploadSessionCreateReq{}
-	oyster_utils.ParseReqBody(c.Request(), &req)
+	if err := oyster_utils.ParseReqBody(c.Request(), &req); err != nil {
+		return c.Render(400, r.JSON(map[string]string{"error": err.Error()}))
+	}
+
+	if req.AlphaTreasureCommitment == "" {
+		return c.Render(400, r.JSON(map[string]string{"error": "alphaTreasureCommitment is required"}))
+	}
+
+	// The alpha broker retries when it does not hear back, answer with the
+	// session it created already.
+	existingSession, err := models.GetUnpaidBetaSession(req.GenesisHash)
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return err
+	}
+	if existingSession != nil {
+		return resumeBetaSession(c, existingSession, req)
+	}
 
-	betaTreasureIndexes := oyster_utils.GenerateInsertedIndexesForPearl(oyster_utils.ConvertToByte(req.FileSizeBytes))
+	// The treasure indexes are set once the alpha broker reveals its secret.
+	betaSecret, err := oyster_utils.NewTreasureSecret()
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return err
+	}
 
 	// Generates ETH address.
-	betaEthAddr, privKey, _ := services.EthWrapper.GenerateEthAddr()
+	betaEthAddr, privKey, keyIndex, err := services.EthWrapper.GenerateEthAddr()
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return err
+	}
 
 	u := models.UploadSession{
-		Type:                 models.SessionTypeBeta,
-		GenesisHash:          req.GenesisHash,
-		NumChunks:            req.NumChunks,
-		FileSizeBytes:        req.FileSizeBytes,
-		StorageLengthInYears: req.StorageLengthInYears,
-		TreasureIdxMap:       oyster_utils.GetTreasureIdxMap(req.AlphaTreasureIndexes, betaTreasureIndexes),
-		TotalCost:            req.Invoice.Cost,
-		ETHAddrAlpha:         req.Invoice.EthAddress,
-		ETHAddrBeta:          nulls.NewString(betaEthAddr),
-		ETHPrivateKey:        privKey,
+		Type:                   models.SessionTypeBeta,
+		GenesisHash:            req.GenesisHash,
+		NumChunks:              req.NumChunks,
+		FileSizeBytes:          req.FileSizeBytes,
+		StorageLengthInYears:   req.StorageLengthInYears,
+		TreasureSecret:         nulls.NewString(betaSecret),
+		PeerTreasureCommitment: nulls.NewString(req.AlphaTreasureCommitment),
+		TotalCost:              req.Invoice.Cost,
+		ETHAddrAlpha:           req.Invoice.EthAddress,
+		ETHAddrBeta:            nulls.NewString(betaEthAddr),
+		ETHKeyIndex:            nulls.NewInt(keyIndex),
+		ETHPrivateKey:          privKey,
+	}
+	if !req.Invoice.PriceQuotedAt.IsZero() {
+		u.PriceQuotedAt = nulls.NewTime(req.Invoice.PriceQuotedAt)
 	}
+
 	vErr, err := u.StartUploadSession()
 	if err != nil {
 		return err
@@ -227,14 +441,119 @@ func (usr *UploadSessionResource) CreateBeta(c buffalo.Context) error {
 	}
 
 	res := uploadSessionCreateBetaRes{
-		UploadSession:       u,
-		ID:                  u.ID.String(),
-		Invoice:             u.GetInvoice(),
-		BetaTreasureIndexes: betaTreasureIndexes,
+		UploadSession:          u,
+		ID:                     u.ID.String(),
+		Invoice:                u.GetInvoice(),
+		BetaTreasureCommitment: oyster_utils.TreasureCommitment(betaSecret),
 	}
 	return c.Render(200, r.JSON(res))
 }
 
+// resumeBetaSession responds to CreateBeta with a session created earlier for
+// the same genesis hash. An alpha broker that starts over with another
+// commitment is committed to a new secret, the old one may have been revealed.
+func resumeBetaSession(c buffalo.Context, session *models.UploadSession, req uploadSessionCreateReq) error {
+	if session.PeerTreasureCommitment.String != req.AlphaTreasureCommitment {
+		betaSecret, err := oyster_utils.NewTreasureSecret()
+		if err != nil {
+			raven.CaptureError(err, nil)
+			return err
+		}
+		session.TreasureSecret = nulls.NewString(betaSecret)
+		session.PeerTreasureCommitment = nulls.NewString(req.AlphaTreasureCommitment)
+		session.TreasureIdxMap = models.TreasureIdxMap{}
+	}
+
+	session.TotalCost = req.Invoice.Cost
+	session.ETHAddrAlpha = req.Invoice.EthAddress
+	if !req.Invoice.PriceQuotedAt.IsZero() {
+		session.PriceQuotedAt = nulls.NewTime(req.Invoice.PriceQuotedAt)
+	}
+	vErr, err := models.DB.ValidateAndSave(session)
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return err
+	}
+	if len(vErr.Errors) > 0 {
+		return c.Render(422, r.JSON(vErr.Errors))
+	}
+
+	res := uploadSessionCreateBetaRes{
+		UploadSession:          *session,
+		ID:                     session.ID.String(),
+		Invoice:                session.GetInvoice(),
+		BetaTreasureCommitment: oyster_utils.TreasureCommitment(session.TreasureSecret.String),
+	}
+	return c.Render(200, r.JSON(res))
+}
+
+// RevealBeta takes the treasure secret the alpha broker committed to, and
+// reveals the beta broker's secret in return.
+func (usr *UploadSessionResource) RevealBeta(c buffalo.Context) error {
+	if err := services.VerifyBrokerRequest(c.Request()); err != nil {
+		return c.Render(401, r.JSON(map[string]string{"error": err.Error()}))
+	}
+
+	req := treasureRevealReq{}
+	if err := oyster_utils.ParseReqBody(c.Request(), &req); err != nil {
+		return c.Render(400, r.JSON(map[string]string{"error": err.Error()}))
+	}
+
+	session := models.UploadSession{}
+	if err := models.DB.Find(&session, c.Param("id")); err != nil || session.Type != models.SessionTypeBeta {
+		return c.Render(404, r.JSON(map[string]string{"error": "upload session not found"}))
+	}
+
+	betaSecret, err := session.RevealTreasure(req.AlphaTreasureSecret)
+	if err == models.ErrNoTreasureCommitment || err == models.ErrTreasureRevealMismatch {
+		return c.Render(422, r.JSON(map[string]string{"error": err.Error()}))
+	}
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return err
+	}
+
+	return c.Render(200, r.JSON(treasureRevealRes{BetaTreasureSecret: betaSecret}))
+}
+
+// RequoteBeta takes the price the alpha broker quoted again for a session that
+// has not been paid for yet.
+func (usr *UploadSessionResource) RequoteBeta(c buffalo.Context) error {
+	if err := services.VerifyBrokerRequest(c.Request()); err != nil {
+		return c.Render(401, r.JSON(map[string]string{"error": err.Error()}))
+	}
+
+	req := betaRequoteReq{}
+	if err := oyster_utils.ParseReqBody(c.Request(), &req); err != nil {
+		return c.Render(400, r.JSON(map[string]string{"error": err.Error()}))
+	}
+
+	session := models.UploadSession{}
+	if err := models.DB.Find(&session, c.Param("id")); err != nil || session.Type != models.SessionTypeBeta {
+		return c.Render(404, r.JSON(map[string]string{"error": "upload session not found"}))
+	}
+	if session.PaymentStatus != models.PaymentStatusPending {
+		return c.Render(409, r.JSON(map[string]string{"error": "upload session already paid for"}))
+	}
+
+	session.TotalCost = req.Invoice.Cost
+	session.PriceQuotedAt = nulls.NewTime(req.Invoice.PriceQuotedAt)
+	vErr, err := models.DB.ValidateAndSave(&session)
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return err
+	}
+	if len(vErr.Errors) > 0 {
+		return c.Render(422, r.JSON(vErr.Errors))
+	}
+
+	return c.Render(200, r.JSON(uploadSessionCreateBetaRes{
+		UploadSession: session,
+		ID:            session.ID.String(),
+		Invoice:       session.GetInvoice(),
+	}))
+}
+
 func (usr *UploadSessionResource) GetPaymentStatus(c buffalo.Context) error {
 	session := models.UploadSession{}
 	err := models.DB.Find(&session, c.Param("id"))
@@ -251,3 +570,73 @@ func (usr *UploadSessionResource) GetPaymentStatus(c buffalo.Context) error {
 
 	return c.Render(200, r.JSON(res))
 }
+
+func (usr *UploadSessionResource) GetProgress(c buffalo.Context) error {
+	progress, err := models.GetUploadProgress(c.Param("genesis_hash"))
+	if err == models.ErrUploadNotFound {
+		return c.Render(404, r.JSON(map[string]string{"error": err.Error()}))
+	}
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return c.Render(500, r.JSON(map[string]string{"error": "could not get upload progress"}))
+	}
+
+	return c.Render(200, r.JSON(progress))
+}
+
+// How often a comment is sent down an idle event stream to keep it open.
+var SessionEventsKeepAlive = 15 * time.Second
+
+// GetEvents streams the state changes of an upload session as server-sent
+// events until the session completes or the client goes away.
+func (usr *UploadSessionResource) GetEvents(c buffalo.Context) error {
+	if c.Value("tx") != nil {
+		return c.Error(500, errors.New("event streams must not hold a transaction"))
+	}
+
+	session := models.UploadSession{}
+	err := models.DB.Find(&session, c.Param("id"))
+	if err != nil {
+		return c.Render(404, r.JSON(map[string]string{"error": "upload session not found"}))
+	}
+
+	flusher, ok := c.Response().(http.Flusher)
+	if !ok {
+		return c.Error(500, errors.New("streaming is not supported"))
+	}
+
+	events, unsubscribe := services.SessionEvents.Subscribe(session.GenesisHash)
+	defer unsubscribe()
+
+	res := c.Response()
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.WriteHeader(200)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(SessionEventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-keepAlive.C:
+			fmt.Fprint(res, ": keep-alive\n\n")
+			flusher.Flush()
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				raven.CaptureError(err, nil)
+				continue
+			}
+			fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+
+			if event.Type == services.EventSessionCompleted {
+				return nil
+			}
+		}
+	}
+}
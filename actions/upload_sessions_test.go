@@ -3,11 +3,22 @@ package actions
 import (
 	"encoding/json"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
 
 	"fmt"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/middleware"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
 	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
 )
 
+const testTreasureSecret = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
 func (as *ActionSuite) Test_UploadSessionsCreate() {
 	res := as.JSON("/api/v2/upload-sessions").Post(map[string]interface{}{
 		"genesisHash":          "genesisHashTest",
@@ -27,17 +38,117 @@ func (as *ActionSuite) Test_UploadSessionsCreate() {
 	as.Equal("genesisHashTest", resParsed.UploadSession.GenesisHash)
 	as.Equal(123, resParsed.UploadSession.FileSizeBytes)
 	as.Equal(models.SessionTypeAlpha, resParsed.UploadSession.Type)
-	as.NotEqual(0, resParsed.Invoice.Cost)
+	as.Equal(1, resParsed.Invoice.Cost.Sign())
 	as.NotEqual("", resParsed.Invoice.EthAddress)
+	as.Equal(resParsed.Invoice.PriceQuotedAt.Add(models.PriceQuoteTTL), resParsed.Invoice.ExpiresAt)
 }
 
-func (as *ActionSuite) Test_UploadSessionsCreateBeta() {
-	res := as.JSON("/api/v2/upload-sessions/beta").Post(map[string]interface{}{
-		"genesisHash":          "genesisHashTest",
+func (as *ActionSuite) Test_UploadSessionsCreate_Requote() {
+	createReq := map[string]interface{}{
+		"genesisHash":          "genesisHashRequote",
+		"fileSizeBytes":        123,
+		"numChunks":            2,
+		"storageLengthInYears": 1,
+	}
+	first := postUploadSession(as, createReq)
+
+	// Creating the unpaid session again returns it with the same quote.
+	second := postUploadSession(as, createReq)
+	as.Equal(first.ID, second.ID)
+	as.Equal(first.Invoice.EthAddress, second.Invoice.EthAddress)
+	as.WithinDuration(first.Invoice.PriceQuotedAt, second.Invoice.PriceQuotedAt, time.Second)
+
+	// Once the quote has expired it is quoted again.
+	expiredAt := time.Now().Add(-models.PriceQuoteTTL - time.Minute)
+	err := as.DB.RawQuery("UPDATE upload_sessions SET price_quoted_at = ? WHERE id = ?",
+		expiredAt, first.ID).All(&[]models.UploadSession{})
+	as.Nil(err)
+
+	third := postUploadSession(as, createReq)
+	as.Equal(first.ID, third.ID)
+	as.True(third.Invoice.ExpiresAt.After(time.Now()))
+}
+
+func (as *ActionSuite) Test_UploadSessionsCreate_RequotesBeta() {
+	var alphaSecret string
+	var requoted models.Invoice
+	betaBroker := fakeBetaBroker(testTreasureSecret, testTreasureSecret, &alphaSecret, &requoted)
+	defer betaBroker.Close()
+
+	createReq := map[string]interface{}{
+		"genesisHash":          "genHashRequoteBeta",
 		"fileSizeBytes":        123,
 		"numChunks":            2,
 		"storageLengthInYears": 1,
-		"alphaTreasureIndexes": []int{1},
+		"betaIp":               betaBroker.URL,
+	}
+	first := postUploadSession(as, createReq)
+	as.Equal("betaSessionID", first.BetaSessionID)
+
+	expiredAt := time.Now().Add(-models.PriceQuoteTTL - time.Minute)
+	err := as.DB.RawQuery("UPDATE upload_sessions SET price_quoted_at = ? WHERE id = ?",
+		expiredAt, first.ID).All(&[]models.UploadSession{})
+	as.Nil(err)
+
+	// The beta broker is sent the alpha's new quote.
+	second := postUploadSession(as, createReq)
+	as.Equal(first.ID, second.ID)
+	as.Equal("betaSessionID", second.BetaSessionID)
+	as.True(second.Invoice.ExpiresAt.After(time.Now()))
+	as.Equal(second.Invoice.Cost.String(), requoted.Cost.String())
+	as.WithinDuration(second.Invoice.PriceQuotedAt, requoted.PriceQuotedAt, time.Second)
+}
+
+func (as *ActionSuite) Test_UploadSessionsCreate_BetaRequoteFails() {
+	var alphaSecret string
+	betaBroker := fakeBetaBroker(testTreasureSecret, testTreasureSecret, &alphaSecret, nil)
+	defer betaBroker.Close()
+
+	createReq := map[string]interface{}{
+		"genesisHash":          "genHashBetaRequoteFails",
+		"fileSizeBytes":        123,
+		"numChunks":            2,
+		"storageLengthInYears": 1,
+		"betaIp":               betaBroker.URL,
+	}
+	first := postUploadSession(as, createReq)
+
+	expiredAt := time.Now().Add(-models.PriceQuoteTTL - time.Minute)
+	err := as.DB.RawQuery("UPDATE upload_sessions SET price_quoted_at = ? WHERE id = ?",
+		expiredAt, first.ID).All(&[]models.UploadSession{})
+	as.Nil(err)
+
+	// The alpha keeps the quote the beta broker has.
+	res := as.JSON("/api/v2/upload-sessions").Post(createReq)
+	as.Equal(502, res.Code)
+	session := models.UploadSession{}
+	as.Nil(as.DB.Find(&session, first.ID))
+	as.True(session.QuoteExpired())
+}
+
+func postUploadSession(as *ActionSuite, req map[string]interface{}) uploadSessionCreateRes {
+	res := as.JSON("/api/v2/upload-sessions").Post(req)
+	as.Equal(200, res.Code)
+
+	resParsed := uploadSessionCreateRes{}
+	bodyBytes, err := ioutil.ReadAll(res.Body)
+	as.Nil(err)
+	as.Nil(json.Unmarshal(bodyBytes, &resParsed))
+	return resParsed
+}
+
+func (as *ActionSuite) Test_UploadSessionsCreateBeta() {
+	res := brokerPost(as, "/api/v2/upload-sessions/beta", map[string]interface{}{
+		"genesisHash":             "genesisHashTest",
+		"fileSizeBytes":           123,
+		"numChunks":               2,
+		"storageLengthInYears":    1,
+		"alphaTreasureCommitment": oyster_utils.TreasureCommitment(testTreasureSecret),
+		"invoice": map[string]interface{}{
+			"cost":          "1.5",
+			"ethAddress":    "0x0000000000000000000000000000000000000abc",
+			"priceQuotedAt": time.Now(),
+		},
 	})
 
 	// Parse response
@@ -51,9 +162,13 @@ func (as *ActionSuite) Test_UploadSessionsCreateBeta() {
 	as.Equal("genesisHashTest", resParsed.UploadSession.GenesisHash)
 	as.Equal(123, resParsed.UploadSession.FileSizeBytes)
 	as.Equal(models.SessionTypeBeta, resParsed.UploadSession.Type)
-	as.True(1 == len(resParsed.BetaTreasureIndexes))
-	as.NotEqual(0, resParsed.Invoice.Cost)
+	as.NotEqual("", resParsed.BetaTreasureCommitment)
+	session := models.UploadSession{}
+	as.Nil(as.DB.Find(&session, resParsed.ID))
+	as.True(session.TreasureIdxMap.IsEmpty()) // Set once the secrets are revealed
+	as.Equal("1.5", resParsed.Invoice.Cost.String())
 	as.NotEqual("", resParsed.Invoice.EthAddress)
+	as.False(resParsed.Invoice.PriceQuotedAt.IsZero())
 }
 
 func (as *ActionSuite) Test_UploadSessionsGetPaymentStatus_Paid() {
@@ -145,3 +260,412 @@ func (as *ActionSuite) Test_UploadSessionsGetPaymentStatus_DoesntExist() {
 
 	//TODO: Return better error response when ID does not exist
 }
+
+func (as *ActionSuite) Test_UploadSessionsUpdate() {
+	session := models.UploadSession{
+		GenesisHash:   "genHashUpdate",
+		FileSizeBytes: 123,
+		NumChunks:     2,
+	}
+	_, err := session.StartUploadSession()
+	as.Nil(err)
+
+	res := putChunks(as, session, []chunkReq{
+		{Idx: 0, Data: "CHUNKDATA", Hash: "genHashUpdate"},
+		{Idx: 1, Data: "CHUNKDATA", Hash: "notTheGenHash"},
+		{Idx: 2, Data: "CHUNKDATA", Hash: "genHashUpdate"},
+		{Idx: 0, Data: "CHUNKDATA", Hash: "genHashUpdate"},
+	})
+
+	as.Equal([]chunkRes{
+		{Idx: 0, Status: ChunkAccepted},
+		{Idx: 1, Status: ChunkHashMismatch},
+		{Idx: 2, Status: ChunkOutOfRange},
+		{Idx: 0, Status: ChunkDuplicate},
+	}, res.Chunks)
+
+	dataMaps, err := models.GetDataMapsByChunkIdxs("genHashUpdate", []int{0, 1})
+	as.Nil(err)
+	as.Equal("CHUNKDATA", dataMaps[0].Message)
+	as.Equal("", dataMaps[1].Message)
+}
+
+func (as *ActionSuite) Test_UploadSessionsUpdate_ResendIsSafe() {
+	session := models.UploadSession{
+		GenesisHash:   "genHashResend",
+		FileSizeBytes: 123,
+		NumChunks:     2,
+	}
+	_, err := session.StartUploadSession()
+	as.Nil(err)
+
+	res := putChunks(as, session, []chunkReq{{Idx: 1, Data: "FIRSTDATA", Hash: "genHashResend"}})
+	as.Equal(ChunkAccepted, res.Chunks[0].Status)
+
+	res = putChunks(as, session, []chunkReq{{Idx: 1, Data: "OTHERDATA", Hash: "genHashResend"}})
+	as.Equal(ChunkDuplicate, res.Chunks[0].Status)
+
+	dataMaps, err := models.GetDataMapsByChunkIdxs("genHashResend", []int{1})
+	as.Nil(err)
+	as.Equal("FIRSTDATA", dataMaps[1].Message)
+}
+
+func (as *ActionSuite) Test_UploadSessionsUpdate_Preparing() {
+	defer func(batchSize int) { models.DataMapsBatchSize = batchSize }(models.DataMapsBatchSize)
+	models.DataMapsBatchSize = 1
+
+	session := models.UploadSession{
+		GenesisHash:   "genHashPreparing",
+		FileSizeBytes: 123,
+		NumChunks:     2,
+	}
+	_, err := session.StartUploadSession()
+	as.Nil(err)
+	as.True(session.Preparing())
+
+	res := as.JSON("/api/v2/upload-sessions/" + session.ID.String()).Put(UploadSessionUpdateReq{
+		Chunks: []chunkReq{{Idx: 0, Data: "CHUNKDATA", Hash: "genHashPreparing"}},
+	})
+	as.Equal(503, res.Code)
+
+	for preparing := true; preparing; {
+		preparing, err = models.BuildDataMapsBatch(session.ID)
+		as.Nil(err)
+	}
+
+	chunks := putChunks(as, session, []chunkReq{{Idx: 0, Data: "CHUNKDATA", Hash: "genHashPreparing"}})
+	as.Equal(ChunkAccepted, chunks.Chunks[0].Status)
+}
+
+func putChunks(as *ActionSuite, session models.UploadSession, chunks []chunkReq) uploadSessionUpdateRes {
+	res := as.JSON("/api/v2/upload-sessions/" + session.ID.String()).Put(UploadSessionUpdateReq{Chunks: chunks})
+	as.Equal(200, res.Code)
+
+	resParsed := uploadSessionUpdateRes{}
+	bodyBytes, err := ioutil.ReadAll(res.Body)
+	as.Nil(err)
+	as.Nil(json.Unmarshal(bodyBytes, &resParsed))
+	return resParsed
+}
+
+func (as *ActionSuite) Test_UploadSessionsGetProgress() {
+	session := models.UploadSession{
+		GenesisHash:   "genHashProgress",
+		FileSizeBytes: 123,
+		NumChunks:     2,
+	}
+	_, err := session.StartUploadSession()
+	as.Nil(err)
+
+	res := as.JSON("/api/v2/upload-progress/genHashProgress").Get()
+	as.Equal(200, res.Code)
+
+	resParsed := models.UploadProgress{}
+	bodyBytes, err := ioutil.ReadAll(res.Body)
+	as.Nil(err)
+	as.Nil(json.Unmarshal(bodyBytes, &resParsed))
+
+	as.Equal("genHashProgress", resParsed.GenesisHash)
+	as.Equal(resParsed.NumChunks, resParsed.Chunks.Pending)
+	as.Equal("unburied", resParsed.TreasureStatus)
+	as.False(resParsed.Completed)
+}
+
+func (as *ActionSuite) Test_UploadSessionsGetProgress_NotFound() {
+	res := as.JSON("/api/v2/upload-progress/genHashNoUpload").Get()
+	as.Equal(404, res.Code)
+}
+
+func (as *ActionSuite) Test_UploadSessionsGetEvents() {
+	session := models.UploadSession{
+		GenesisHash:   "genHashEvents",
+		FileSizeBytes: 123,
+		NumChunks:     2,
+	}
+	_, err := session.StartUploadSession()
+	as.Nil(err)
+
+	// Publish until the stream has subscribed and ended on the completed event.
+	done := make(chan bool)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+				services.SessionEvents.Publish(services.SessionEvent{
+					Type:        services.EventSessionCompleted,
+					GenesisHash: "genHashEvents",
+				})
+			}
+		}
+	}()
+	res := as.JSON("/api/v2/upload-sessions/" + session.ID.String() + "/events").Get()
+	close(done)
+
+	as.Equal(200, res.Code)
+	as.Equal("text/event-stream", res.Header().Get("Content-Type"))
+	as.Contains(res.Body.String(), "event: session_completed\ndata: ")
+}
+
+func (as *ActionSuite) Test_UploadSessionsGetEvents_NoTransaction() {
+	usr := UploadSessionResource{}
+	app := buffalo.New(buffalo.Options{})
+	app.Use(middleware.PopTransaction(models.DB))
+	app.GET("/events/{id}", usr.GetEvents)
+
+	res := httptest.NewRecorder()
+	app.ServeHTTP(res, httptest.NewRequest("GET", "/events/"+uuid.Must(uuid.NewV4()).String(), nil))
+	as.Equal(500, res.Code)
+
+	// Served without one by the app, or it would answer 500 rather than 404.
+	res = as.JSON("/api/v2/upload-sessions/" + uuid.Must(uuid.NewV4()).String() + "/events").Get()
+	as.Equal(404, res.Code)
+}
+
+func (as *ActionSuite) Test_UploadSessionsGetEvents_NotFound() {
+	res := as.JSON("/api/v2/upload-sessions/" + uuid.Must(uuid.NewV4()).String() + "/events").Get()
+	as.Equal(404, res.Code)
+}
+
+func (as *ActionSuite) Test_UploadSessionsCreate_BetaRefused() {
+	betaBroker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(422)
+	}))
+	defer betaBroker.Close()
+
+	res := as.JSON("/api/v2/upload-sessions").Post(map[string]interface{}{
+		"genesisHash":          "genHashBetaRefused",
+		"fileSizeBytes":        123,
+		"numChunks":            2,
+		"storageLengthInYears": 1,
+		"betaIp":               betaBroker.URL,
+	})
+	as.Equal(502, res.Code)
+
+	// The alpha session is rolled back.
+	count, err := as.DB.Where("genesis_hash = ?", "genHashBetaRefused").Count(&models.UploadSession{})
+	as.Nil(err)
+	as.Equal(0, count)
+	count, err = as.DB.Where("genesis_hash = ?", "genHashBetaRefused").Count(&models.DataMap{})
+	as.Nil(err)
+	as.Equal(0, count)
+}
+
+func (as *ActionSuite) Test_UploadSessionsCreateBeta_Unsigned() {
+	res := as.JSON("/api/v2/upload-sessions/beta").Post(map[string]interface{}{
+		"genesisHash":   "genHashUnsigned",
+		"fileSizeBytes": 123,
+		"numChunks":     2,
+	})
+	as.Equal(401, res.Code)
+
+	// Nothing is accepted while this broker has no secret to check with.
+	services.SetBrokerSecret("")
+	defer services.SetBrokerSecret("testSecret")
+	res2 := brokerPost(as, "/api/v2/upload-sessions/beta", map[string]interface{}{
+		"genesisHash":   "genHashUnsigned",
+		"fileSizeBytes": 123,
+		"numChunks":     2,
+	})
+	as.Equal(401, res2.Code)
+}
+
+func (as *ActionSuite) Test_UploadSessionsCreateBeta_Retried() {
+	req := map[string]interface{}{
+		"genesisHash":             "genHashBetaRetried",
+		"fileSizeBytes":           123,
+		"numChunks":               2,
+		"storageLengthInYears":    1,
+		"alphaTreasureCommitment": oyster_utils.TreasureCommitment(testTreasureSecret),
+	}
+	first := postBetaSession(as, req)
+	second := postBetaSession(as, req)
+	as.Equal(first.ID, second.ID)
+	as.Equal(first.BetaTreasureCommitment, second.BetaTreasureCommitment)
+
+	// An alpha broker starting over with another secret is answered with a
+	// new commitment on the same session.
+	otherSecret, _ := oyster_utils.NewTreasureSecret()
+	req["alphaTreasureCommitment"] = oyster_utils.TreasureCommitment(otherSecret)
+	third := postBetaSession(as, req)
+	as.Equal(first.ID, third.ID)
+	as.NotEqual(first.BetaTreasureCommitment, third.BetaTreasureCommitment)
+
+	count, err := as.DB.Where("genesis_hash = ?", "genHashBetaRetried").Count(&models.UploadSession{})
+	as.Nil(err)
+	as.Equal(1, count)
+
+	res := brokerPost(as, "/api/v2/upload-sessions/beta/"+third.ID+"/reveal",
+		treasureRevealReq{AlphaTreasureSecret: otherSecret})
+	as.Equal(200, res.Code)
+	revealRes := treasureRevealRes{}
+	as.Nil(json.Unmarshal(res.Body.Bytes(), &revealRes))
+	as.True(oyster_utils.VerifyTreasureReveal(revealRes.BetaTreasureSecret, third.BetaTreasureCommitment))
+}
+
+func postBetaSession(as *ActionSuite, req map[string]interface{}) uploadSessionCreateBetaRes {
+	res := brokerPost(as, "/api/v2/upload-sessions/beta", req)
+	as.Equal(200, res.Code)
+
+	resParsed := uploadSessionCreateBetaRes{}
+	as.Nil(json.Unmarshal(res.Body.Bytes(), &resParsed))
+	return resParsed
+}
+
+func (as *ActionSuite) Test_UploadSessionsRevealBeta() {
+	res := brokerPost(as, "/api/v2/upload-sessions/beta", map[string]interface{}{
+		"genesisHash":             "genHashReveal",
+		"fileSizeBytes":           123,
+		"numChunks":               2,
+		"alphaTreasureCommitment": oyster_utils.TreasureCommitment(testTreasureSecret),
+	})
+	as.Equal(200, res.Code)
+	betaRes := uploadSessionCreateBetaRes{}
+	as.Nil(json.Unmarshal(res.Body.Bytes(), &betaRes))
+	revealURL := "/api/v2/upload-sessions/beta/" + betaRes.ID + "/reveal"
+
+	// The alpha broker cannot reveal another secret than it committed to.
+	otherSecret, _ := oyster_utils.NewTreasureSecret()
+	res = brokerPost(as, revealURL, treasureRevealReq{AlphaTreasureSecret: otherSecret})
+	as.Equal(422, res.Code)
+
+	res = brokerPost(as, revealURL, treasureRevealReq{AlphaTreasureSecret: testTreasureSecret})
+	as.Equal(200, res.Code)
+	revealRes := treasureRevealRes{}
+	as.Nil(json.Unmarshal(res.Body.Bytes(), &revealRes))
+	as.True(oyster_utils.VerifyTreasureReveal(revealRes.BetaTreasureSecret, betaRes.BetaTreasureCommitment))
+
+	expected, err := oyster_utils.TreasureIndexesFromSecrets(oyster_utils.ConvertToByte(123),
+		testTreasureSecret, revealRes.BetaTreasureSecret)
+	as.Nil(err)
+	session := models.UploadSession{}
+	as.Nil(as.DB.Find(&session, betaRes.ID))
+	as.Equal(expected, session.TreasureIdxMap.SectorIndexes())
+
+	// Only beta sessions are revealed to the alpha broker.
+	alphaSession := models.UploadSession{
+		GenesisHash:            "genHashRevealAlpha",
+		FileSizeBytes:          123,
+		NumChunks:              2,
+		TreasureSecret:         nulls.NewString(testTreasureSecret),
+		PeerTreasureCommitment: nulls.NewString(oyster_utils.TreasureCommitment(testTreasureSecret)),
+	}
+	_, err = alphaSession.StartUploadSession()
+	as.Nil(err)
+	res = brokerPost(as, "/api/v2/upload-sessions/beta/"+alphaSession.ID.String()+"/reveal",
+		treasureRevealReq{AlphaTreasureSecret: testTreasureSecret})
+	as.Equal(404, res.Code)
+}
+
+func (as *ActionSuite) Test_UploadSessionsRequoteBeta() {
+	res := brokerPost(as, "/api/v2/upload-sessions/beta", map[string]interface{}{
+		"genesisHash":             "genHashRequoteBetaSession",
+		"fileSizeBytes":           123,
+		"numChunks":               2,
+		"storageLengthInYears":    1,
+		"alphaTreasureCommitment": oyster_utils.TreasureCommitment(testTreasureSecret),
+		"invoice": map[string]interface{}{
+			"cost":          "1.5",
+			"ethAddress":    "0x0000000000000000000000000000000000000abc",
+			"priceQuotedAt": time.Now().Add(-models.PriceQuoteTTL - time.Minute),
+		},
+	})
+	as.Equal(200, res.Code)
+	betaRes := uploadSessionCreateBetaRes{}
+	as.Nil(json.Unmarshal(res.Body.Bytes(), &betaRes))
+
+	quotedAt := time.Now()
+	res = brokerPost(as, "/api/v2/upload-sessions/beta/"+betaRes.ID+"/requote", map[string]interface{}{
+		"invoice": map[string]interface{}{
+			"cost":          "2.5",
+			"ethAddress":    "0x0000000000000000000000000000000000000abc",
+			"priceQuotedAt": quotedAt,
+		},
+	})
+	as.Equal(200, res.Code)
+
+	session := models.UploadSession{}
+	as.Nil(as.DB.Find(&session, betaRes.ID))
+	as.Equal("2.5", session.TotalCost.String())
+	as.WithinDuration(quotedAt, session.PriceQuotedAt.Time, time.Second)
+	as.False(session.QuoteExpired())
+
+	res = brokerPost(as, "/api/v2/upload-sessions/beta/"+uuid.Must(uuid.NewV4()).String()+"/requote", map[string]interface{}{})
+	as.Equal(404, res.Code)
+}
+
+// fakeBetaBroker answers the beta handshake, revealing revealedSecret after
+// committing to committedSecret. Stores the alpha secret it was revealed, and
+// the invoice it was requoted if requoted is set. Refuses requotes otherwise.
+func fakeBetaBroker(committedSecret string, revealedSecret string, alphaSecret *string,
+	requoted *models.Invoice) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v2/upload-sessions/beta" {
+			json.NewEncoder(w).Encode(uploadSessionCreateBetaRes{
+				ID:                     "betaSessionID",
+				BetaTreasureCommitment: oyster_utils.TreasureCommitment(committedSecret),
+			})
+			return
+		}
+		if r.URL.Path == "/api/v2/upload-sessions/beta/betaSessionID/requote" {
+			if requoted == nil {
+				w.WriteHeader(409)
+				return
+			}
+			req := betaRequoteReq{}
+			json.NewDecoder(r.Body).Decode(&req)
+			*requoted = req.Invoice
+			json.NewEncoder(w).Encode(uploadSessionCreateBetaRes{ID: "betaSessionID", Invoice: req.Invoice})
+			return
+		}
+
+		req := treasureRevealReq{}
+		json.NewDecoder(r.Body).Decode(&req)
+		*alphaSecret = req.AlphaTreasureSecret
+		json.NewEncoder(w).Encode(treasureRevealRes{BetaTreasureSecret: revealedSecret})
+	}))
+}
+
+func (as *ActionSuite) Test_UploadSessionsCreate_TreasureFromBothSecrets() {
+	var alphaSecret string
+	betaBroker := fakeBetaBroker(testTreasureSecret, testTreasureSecret, &alphaSecret, nil)
+	defer betaBroker.Close()
+
+	res := postUploadSession(as, map[string]interface{}{
+		"genesisHash":          "genHashBothSecrets",
+		"fileSizeBytes":        123,
+		"numChunks":            2,
+		"storageLengthInYears": 1,
+		"betaIp":               betaBroker.URL,
+	})
+	as.Equal("betaSessionID", res.BetaSessionID)
+
+	expected, err := oyster_utils.TreasureIndexesFromSecrets(oyster_utils.ConvertToByte(123),
+		alphaSecret, testTreasureSecret)
+	as.Nil(err)
+	session := models.UploadSession{}
+	as.Nil(as.DB.Find(&session, res.ID))
+	as.Equal(expected, session.TreasureIdxMap.SectorIndexes())
+}
+
+func (as *ActionSuite) Test_UploadSessionsCreate_BetaRevealMismatch() {
+	// The beta broker reveals another secret than it committed to.
+	var alphaSecret string
+	otherSecret, _ := oyster_utils.NewTreasureSecret()
+	betaBroker := fakeBetaBroker(testTreasureSecret, otherSecret, &alphaSecret, nil)
+	defer betaBroker.Close()
+
+	res := as.JSON("/api/v2/upload-sessions").Post(map[string]interface{}{
+		"genesisHash":          "genHashRevealMismatch",
+		"fileSizeBytes":        123,
+		"numChunks":            2,
+		"storageLengthInYears": 1,
+		"betaIp":               betaBroker.URL,
+	})
+	as.Equal(502, res.Code)
+
+	count, err := as.DB.Where("genesis_hash = ?", "genHashRevealMismatch").Count(&models.UploadSession{})
+	as.Nil(err)
+	as.Equal(0, count)
+}
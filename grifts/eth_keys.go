@@ -0,0 +1,107 @@
+package grifts
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gobuffalo/uuid"
+	"github.com/markbates/grift/grift"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+)
+
+var _ = grift.Namespace("eth_keys", func() {
+
+	grift.Desc("encrypt", "Encrypts ETH private keys still stored in plain text. The broker also does this when it starts.")
+	grift.Add("encrypt", func(c *grift.Context) error {
+		count, err := models.EncryptPlaintextEthKeys()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Encrypted %d ETH private keys\n", count)
+		return nil
+	})
+
+	grift.Desc("rotate", "Re-encrypts ETH private keys under ETH_KEY_MASTER_KEY. "+
+		"The old master key must be listed in ETH_KEY_PREVIOUS_MASTER_KEYS.")
+	grift.Add("rotate", func(c *grift.Context) error {
+		count, err := models.RotateEthKeys()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rotated %d ETH private keys\n", count)
+		return nil
+	})
+
+	grift.Desc("derive", "Re-derives a session's address from BROKER_MNEMONIC. "+
+		"Usage: buffalo task eth_keys:derive <eth_key_index>")
+	grift.Add("derive", func(c *grift.Context) error {
+		if len(c.Args) != 1 {
+			return errors.New("usage: buffalo task eth_keys:derive <eth_key_index>")
+		}
+		index, err := strconv.Atoi(c.Args[0])
+		if err != nil {
+			return err
+		}
+
+		key, err := services.DeriveSessionKey(index)
+		if err != nil {
+			return err
+		}
+		// Only the address, private keys never go to the terminal.
+		fmt.Printf("Address: %s\n", crypto.PubkeyToAddress(key.PublicKey).Hex())
+		return nil
+	})
+
+	grift.Desc("restore", "Re-derives a session's private key from BROKER_MNEMONIC and stores it encrypted. "+
+		"Usage: buffalo task eth_keys:restore <session id|eth_key_index>")
+	grift.Add("restore", func(c *grift.Context) error {
+		if len(c.Args) != 1 {
+			return errors.New("usage: buffalo task eth_keys:restore <session id|eth_key_index>")
+		}
+
+		session := models.UploadSession{}
+		if id, err := uuid.FromString(c.Args[0]); err == nil {
+			if err = models.DB.Find(&session, id); err != nil {
+				return err
+			}
+		} else {
+			index, err := strconv.Atoi(c.Args[0])
+			if err != nil {
+				return errors.New("not a session id or an eth_key_index: " + c.Args[0])
+			}
+			if err = models.DB.Where("eth_key_index = ?", index).First(&session); err != nil {
+				return err
+			}
+		}
+		if !session.ETHKeyIndex.Valid {
+			return errors.New("session " + session.ID.String() + " has no eth_key_index to derive its key at")
+		}
+
+		key, err := services.DeriveSessionKey(session.ETHKeyIndex.Int)
+		if err != nil {
+			return err
+		}
+		// Refuse to overwrite the key with one for another address, e.g. from
+		// the wrong mnemonic.
+		addr := crypto.PubkeyToAddress(key.PublicKey).Hex()
+		sessionAddr := session.ETHAddrAlpha
+		if session.Type == models.SessionTypeBeta {
+			sessionAddr = session.ETHAddrBeta
+		}
+		if !strings.EqualFold(addr, sessionAddr.String) {
+			return fmt.Errorf("derived address %s is not the session's address %s", addr, sessionAddr.String)
+		}
+
+		if err = models.RestoreEthKey(session.ID, hex.EncodeToString(crypto.FromECDSA(key))); err != nil {
+			return err
+		}
+		fmt.Printf("Restored the private key of session %s, address %s\n", session.ID, addr)
+		return nil
+	})
+
+})
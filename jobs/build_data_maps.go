@@ -0,0 +1,122 @@
+package jobs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	raven "github.com/getsentry/raven-go"
+	"github.com/gobuffalo/uuid"
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+var (
+	// How long a session whose data maps failed to build is left before it is
+	// tried again. Doubles with every failure in a row, up to
+	// BuildDataMapsMaxRetryDelay.
+	BuildDataMapsRetryDelay    = time.Minute
+	BuildDataMapsMaxRetryDelay = time.Hour
+	// How many times in a row building a session's data maps can fail before
+	// it is given up on.
+	BuildDataMapsMaxFailures = 10
+)
+
+// buildFailure is when the data maps of a session last failed to build, and
+// how many times in a row they have.
+type buildFailure struct {
+	at       time.Time
+	failures int
+}
+
+var (
+	buildFailuresMtx sync.Mutex
+	buildFailures    = map[uuid.UUID]buildFailure{}
+)
+
+func init() {
+}
+
+// BuildDataMaps carries on building the data maps of the sessions still
+// preparing, a batch of each in turn, until they are all ready or maxTime is
+// up. Whatever is left is carried on with the next time it runs. A session
+// whose batch fails is not tried again this run, and is backed off from the
+// runs after it until it builds again, or is marked DataMapsError once it has
+// failed BuildDataMapsMaxFailures times in a row.
+func BuildDataMaps(maxTime time.Duration) {
+	deadline := time.Now().Add(maxTime)
+
+	sessions, err := models.GetPreparingSessions()
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return
+	}
+
+	buildFailuresMtx.Lock()
+	defer buildFailuresMtx.Unlock()
+	sessions = sessionsToBuild(sessions)
+
+	for len(sessions) > 0 && time.Now().Before(deadline) {
+		var stillPreparing []models.UploadSession
+		for _, session := range sessions {
+			// BuildDataMapsBatch has already reported the error.
+			preparing, err := models.BuildDataMapsBatch(session.ID)
+			if err != nil {
+				failure := buildFailures[session.ID]
+				buildFailures[session.ID] = buildFailure{at: time.Now(), failures: failure.failures + 1}
+				if failure.failures+1 >= BuildDataMapsMaxFailures {
+					giveUpBuildingDataMaps(session)
+				}
+				continue
+			}
+
+			delete(buildFailures, session.ID)
+			if preparing {
+				stillPreparing = append(stillPreparing, session)
+			}
+		}
+		sessions = stillPreparing
+	}
+}
+
+// giveUpBuildingDataMaps marks session DataMapsError, so it is no longer
+// preparing, and forgets its failures.
+func giveUpBuildingDataMaps(session models.UploadSession) {
+	raven.CaptureError(fmt.Errorf("gave up building the data maps of session %s after %d failures",
+		session.ID, BuildDataMapsMaxFailures), nil)
+	if err := models.MarkDataMapsFailed(session.ID); err != nil {
+		raven.CaptureError(err, nil)
+		return
+	}
+	delete(buildFailures, session.ID)
+}
+
+// sessionsToBuild returns the sessions that are not backed off, and forgets
+// the failures of sessions that are no longer preparing.
+func sessionsToBuild(preparing []models.UploadSession) []models.UploadSession {
+	stillPreparing := make(map[uuid.UUID]bool, len(preparing))
+	var sessions []models.UploadSession
+	for _, session := range preparing {
+		stillPreparing[session.ID] = true
+		if failure, ok := buildFailures[session.ID]; !ok || time.Now().After(failure.retryAt()) {
+			sessions = append(sessions, session)
+		}
+	}
+
+	for id := range buildFailures {
+		if !stillPreparing[id] {
+			delete(buildFailures, id)
+		}
+	}
+	return sessions
+}
+
+func (f buildFailure) retryAt() time.Time {
+	delay := BuildDataMapsRetryDelay
+	for i := 1; i < f.failures && delay < BuildDataMapsMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > BuildDataMapsMaxRetryDelay {
+		delay = BuildDataMapsMaxRetryDelay
+	}
+	return f.at.Add(delay)
+}
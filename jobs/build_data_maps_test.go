@@ -0,0 +1,126 @@
+package jobs_test
+
+import (
+	"time"
+
+	"github.com/oysterprotocol/brokernode/jobs"
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+func (suite *JobsSuite) Test_BuildDataMaps() {
+	defer func(batchSize int) { models.DataMapsBatchSize = batchSize }(models.DataMapsBatchSize)
+	models.DataMapsBatchSize = 2
+
+	var sessions []models.UploadSession
+	for _, genHash := range []string{"genHashBuild1", "genHashBuild2"} {
+		session := models.UploadSession{
+			GenesisHash:   genHash,
+			FileSizeBytes: 123,
+			NumChunks:     5,
+		}
+		_, err := session.StartUploadSession()
+		suite.Nil(err)
+		suite.True(session.Preparing())
+		sessions = append(sessions, session)
+	}
+
+	jobs.BuildDataMaps(time.Minute)
+
+	preparing, err := models.GetPreparingSessions()
+	suite.Nil(err)
+	suite.Equal(0, len(preparing))
+
+	for _, session := range sessions {
+		count, err := models.DataMapQuery{GenesisHash: session.GenesisHash}.Count()
+		suite.Nil(err)
+		suite.True(count >= session.NumChunks)
+	}
+}
+
+func (suite *JobsSuite) Test_BuildDataMaps_BacksOffFailedSession() {
+	defer func(batchSize int) { models.DataMapsBatchSize = batchSize }(models.DataMapsBatchSize)
+	models.DataMapsBatchSize = 2
+	defer func(delay time.Duration) { jobs.BuildDataMapsRetryDelay = delay }(jobs.BuildDataMapsRetryDelay)
+	jobs.BuildDataMapsRetryDelay = time.Hour
+
+	var sessions []models.UploadSession
+	for _, genHash := range []string{"genHashBroken", "genHashBuilt"} {
+		session := models.UploadSession{
+			GenesisHash:   genHash,
+			FileSizeBytes: 123,
+			NumChunks:     5,
+		}
+		_, err := session.StartUploadSession()
+		suite.Nil(err)
+		sessions = append(sessions, session)
+	}
+
+	// Data maps without a genesis hash fail to validate.
+	suite.Nil(suite.DB.RawQuery("UPDATE upload_sessions SET genesis_hash = ? WHERE id = ?",
+		"", sessions[0].ID).Exec())
+
+	// The other session is built regardless.
+	jobs.BuildDataMaps(time.Minute)
+
+	preparing, err := models.GetPreparingSessions()
+	suite.Nil(err)
+	suite.Equal(1, len(preparing))
+	suite.Equal(sessions[0].ID, preparing[0].ID)
+
+	// Not tried again until it has been backed off for long enough.
+	suite.Nil(suite.DB.RawQuery("UPDATE upload_sessions SET genesis_hash = ? WHERE id = ?",
+		"genHashBroken", sessions[0].ID).Exec())
+	jobs.BuildDataMaps(time.Minute)
+
+	preparing, err = models.GetPreparingSessions()
+	suite.Nil(err)
+	suite.Equal(1, len(preparing))
+
+	jobs.BuildDataMapsRetryDelay = 0
+	jobs.BuildDataMaps(time.Minute)
+
+	preparing, err = models.GetPreparingSessions()
+	suite.Nil(err)
+	suite.Equal(0, len(preparing))
+}
+
+func (suite *JobsSuite) Test_BuildDataMaps_GivesUpOnFailingSession() {
+	defer func(batchSize int) { models.DataMapsBatchSize = batchSize }(models.DataMapsBatchSize)
+	models.DataMapsBatchSize = 2
+	defer func(delay time.Duration) { jobs.BuildDataMapsRetryDelay = delay }(jobs.BuildDataMapsRetryDelay)
+	jobs.BuildDataMapsRetryDelay = 0
+	defer func(failures int) { jobs.BuildDataMapsMaxFailures = failures }(jobs.BuildDataMapsMaxFailures)
+	jobs.BuildDataMapsMaxFailures = 2
+
+	session := models.UploadSession{
+		GenesisHash:   "genHashGiveUp",
+		FileSizeBytes: 123,
+		NumChunks:     5,
+	}
+	_, err := session.StartUploadSession()
+	suite.Nil(err)
+
+	// Data maps without a genesis hash fail to validate.
+	suite.Nil(suite.DB.RawQuery("UPDATE upload_sessions SET genesis_hash = ? WHERE id = ?",
+		"", session.ID).Exec())
+
+	jobs.BuildDataMaps(time.Minute)
+	preparing, err := models.GetPreparingSessions()
+	suite.Nil(err)
+	suite.Equal(1, len(preparing))
+
+	jobs.BuildDataMaps(time.Minute)
+	preparing, err = models.GetPreparingSessions()
+	suite.Nil(err)
+	suite.Equal(0, len(preparing))
+
+	suite.Nil(suite.DB.RawQuery("UPDATE upload_sessions SET genesis_hash = ? WHERE id = ?",
+		"genHashGiveUp", session.ID).Exec())
+	stored := models.UploadSession{}
+	suite.Nil(suite.DB.Find(&stored, session.ID))
+	suite.True(stored.DataMapsFailed())
+
+	progress, err := models.GetUploadProgress("genHashGiveUp")
+	suite.Nil(err)
+	suite.Equal("error", progress.DataMapsStatus)
+}
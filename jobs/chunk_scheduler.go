@@ -0,0 +1,228 @@
+package jobs
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+/*
+A ChunkScheduler shares the ready channels out over the sessions with
+unassigned chunks. Every run, each ready channel takes up to one bundle per
+session with chunks left, sized by how fast the channel has been doing PoW,
+and every bundle holds the chunks of one session. The scheduler is picked by
+CHUNK_SCHEDULER:
+
+	age     - oldest session first, the way chunks used to be sent
+	fair    - every session in turn, so a huge upload can't starve small ones
+	paid    - sessions in turn, weighted by how much they paid per chunk (default)
+
+The fair and paid schedulers keep each session's turn between runs, so a run
+with fewer channels than sessions does not always start with the oldest.
+*/
+
+const (
+	ChunkSchedulerAge  = "age"
+	ChunkSchedulerFair = "fair"
+	ChunkSchedulerPaid = "paid"
+)
+
+var (
+	// Bundles are sized to take about this long on the channel doing them.
+	BundleTargetTime = 60 * time.Second
+
+	// Bundles are never smaller or larger than these, whatever the channel's
+	// throughput. A channel without PoW stats gets BundleSize.
+	MinBundleSize = 10
+	MaxBundleSize = 100
+)
+
+// SessionDemand is a session with the number of chunks it has left to send.
+type SessionDemand struct {
+	Session    models.UploadSession
+	Unassigned int
+}
+
+// SessionBundle is a bundle of Size chunks of the session at Demand in the
+// demands it was scheduled from.
+type SessionBundle struct {
+	Demand int
+	Size   int
+}
+
+type ChunkScheduler interface {
+	Name() string
+	// Schedule returns the bundle for each of bundleSizes, in order, and
+	// stops early once no session has chunks left. demands are oldest first.
+	Schedule(demands []SessionDemand, bundleSizes []int) []SessionBundle
+}
+
+// Scheduler is the scheduler ProcessUnassignedChunks uses.
+var Scheduler ChunkScheduler = newWeightedScheduler(ChunkSchedulerPaid, paidWeight)
+
+// NewChunkScheduler returns the scheduler called name.
+func NewChunkScheduler(name string) (ChunkScheduler, error) {
+	switch name {
+	case ChunkSchedulerAge:
+		return ageScheduler{}, nil
+	case ChunkSchedulerFair:
+		return newWeightedScheduler(name, fairWeight), nil
+	case "", ChunkSchedulerPaid:
+		return newWeightedScheduler(ChunkSchedulerPaid, paidWeight), nil
+	default:
+		return nil, fmt.Errorf("unknown chunk scheduler %q", name)
+	}
+}
+
+// BundleSizeFor returns how many chunks a channel with stats should be sent
+// at once to be busy for about BundleTargetTime.
+func BundleSizeFor(stats models.PowStats) int {
+	if stats.ChunksPerSecond <= 0 {
+		return BundleSize
+	}
+
+	size := int(stats.ChunksPerSecond * (1 - stats.FailureRate) * BundleTargetTime.Seconds())
+	if size < MinBundleSize {
+		return MinBundleSize
+	}
+	if size > MaxBundleSize {
+		return MaxBundleSize
+	}
+	return size
+}
+
+// ageScheduler sends the chunks of the oldest session with chunks left.
+type ageScheduler struct{}
+
+func (s ageScheduler) Name() string {
+	return ChunkSchedulerAge
+}
+
+func (s ageScheduler) Schedule(demands []SessionDemand, bundleSizes []int) []SessionBundle {
+	var bundles []SessionBundle
+	next := 0
+	remaining := 0
+	if len(demands) > 0 {
+		remaining = demands[0].Unassigned
+	}
+
+	for _, size := range bundleSizes {
+		for remaining <= 0 && next+1 < len(demands) {
+			next++
+			remaining = demands[next].Unassigned
+		}
+		if remaining <= 0 {
+			break
+		}
+
+		if size > remaining {
+			size = remaining
+		}
+		remaining -= size
+		bundles = append(bundles, SessionBundle{Demand: next, Size: size})
+	}
+	return bundles
+}
+
+// weightedScheduler hands out bundles by smooth weighted round-robin: every
+// bundle, each session with chunks left gains its weight in credit, and the
+// session with the most credit gets the bundle and pays back the weight of
+// all of them. Ties go to the older session. Credit is kept by genesis hash
+// from one run to the next, and dropped once a session has no chunks left.
+type weightedScheduler struct {
+	name   string
+	weight func(demand SessionDemand) float64
+
+	mtx    sync.Mutex
+	credit map[string]float64
+}
+
+func newWeightedScheduler(name string, weight func(demand SessionDemand) float64) *weightedScheduler {
+	return &weightedScheduler{name: name, weight: weight, credit: map[string]float64{}}
+}
+
+func (s *weightedScheduler) Name() string {
+	return s.name
+}
+
+func (s *weightedScheduler) Schedule(demands []SessionDemand, bundleSizes []int) []SessionBundle {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	remaining := make([]int, len(demands))
+	credit := make([]float64, len(demands))
+	weights := make([]float64, len(demands))
+	maxWeight := 0.0
+	for i, demand := range demands {
+		remaining[i] = demand.Unassigned
+		credit[i] = s.credit[demand.Session.GenesisHash]
+		weights[i] = s.weight(demand)
+		if weights[i] > maxWeight {
+			maxWeight = weights[i]
+		}
+	}
+
+	// A session that weighs nothing still gets a turn now and then.
+	for i := range weights {
+		if maxWeight <= 0 {
+			weights[i] = 1
+		} else if weights[i] < maxWeight/100 {
+			weights[i] = maxWeight / 100
+		}
+	}
+
+	var bundles []SessionBundle
+	for _, size := range bundleSizes {
+		next := -1
+		totalWeight := 0.0
+		for i := range demands {
+			if remaining[i] <= 0 {
+				continue
+			}
+			credit[i] += weights[i]
+			totalWeight += weights[i]
+			if next == -1 || credit[i] > credit[next] {
+				next = i
+			}
+		}
+		if next == -1 {
+			break
+		}
+
+		credit[next] -= totalWeight
+		if size > remaining[next] {
+			size = remaining[next]
+		}
+		remaining[next] -= size
+		bundles = append(bundles, SessionBundle{Demand: next, Size: size})
+	}
+
+	s.credit = map[string]float64{}
+	for i, demand := range demands {
+		if remaining[i] > 0 {
+			s.credit[demand.Session.GenesisHash] = credit[i]
+		}
+	}
+	return bundles
+}
+
+func fairWeight(demand SessionDemand) float64 {
+	return 1
+}
+
+// paidWeight weighs sessions by the PRL they paid per chunk, so a large
+// upload is not put ahead of a small one that paid a better rate.
+func paidWeight(demand SessionDemand) float64 {
+	paid, _ := new(big.Float).SetInt(demand.Session.PaymentReceived.Wei()).Float64()
+	units, _ := new(big.Float).SetInt(oyster_utils.AmountFromUnits(1).Wei()).Float64()
+
+	numChunks := demand.Session.NumChunks
+	if numChunks < 1 {
+		numChunks = 1
+	}
+	return paid / units / float64(numChunks)
+}
@@ -0,0 +1,137 @@
+package jobs_test
+
+import (
+	"fmt"
+
+	"github.com/oysterprotocol/brokernode/jobs"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+func demandsOf(unassigned ...int) []jobs.SessionDemand {
+	demands := make([]jobs.SessionDemand, len(unassigned))
+	for i, n := range unassigned {
+		demands[i] = jobs.SessionDemand{
+			Session:    models.UploadSession{GenesisHash: fmt.Sprintf("genHash%d", i), NumChunks: 1000},
+			Unassigned: n,
+		}
+	}
+	return demands
+}
+
+// bundlesPerDemand counts the bundles each demand was scheduled.
+func bundlesPerDemand(bundles []jobs.SessionBundle, numDemands int) []int {
+	counts := make([]int, numDemands)
+	for _, bundle := range bundles {
+		counts[bundle.Demand]++
+	}
+	return counts
+}
+
+func (suite *JobsSuite) Test_NewChunkScheduler() {
+	_, err := jobs.NewChunkScheduler("lottery")
+	suite.NotNil(err)
+
+	for _, name := range []string{jobs.ChunkSchedulerAge, jobs.ChunkSchedulerFair, jobs.ChunkSchedulerPaid} {
+		scheduler, err := jobs.NewChunkScheduler(name)
+		suite.Nil(err)
+		suite.Equal(name, scheduler.Name())
+	}
+
+	scheduler, err := jobs.NewChunkScheduler("")
+	suite.Nil(err)
+	suite.Equal(jobs.ChunkSchedulerPaid, scheduler.Name())
+}
+
+func (suite *JobsSuite) Test_AgeScheduler() {
+	scheduler, _ := jobs.NewChunkScheduler(jobs.ChunkSchedulerAge)
+
+	// The oldest session takes every bundle it can fill before the next one.
+	bundles := scheduler.Schedule(demandsOf(1000, 20, 20), []int{30, 30, 30})
+	suite.Equal([]jobs.SessionBundle{{Demand: 0, Size: 30}, {Demand: 0, Size: 30}, {Demand: 0, Size: 30}}, bundles)
+
+	bundles = scheduler.Schedule(demandsOf(0, 35, 20), []int{30, 30, 30, 30})
+	suite.Equal([]jobs.SessionBundle{{Demand: 1, Size: 30}, {Demand: 1, Size: 5}, {Demand: 2, Size: 20}}, bundles)
+}
+
+func (suite *JobsSuite) Test_FairScheduler() {
+	scheduler, _ := jobs.NewChunkScheduler(jobs.ChunkSchedulerFair)
+
+	// A huge upload does not starve the small ones.
+	bundles := scheduler.Schedule(demandsOf(1000, 20, 20), []int{30, 30, 30})
+	suite.Equal([]jobs.SessionBundle{{Demand: 0, Size: 30}, {Demand: 1, Size: 20}, {Demand: 2, Size: 20}}, bundles)
+
+	// Once the small ones are done the huge one gets every bundle.
+	bundles = scheduler.Schedule(demandsOf(1000, 20), []int{30, 30, 30, 30})
+	suite.Equal([]int{3, 1}, bundlesPerDemand(bundles, 2))
+
+	// Stops when no session has chunks left.
+	bundles = scheduler.Schedule(demandsOf(5), []int{30, 30})
+	suite.Equal([]jobs.SessionBundle{{Demand: 0, Size: 5}}, bundles)
+}
+
+func (suite *JobsSuite) Test_FairScheduler_FewerChannelsThanSessions() {
+	scheduler, _ := jobs.NewChunkScheduler(jobs.ChunkSchedulerFair)
+	demands := demandsOf(1000, 1000, 1000)
+
+	// Each run picks up where the last one stopped rather than starting with
+	// the oldest session again.
+	var turns []int
+	for run := 0; run < 4; run++ {
+		for _, bundle := range scheduler.Schedule(demands, []int{30}) {
+			turns = append(turns, bundle.Demand)
+		}
+	}
+	suite.Equal([]int{0, 1, 2, 0}, turns)
+
+	turns = nil
+	for run := 0; run < 3; run++ {
+		for _, bundle := range scheduler.Schedule(demands, []int{30, 30}) {
+			turns = append(turns, bundle.Demand)
+		}
+	}
+	suite.Equal([]int{1, 2, 0, 1, 2, 0}, turns)
+}
+
+func (suite *JobsSuite) Test_PaidScheduler() {
+	scheduler, _ := jobs.NewChunkScheduler(jobs.ChunkSchedulerPaid)
+
+	demands := demandsOf(1000, 1000, 1000)
+	demands[0].Session.PaymentReceived = oyster_utils.AmountFromUnits(3)
+	demands[1].Session.PaymentReceived = oyster_utils.AmountFromUnits(1)
+
+	// Shared 3 to 1, and the session that paid nothing still gets a turn.
+	bundles := scheduler.Schedule(demands, []int{10, 10, 10, 10, 10, 10, 10, 10})
+	suite.Equal([]int{6, 2, 0}, bundlesPerDemand(bundles, 3))
+	suite.Equal([]jobs.SessionBundle{{Demand: 0, Size: 10}, {Demand: 1, Size: 10}, {Demand: 0, Size: 10},
+		{Demand: 0, Size: 10}}, bundles[:4])
+
+	bundleSizes := make([]int, 200)
+	for i := range bundleSizes {
+		bundleSizes[i] = 10
+	}
+	bundles = scheduler.Schedule(demands, bundleSizes)
+	suite.True(bundlesPerDemand(bundles, 3)[2] > 0)
+
+	// Weighed by what was paid per chunk, not in total.
+	scheduler, _ = jobs.NewChunkScheduler(jobs.ChunkSchedulerPaid)
+	demands = demandsOf(1000, 100)
+	demands[0].Session.PaymentReceived = oyster_utils.AmountFromUnits(2)
+	demands[1].Session.PaymentReceived = oyster_utils.AmountFromUnits(1)
+	demands[1].Session.NumChunks = 100
+
+	bundles = scheduler.Schedule(demands, []int{10, 10, 10, 10, 10, 10})
+	suite.Equal([]int{1, 5}, bundlesPerDemand(bundles, 2))
+}
+
+func (suite *JobsSuite) Test_BundleSizeFor() {
+	suite.Equal(jobs.BundleSize, jobs.BundleSizeFor(models.PowStats{}))
+
+	// 1 chunk per second fills the 60 second target with 60 chunks, fewer
+	// when runs fail.
+	suite.Equal(60, jobs.BundleSizeFor(models.PowStats{ChunksPerSecond: 1}))
+	suite.Equal(30, jobs.BundleSizeFor(models.PowStats{ChunksPerSecond: 1, FailureRate: 0.5}))
+
+	suite.Equal(jobs.MinBundleSize, jobs.BundleSizeFor(models.PowStats{ChunksPerSecond: 0.01}))
+	suite.Equal(jobs.MaxBundleSize, jobs.BundleSizeFor(models.PowStats{ChunksPerSecond: 10}))
+}
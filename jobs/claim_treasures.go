@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	raven "github.com/getsentry/raven-go"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+)
+
+func init() {
+}
+
+// ClaimTreasures moves every treasure claim webnodes have made forward,
+// funding treasure addresses with gas and sending the claims.
+func ClaimTreasures(ethService services.Eth) {
+	claims, err := models.GetPendingTreasureClaims()
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return
+	}
+
+	for i := range claims {
+		if err := ethService.ClaimTreasure(&claims[i]); err != nil {
+			// Tried again next time.
+			raven.CaptureError(err, nil)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package jobs_test
+
+import (
+	"strconv"
+
+	"github.com/oysterprotocol/brokernode/jobs"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+)
+
+func (suite *JobsSuite) Test_ClaimTreasures() {
+	defer services.SetUpMock()
+
+	statuses := []models.TreasureClaimStatus{models.TreasureClaimNotStarted, models.TreasureClaimGasProcessing,
+		models.TreasureClaimGasSent, models.TreasureClaimProcessing, models.TreasureClaimSuccess,
+		models.TreasureClaimError}
+	for i, status := range statuses {
+		_, err := models.DB.ValidateAndCreate(&models.TreasureClaim{
+			GenesisHash:     "genHashClaimTreasures",
+			SectorIdx:       i,
+			ETHAddr:         "treasureAddr" + strconv.Itoa(i),
+			ReceiverEthAddr: "receiverAddr",
+			Status:          status,
+		})
+		suite.Nil(err)
+	}
+
+	var claimed []models.TreasureClaimStatus
+	EthMock.ClaimTreasure = func(claim *models.TreasureClaim) error {
+		claimed = append(claimed, claim.Status)
+		return nil
+	}
+
+	jobs.ClaimTreasures(EthMock)
+
+	// Only claims still waiting on the job are moved forward.
+	suite.Equal(4, len(claimed))
+	for _, status := range claimed {
+		suite.NotEqual(models.TreasureClaimSuccess, status)
+		suite.NotEqual(models.TreasureClaimError, status)
+	}
+}
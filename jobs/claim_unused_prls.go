@@ -115,7 +115,8 @@ func StartNewClaims() {
 	}
 }
 
-// wraps calls eth_gatway's SendGas method and sets GasStatus to GasTransferProcessing
+// wraps calls eth_gatway's SendGas method, which sets GasStatus to GasTransferProcessing
+// for each transfer it submits
 func InitiateGasTransfer(uploadsThatNeedGas []models.CompletedUpload) {
 	err := ethWrapper.SendGas(uploadsThatNeedGas)
 	if err != nil {
@@ -123,11 +124,10 @@ func InitiateGasTransfer(uploadsThatNeedGas []models.CompletedUpload) {
 		raven.CaptureError(err, nil)
 		return
 	}
-	//TODO un-comment this out when ETH stuff works
-	//models.SetGasStatus(needGas, models.GasTransferProcessing)
 }
 
-// wraps calls eth_gatway's ClaimPRLs method and sets GasStatus to GasTransferProcessing
+// wraps calls eth_gatway's ClaimPRLs method, which sets PRLStatus to PRLClaimProcessing
+// for each claim it submits
 func InitiatePRLClaim(uploadsWithUnclaimedPRLs []models.CompletedUpload) {
 	err := ethWrapper.ClaimPRLs(uploadsWithUnclaimedPRLs)
 	if err != nil {
@@ -135,8 +135,6 @@ func InitiatePRLClaim(uploadsWithUnclaimedPRLs []models.CompletedUpload) {
 		raven.CaptureError(err, nil)
 		return
 	}
-	//TODO un-comment this out when ETH stuff works
-	//models.SetPRLStatus(uploadsWithUnclaimedPRLs, models.PRLClaimProcessing)
 }
 
 // purge claims whose PRLStatus is PRLClaimSuccess
@@ -0,0 +1,188 @@
+package jobs
+
+import (
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	raven "github.com/getsentry/raven-go"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+var (
+	// Number of blocks a payment must be buried under before it counts
+	// towards a session. Protects against reorgs.
+	PaymentConfirmations uint64 = 12
+
+	// How many blocks back to scan for payments when the broker starts.
+	PaymentScanLookback uint64 = 5760 // about a day
+
+	lastScannedBlock  uint64
+	watchPaymentsOnce sync.Once
+)
+
+func init() {
+	if confirmations, err := strconv.ParseUint(os.Getenv("PAYMENT_CONFIRMATIONS"), 10, 64); err == nil {
+		PaymentConfirmations = confirmations
+	}
+}
+
+// DetectPayments looks for PRL transfers to upload session invoice addresses
+// and marks sessions paid once their transfers are confirmed.
+func DetectPayments(ethService services.Eth) {
+	if oyster_utils.BrokerMode != oyster_utils.ProdMode {
+		// Sessions are created already paid in the test modes.
+		return
+	}
+
+	watchPaymentsOnce.Do(func() {
+		WatchForPayments(ethService, stopJobs)
+	})
+
+	currentBlock, err := ethService.GetCurrentBlock()
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return
+	}
+
+	ScanForPayments(ethService, currentBlock.NumberU64())
+	ConfirmPayments(ethService, currentBlock.NumberU64())
+}
+
+// WatchForPayments records transfers as soon as the subscription reports
+// them, until done is closed.
+func WatchForPayments(ethService services.Eth, done <-chan struct{}) {
+	transferLogs := make(chan types.Log)
+	ethService.SubscribeToTransfer(transferLogs, done)
+
+	go func() {
+		for transferLog := range transferLogs {
+			RecordTransferLog(transferLog)
+		}
+	}()
+}
+
+// ScanForPayments is the polling fallback for transfers the subscription
+// missed. The last PaymentConfirmations blocks are scanned again on every run
+// so a transfer re-mined after a reorg is picked up again.
+func ScanForPayments(ethService services.Eth, currentBlock uint64) {
+	fromBlock := lastScannedBlock + 1
+	if lastScannedBlock == 0 {
+		fromBlock = blocksBefore(currentBlock, PaymentScanLookback)
+	}
+	if rescanFrom := blocksBefore(currentBlock, PaymentConfirmations); rescanFrom < fromBlock {
+		fromBlock = rescanFrom
+	}
+
+	transferLogs, err := ethService.FilterTransfers(fromBlock, currentBlock)
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return
+	}
+
+	for _, transferLog := range transferLogs {
+		RecordTransferLog(transferLog)
+	}
+	lastScannedBlock = currentBlock
+}
+
+// RecordTransferLog saves a transfer if it pays one of our sessions, or
+// forgets it if a reorg removed it.
+func RecordTransferLog(transferLog types.Log) {
+	toAddr, amount, err := services.DecodeTransferLog(transferLog)
+	if err != nil {
+		return
+	}
+
+	if transferLog.Removed {
+		err = models.RemovePaymentTransfer(transferLog.TxHash.Hex(), int(transferLog.Index))
+		if err != nil {
+			raven.CaptureError(err, nil)
+		}
+		return
+	}
+
+	session, err := models.GetSessionByInvoiceAddress(toAddr.Hex())
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return
+	}
+	if session == nil {
+		// Not a payment to this broker.
+		return
+	}
+
+	err = models.RecordPaymentTransfer(models.PaymentTransfer{
+		TxHash:      transferLog.TxHash.Hex(),
+		LogIndex:    int(transferLog.Index),
+		BlockNumber: int64(transferLog.BlockNumber),
+		BlockHash:   transferLog.BlockHash.Hex(),
+		ToAddr:      toAddr.Hex(),
+		Amount:      oyster_utils.AmountFromWei(amount),
+	})
+	if err != nil {
+		raven.CaptureError(err, nil)
+	}
+}
+
+// ConfirmPayments credits every transfer that has PaymentConfirmations blocks
+// on top of it, after checking its block is still part of the chain.
+func ConfirmPayments(ethService services.Eth, currentBlock uint64) {
+	if currentBlock < PaymentConfirmations {
+		return
+	}
+
+	transfers, err := models.GetUnconfirmedPaymentTransfers(int64(currentBlock - PaymentConfirmations))
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return
+	}
+
+	for _, transfer := range transfers {
+		canonicalHash, err := ethService.GetBlockHash(uint64(transfer.BlockNumber))
+		if err != nil {
+			raven.CaptureError(err, nil)
+			continue
+		}
+
+		if canonicalHash.Hex() != transfer.BlockHash {
+			// Reorged out. ScanForPayments records it again if it was re-mined.
+			err = models.RemovePaymentTransfer(transfer.TxHash, transfer.LogIndex)
+		} else {
+			err = models.ConfirmPaymentTransfer(transfer)
+			if err == nil {
+				publishPaymentReceived(transfer)
+			}
+		}
+		if err != nil {
+			raven.CaptureError(err, nil)
+		}
+	}
+}
+
+func publishPaymentReceived(transfer models.PaymentTransfer) {
+	session, err := models.GetSessionByInvoiceAddress(transfer.ToAddr)
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return
+	}
+	if session == nil {
+		return
+	}
+
+	services.SessionEvents.Publish(services.SessionEvent{
+		Type:          services.EventPaymentReceived,
+		GenesisHash:   session.GenesisHash,
+		PaymentStatus: session.GetPaymentStatus(),
+	})
+}
+
+func blocksBefore(block uint64, count uint64) uint64 {
+	if block < count {
+		return 0
+	}
+	return block - count
+}
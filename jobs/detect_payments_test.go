@@ -0,0 +1,151 @@
+package jobs_test
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/oysterprotocol/brokernode/jobs"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+var (
+	paymentBlockNumber = uint64(100)
+	paymentBlockHash   = common.HexToHash("0x01")
+	transferLogs       []types.Log
+	canonicalBlockHash common.Hash
+)
+
+func (suite *JobsSuite) Test_DetectPayments_Paid() {
+	defer services.SetUpMock()
+
+	session := makePendingSession(suite, "genHashPaid", "0x00000000000000000000000000000000000000a1")
+	transferLogs = []types.Log{makeTransferLog(session.ETHAddrAlpha.String, prl(1), common.HexToHash("0xa1"))}
+	canonicalBlockHash = paymentBlockHash
+
+	runDetectPayments(suite)
+
+	suite.DB.Find(&session, session.ID)
+	suite.Equal(models.PaymentStatusPaid, session.PaymentStatus)
+	suite.Equal("1", session.PaymentReceived.String())
+}
+
+func (suite *JobsSuite) Test_DetectPayments_Underpaid() {
+	defer services.SetUpMock()
+
+	session := makePendingSession(suite, "genHashUnderpaid", "0x00000000000000000000000000000000000000a2")
+	halfPRL := new(big.Int).Div(prl(1), big.NewInt(2))
+	transferLogs = []types.Log{makeTransferLog(session.ETHAddrAlpha.String, halfPRL, common.HexToHash("0xa2"))}
+	canonicalBlockHash = paymentBlockHash
+
+	runDetectPayments(suite)
+
+	suite.DB.Find(&session, session.ID)
+	suite.Equal(models.PaymentStatusUnderpaid, session.PaymentStatus)
+}
+
+func (suite *JobsSuite) Test_DetectPayments_Overpaid() {
+	defer services.SetUpMock()
+
+	session := makePendingSession(suite, "genHashOverpaid", "0x00000000000000000000000000000000000000a3")
+	transferLogs = []types.Log{makeTransferLog(session.ETHAddrAlpha.String, prl(2), common.HexToHash("0xa3"))}
+	canonicalBlockHash = paymentBlockHash
+
+	runDetectPayments(suite)
+
+	suite.DB.Find(&session, session.ID)
+	suite.Equal(models.PaymentStatusOverpaid, session.PaymentStatus)
+}
+
+func (suite *JobsSuite) Test_DetectPayments_Reorged() {
+	defer services.SetUpMock()
+
+	session := makePendingSession(suite, "genHashReorged", "0x00000000000000000000000000000000000000a4")
+	transferLogs = []types.Log{makeTransferLog(session.ETHAddrAlpha.String, prl(1), common.HexToHash("0xa4"))}
+
+	// The block the transfer was mined in is no longer part of the chain.
+	canonicalBlockHash = common.HexToHash("0x02")
+
+	runDetectPayments(suite)
+
+	suite.DB.Find(&session, session.ID)
+	suite.Equal(models.PaymentStatusPending, session.PaymentStatus)
+
+	transfers := []models.PaymentTransfer{}
+	suite.DB.Where("tx_hash = ?", common.HexToHash("0xa4").Hex()).All(&transfers)
+	suite.Equal(0, len(transfers))
+}
+
+func (suite *JobsSuite) Test_DetectPayments_NotEnoughConfirmations() {
+	defer services.SetUpMock()
+
+	session := makePendingSession(suite, "genHashUnconfirmed", "0x00000000000000000000000000000000000000a5")
+	transferLogs = []types.Log{makeTransferLog(session.ETHAddrAlpha.String, prl(1), common.HexToHash("0xa5"))}
+	canonicalBlockHash = paymentBlockHash
+
+	setUpPaymentMocks()
+	jobs.ScanForPayments(EthMock, paymentBlockNumber+1)
+	jobs.ConfirmPayments(EthMock, paymentBlockNumber+1)
+
+	suite.DB.Find(&session, session.ID)
+	suite.Equal(models.PaymentStatusPending, session.PaymentStatus)
+}
+
+func runDetectPayments(suite *JobsSuite) {
+	setUpPaymentMocks()
+
+	currentBlock := paymentBlockNumber + jobs.PaymentConfirmations
+	jobs.ScanForPayments(EthMock, currentBlock)
+	jobs.ConfirmPayments(EthMock, currentBlock)
+}
+
+func setUpPaymentMocks() {
+	EthMock.FilterTransfers = func(fromBlock uint64, toBlock uint64) ([]types.Log, error) {
+		return transferLogs, nil
+	}
+	EthMock.GetBlockHash = func(blockNumber uint64) (common.Hash, error) {
+		return canonicalBlockHash, nil
+	}
+}
+
+func makePendingSession(suite *JobsSuite, genHash string, ethAddr string) models.UploadSession {
+	session := models.UploadSession{
+		GenesisHash:          genHash,
+		NumChunks:            2,
+		FileSizeBytes:        123,
+		StorageLengthInYears: 1,
+		Type:                 models.SessionTypeAlpha,
+		ETHAddrAlpha:         nulls.NewString(common.HexToAddress(ethAddr).Hex()),
+		PaymentStatus:        models.PaymentStatusPending,
+	}
+	_, err := session.StartUploadSession()
+	suite.Nil(err)
+
+	session.TotalCost = oyster_utils.AmountFromUnits(1)
+	suite.Nil(suite.DB.Save(&session))
+
+	return session
+}
+
+func makeTransferLog(toAddr string, amount *big.Int, txHash common.Hash) types.Log {
+	return types.Log{
+		Address: services.OysterPearlAddress,
+		Topics: []common.Hash{
+			services.TransferEventSignature,
+			common.Hash{},
+			common.BytesToHash(common.HexToAddress(toAddr).Bytes()),
+		},
+		Data:        common.LeftPadBytes(amount.Bytes(), 32),
+		BlockNumber: paymentBlockNumber,
+		BlockHash:   paymentBlockHash,
+		TxHash:      txHash,
+	}
+}
+
+func prl(amount int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(amount), big.NewInt(params.Ether))
+}
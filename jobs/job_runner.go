@@ -1,22 +1,47 @@
 package jobs
 
 import (
+	raven "github.com/getsentry/raven-go"
 	"github.com/gobuffalo/buffalo/worker"
+	"github.com/oysterprotocol/brokernode/models"
 	"github.com/oysterprotocol/brokernode/services"
+	"log"
+	"sync"
 	"time"
 )
 
+// How many chunks are sent to a channel at once until it has PoW stats, and
+// how many chunks are verified at once.
 var BundleSize = 30
 
 var OysterWorker = worker.NewSimple()
 
-var IotaWrapper = services.IotaWrapper
+// Set by Start, jobs talking to IOTA use it.
+var IotaWrapper services.IotaService
 var EthWrapper = services.EthWrapper
 
-func init() {
-	registerHandlers(OysterWorker)
+// Closed by Stop, jobs running outside the worker stop with it.
+var stopJobs = make(chan struct{})
+var stopJobsOnce sync.Once
 
-	doWork(OysterWorker)
+// Start registers the job handlers with the worker and schedules the jobs.
+func Start(oysterWorker *worker.Simple, iotaWrapper services.IotaService) {
+	IotaWrapper = iotaWrapper
+
+	registerHandlers(oysterWorker)
+
+	doWork(oysterWorker)
+}
+
+// Stop stops the worker, so no job is run or rescheduled anymore, and the
+// jobs that run outside it.
+func Stop() {
+	stopJobsOnce.Do(func() {
+		if err := OysterWorker.Stop(); err != nil {
+			raven.CaptureError(err, nil)
+		}
+		close(stopJobs)
+	})
 }
 
 func registerHandlers(oysterWorker *worker.Simple) {
@@ -27,6 +52,11 @@ func registerHandlers(oysterWorker *worker.Simple) {
 	oysterWorker.Register("updateTimedOutDataMapsHandler", updateTimedOutDataMapsHandler)
 	oysterWorker.Register("processPaidSessionsHandler", processPaidSessionsHandler)
 	oysterWorker.Register("claimUnusedPRLsHandler", claimUnusedPRLsHandler)
+	oysterWorker.Register("detectPaymentsHandler", detectPaymentsHandler)
+	oysterWorker.Register("sendBrokerHeartbeatsHandler", sendBrokerHeartbeatsHandler)
+	oysterWorker.Register("prunePowRunsHandler", prunePowRunsHandler)
+	oysterWorker.Register("buildDataMapsHandler", buildDataMapsHandler)
+	oysterWorker.Register("claimTreasuresHandler", claimTreasuresHandler)
 }
 
 func doWork(oysterWorker *worker.Simple) {
@@ -86,6 +116,46 @@ func doWork(oysterWorker *worker.Simple) {
 		},
 	}
 
+	detectPaymentsJob := worker.Job{
+		Queue:   "default",
+		Handler: "detectPaymentsHandler",
+		Args: worker.Args{
+			"duration": 30 * time.Second,
+		},
+	}
+
+	sendBrokerHeartbeatsJob := worker.Job{
+		Queue:   "default",
+		Handler: "sendBrokerHeartbeatsHandler",
+		Args: worker.Args{
+			"duration": 60 * time.Second,
+		},
+	}
+
+	prunePowRunsJob := worker.Job{
+		Queue:   "default",
+		Handler: "prunePowRunsHandler",
+		Args: worker.Args{
+			"duration": 10 * time.Minute,
+		},
+	}
+
+	buildDataMapsJob := worker.Job{
+		Queue:   "default",
+		Handler: "buildDataMapsHandler",
+		Args: worker.Args{
+			"duration": 5 * time.Second,
+		},
+	}
+
+	claimTreasuresJob := worker.Job{
+		Queue:   "default",
+		Handler: "claimTreasuresHandler",
+		Args: worker.Args{
+			"duration": 30 * time.Second,
+		},
+	}
+
 	oysterWorker.PerformIn(flushOldWebnodesJob, flushOldWebnodesJob.Args["duration"].(time.Duration))
 	oysterWorker.PerformIn(processUnassignedChunksJob, processUnassignedChunksJob.Args["duration"].(time.Duration))
 	oysterWorker.PerformIn(purgeCompletedSessionsJob, purgeCompletedSessionsJob.Args["duration"].(time.Duration))
@@ -93,6 +163,11 @@ func doWork(oysterWorker *worker.Simple) {
 	oysterWorker.PerformIn(updateTimedOutDataMapsJob, updateTimedOutDataMapsJob.Args["duration"].(time.Duration))
 	oysterWorker.PerformIn(processPaidSessionsJob, processPaidSessionsJob.Args["duration"].(time.Duration))
 	oysterWorker.PerformIn(claimUnusedPRLsJob, claimUnusedPRLsJob.Args["duration"].(time.Duration))
+	oysterWorker.PerformIn(detectPaymentsJob, detectPaymentsJob.Args["duration"].(time.Duration))
+	oysterWorker.PerformIn(sendBrokerHeartbeatsJob, sendBrokerHeartbeatsJob.Args["duration"].(time.Duration))
+	oysterWorker.PerformIn(prunePowRunsJob, prunePowRunsJob.Args["duration"].(time.Duration))
+	oysterWorker.PerformIn(buildDataMapsJob, buildDataMapsJob.Args["duration"].(time.Duration))
+	oysterWorker.PerformIn(claimTreasuresJob, claimTreasuresJob.Args["duration"].(time.Duration))
 }
 
 var flushOldWebnodesHandler = func(args worker.Args) error {
@@ -149,7 +224,7 @@ var verifyDataMapsHandler = func(args worker.Args) error {
 }
 
 var updateTimedOutDataMapsHandler = func(args worker.Args) error {
-	UpdateTimeOutDataMaps(time.Now().Add(-1 * time.Minute))
+	UpdateTimeOutDataMaps(IotaWrapper, time.Now().Add(-1*time.Minute))
 
 	updateTimedOutDataMapsJob := worker.Job{
 		Queue:   "default",
@@ -162,7 +237,13 @@ var updateTimedOutDataMapsHandler = func(args worker.Args) error {
 }
 
 var processPaidSessionsHandler = func(args worker.Args) error {
-	ProcessPaidSessions()
+	// Burying treasures sends transactions, no point while the ethereum node
+	// can't be reached.
+	if err := EthWrapper.CheckHealth(); err != nil {
+		log.Println("Skipping processPaidSessions: " + err.Error())
+	} else {
+		ProcessPaidSessions(EthWrapper)
+	}
 
 	processPaidSessionsJob := worker.Job{
 		Queue:   "default",
@@ -176,7 +257,13 @@ var processPaidSessionsHandler = func(args worker.Args) error {
 
 var claimUnusedPRLsHandler = func(args worker.Args) error {
 	thresholdTime := time.Now().Add(-3 * time.Hour) // consider a transaction timed out if it takes more than 3 hours
-	ClaimUnusedPRLs(EthWrapper, thresholdTime)
+
+	// No point sending transactions while the ethereum node can't be reached.
+	if err := EthWrapper.CheckHealth(); err != nil {
+		log.Println("Skipping claimUnusedPRLs: " + err.Error())
+	} else {
+		ClaimUnusedPRLs(EthWrapper, thresholdTime)
+	}
 
 	claimUnusedPRLsJob := worker.Job{
 		Queue:   "default",
@@ -187,3 +274,78 @@ var claimUnusedPRLsHandler = func(args worker.Args) error {
 
 	return nil
 }
+
+var detectPaymentsHandler = func(args worker.Args) error {
+	if err := EthWrapper.CheckHealth(); err != nil {
+		log.Println("Skipping detectPayments: " + err.Error())
+	} else {
+		DetectPayments(EthWrapper)
+	}
+
+	detectPaymentsJob := worker.Job{
+		Queue:   "default",
+		Handler: "detectPaymentsHandler",
+		Args:    args,
+	}
+	OysterWorker.PerformIn(detectPaymentsJob, detectPaymentsJob.Args["duration"].(time.Duration))
+
+	return nil
+}
+
+var sendBrokerHeartbeatsHandler = func(args worker.Args) error {
+	SendBrokerHeartbeats()
+
+	sendBrokerHeartbeatsJob := worker.Job{
+		Queue:   "default",
+		Handler: "sendBrokerHeartbeatsHandler",
+		Args:    args,
+	}
+	OysterWorker.PerformIn(sendBrokerHeartbeatsJob, sendBrokerHeartbeatsJob.Args["duration"].(time.Duration))
+
+	return nil
+}
+
+var prunePowRunsHandler = func(args worker.Args) error {
+	if err := models.PrunePowRuns(time.Now().Add(-models.PowRunMaxAge)); err != nil {
+		raven.CaptureError(err, nil)
+	}
+
+	prunePowRunsJob := worker.Job{
+		Queue:   "default",
+		Handler: "prunePowRunsHandler",
+		Args:    args,
+	}
+	OysterWorker.PerformIn(prunePowRunsJob, prunePowRunsJob.Args["duration"].(time.Duration))
+
+	return nil
+}
+
+var buildDataMapsHandler = func(args worker.Args) error {
+	BuildDataMaps(time.Minute)
+
+	buildDataMapsJob := worker.Job{
+		Queue:   "default",
+		Handler: "buildDataMapsHandler",
+		Args:    args,
+	}
+	OysterWorker.PerformIn(buildDataMapsJob, buildDataMapsJob.Args["duration"].(time.Duration))
+
+	return nil
+}
+
+var claimTreasuresHandler = func(args worker.Args) error {
+	if err := EthWrapper.CheckHealth(); err != nil {
+		log.Println("Skipping claimTreasures: " + err.Error())
+	} else {
+		ClaimTreasures(EthWrapper)
+	}
+
+	claimTreasuresJob := worker.Job{
+		Queue:   "default",
+		Handler: "claimTreasuresHandler",
+		Args:    args,
+	}
+	OysterWorker.PerformIn(claimTreasuresJob, claimTreasuresJob.Args["duration"].(time.Duration))
+
+	return nil
+}
@@ -5,9 +5,12 @@ import (
 	"github.com/iotaledger/giota"
 	"github.com/oysterprotocol/brokernode/models"
 	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
 	"testing"
 )
 
+const testMasterKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
 var IotaMock services.IotaService
 
 type JobsSuite struct {
@@ -49,6 +52,9 @@ func (suite *JobsSuite) SetupSuite() {
 		ChunksMatch: func(chunkOnTangle giota.Transaction, chunkOnRecord models.DataMap, checkBranchAndTrunk bool) bool {
 			return false
 		},
+		BroadcastTransactions: func(transactions []giota.Transaction) error {
+			return nil
+		},
 	}
 }
 
@@ -63,6 +69,7 @@ func (suite *JobsSuite) SetupSuite() {
 //}
 
 func Test_JobsSuite(t *testing.T) {
+	oyster_utils.SetEthKeyMasterKeys(testMasterKey)
 
 	as := &JobsSuite{suite.NewModel()}
 	suite.Run(t, as)
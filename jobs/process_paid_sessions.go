@@ -4,19 +4,21 @@ import (
 	"errors"
 	"github.com/getsentry/raven-go"
 	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
 	"log"
 )
 
 func init() {
 }
 
-func ProcessPaidSessions() {
+func ProcessPaidSessions(ethService services.Eth) {
 
-	BuryTreasureInDataMaps()
+	BuryTreasureInDataMaps(ethService)
 	MarkBuriedMapsAsUnassigned()
 }
 
-func BuryTreasureInDataMaps() error {
+func BuryTreasureInDataMaps(ethService services.Eth) error {
 
 	unburiedSessions, err := models.GetSessionsThatNeedTreasure()
 
@@ -32,6 +34,22 @@ func BuryTreasureInDataMaps() error {
 			return err
 		}
 
+		if oyster_utils.BrokerMode == oyster_utils.ProdMode {
+			// The treasure only goes into the data maps once its PRL is locked on chain.
+			if err = ethService.BuryPrl(unburiedSession, treasureIndex); err != nil {
+				raven.CaptureError(err, nil)
+			}
+
+			buried, err := models.TreasuresBuried(unburiedSession.GenesisHash, len(treasureIndex))
+			if err != nil {
+				raven.CaptureError(err, nil)
+				continue
+			}
+			if !buried {
+				continue
+			}
+		}
+
 		BuryTreasure(treasureIndex, &unburiedSession)
 	}
 	return nil
@@ -53,7 +71,12 @@ func BuryTreasure(treasureIndexMap []models.TreasureMap, unburiedSession *models
 			raven.CaptureError(err, nil)
 			return err
 		}
-		treasureChunks[0].Message, err = models.CreateTreasurePayload(entry.Key, treasureChunks[0].Hash, models.MaxSideChainLength)
+		treasureKey, err := entry.PrivateKey()
+		if err != nil {
+			raven.CaptureError(err, nil)
+			return err
+		}
+		treasureChunks[0].Message, err = models.CreateTreasurePayload(treasureKey, treasureChunks[0].Hash, models.MaxSideChainLength)
 		if err != nil {
 			raven.CaptureError(err, nil)
 			return err
@@ -65,6 +88,11 @@ func BuryTreasure(treasureIndexMap []models.TreasureMap, unburiedSession *models
 	unburiedSession.TreasureStatus = models.TreasureBuried
 	unburiedSession.SetTreasureMap(treasureIndexMap)
 	models.DB.ValidateAndSave(unburiedSession)
+
+	services.SessionEvents.Publish(services.SessionEvent{
+		Type:        services.EventTreasureBuried,
+		GenesisHash: unburiedSession.GenesisHash,
+	})
 	return nil
 }
 
@@ -2,82 +2,55 @@ package jobs_test
 
 import (
 	"fmt"
-	"github.com/gobuffalo/pop/nulls"
 	"github.com/oysterprotocol/brokernode/jobs"
 	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
 )
 
 func (suite *JobsSuite) Test_ProcessPaidSessions() {
-	fileBytesCount := 500000
+	defer services.SetUpMock()
 
 	// This map seems pointless but it makes the testing
 	// in the for loop later on a bit simpler
 	treasureIndexes := map[int]int{}
 	treasureIndexes[5] = 5
-	treasureIndexes[78] = 78
-	treasureIndexes[199] = 199
+	treasureIndexes[sectorStart(1)+78] = sectorStart(1) + 78
+	treasureIndexes[sectorStart(2)+99] = sectorStart(2) + 99
 
 	// create a dummy TreasureIdxMap for the data maps
 	// that need to get treasure buried
-	testMap1 := `[{
-		"sector": 1,
-		"idx": ` + fmt.Sprint(treasureIndexes[5]) + `,
-		"key": "firstKeyFirstMap"
-		},
-		{ 
-		"sector": 2,
-		"idx": ` + fmt.Sprint(treasureIndexes[78]) + `,
-		"key": "secondKeyFirstMap"
-		},
-		{
-		"sector": 3,
-		"idx": ` + fmt.Sprint(treasureIndexes[199]) + `,
-		"key": "thirdKeyFirstMap"
-		}]`
+	testMap1 := models.TreasureIdxMap{Treasures: []models.TreasureMap{
+		{Sector: 0, Idx: 5, Key: "firstKeyFirstMap"},
+		{Sector: 1, Idx: sectorStart(1) + 78, Key: "secondKeyFirstMap"},
+		{Sector: 2, Idx: sectorStart(2) + 99, Key: "thirdKeyFirstMap"},
+	}}
 
 	// create another dummy TreasureIdxMap for the data maps
 	// who already have treasure buried
-	testMap2 := `[{
-		"sector": 1,
-		"idx": 155,
-		"key": "firstKeySecondMap"
-		},
-		{ 
-		"sector": 2,
-		"idx": 204,
-		"key": "secondKeySecondMap"
-		},
-		{
-		"sector": 3,
-		"idx": 599,
-		"key": "thirdKeySecondMap"
-		}]`
+	testMap2 := models.TreasureIdxMap{Treasures: []models.TreasureMap{
+		{Sector: 0, Idx: 155, Key: "firstKeySecondMap"},
+		{Sector: 1, Idx: sectorStart(1) + 204, Key: "secondKeySecondMap"},
+		{Sector: 2, Idx: sectorStart(2) + 59, Key: "thirdKeySecondMap"},
+	}}
 
 	// create and start the upload session for the data maps that need treasure buried
-	uploadSession1 := models.UploadSession{
+	startMultiSectorSession(suite, models.UploadSession{
 		GenesisHash:    "genHash1",
-		NumChunks:      500,
-		FileSizeBytes:  fileBytesCount,
 		Type:           models.SessionTypeAlpha,
 		PaymentStatus:  models.PaymentStatusPaid,
 		TreasureStatus: models.TreasureUnburied,
-		TreasureIdxMap: nulls.String{string(testMap1), true},
-	}
-
-	uploadSession1.StartUploadSession()
+		TreasureIdxMap: testMap1,
+	})
 
 	// create and start the upload session for the data maps that already have buried treasure
-	uploadSession2 := models.UploadSession{
+	startMultiSectorSession(suite, models.UploadSession{
 		GenesisHash:    "genHash2",
-		NumChunks:      500,
-		FileSizeBytes:  fileBytesCount,
 		Type:           models.SessionTypeAlpha,
 		PaymentStatus:  models.PaymentStatusPaid,
 		TreasureStatus: models.TreasureBuried,
-		TreasureIdxMap: nulls.String{string(testMap2), true},
-	}
-
-	uploadSession2.StartUploadSession()
+		TreasureIdxMap: testMap2,
+	})
 
 	// verify that we have successfully created all the data maps
 	paidButUnburied := []models.DataMap{}
@@ -104,8 +77,10 @@ func (suite *JobsSuite) Test_ProcessPaidSessions() {
 		suite.DB.ValidateAndSave(&dMap)
 	}
 
+	makeEthMocks_process_paid_sessions(&EthMock, models.TreasureBurialSuccess)
+
 	// call method under test
-	jobs.ProcessPaidSessions()
+	jobs.ProcessPaidSessions(EthMock)
 
 	paidButUnburied = []models.DataMap{}
 	err = suite.DB.Where("genesis_hash = ?", "genHash1").All(&paidButUnburied)
@@ -150,3 +125,94 @@ func (suite *JobsSuite) Test_ProcessPaidSessions() {
 		suite.Equal(true, ok)
 	}
 }
+
+func (suite *JobsSuite) Test_ProcessPaidSessions_WaitsForBurialOnChain() {
+	defer services.SetUpMock()
+
+	testMap := models.TreasureIdxMap{Treasures: []models.TreasureMap{
+		{Sector: 0, Idx: 5, Key: "firstKey"},
+		{Sector: 1, Idx: sectorStart(1) + 78, Key: "secondKey"},
+		{Sector: 2, Idx: sectorStart(2) + 99, Key: "thirdKey"},
+	}}
+
+	startMultiSectorSession(suite, models.UploadSession{
+		GenesisHash:    "genHashUnconfirmedBurial",
+		Type:           models.SessionTypeAlpha,
+		PaymentStatus:  models.PaymentStatusPaid,
+		TreasureStatus: models.TreasureUnburied,
+		TreasureIdxMap: testMap,
+	})
+
+	// The PRL transfers have been sent but not mined yet.
+	makeEthMocks_process_paid_sessions(&EthMock, models.TreasureBurialPRLProcessing)
+
+	jobs.ProcessPaidSessions(EthMock)
+
+	session := models.UploadSession{}
+	err := suite.DB.Where("genesis_hash = ?", "genHashUnconfirmedBurial").First(&session)
+	suite.Equal(nil, err)
+	suite.Equal(models.TreasureUnburied, session.TreasureStatus)
+
+	// keys are kept until the burial is done
+	treasureIndex, err := session.GetTreasureMap()
+	suite.Equal(nil, err)
+	for _, entry := range treasureIndex {
+		suite.NotEqual("", entry.Key)
+	}
+
+	dMaps := []models.DataMap{}
+	err = suite.DB.Where("genesis_hash = ?", "genHashUnconfirmedBurial").All(&dMaps)
+	suite.Equal(nil, err)
+	for _, dMap := range dMaps {
+		suite.Equal("", dMap.Message)
+		suite.NotEqual(models.Unassigned, dMap.Status)
+	}
+
+	burials, err := models.GetTreasureBurials("genHashUnconfirmedBurial")
+	suite.Equal(nil, err)
+	suite.Equal(3, len(burials))
+}
+
+// sectorStart returns the chunk_idx sector starts at.
+func sectorStart(sector int) int {
+	return sector * oyster_utils.FileSectorInChunkSize
+}
+
+// startMultiSectorSession saves session as a file of three sectors, with only
+// the data maps around its treasures, as a sector is a million chunks.
+func startMultiSectorSession(suite *JobsSuite, session models.UploadSession) {
+	session.NumChunks = sectorStart(2) + 100
+	session.FileSizeBytes = session.NumChunks * oyster_utils.FileChunkSizeInByte
+	vErr, err := suite.DB.ValidateAndCreate(&session)
+	suite.Nil(err)
+	suite.False(vErr.HasAny())
+
+	for _, treasure := range session.TreasureIdxMap.Treasures {
+		for _, chunkIdx := range []int{treasure.Idx - 1, treasure.Idx, treasure.Idx + 1} {
+			suite.Nil(suite.DB.Create(&models.DataMap{
+				GenesisHash: session.GenesisHash,
+				ChunkIdx:    chunkIdx,
+				Hash:        fmt.Sprint(session.GenesisHash, chunkIdx),
+				Status:      models.Pending,
+			}))
+		}
+	}
+}
+
+func makeEthMocks_process_paid_sessions(ethMock *services.Eth, burialStatus models.TreasureBurialStatus) {
+	ethMock.BuryPrl = func(session models.UploadSession, treasureMap []models.TreasureMap) error {
+		for _, entry := range treasureMap {
+			burial, err := models.FindOrCreateTreasureBurial(models.TreasureBurial{
+				GenesisHash: session.GenesisHash,
+				Idx:         entry.Idx,
+				ETHAddr:     session.GenesisHash + fmt.Sprint(entry.Idx),
+			})
+			if err != nil {
+				return err
+			}
+			burial.Status = burialStatus
+			models.DB.ValidateAndSave(&burial)
+		}
+		return nil
+	}
+}
@@ -21,56 +21,94 @@ func ProcessUnassignedChunks(iotaWrapper services.IotaService) {
 	}
 }
 
+// GetSessionUnassignedChunks sends up to one bundle of unassigned chunks per
+// session to each ready channel, shared out over sessions by Scheduler.
 func GetSessionUnassignedChunks(sessions []models.UploadSession, iotaWrapper services.IotaService) {
+	channels, err := models.GetReadyChannels()
+	if err != nil {
+		raven.CaptureError(err, nil)
+	}
+	if len(channels) <= 0 {
+		return
+	}
+
+	demands := []SessionDemand{}
 	for _, session := range sessions {
-		channels, err := models.GetReadyChannels()
+		unassigned, err := models.CountUnassignedChunksBySession(session)
 		if err != nil {
 			raven.CaptureError(err, nil)
+			continue
 		}
-		if len(channels) <= 0 {
-			break
+		if unassigned > 0 {
+			demands = append(demands, SessionDemand{Session: session, Unassigned: unassigned})
 		}
+	}
+	if len(demands) == 0 {
+		return
+	}
 
-		chunks, err := models.GetUnassignedChunksBySession(session, len(channels)*BundleSize)
-		AssignChunksToChannels(chunks, channels, iotaWrapper)
-		if len(chunks) == len(channels)*BundleSize {
-			// we have used up all the channels, no point in doing the for loop again
-			break
+	channelBundleSizes := make([]int, len(channels))
+	for i, channel := range channels {
+		stats, err := models.GetChannelPowStats(channel.ChannelID)
+		if err != nil {
+			raven.CaptureError(err, nil)
 		}
+		channelBundleSizes[i] = BundleSizeFor(stats)
 	}
-}
 
-func AssignChunksToChannels(chunks []models.DataMap, channels []models.ChunkChannel, iotaWrapper services.IotaService) {
+	// Every channel is offered once for each session, as many bundles as
+	// when each session was sent to every channel in turn.
+	bundleSizes := []int{}
+	for range demands {
+		bundleSizes = append(bundleSizes, channelBundleSizes...)
+	}
 
-	// as long as there are still chunks and still channels this for loop continues
-	for ok, i, j := true, 0, 0; ok; ok = i < len(chunks) && j < len(channels) {
-		end := i + BundleSize
+	bundles := Scheduler.Schedule(demands, bundleSizes)
 
-		if end > len(chunks) {
-			end = len(chunks)
+	// Gets the chunks of each session at once, then splits them into its bundles.
+	chunksNeeded := map[int]int{}
+	for _, bundle := range bundles {
+		chunksNeeded[bundle.Demand] += bundle.Size
+	}
+	chunksByDemand := map[int][]models.DataMap{}
+	for demand, numChunks := range chunksNeeded {
+		chunksByDemand[demand], err = models.GetUnassignedChunksBySession(demands[demand].Session, numChunks)
+		if err != nil {
+			raven.CaptureError(err, nil)
 		}
+	}
 
-		if i >= end {
-			break
+	for i, bundle := range bundles {
+		chunks := chunksByDemand[bundle.Demand]
+		if bundle.Size > len(chunks) {
+			bundle.Size = len(chunks)
+		}
+		if bundle.Size == 0 {
+			continue
 		}
 
-		filteredChunks, err := iotaWrapper.VerifyChunkMessagesMatchRecord(chunks[i:end])
+		SendBundleToChannel(chunks[:bundle.Size], &channels[i%len(channels)], iotaWrapper)
+		chunksByDemand[bundle.Demand] = chunks[bundle.Size:]
+	}
+}
 
-		if err != nil {
-			raven.CaptureError(err, nil)
-		}
-		chunksToSend := append(filteredChunks.NotAttached, filteredChunks.DoesNotMatchTangle...)
+// SendBundleToChannel sends the chunks that are not on the tangle yet to
+// channel, and marks the others Complete.
+func SendBundleToChannel(chunks []models.DataMap, channel *models.ChunkChannel, iotaWrapper services.IotaService) {
+	filteredChunks, err := iotaWrapper.VerifyChunkMessagesMatchRecord(chunks)
 
-		if len(chunksToSend) > 0 {
-			iotaWrapper.SendChunksToChannel(chunksToSend, &channels[j])
-		}
-		if len(filteredChunks.MatchesTangle) > 0 {
-			for _, chunk := range filteredChunks.MatchesTangle {
-				chunk.Status = models.Complete
-				models.DB.ValidateAndSave(&chunk)
-			}
+	if err != nil {
+		raven.CaptureError(err, nil)
+	}
+	chunksToSend := append(filteredChunks.NotAttached, filteredChunks.DoesNotMatchTangle...)
+
+	if len(chunksToSend) > 0 {
+		iotaWrapper.SendChunksToChannel(chunksToSend, channel)
+	}
+	if len(filteredChunks.MatchesTangle) > 0 {
+		for _, chunk := range filteredChunks.MatchesTangle {
+			chunk.Status = models.Complete
+			models.DB.ValidateAndSave(&chunk)
 		}
-		j++
-		i += BundleSize
 	}
 }
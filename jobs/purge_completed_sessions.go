@@ -3,6 +3,7 @@ package jobs
 import (
 	"github.com/gobuffalo/pop"
 	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
 	"log"
 )
 
@@ -11,24 +12,13 @@ func init() {
 
 func PurgeCompletedSessions() {
 
-	var genesisHashesNotComplete = []models.DataMap{}
-	var allGenesisHashesStruct = []models.DataMap{}
-
-	err := models.DB.RawQuery("SELECT distinct genesis_hash FROM data_maps").All(&allGenesisHashesStruct)
+	allGenesisHashes, err := models.DataMapQuery{}.GenesisHashes()
 
 	if err != nil {
 		log.Panic(err)
 	}
 
-	allGenesisHashes := make([]string, 0, len(allGenesisHashesStruct))
-
-	for _, genesisHash := range allGenesisHashesStruct {
-		allGenesisHashes = append(allGenesisHashes, genesisHash.GenesisHash)
-	}
-
-	err = models.DB.RawQuery("SELECT distinct genesis_hash FROM data_maps WHERE status != ? AND status != ?",
-		models.Complete,
-		models.Confirmed).All(&genesisHashesNotComplete)
+	genesisHashesNotComplete, err := models.DataMapQuery{NotStatuses: models.DoneStatuses}.GenesisHashes()
 
 	if err != nil {
 		log.Panic(err)
@@ -37,7 +27,7 @@ func PurgeCompletedSessions() {
 	notComplete := map[string]bool{}
 
 	for _, genesisHash := range genesisHashesNotComplete {
-		notComplete[genesisHash.GenesisHash] = true
+		notComplete[genesisHash] = true
 	}
 
 	var moveToComplete = []models.DataMap{}
@@ -45,11 +35,12 @@ func PurgeCompletedSessions() {
 	for _, genesisHash := range allGenesisHashes {
 		if !notComplete[genesisHash] {
 
-			models.DB.Transaction(func(tx *pop.Connection) error {
-				tx.RawQuery("SELECT * from data_maps WHERE genesis_hash = ?", genesisHash).All(&moveToComplete)
+			err = models.DB.Transaction(func(tx *pop.Connection) error {
+				sessionDataMaps := models.DataMapQuery{GenesisHash: genesisHash}.On(tx)
+				moveToComplete, _ = sessionDataMaps.All()
 				MoveToComplete(tx, moveToComplete) // Passed in the connection
 
-				err = tx.RawQuery("DELETE from data_maps WHERE genesis_hash = ?", genesisHash).All(&[]models.DataMap{})
+				err = sessionDataMaps.Delete()
 				if err != nil {
 					return err
 				}
@@ -83,6 +74,14 @@ func PurgeCompletedSessions() {
 
 				return nil
 			})
+
+			if err == nil {
+				services.SessionEvents.Publish(services.SessionEvent{
+					Type:        services.EventSessionCompleted,
+					GenesisHash: genesisHash,
+					NumChunks:   len(moveToComplete),
+				})
+			}
 		}
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"github.com/gobuffalo/pop/nulls"
 	"github.com/oysterprotocol/brokernode/jobs"
 	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/utils"
 )
 
 func (suite *JobsSuite) Test_PurgeCompletedSessions() {
@@ -138,6 +139,8 @@ func (suite *JobsSuite) Test_PurgeCompletedSessions() {
 	suite.Equal(nil, err)
 
 	suite.Equal("SOME_BETA_ETH_ADDRESS", completedUploads[0].ETHAddr)
-	suite.Equal("SOME_PRIVATE_KEY", completedUploads[0].ETHPrivateKey)
+	ethKey, err := oyster_utils.DecryptEthKey(completedUploads[0].ETHPrivateKey)
+	suite.Equal(nil, err)
+	suite.Equal("SOME_PRIVATE_KEY", ethKey)
 	suite.Equal("genHash1", completedUploads[0].GenesisHash)
 }
@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"os"
+	"strconv"
+
+	raven "github.com/getsentry/raven-go"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+)
+
+// How many chunks this broker takes on at once, set by BROKER_CAPACITY.
+var BrokerCapacity = 1000000
+
+func init() {
+	if capacity, err := strconv.Atoi(os.Getenv("BROKER_CAPACITY")); err == nil {
+		BrokerCapacity = capacity
+	}
+}
+
+// SendBrokerHeartbeats tells every known peer this broker is up and how many
+// more chunks it can take on, registering with the peers that do not know it.
+func SendBrokerHeartbeats() {
+	if services.BrokerEndpoint == "" {
+		return
+	}
+
+	capacity, err := GetBrokerCapacity()
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return
+	}
+
+	peers, err := getPeerEndpoints()
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return
+	}
+
+	for _, peer := range peers {
+		err = services.PostToBroker(peer, "/api/v2/brokernodes/heartbeat", services.BrokerHeartbeatReq{
+			Endpoint: services.BrokerEndpoint,
+			Capacity: capacity,
+		}, &map[string]interface{}{})
+
+		if brokerErr, ok := err.(*services.BrokerError); ok && brokerErr.StatusCode == 404 {
+			err = services.PostToBroker(peer, "/api/v2/brokernodes", services.BrokerRegistrationReq{
+				Endpoint:   services.BrokerEndpoint,
+				EthAddress: services.MainWalletAddress.Hex(),
+				Capacity:   capacity,
+			}, &map[string]interface{}{})
+		}
+		if err != nil {
+			raven.CaptureError(err, nil)
+		}
+	}
+}
+
+// GetBrokerCapacity returns how many more chunks this broker can take on.
+func GetBrokerCapacity() (int, error) {
+	inProgress, err := models.DataMapQuery{NotStatuses: models.DoneStatuses}.Count()
+	if err != nil {
+		return 0, err
+	}
+
+	if inProgress >= BrokerCapacity {
+		return 0, nil
+	}
+	return BrokerCapacity - inProgress, nil
+}
+
+// getPeerEndpoints returns the configured and registered peers, without this
+// broker.
+func getPeerEndpoints() ([]string, error) {
+	brokernodes := []models.Brokernode{}
+	if err := models.DB.Where("endpoint != ''").All(&brokernodes); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{services.BrokerEndpoint: true}
+	var peers []string
+	for _, peer := range services.BrokerPeers {
+		if !seen[peer] {
+			seen[peer] = true
+			peers = append(peers, peer)
+		}
+	}
+	for _, b := range brokernodes {
+		if !seen[b.Endpoint] {
+			seen[b.Endpoint] = true
+			peers = append(peers, b.Endpoint)
+		}
+	}
+	return peers, nil
+}
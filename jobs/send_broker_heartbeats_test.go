@@ -0,0 +1,42 @@
+package jobs_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/oysterprotocol/brokernode/jobs"
+	"github.com/oysterprotocol/brokernode/services"
+)
+
+func (suite *JobsSuite) Test_SendBrokerHeartbeats() {
+	var paths []string
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/api/v2/brokernodes/heartbeat" {
+			// Not registered yet.
+			w.WriteHeader(404)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer peer.Close()
+
+	defer func(endpoint string, peers []string) {
+		services.BrokerEndpoint = endpoint
+		services.BrokerPeers = peers
+	}(services.BrokerEndpoint, services.BrokerPeers)
+	services.BrokerEndpoint = "self"
+	services.BrokerPeers = []string{peer.URL, "self"}
+	services.SetBrokerSecret("testSecret")
+	defer services.SetBrokerSecret("")
+
+	jobs.SendBrokerHeartbeats()
+
+	suite.Equal([]string{"/api/v2/brokernodes/heartbeat", "/api/v2/brokernodes"}, paths)
+}
+
+func (suite *JobsSuite) Test_GetBrokerCapacity() {
+	capacity, err := jobs.GetBrokerCapacity()
+	suite.Nil(err)
+	suite.Equal(jobs.BrokerCapacity, capacity)
+}
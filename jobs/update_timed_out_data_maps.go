@@ -5,16 +5,22 @@ import (
 
 	raven "github.com/getsentry/raven-go"
 	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
 )
 
 func init() {
 }
 
-func UpdateTimeOutDataMaps(thresholdTime time.Time) {
+// UpdateTimeOutDataMaps broadcasts again the chunks that have not been verified
+// since thresholdTime, and sends those whose PoW is lost to be attached again.
+// Chunks still queued in a PoW job are left to the job.
+func UpdateTimeOutDataMaps(iotaWrapper services.IotaService, thresholdTime time.Time) {
 
-	timedOutDataMaps := []models.DataMap{}
-
-	err := models.DB.Where("status = ? AND updated_at <= ?", models.Unverified, thresholdTime).All(&timedOutDataMaps)
+	timedOutDataMaps, err := models.DataMapQuery{
+		Statuses:      []models.DataMapStatus{models.Unverified},
+		UpdatedBefore: thresholdTime,
+		Unqueued:      true,
+	}.All()
 	if err != nil {
 		raven.CaptureError(err, nil)
 	}
@@ -23,7 +29,20 @@ func UpdateTimeOutDataMaps(thresholdTime time.Time) {
 
 		//when we bring back hooknodes, do decrement somewhere in here
 
-		for _, timedOutDataMap := range timedOutDataMaps {
+		transactions, attachedDataMaps, lostDataMaps := services.AttachedTransactions(timedOutDataMaps)
+
+		if len(transactions) > 0 {
+			if err = iotaWrapper.BroadcastTransactions(transactions); err != nil {
+				raven.CaptureError(err, nil)
+			}
+
+			// Waits for them to be verified before checking them again.
+			for _, attachedDataMap := range attachedDataMaps {
+				models.DB.ValidateAndSave(&attachedDataMap)
+			}
+		}
+
+		for _, timedOutDataMap := range lostDataMaps {
 			//go services.SegmentClient.Enqueue(analytics.Track{
 			//	Event:  "chunk_timed_out",
 			//	UserId: services.GetLocalIP(),
@@ -34,6 +53,7 @@ func UpdateTimeOutDataMaps(thresholdTime time.Time) {
 			//})
 
 			timedOutDataMap.Status = models.Unassigned
+			timedOutDataMap.AttachedTrytes = ""
 			models.DB.ValidateAndSave(&timedOutDataMap)
 		}
 	}
@@ -1,8 +1,10 @@
 package jobs_test
 
 import (
+	"github.com/iotaledger/giota"
 	"github.com/oysterprotocol/brokernode/jobs"
 	"github.com/oysterprotocol/brokernode/models"
+	"strings"
 	"time"
 )
 
@@ -28,7 +30,7 @@ func (suite *JobsSuite) Test_UpdateTimedOutDataMaps() {
 	}
 
 	// call method under test, passing in our mock of our iota methods
-	jobs.UpdateTimeOutDataMaps(time.Now().Add(60 * time.Second))
+	jobs.UpdateTimeOutDataMaps(IotaMock, time.Now().Add(60*time.Second))
 
 	allDataMaps = []models.DataMap{}
 	err = suite.DB.All(&allDataMaps)
@@ -43,3 +45,72 @@ func (suite *JobsSuite) Test_UpdateTimedOutDataMaps() {
 		}
 	}
 }
+
+// attachedTrytes returns the trytes of a transaction to address attached at
+// attachedAt.
+func attachedTrytes(address string, attachedAt time.Time) string {
+	tx, _ := giota.NewTransaction(giota.Trytes(strings.Repeat("9", 2673)))
+	tx.Address = giota.Address(address)
+	tx.AttachmentTimestamp = giota.Int2Trits(attachedAt.UnixNano()/int64(time.Millisecond),
+		giota.TimestampTrinarySize).Trytes()
+	return string(tx.Trytes())
+}
+
+func (suite *JobsSuite) Test_UpdateTimedOutDataMaps_BroadcastsKeptPow() {
+	vErr, err := models.BuildDataMaps("genHashKeptPow", 2)
+	suite.Nil(err)
+	suite.Equal(0, len(vErr.Errors))
+
+	dataMaps := []models.DataMap{}
+	suite.Nil(suite.DB.Where("genesis_hash = ?", "genHashKeptPow").Order("chunk_idx asc").All(&dataMaps))
+
+	// The first chunk was attached just now, the second so long ago its PoW is lost.
+	dataMaps[0].AttachedTrytes = attachedTrytes(dataMaps[0].Address, time.Now())
+	dataMaps[1].AttachedTrytes = attachedTrytes(dataMaps[1].Address, time.Now().Add(-time.Hour))
+	for i := range dataMaps {
+		dataMaps[i].Status = models.Unverified
+		suite.DB.ValidateAndSave(&dataMaps[i])
+	}
+
+	var broadcast []giota.Transaction
+	iotaMock := IotaMock
+	iotaMock.BroadcastTransactions = func(transactions []giota.Transaction) error {
+		broadcast = append(broadcast, transactions...)
+		return nil
+	}
+
+	jobs.UpdateTimeOutDataMaps(iotaMock, time.Now().Add(60*time.Second))
+
+	suite.Equal(1, len(broadcast))
+	suite.Equal(giota.Address(dataMaps[0].Address), broadcast[0].Address)
+
+	kept := models.DataMap{}
+	suite.Nil(suite.DB.Find(&kept, dataMaps[0].ID))
+	suite.Equal(models.Unverified, kept.Status)
+	suite.NotEqual("", kept.AttachedTrytes)
+
+	lost := models.DataMap{}
+	suite.Nil(suite.DB.Find(&lost, dataMaps[1].ID))
+	suite.Equal(models.Unassigned, lost.Status)
+	suite.Equal("", lost.AttachedTrytes)
+}
+
+func (suite *JobsSuite) Test_UpdateTimedOutDataMaps_SkipsQueuedPowJobs() {
+	vErr, err := models.BuildDataMaps("genHashQueuedPow", 2)
+	suite.Nil(err)
+	suite.Equal(0, len(vErr.Errors))
+
+	dataMaps := []models.DataMap{}
+	suite.Nil(suite.DB.Where("genesis_hash = ?", "genHashQueuedPow").All(&dataMaps))
+	_, err = models.EnqueuePowJob("CHANNEL", dataMaps, nil)
+	suite.Nil(err)
+
+	jobs.UpdateTimeOutDataMaps(IotaMock, time.Now().Add(60*time.Second))
+
+	for _, dataMap := range dataMaps {
+		queued := models.DataMap{}
+		suite.Nil(suite.DB.Find(&queued, dataMap.ID))
+		suite.Equal(models.Unverified, queued.Status)
+		suite.NotEqual("", queued.PowJobID)
+	}
+}
@@ -11,9 +11,7 @@ func init() {
 
 func VerifyDataMaps(IotaWrapper services.IotaService) {
 
-	unverifiedDataMaps := []models.DataMap{}
-
-	err := models.DB.Where("status = ?", models.Unverified).All(&unverifiedDataMaps)
+	unverifiedDataMaps, err := models.DataMapQuery{Statuses: []models.DataMapStatus{models.Unverified}}.All()
 	if err != nil {
 		raven.CaptureError(err, nil)
 	}
@@ -54,6 +52,8 @@ func CheckChunks(IotaWrapper services.IotaService, unverifiedDataMaps []models.D
 			matchingChunk.Status = models.Complete
 			models.DB.ValidateAndSave(&matchingChunk)
 		}
+
+		services.SessionEvents.PublishChunkEvents(services.EventChunksVerified, filteredChunks.MatchesTangle)
 	}
 
 	if len(filteredChunks.DoesNotMatchTangle) > 0 {
@@ -3,8 +3,12 @@ package main
 import (
 	"github.com/gobuffalo/pop"
 	"github.com/oysterprotocol/brokernode/actions"
+	"github.com/oysterprotocol/brokernode/jobs"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
 	"log"
 	"math/rand"
+	"os"
 	"time"
 )
 
@@ -12,8 +16,41 @@ func main() {
 	pop.Debug = false
 	// Setup rand. See https://til.hashrocket.com/posts/355f31f19c-seeding-golangs-rand
 	rand.Seed(time.Now().Unix())
+
+	// Keys stored before they were encrypted at rest are encrypted before
+	// anything reads them. Nothing starts while any are left in plain text.
+	count, err := models.EncryptPlaintextEthKeys()
+	if err != nil {
+		log.Fatal("Could not encrypt plain text ETH private keys: " + err.Error())
+	}
+	if count > 0 {
+		log.Printf("Encrypted %d plain text ETH private keys", count)
+	}
+
+	iotaConfig, err := services.IotaConfigFromEnv()
+	if err != nil {
+		log.Fatal("Invalid IRI nodes: Check the .env file for IOTA_NODES or HOST_IP")
+	}
+	iotaService, err := services.NewIotaService(iotaConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if jobs.Scheduler, err = jobs.NewChunkScheduler(os.Getenv("CHUNK_SCHEDULER")); err != nil {
+		log.Fatal(err)
+	}
+	if err := iotaService.Start(); err != nil {
+		log.Fatal(err)
+	}
+	jobs.Start(jobs.OysterWorker, *iotaService)
+	actions.IotaWrapper = *iotaService
+
+	// Serve returns once the app is shut down. The jobs are stopped before
+	// the PoW workers they hand chunks to, and both before log.Fatal exits.
 	app := actions.App()
-	if err := app.Serve(); err != nil {
+	err = app.Serve()
+	jobs.Stop()
+	iotaService.Stop()
+	if err != nil {
 		log.Fatal(err)
 	}
 }
@@ -2,20 +2,41 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/gobuffalo/uuid"
 	"github.com/gobuffalo/validate"
 	"github.com/gobuffalo/validate/validators"
+	"math/rand"
 	"time"
 )
 
+/*
+Brokernodes are the peers this broker knows of. A peer registers itself with
+its endpoint, and keeps sending heartbeats with how many more chunks it can
+take on. Peers that have been seen within BrokernodeHeartbeatTimeout and have
+capacity are healthy, and are picked at random as beta brokers, the better
+their reputation the likelier.
+*/
+
 type Brokernode struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
-	Address   string    `json:"address" db:"address"`
+	ID         uuid.UUID  `json:"id" db:"id"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+	Address    string     `json:"address" db:"address"`
+	Endpoint   string     `json:"endpoint" db:"endpoint"`
+	EthAddress string     `json:"eth_address" db:"eth_address"`
+	LastSeenAt nulls.Time `json:"last_seen_at" db:"last_seen_at"`
+	Capacity   int        `json:"capacity" db:"capacity"`
+	Reputation int        `json:"reputation" db:"reputation"`
 }
 
+// Peers that have not sent a heartbeat for this long are not picked as beta.
+var BrokernodeHeartbeatTimeout = 5 * time.Minute
+
+var ErrBrokernodeNotFound = errors.New("brokernode is not registered")
+
 // String is not required by pop and may be deleted
 func (b Brokernode) String() string {
 	jb, _ := json.Marshal(b)
@@ -36,6 +57,7 @@ func (b Brokernodes) String() string {
 func (b *Brokernode) Validate(tx *pop.Connection) (*validate.Errors, error) {
 	return validate.Validate(
 		&validators.StringIsPresent{Field: b.Address, Name: "Address"},
+		&validators.IntIsGreaterThan{Field: b.Capacity, Name: "Capacity", Compared: -1},
 	), nil
 }
 
@@ -50,3 +72,110 @@ func (b *Brokernode) ValidateCreate(tx *pop.Connection) (*validate.Errors, error
 func (b *Brokernode) ValidateUpdate(tx *pop.Connection) (*validate.Errors, error) {
 	return validate.NewErrors(), nil
 }
+
+/**
+ * Methods
+ */
+
+// RegisterBrokernode adds the peer at b.Endpoint, or updates it if it has
+// registered before. Registering counts as a heartbeat.
+func RegisterBrokernode(b Brokernode) (*Brokernode, *validate.Errors, error) {
+	existing, err := GetBrokernodeByEndpoint(b.Endpoint)
+	if err != nil {
+		return nil, validate.NewErrors(), err
+	}
+	if existing != nil {
+		existing.Address = b.Address
+		existing.EthAddress = b.EthAddress
+		existing.Capacity = b.Capacity
+		b = *existing
+	}
+	if b.Address == "" {
+		b.Address = b.Endpoint
+	}
+	b.LastSeenAt = nulls.NewTime(time.Now())
+
+	vErr, err := DB.ValidateAndSave(&b)
+	return &b, vErr, err
+}
+
+// BrokernodeHeartbeat records that the peer at endpoint is up and can take on
+// capacity more chunks.
+func BrokernodeHeartbeat(endpoint string, capacity int) (*Brokernode, error) {
+	b, err := GetBrokernodeByEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, ErrBrokernodeNotFound
+	}
+
+	b.Capacity = capacity
+	b.LastSeenAt = nulls.NewTime(time.Now())
+	_, err = DB.ValidateAndSave(b)
+	return b, err
+}
+
+// GetBrokernodeByEndpoint returns the peer at endpoint, or nil.
+func GetBrokernodeByEndpoint(endpoint string) (*Brokernode, error) {
+	brokernodes := []Brokernode{}
+	err := DB.Where("endpoint = ?", endpoint).All(&brokernodes)
+	if err != nil || len(brokernodes) == 0 {
+		return nil, err
+	}
+	return &brokernodes[0], nil
+}
+
+// GetHealthyBrokernodes returns the peers that have been seen recently and
+// have capacity, best reputation first.
+func GetHealthyBrokernodes() ([]Brokernode, error) {
+	brokernodes := []Brokernode{}
+	err := DB.Where("endpoint != '' AND last_seen_at >= ? AND capacity > 0",
+		time.Now().Add(-BrokernodeHeartbeatTimeout)).
+		Order("reputation desc, capacity desc").All(&brokernodes)
+	return brokernodes, err
+}
+
+// SelectBetaBrokernode picks a healthy peer to start a beta session on, other
+// than selfEndpoint, weighted by reputation so the work is spread out while
+// peers that fail sessions get less of it. Returns nil if there is none.
+func SelectBetaBrokernode(selfEndpoint string) (*Brokernode, error) {
+	brokernodes, err := GetHealthyBrokernodes()
+	if err != nil {
+		return nil, err
+	}
+
+	var peers []Brokernode
+	for _, b := range brokernodes {
+		if b.Endpoint != selfEndpoint {
+			peers = append(peers, b)
+		}
+	}
+	if len(peers) == 0 {
+		return nil, nil
+	}
+
+	// Reputations can be negative, the worst peer is weighted 1. Peers come
+	// best reputation first.
+	minReputation := peers[len(peers)-1].Reputation
+	totalWeight := 0
+	for _, b := range peers {
+		totalWeight += b.Reputation - minReputation + 1
+	}
+
+	pick := rand.Intn(totalWeight)
+	for i, b := range peers {
+		pick -= b.Reputation - minReputation + 1
+		if pick < 0 {
+			return &peers[i], nil
+		}
+	}
+	return &peers[len(peers)-1], nil
+}
+
+// AdjustBrokernodeReputation changes the reputation of the peer at endpoint
+// by delta. Does nothing for peers that are not registered.
+func AdjustBrokernodeReputation(endpoint string, delta int) error {
+	return DB.RawQuery("UPDATE brokernodes SET reputation = reputation + ? WHERE endpoint = ?",
+		delta, endpoint).All(&[]Brokernode{})
+}
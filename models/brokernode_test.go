@@ -1,7 +1,75 @@
-package models
+package models_test
 
-import "testing"
+import (
+	"time"
 
-func Test_Brokernode(t *testing.T) {
-	t.Log("This test needs to be implemented!")
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+func (ms *ModelSuite) Test_RegisterBrokernode() {
+	b, vErr, err := models.RegisterBrokernode(models.Brokernode{Endpoint: "1.2.3.4", Capacity: 10})
+	ms.Nil(err)
+	ms.Equal(0, len(vErr.Errors))
+	ms.Equal("1.2.3.4", b.Address)
+	ms.True(b.LastSeenAt.Valid)
+
+	// Registering again updates the same peer.
+	b, _, err = models.RegisterBrokernode(models.Brokernode{Endpoint: "1.2.3.4", EthAddress: "0xabc", Capacity: 20})
+	ms.Nil(err)
+	ms.Equal("0xabc", b.EthAddress)
+
+	count, err := ms.DB.Count(&models.Brokernode{})
+	ms.Nil(err)
+	ms.Equal(1, count)
+}
+
+func (ms *ModelSuite) Test_BrokernodeHeartbeat() {
+	_, err := models.BrokernodeHeartbeat("1.2.3.4", 10)
+	ms.Equal(models.ErrBrokernodeNotFound, err)
+
+	models.RegisterBrokernode(models.Brokernode{Endpoint: "1.2.3.4", Capacity: 10})
+	b, err := models.BrokernodeHeartbeat("1.2.3.4", 5)
+	ms.Nil(err)
+	ms.Equal(5, b.Capacity)
+}
+
+func (ms *ModelSuite) Test_SelectBetaBrokernode() {
+	b, err := models.SelectBetaBrokernode("self")
+	ms.Nil(err)
+	ms.Nil(b)
+
+	stale := time.Now().Add(-models.BrokernodeHeartbeatTimeout - time.Minute)
+	for _, peer := range []models.Brokernode{
+		{Address: "self", Endpoint: "self", Capacity: 10, Reputation: 10, LastSeenAt: nulls.NewTime(time.Now())},
+		{Address: "stale", Endpoint: "stale", Capacity: 10, Reputation: 10, LastSeenAt: nulls.NewTime(stale)},
+		{Address: "full", Endpoint: "full", Capacity: 0, Reputation: 10, LastSeenAt: nulls.NewTime(time.Now())},
+		{Address: "good", Endpoint: "good", Capacity: 10, Reputation: 1, LastSeenAt: nulls.NewTime(time.Now())},
+		{Address: "bad", Endpoint: "bad", Capacity: 10, Reputation: -1, LastSeenAt: nulls.NewTime(time.Now())},
+	} {
+		peer := peer
+		ms.Nil(ms.DB.Create(&peer))
+	}
+
+	// Only healthy peers are picked, the better reputation more often.
+	picks := selectBetaBrokernodes(ms, 1000)
+	ms.Equal(1000, picks["good"]+picks["bad"])
+	ms.True(picks["good"] > picks["bad"])
+	ms.True(picks["bad"] > 0)
+
+	ms.Nil(models.AdjustBrokernodeReputation("good", -5))
+	picks = selectBetaBrokernodes(ms, 1000)
+	ms.True(picks["bad"] > picks["good"])
+	ms.True(picks["good"] > 0)
+}
+
+// selectBetaBrokernodes counts how many times each peer is picked in n picks.
+func selectBetaBrokernodes(ms *ModelSuite, n int) map[string]int {
+	picks := map[string]int{}
+	for i := 0; i < n; i++ {
+		b, err := models.SelectBetaBrokernode("self")
+		ms.Nil(err)
+		picks[b.Endpoint]++
+	}
+	return picks
 }
@@ -3,6 +3,7 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"math/rand"
 	"sync"
 	"time"
@@ -26,6 +27,9 @@ type ChunkChannel struct {
 	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// Time a chunk is assumed to take until a channel has processed some.
+const DefaultTimePerChunk = 10 * time.Second
+
 var (
 	letters = []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZ")
 	wg      sync.WaitGroup
@@ -95,6 +99,52 @@ func GetOneReadyChannel() (ChunkChannel, error) {
 	return channel, err
 }
 
+// EstimateReadyTime estimates when the channels will have done proof of work
+// on numChunks more chunks, going by when each channel is next ready and its
+// throughput from the rolling PoW stats. Returns the zero time if there are no
+// chunks or no channels to estimate with.
+func EstimateReadyTime(numChunks int) (time.Time, error) {
+	if numChunks <= 0 {
+		return time.Time{}, nil
+	}
+
+	channels := []ChunkChannel{}
+	err := DB.RawQuery("SELECT * from chunk_channels ORDER BY est_ready_time;").All(&channels)
+	if err != nil || len(channels) == 0 {
+		return time.Time{}, err
+	}
+
+	// Seconds from now until each channel is ready, in the order they are.
+	now := time.Now()
+	readyIn := make([]float64, len(channels))
+	throughputs := make([]float64, len(channels))
+	for i, channel := range channels {
+		readyIn[i] = math.Max(channel.EstReadyTime.Sub(now).Seconds(), 0)
+
+		stats, err := GetChannelPowStats(channel.ChannelID)
+		if err != nil {
+			return time.Time{}, err
+		}
+		throughputs[i] = 1 / stats.TimePerChunk().Seconds()
+	}
+
+	// The channels ready by time t have done sum(throughput * (t - readyIn))
+	// chunks. Adds the channels in turn until that reaches numChunks before the
+	// next one is ready.
+	var throughput, backlog, readyAt float64
+	for i := range channels {
+		throughput += throughputs[i]
+		backlog += throughputs[i] * readyIn[i]
+		readyAt = (float64(numChunks) + backlog) / throughput
+		if i+1 == len(channels) || readyAt <= readyIn[i+1] {
+			break
+		}
+	}
+
+	return now.Add(time.Duration(readyAt * float64(time.Second))), nil
+}
+
+// MakeChannels makes sure there are powProcs chunk channels and returns them.
 func MakeChannels(powProcs int) ([]ChunkChannel, error) {
 
 	wg.Add(1)
@@ -103,14 +153,31 @@ func MakeChannels(powProcs int) ([]ChunkChannel, error) {
 	go func(err *error) {
 		defer wg.Done()
 		*err = DB.Transaction(func(DB *pop.Connection) error {
-			err := DB.RawQuery("DELETE from chunk_channels;").All(&[]ChunkChannel{})
+			// Channels are kept across restarts so the PoW jobs queued on
+			// them are still picked up. Only the surplus is removed.
+			existing := []ChunkChannel{}
+			err := DB.RawQuery("SELECT * from chunk_channels ORDER BY created_at;").All(&existing)
 			if err != nil {
 				fmt.Println(err)
 				raven.CaptureError(err, nil)
 				return err
 			}
 
-			for i := 0; i < powProcs; i++ {
+			for i, channel := range existing {
+				if i < powProcs {
+					channel.EstReadyTime = time.Now().Add(-5 * time.Second)
+					_, err = DB.ValidateAndSave(&channel)
+				} else {
+					err = DB.Destroy(&channel)
+				}
+				if err != nil {
+					fmt.Println(err)
+					raven.CaptureError(err, nil)
+					return err
+				}
+			}
+
+			for i := len(existing); i < powProcs; i++ {
 
 				var err error
 				channel := ChunkChannel{}
@@ -10,20 +10,20 @@ import (
 )
 
 type CompletedDataMap struct {
-	ID             int       `json:"id" db:"id"`
-	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt      time.Time `json:"updatedAt" db:"updated_at"`
-	Status         int       `json:"status" db:"status"`
-	NodeID         string    `json:"nodeID" db:"node_id"`
-	NodeType       string    `json:"nodeType" db:"node_type"`
-	Message        string    `json:"message" db:"message"`
-	TrunkTx        string    `json:"trunkTx" db:"trunk_tx"`
-	BranchTx       string    `json:"branchTx" db:"branch_tx"`
-	GenesisHash    string    `json:"genesisHash" db:"genesis_hash"`
-	ChunkIdx       int       `json:"chunkIdx" db:"chunk_idx"`
-	Hash           string    `json:"hash" db:"hash"`
-	ObfuscatedHash string    `json:"obfuscatedHash" db:"obfuscated_hash"`
-	Address        string    `json:"address" db:"address"`
+	ID             int           `json:"id" db:"id"`
+	CreatedAt      time.Time     `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time     `json:"updatedAt" db:"updated_at"`
+	Status         DataMapStatus `json:"status" db:"status"`
+	NodeID         string        `json:"nodeID" db:"node_id"`
+	NodeType       string        `json:"nodeType" db:"node_type"`
+	Message        string        `json:"message" db:"message"`
+	TrunkTx        string        `json:"trunkTx" db:"trunk_tx"`
+	BranchTx       string        `json:"branchTx" db:"branch_tx"`
+	GenesisHash    string        `json:"genesisHash" db:"genesis_hash"`
+	ChunkIdx       int           `json:"chunkIdx" db:"chunk_idx"`
+	Hash           string        `json:"hash" db:"hash"`
+	ObfuscatedHash string        `json:"obfuscatedHash" db:"obfuscated_hash"`
+	Address        string        `json:"address" db:"address"`
 }
 
 func init() {
@@ -65,3 +65,12 @@ func (d *CompletedDataMap) ValidateCreate(tx *pop.Connection) (*validate.Errors,
 func (d *CompletedDataMap) ValidateUpdate(tx *pop.Connection) (*validate.Errors, error) {
 	return validate.NewErrors(), nil
 }
+
+// CountCompletedDataMapsByStatus returns how many completed data maps of
+// genesisHash are in each status.
+func CountCompletedDataMapsByStatus(genesisHash string) (map[DataMapStatus]int, error) {
+	counts := []statusCount{}
+	err := DB.RawQuery("SELECT status, COUNT(*) AS count from completed_data_maps WHERE genesis_hash = ? GROUP BY status",
+		genesisHash).All(&counts)
+	return statusCountsByStatus(counts), err
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/gobuffalo/uuid"
 	"github.com/gobuffalo/validate"
 	"github.com/gobuffalo/validate/validators"
@@ -18,7 +19,8 @@ type CompletedUpload struct {
 	UpdatedAt     time.Time         `json:"updatedAt" db:"updated_at"`
 	GenesisHash   string            `json:"genesisHash" db:"genesis_hash"`
 	ETHAddr       string            `json:"ethAddr" db:"eth_addr"`
-	ETHPrivateKey string            `json:"ethPrivateKey" db:"eth_private_key"`
+	ETHKeyIndex   nulls.Int         `json:"-" db:"eth_key_index"`
+	ETHPrivateKey string            `json:"-" db:"eth_private_key"` // Encrypted, see oyster_utils.EncryptEthKey
 	PRLStatus     PRLClaimStatus    `json:"prlStatus" db:"prl_status"`
 	GasStatus     GasTransferStatus `json:"gasStatus" db:"gas_status"`
 }
@@ -99,6 +101,10 @@ func (c *CompletedUpload) BeforeCreate(tx *pop.Connection) error {
 	return nil
 }
 
+func (c *CompletedUpload) BeforeSave(tx *pop.Connection) error {
+	return encryptEthKey(&c.ETHPrivateKey)
+}
+
 /**
  * Methods
  */
@@ -111,11 +117,13 @@ func NewCompletedUpload(session UploadSession) error {
 		_, err = DB.ValidateAndSave(&CompletedUpload{
 			GenesisHash:   session.GenesisHash,
 			ETHAddr:       session.ETHAddrAlpha.String,
+			ETHKeyIndex:   session.ETHKeyIndex,
 			ETHPrivateKey: session.ETHPrivateKey})
 	case SessionTypeBeta:
 		_, err = DB.ValidateAndSave(&CompletedUpload{
 			GenesisHash:   session.GenesisHash,
 			ETHAddr:       session.ETHAddrBeta.String,
+			ETHKeyIndex:   session.ETHKeyIndex,
 			ETHPrivateKey: session.ETHPrivateKey})
 	default:
 		err = errors.New("no session type provided for session in method models.NewCompletedUpload")
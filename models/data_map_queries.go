@@ -0,0 +1,283 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+)
+
+/*
+A DataMapQuery selects data maps. Every field that is set narrows the query
+down, and a zero query selects every data map. Queries are values, so they can
+be built up and passed around without one caller changing another's query:
+
+	chunks, err := UnassignedDataMaps().ForSession(session).Paginate(1, 100).All()
+*/
+
+var (
+	// Chunks waiting to be sent to a channel. Error'd chunks are sent again.
+	UnassignedStatuses = []DataMapStatus{Unassigned, Error}
+
+	// Chunks that are on the tangle.
+	DoneStatuses = []DataMapStatus{Complete, Confirmed}
+)
+
+// Chunk orders a query can be sorted in, see SortOrder.
+const (
+	ChunkOrderAsc  = "asc"
+	ChunkOrderDesc = "desc"
+)
+
+var ErrUnfilteredDataMapQuery = errors.New("refusing to change every data map")
+
+type DataMapQuery struct {
+	IDs           []uuid.UUID // Any of these data maps
+	GenesisHash   string
+	ChunkIdxs     []int           // At any of these chunk idxs
+	Statuses      []DataMapStatus // Any of these statuses
+	NotStatuses   []DataMapStatus // None of these statuses
+	PowJobID      string          // Queued in this PoW job
+	Unqueued      bool            // Not queued in any PoW job
+	WithMessage   bool            // With a message, so not the treasure chunk before it is buried
+	UpdatedBefore time.Time       // Not updated since
+
+	Order   string // ChunkOrderAsc or ChunkOrderDesc by chunk_idx, unsorted if empty
+	Page    int    // 1 based page of PerPage data maps
+	PerPage int    // Every data map if 0
+
+	tx *pop.Connection
+}
+
+// UnassignedDataMaps returns the query for the chunks waiting to be sent to a
+// channel.
+func UnassignedDataMaps() DataMapQuery {
+	return DataMapQuery{Statuses: UnassignedStatuses}
+}
+
+// ForSession narrows q down to the chunks of session, in the order the
+// session's type sends them in.
+func (q DataMapQuery) ForSession(session UploadSession) DataMapQuery {
+	q.GenesisHash = session.GenesisHash
+	q.Order = SortOrder[session.Type]
+	return q
+}
+
+// Paginate returns page of q, perPage data maps to a page.
+func (q DataMapQuery) Paginate(page int, perPage int) DataMapQuery {
+	q.Page = page
+	q.PerPage = perPage
+	return q
+}
+
+// On runs q on tx instead of DB.
+func (q DataMapQuery) On(tx *pop.Connection) DataMapQuery {
+	q.tx = tx
+	return q
+}
+
+// All returns the data maps q selects.
+func (q DataMapQuery) All() ([]DataMap, error) {
+	dataMaps := []DataMap{}
+	query, err := q.query()
+	if err != nil {
+		return dataMaps, err
+	}
+	err = query.All(&dataMaps)
+	return dataMaps, err
+}
+
+// First returns the first data map q selects.
+func (q DataMapQuery) First() (DataMap, error) {
+	dataMap := DataMap{}
+	query, err := q.query()
+	if err != nil {
+		return dataMap, err
+	}
+	err = query.First(&dataMap)
+	return dataMap, err
+}
+
+// Count returns how many data maps q selects, whatever page it is on.
+func (q DataMapQuery) Count() (int, error) {
+	query, err := q.query()
+	if err != nil {
+		return 0, err
+	}
+	return query.Count(&DataMap{})
+}
+
+// GenesisHashes returns the distinct genesis hashes of the data maps q selects.
+func (q DataMapQuery) GenesisHashes() ([]string, error) {
+	where, args := q.where()
+	if where != "" {
+		where = " WHERE " + where
+	}
+
+	dataMaps := []DataMap{}
+	err := q.conn().RawQuery("SELECT DISTINCT genesis_hash from data_maps"+where, args...).All(&dataMaps)
+
+	genesisHashes := make([]string, 0, len(dataMaps))
+	for _, dataMap := range dataMaps {
+		genesisHashes = append(genesisHashes, dataMap.GenesisHash)
+	}
+	return genesisHashes, err
+}
+
+// StatusCounts returns how many data maps q selects in each status.
+func (q DataMapQuery) StatusCounts() (map[DataMapStatus]int, error) {
+	where, args := q.where()
+	if where != "" {
+		where = " WHERE " + where
+	}
+
+	counts := []statusCount{}
+	err := q.conn().RawQuery("SELECT status, COUNT(*) AS count from data_maps"+where+" GROUP BY status",
+		args...).All(&counts)
+	return statusCountsByStatus(counts), err
+}
+
+// UpdateStatus sets the status of the data maps q selects.
+func (q DataMapQuery) UpdateStatus(status DataMapStatus) error {
+	return q.Update(map[string]interface{}{"status": status})
+}
+
+// Update sets columns, keyed by column name, of the data maps q selects.
+func (q DataMapQuery) Update(columns map[string]interface{}) error {
+	where, args := q.where()
+	if where == "" {
+		return ErrUnfilteredDataMapQuery
+	}
+
+	// Sorted, so the same update is always the same statement.
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	set := ""
+	values := make([]interface{}, 0, len(columns)+1+len(args))
+	for _, name := range names {
+		set += name + " = ?, "
+		values = append(values, columns[name])
+	}
+	values = append(values, time.Now())
+	values = append(values, args...)
+
+	return q.conn().RawQuery("UPDATE data_maps SET "+set+"updated_at = ? WHERE "+where, values...).Exec()
+}
+
+// Delete deletes the data maps q selects.
+func (q DataMapQuery) Delete() error {
+	where, args := q.where()
+	if where == "" {
+		return ErrUnfilteredDataMapQuery
+	}
+
+	return q.conn().RawQuery("DELETE from data_maps WHERE "+where, args...).Exec()
+}
+
+func (q DataMapQuery) conn() *pop.Connection {
+	if q.tx != nil {
+		return q.tx
+	}
+	return DB
+}
+
+func (q DataMapQuery) query() (*pop.Query, error) {
+	query := pop.Q(q.conn())
+	if where, args := q.where(); where != "" {
+		query = query.Where(where, args...)
+	}
+
+	switch q.Order {
+	case "":
+	case ChunkOrderAsc, ChunkOrderDesc:
+		query = query.Order("chunk_idx " + q.Order)
+	default:
+		return nil, errors.New("unknown chunk order " + q.Order)
+	}
+
+	// pop counts every page it paginates, the first page is only limited so
+	// fetching a batch of chunks stays one query.
+	if q.PerPage > 0 && q.Page > 1 {
+		query = query.Paginate(q.Page, q.PerPage)
+	} else if q.PerPage > 0 {
+		query = query.Limit(q.PerPage)
+	}
+	return query, nil
+}
+
+func (q DataMapQuery) where() (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+
+	if len(q.IDs) > 0 {
+		clauses = append(clauses, "id IN ("+placeholders(len(q.IDs))+")")
+		for _, id := range q.IDs {
+			args = append(args, id)
+		}
+	}
+	if q.GenesisHash != "" {
+		clauses = append(clauses, "genesis_hash = ?")
+		args = append(args, q.GenesisHash)
+	}
+	if len(q.ChunkIdxs) > 0 {
+		clauses = append(clauses, "chunk_idx IN ("+placeholders(len(q.ChunkIdxs))+")")
+		for _, chunkIdx := range q.ChunkIdxs {
+			args = append(args, chunkIdx)
+		}
+	}
+	if len(q.Statuses) > 0 {
+		clauses = append(clauses, "status IN ("+placeholders(len(q.Statuses))+")")
+		for _, status := range q.Statuses {
+			args = append(args, status)
+		}
+	}
+	if len(q.NotStatuses) > 0 {
+		clauses = append(clauses, "status NOT IN ("+placeholders(len(q.NotStatuses))+")")
+		for _, status := range q.NotStatuses {
+			args = append(args, status)
+		}
+	}
+	if q.PowJobID != "" {
+		clauses = append(clauses, "pow_job_id = ?")
+		args = append(args, q.PowJobID)
+	}
+	if q.Unqueued {
+		clauses = append(clauses, "pow_job_id = ?")
+		args = append(args, "")
+	}
+	if q.WithMessage {
+		clauses = append(clauses, "message != ?")
+		args = append(args, "")
+	}
+	if !q.UpdatedBefore.IsZero() {
+		clauses = append(clauses, "updated_at <= ?")
+		args = append(args, q.UpdatedBefore)
+	}
+
+	return strings.Join(clauses, " AND "), args
+}
+
+type statusCount struct {
+	Status DataMapStatus `db:"status"`
+	Count  int           `db:"count"`
+}
+
+func statusCountsByStatus(counts []statusCount) map[DataMapStatus]int {
+	byStatus := make(map[DataMapStatus]int, len(counts))
+	for _, count := range counts {
+		byStatus[count.Status] = count.Count
+	}
+	return byStatus
+}
+
+// placeholders returns n comma separated placeholders for an IN clause.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
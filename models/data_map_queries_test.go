@@ -0,0 +1,109 @@
+package models_test
+
+import (
+	"github.com/gobuffalo/uuid"
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+func (suite *ModelSuite) Test_GetUnassignedChunksBySession_OnlyTheSession() {
+	for _, genHash := range []string{"genHashQuery1", "genHashQuery2"} {
+		vErr, err := models.BuildDataMaps(genHash, 4)
+		suite.Nil(err)
+		suite.Equal(0, len(vErr.Errors))
+	}
+
+	// Every chunk of the other session has errored.
+	suite.Nil(suite.DB.RawQuery("UPDATE data_maps SET status = ? WHERE genesis_hash = ?",
+		models.Unassigned, "genHashQuery1").Exec())
+	suite.Nil(suite.DB.RawQuery("UPDATE data_maps SET status = ? WHERE genesis_hash = ?",
+		models.Error, "genHashQuery2").Exec())
+
+	session := models.UploadSession{GenesisHash: "genHashQuery1", Type: models.SessionTypeBeta}
+
+	chunks, err := models.GetAllUnassignedChunksBySession(session)
+	suite.Nil(err)
+	suite.Equal(5, len(chunks))
+	for i, chunk := range chunks {
+		suite.Equal("genHashQuery1", chunk.GenesisHash)
+		if i > 0 {
+			suite.True(chunk.ChunkIdx < chunks[i-1].ChunkIdx)
+		}
+	}
+
+	count, err := models.CountUnassignedChunksBySession(session)
+	suite.Nil(err)
+	suite.Equal(5, count)
+
+	genHashes, err := models.GetUnassignedGenesisHashes()
+	suite.Nil(err)
+	suite.Equal(2, len(genHashes))
+}
+
+func (suite *ModelSuite) Test_DataMapQuery_Paginate() {
+	vErr, err := models.BuildDataMaps("genHashQuery", 4)
+	suite.Nil(err)
+	suite.Equal(0, len(vErr.Errors))
+
+	query := models.DataMapQuery{GenesisHash: "genHashQuery", Order: models.ChunkOrderAsc}
+
+	firstPage, err := query.Paginate(1, 3).All()
+	suite.Nil(err)
+	suite.Equal(3, len(firstPage))
+	suite.Equal(0, firstPage[0].ChunkIdx)
+
+	secondPage, err := query.Paginate(2, 3).All()
+	suite.Nil(err)
+	suite.Equal(2, len(secondPage))
+	suite.Equal(3, secondPage[0].ChunkIdx)
+
+	count, err := query.Paginate(2, 3).Count()
+	suite.Nil(err)
+	suite.Equal(5, count)
+
+	_, err = models.DataMapQuery{Order: "chunk_idx; DROP TABLE data_maps"}.All()
+	suite.NotNil(err)
+}
+
+func (suite *ModelSuite) Test_DataMapQuery_RefusesUnfilteredChanges() {
+	vErr, err := models.BuildDataMaps("genHashQuery", 2)
+	suite.Nil(err)
+	suite.Equal(0, len(vErr.Errors))
+
+	suite.Equal(models.ErrUnfilteredDataMapQuery, models.DataMapQuery{}.UpdateStatus(models.Complete))
+	suite.Equal(models.ErrUnfilteredDataMapQuery, models.DataMapQuery{}.Delete())
+
+	suite.Nil(models.DataMapQuery{GenesisHash: "genHashQuery"}.UpdateStatus(models.Complete))
+	count, err := models.DataMapQuery{Statuses: models.DoneStatuses}.Count()
+	suite.Nil(err)
+	suite.Equal(3, count)
+
+	suite.Nil(models.DataMapQuery{GenesisHash: "genHashQuery"}.Delete())
+	count, err = models.DataMapQuery{}.Count()
+	suite.Nil(err)
+	suite.Equal(0, count)
+}
+
+func (suite *ModelSuite) Test_DataMapQuery_UpdateAndStatusCounts() {
+	vErr, err := models.BuildDataMaps("genHashQuery", 4)
+	suite.Nil(err)
+	suite.Equal(0, len(vErr.Errors))
+
+	chunks, err := models.DataMapQuery{GenesisHash: "genHashQuery", ChunkIdxs: []int{1, 3}}.All()
+	suite.Nil(err)
+	suite.Equal(2, len(chunks))
+
+	query := models.DataMapQuery{IDs: []uuid.UUID{chunks[0].ID, chunks[1].ID}}
+	suite.Nil(query.Update(map[string]interface{}{
+		"status":     models.Unverified,
+		"pow_job_id": "job",
+	}))
+	suite.Equal(models.ErrUnfilteredDataMapQuery, models.DataMapQuery{}.Update(map[string]interface{}{"pow_job_id": ""}))
+
+	queued, err := models.DataMapQuery{PowJobID: "job"}.All()
+	suite.Nil(err)
+	suite.Equal(2, len(queued))
+
+	counts, err := models.DataMapQuery{GenesisHash: "genHashQuery"}.StatusCounts()
+	suite.Nil(err)
+	suite.Equal(map[models.DataMapStatus]int{models.Pending: 3, models.Unverified: 2}, counts)
+}
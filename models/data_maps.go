@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/json"
+	"errors"
 	"github.com/getsentry/raven-go"
 	"math/rand"
 
@@ -30,30 +31,38 @@ const (
 	MaxNumberOfValueForInsertOperation = 50
 )
 
+// How many data maps are built and inserted in one transaction.
+var DataMapsBatchSize = 1000
+
+// DataMapStatus is where a chunk is on its way to the tangle.
+type DataMapStatus int
+
 const (
-	Pending int = iota + 1
+	Pending DataMapStatus = iota + 1
 	Unassigned
 	Unverified
 	Complete
 	Confirmed
-	Error = -1
+	Error DataMapStatus = -1
 )
 
 type DataMap struct {
-	ID             uuid.UUID `json:"id" db:"id"`
-	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt      time.Time `json:"updatedAt" db:"updated_at"`
-	Status         int       `json:"status" db:"status"`
-	NodeID         string    `json:"nodeID" db:"node_id"`
-	NodeType       string    `json:"nodeType" db:"node_type"`
-	Message        string    `json:"message" db:"message"`
-	TrunkTx        string    `json:"trunkTx" db:"trunk_tx"`
-	BranchTx       string    `json:"branchTx" db:"branch_tx"`
-	GenesisHash    string    `json:"genesisHash" db:"genesis_hash"`
-	ChunkIdx       int       `json:"chunkIdx" db:"chunk_idx"`
-	Hash           string    `json:"hash" db:"hash"`
-	ObfuscatedHash string    `json:"obfuscatedHash" db:"obfuscated_hash"`
-	Address        string    `json:"address" db:"address"`
+	ID             uuid.UUID     `json:"id" db:"id"`
+	CreatedAt      time.Time     `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time     `json:"updatedAt" db:"updated_at"`
+	Status         DataMapStatus `json:"status" db:"status"`
+	NodeID         string        `json:"nodeID" db:"node_id"`
+	NodeType       string        `json:"nodeType" db:"node_type"`
+	Message        string        `json:"message" db:"message"`
+	TrunkTx        string        `json:"trunkTx" db:"trunk_tx"`
+	BranchTx       string        `json:"branchTx" db:"branch_tx"`
+	GenesisHash    string        `json:"genesisHash" db:"genesis_hash"`
+	ChunkIdx       int           `json:"chunkIdx" db:"chunk_idx"`
+	Hash           string        `json:"hash" db:"hash"`
+	ObfuscatedHash string        `json:"obfuscatedHash" db:"obfuscated_hash"`
+	Address        string        `json:"address" db:"address"`
+	AttachedTrytes string        `json:"-" db:"attached_trytes"` // Trytes of the transaction the chunk was attached with
+	PowJobID       string        `json:"-" db:"pow_job_id"`      // PoW job the chunk is queued in, if any
 }
 
 type TypeAndChunkMap struct {
@@ -65,8 +74,8 @@ var SortOrder map[int]string
 
 func init() {
 	SortOrder = make(map[int]string, 2)
-	SortOrder[SessionTypeAlpha] = "asc"
-	SortOrder[SessionTypeBeta] = "desc"
+	SortOrder[SessionTypeAlpha] = ChunkOrderAsc
+	SortOrder[SessionTypeBeta] = ChunkOrderDesc
 }
 
 // String is not required by pop and may be deleted
@@ -106,22 +115,57 @@ func (d *DataMap) ValidateUpdate(tx *pop.Connection) (*validate.Errors, error) {
 	return validate.NewErrors(), nil
 }
 
-// BuildDataMaps builds the datamap and inserts them into the DB.
+// BuildDataMaps builds the datamap and inserts them into the DB, DataMapsBatchSize
+// data maps to a transaction.
 func BuildDataMaps(genHash string, numChunks int) (vErr *validate.Errors, err error) {
+	vErr = validate.NewErrors()
+	fileChunksCount := totalDataMaps(numChunks)
 
-	fileChunksCount := numChunks
+	currHash := genHash
+	for start := 0; start < fileChunksCount; start += DataMapsBatchSize {
+		end := start + DataMapsBatchSize
+		if end > fileChunksCount {
+			end = fileChunksCount
+		}
 
-	if oyster_utils.BrokerMode != oyster_utils.TestModeNoTreasure {
-		fileChunksCount = oyster_utils.GetTotalFileChunkIncludingBuriedPearlsUsingNumChunks(numChunks)
+		err = DB.Transaction(func(tx *pop.Connection) error {
+			var err error
+			currHash, vErr, err = buildDataMapsBatch(tx, genHash, currHash, start, end)
+			if err == nil && vErr.HasAny() {
+				err = errors.New(vErr.Error())
+			}
+			return err
+		})
+		if vErr.HasAny() {
+			// The batch was rolled back, the errors are for the caller to render.
+			return vErr, nil
+		}
+		if err != nil {
+			return
+		}
 	}
 
+	return
+}
+
+// totalDataMaps returns how many data maps a file of numChunks chunks takes,
+// the chunks the treasure is buried in included.
+func totalDataMaps(numChunks int) int {
+	if oyster_utils.BrokerMode == oyster_utils.TestModeNoTreasure {
+		return numChunks
+	}
+	return oyster_utils.GetTotalFileChunkIncludingBuriedPearlsUsingNumChunks(numChunks)
+}
+
+// buildDataMapsBatch inserts the data maps of genHash from chunk idx start up
+// to end, currHash being the hash of the one at start. Returns the hash of the
+// data map at end.
+func buildDataMapsBatch(tx *pop.Connection, genHash string, currHash string, start int, end int) (string, *validate.Errors, error) {
 	operation, _ := oyster_utils.CreateDbUpdateOperation(&DataMap{})
 	columnNames := operation.GetColumns()
 	var values []string
 
-	currHash := genHash
-	insertionCount := 0
-	for i := 0; i < fileChunksCount; i++ {
+	for i := start; i < end; i++ {
 		obfuscatedHash := oyster_utils.HashString(currHash, sha512.New384())
 		currAddr := string(oyster_utils.MakeAddress(obfuscatedHash))
 
@@ -134,21 +178,24 @@ func BuildDataMaps(genHash string, numChunks int) (vErr *validate.Errors, err er
 			Status:         Pending,
 		}
 		// Validate the data
-		vErr, _ = dataMap.Validate(nil)
+		if vErr, _ := dataMap.Validate(nil); vErr.HasAny() {
+			return currHash, vErr, nil
+		}
 		values = append(values, fmt.Sprintf("(%s)", operation.GetNewUpdateValue(dataMap)))
 
 		currHash = oyster_utils.HashString(currHash, sha256.New())
 
-		insertionCount++
-		if insertionCount >= MaxNumberOfValueForInsertOperation {
-			err = insertsIntoDataMapsTable(columnNames, strings.Join(values, oyster_utils.COLUMNS_SEPARATOR))
-			insertionCount = 0
+		if len(values) >= MaxNumberOfValueForInsertOperation {
+			err := insertsIntoDataMapsTable(tx, columnNames, strings.Join(values, oyster_utils.COLUMNS_SEPARATOR))
+			if err != nil {
+				return currHash, validate.NewErrors(), err
+			}
 			values = nil
 		}
 	}
-	err = insertsIntoDataMapsTable(columnNames, strings.Join(values, oyster_utils.COLUMNS_SEPARATOR))
 
-	return
+	err := insertsIntoDataMapsTable(tx, columnNames, strings.Join(values, oyster_utils.COLUMNS_SEPARATOR))
+	return currHash, validate.NewErrors(), err
 }
 
 /*@TODO is this file the best place for this method?*/
@@ -166,21 +213,16 @@ func CreateTreasurePayload(ethereumSeed string, sha256Hash string, maxSideChainL
 
 func GetUnassignedGenesisHashes() ([]interface{}, error) {
 
-	var genesisHashesUnassigned = []DataMap{}
-
-	err := DB.RawQuery("SELECT distinct genesis_hash FROM data_maps WHERE status = ? || status = ?",
-		Unassigned,
-		Error).All(&genesisHashesUnassigned)
-
+	genesisHashes, err := UnassignedDataMaps().GenesisHashes()
 	if err != nil {
 		raven.CaptureError(err, nil)
 		return nil, err
 	}
 
-	genHashInterface := make([]interface{}, len(genesisHashesUnassigned))
+	genHashInterface := make([]interface{}, len(genesisHashes))
 
-	for i, genHash := range genesisHashesUnassigned {
-		genHashInterface[i] = genHash.GenesisHash
+	for i, genHash := range genesisHashes {
+		genHashInterface[i] = genHash
 	}
 
 	// return value is an interface like this:
@@ -190,8 +232,7 @@ func GetUnassignedGenesisHashes() ([]interface{}, error) {
 }
 
 func GetUnassignedChunks() (dataMaps []DataMap, err error) {
-	dataMaps = []DataMap{}
-	err = DB.Where("status = ? OR status = ?", Unassigned, Error).All(&dataMaps)
+	dataMaps, err = UnassignedDataMaps().All()
 	if err != nil {
 		raven.CaptureError(err, nil)
 	}
@@ -199,16 +240,7 @@ func GetUnassignedChunks() (dataMaps []DataMap, err error) {
 }
 
 func GetAllUnassignedChunksBySession(session UploadSession) (dataMaps []DataMap, err error) {
-	dataMaps = []DataMap{}
-
-	if session.Type == SessionTypeAlpha {
-		err = DB.Where("genesis_hash = ? AND status = ? OR status = ? ORDER BY chunk_idx asc",
-			session.GenesisHash, Unassigned, Error).All(&dataMaps)
-	} else {
-		err = DB.Where("genesis_hash = ? AND status = ? OR status = ? ORDER BY chunk_idx desc",
-			session.GenesisHash, Unassigned, Error).All(&dataMaps)
-	}
-
+	dataMaps, err = UnassignedDataMaps().ForSession(session).All()
 	if err != nil {
 		raven.CaptureError(err, nil)
 	}
@@ -216,22 +248,19 @@ func GetAllUnassignedChunksBySession(session UploadSession) (dataMaps []DataMap,
 }
 
 func GetUnassignedChunksBySession(session UploadSession, limit int) (dataMaps []DataMap, err error) {
-	dataMaps = []DataMap{}
-
-	if session.Type == SessionTypeAlpha {
-		err = DB.Where("genesis_hash = ? AND status = ? OR status = ? ORDER BY chunk_idx asc LIMIT ?",
-			session.GenesisHash, Unassigned, Error, limit).All(&dataMaps)
-	} else {
-		err = DB.Where("genesis_hash = ? AND status = ? OR status = ? ORDER BY chunk_idx desc LIMIT ?",
-			session.GenesisHash, Unassigned, Error, limit).All(&dataMaps)
-	}
-
+	dataMaps, err = UnassignedDataMaps().ForSession(session).Paginate(1, limit).All()
 	if err != nil {
 		raven.CaptureError(err, nil)
 	}
 	return dataMaps, err
 }
 
+// CountUnassignedChunksBySession returns how many chunks of session are
+// waiting to be sent to a channel.
+func CountUnassignedChunksBySession(session UploadSession) (int, error) {
+	return UnassignedDataMaps().ForSession(session).Count()
+}
+
 func AttachUnassignedChunksToGenHashMap(genesisHashes []interface{}) (map[string]TypeAndChunkMap, error) {
 
 	/* TODO: this method was an attempt at more sophisticated chunk prioritizing but the tests are being
@@ -241,7 +270,6 @@ func AttachUnassignedChunksToGenHashMap(genesisHashes []interface{}) (map[string
 	if len(genesisHashes) > 0 {
 
 		incompleteSessions := []UploadSession{}
-		dataMaps := []DataMap{}
 
 		err := DB.Where("genesis_hash in (?)", genesisHashes...).All(&incompleteSessions)
 
@@ -255,16 +283,10 @@ func AttachUnassignedChunksToGenHashMap(genesisHashes []interface{}) (map[string
 
 		hashAndTypeMap := map[string]TypeAndChunkMap{}
 		for _, session := range incompleteSessions {
-			if session.Type == SessionTypeAlpha {
-				err = DB.RawQuery("SELECT * from data_maps where genesis_hash = ? AND status = ? OR status = ? ORDER BY chunk_idx asc",
-					session.GenesisHash,
-					Unassigned,
-					Error).All(&dataMaps)
-			} else {
-				err = DB.RawQuery("SELECT * from data_maps where genesis_hash = ? AND status = ? OR status = ? ORDER BY chunk_idx desc",
-					session.GenesisHash,
-					Unassigned,
-					Error).All(&dataMaps)
+			dataMaps, err := UnassignedDataMaps().ForSession(session).All()
+			if err != nil {
+				raven.CaptureError(err, nil)
+				return nil, err
 			}
 
 			typeAndChunkMap := TypeAndChunkMap{
@@ -280,21 +302,73 @@ func AttachUnassignedChunksToGenHashMap(genesisHashes []interface{}) (map[string
 	return nil, nil
 }
 
-func insertsIntoDataMapsTable(columnsName string, values string) error {
+// SetDataMapAttachedTrytes keeps the trytes the data map with id was attached
+// to the tangle with.
+func SetDataMapAttachedTrytes(id uuid.UUID, trytes string) error {
+	return DataMapQuery{IDs: []uuid.UUID{id}}.Update(map[string]interface{}{"attached_trytes": trytes})
+}
+
+func insertsIntoDataMapsTable(tx *pop.Connection, columnsName string, values string) error {
 	if len(values) == 0 {
 		return nil
 	}
 
 	rawQuery := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", DataMapTableName, columnsName, values)
-	return DB.RawQuery(rawQuery).All(&[]DataMap{})
+	return tx.RawQuery(rawQuery).All(&[]DataMap{})
+}
+
+// GetDataMapsByChunkIdxs returns the data maps of genesisHash at chunkIdxs,
+// keyed by chunk idx. Chunk idxs without a data map are left out.
+func GetDataMapsByChunkIdxs(genesisHash string, chunkIdxs []int) (map[int]DataMap, error) {
+	dataMapsByIdx := make(map[int]DataMap, len(chunkIdxs))
+	if len(chunkIdxs) == 0 {
+		return dataMapsByIdx, nil
+	}
+
+	dataMaps, err := DataMapQuery{GenesisHash: genesisHash, ChunkIdxs: chunkIdxs}.All()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dataMap := range dataMaps {
+		dataMapsByIdx[dataMap.ChunkIdx] = dataMap
+	}
+	return dataMapsByIdx, nil
+}
+
+// UpsertDataMapMessages writes the messages and statuses of existing data
+// maps in batches. A data map that already holds a message keeps it, so
+// writing the same chunk again is safe.
+func UpsertDataMapMessages(dataMaps []DataMap) error {
+	operation, _ := oyster_utils.CreateDbUpdateOperation(&DataMap{})
+	columnNames := operation.GetColumns()
+
+	for start := 0; start < len(dataMaps); start += MaxNumberOfValueForInsertOperation {
+		end := start + MaxNumberOfValueForInsertOperation
+		if end > len(dataMaps) {
+			end = len(dataMaps)
+		}
+
+		var values []string
+		for _, dataMap := range dataMaps[start:end] {
+			values = append(values, fmt.Sprintf("(%s)", operation.GetUpsertValue(dataMap)))
+		}
+
+		// status is assigned before message, while message still holds its old value.
+		rawQuery := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s ON DUPLICATE KEY UPDATE "+
+			"status = IF(message = '', VALUES(status), status), "+
+			"message = IF(message = '', VALUES(message), message), "+
+			"updated_at = NOW()",
+			DataMapTableName, columnNames, strings.Join(values, oyster_utils.COLUMNS_SEPARATOR))
+		if err := DB.RawQuery(rawQuery).All(&[]DataMap{}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // GetDataMapByGenesisHashAndChunkIdx lets you pass in genesis hash and chunk idx as
 // parameters to get a specific data map
 func GetDataMapByGenesisHashAndChunkIdx(genesisHash string, chunkIdx int) ([]DataMap, error) {
-	dataMaps := []DataMap{}
-	err := DB.Where("genesis_hash = ?",
-		genesisHash).Where("chunk_idx = ?", chunkIdx).All(&dataMaps)
-
-	return dataMaps, err
+	return DataMapQuery{GenesisHash: genesisHash, ChunkIdxs: []int{chunkIdx}}.All()
 }
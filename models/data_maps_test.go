@@ -52,6 +52,35 @@ func (ms *ModelSuite) Test_BuildDataMaps() {
 	}
 }
 
+func (ms *ModelSuite) Test_UpsertDataMapMessages() {
+	genHash := "genHashUpsert"
+	numChunks := models.MaxNumberOfValueForInsertOperation + 10 // More than one batch
+	_, err := models.BuildDataMaps(genHash, numChunks)
+	ms.Nil(err)
+
+	dMaps := []models.DataMap{}
+	ms.Nil(ms.DB.Where("genesis_hash = ?", genHash).Order("chunk_idx asc").All(&dMaps))
+	dMaps[0].Message = "ALREADYSENT"
+	ms.Nil(ms.DB.Save(&dMaps[0]))
+
+	for i := range dMaps {
+		dMaps[i].Message = "NEWMESSAGE"
+		dMaps[i].Status = models.Unassigned
+	}
+	ms.Nil(models.UpsertDataMapMessages(dMaps))
+
+	stored := []models.DataMap{}
+	ms.Nil(ms.DB.Where("genesis_hash = ?", genHash).Order("chunk_idx asc").All(&stored))
+	ms.Equal(len(dMaps), len(stored)) // Updated in place, nothing inserted
+
+	ms.Equal("ALREADYSENT", stored[0].Message)
+	ms.Equal(models.Pending, stored[0].Status)
+	for _, dMap := range stored[1:] {
+		ms.Equal("NEWMESSAGE", dMap.Message)
+		ms.Equal(models.Unassigned, dMap.Status)
+	}
+}
+
 func (ms *ModelSuite) Test_CreateTreasurePayload() {
 	maxSideChainLength := 10
 	matchesFound := 0
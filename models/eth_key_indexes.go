@@ -0,0 +1,100 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+)
+
+// How many indexes ReserveEthKeyIndex tries before giving up.
+const reserveEthKeyIndexAttempts = 5
+
+/*
+An EthKeyIndex is a BIP44 derivation index handed out to a session address.
+Indexes are never reused, even after the sessions using them are purged, so
+no two sessions ever share an address.
+*/
+
+type EthKeyIndex struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+	Idx       int       `json:"idx" db:"idx"`
+}
+
+// String is not required by pop and may be deleted
+func (e EthKeyIndex) String() string {
+	je, _ := json.Marshal(e)
+	return string(je)
+}
+
+// EthKeyIndexes is not required by pop and may be deleted
+type EthKeyIndexes []EthKeyIndex
+
+// String is not required by pop and may be deleted
+func (e EthKeyIndexes) String() string {
+	je, _ := json.Marshal(e)
+	return string(je)
+}
+
+// Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
+// This method is not required and may be deleted.
+func (e *EthKeyIndex) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
+
+// ValidateCreate gets run every time you call "pop.ValidateAndCreate" method.
+// This method is not required and may be deleted.
+func (e *EthKeyIndex) ValidateCreate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
+
+// ValidateUpdate gets run every time you call "pop.ValidateAndUpdate" method.
+// This method is not required and may be deleted.
+func (e *EthKeyIndex) ValidateUpdate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
+
+/**
+ * Methods
+ */
+
+// ReserveEthKeyIndex hands out the next unused derivation index. A caller
+// that loses a race for an index to another broker process tries the next
+// one.
+func ReserveEthKeyIndex() (idx int, err error) {
+	for attempt := 0; attempt < reserveEthKeyIndexAttempts; attempt++ {
+		if idx, err = reserveNextEthKeyIndex(); !isDuplicateKeyError(err) {
+			return idx, err
+		}
+	}
+	return idx, err
+}
+
+func reserveNextEthKeyIndex() (int, error) {
+	reserved := EthKeyIndex{}
+	err := DB.Transaction(func(tx *pop.Connection) error {
+		last := struct {
+			Idx int `db:"idx"`
+		}{}
+		// Locks the index so concurrent sessions cannot reserve the same one.
+		err := tx.RawQuery("SELECT COALESCE(MAX(idx), -1) AS idx from eth_key_indexes FOR UPDATE").First(&last)
+		if err != nil {
+			return err
+		}
+
+		reserved.Idx = last.Idx + 1
+		return tx.Create(&reserved)
+	})
+	return reserved.Idx, err
+}
+
+// isDuplicateKeyError reports whether err is a unique index violation.
+func isDuplicateKeyError(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "Duplicate entry") ||
+		strings.Contains(err.Error(), "duplicate key value"))
+}
@@ -0,0 +1,173 @@
+package models
+
+import (
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+/*
+ETH private keys are only ever stored encrypted. Models encrypt a plain key
+before it is written, and only the eth gateway decrypts them. Treasure keys
+are kept inside upload_sessions.treasure_idx_map rather than in a column of
+their own.
+*/
+
+// Tables holding an eth_private_key column.
+var ethKeyTables = []string{"upload_sessions", "completed_uploads", "treasure_claims"}
+
+type ethKeyRow struct {
+	ID            uuid.UUID    `db:"id"`
+	ETHPrivateKey nulls.String `db:"eth_private_key"`
+}
+
+type treasureKeysRow struct {
+	ID             uuid.UUID      `db:"id"`
+	TreasureIdxMap TreasureIdxMap `db:"treasure_idx_map"`
+}
+
+// encryptEthKey encrypts *ethKey in place unless it is empty or already
+// encrypted.
+func encryptEthKey(ethKey *string) error {
+	if *ethKey == "" || oyster_utils.IsEncryptedEthKey(*ethKey) {
+		return nil
+	}
+
+	encrypted, err := oyster_utils.EncryptEthKey(*ethKey)
+	if err != nil {
+		return err
+	}
+	*ethKey = encrypted
+	return nil
+}
+
+// EncryptPlaintextEthKeys encrypts every key still stored in plain text and
+// returns how many it encrypted.
+func EncryptPlaintextEthKeys() (count int, err error) {
+	err = DB.Transaction(func(tx *pop.Connection) error {
+		for _, table := range ethKeyTables {
+			rows := []ethKeyRow{}
+			err := tx.RawQuery("SELECT id, eth_private_key from "+table+
+				" WHERE eth_private_key IS NOT NULL AND eth_private_key != '' AND eth_private_key NOT LIKE ?",
+				"enc1-%").All(&rows)
+			if err != nil {
+				return err
+			}
+
+			for _, row := range rows {
+				encrypted, err := oyster_utils.EncryptEthKey(row.ETHPrivateKey.String)
+				if err != nil {
+					return err
+				}
+				if err = updateEthKey(tx, table, row.ID, encrypted); err != nil {
+					return err
+				}
+				count++
+			}
+		}
+
+		treasureKeys, err := resealTreasureKeys(tx, func(key string) (string, bool, error) {
+			if oyster_utils.IsEncryptedEthKey(key) {
+				return key, false, nil
+			}
+			encrypted, err := oyster_utils.EncryptEthKey(key)
+			return encrypted, err == nil, err
+		})
+		count += treasureKeys
+		return err
+	})
+	return count, err
+}
+
+// RotateEthKeys re-seals every encrypted key under the current master key
+// and returns how many keys it re-sealed. The master keys the rows are
+// currently sealed with must still be configured as previous master keys.
+func RotateEthKeys() (count int, err error) {
+	err = DB.Transaction(func(tx *pop.Connection) error {
+		for _, table := range ethKeyTables {
+			rows := []ethKeyRow{}
+			err := tx.RawQuery("SELECT id, eth_private_key from "+table+" WHERE eth_private_key LIKE ?",
+				"enc1-%").All(&rows)
+			if err != nil {
+				return err
+			}
+
+			for _, row := range rows {
+				rewrapped, changed, err := oyster_utils.RewrapEthKey(row.ETHPrivateKey.String)
+				if err != nil {
+					return err
+				}
+				if !changed {
+					continue
+				}
+				if err = updateEthKey(tx, table, row.ID, rewrapped); err != nil {
+					return err
+				}
+				count++
+			}
+		}
+
+		treasureKeys, err := resealTreasureKeys(tx, func(key string) (string, bool, error) {
+			if !oyster_utils.IsEncryptedEthKey(key) {
+				return key, false, nil
+			}
+			return oyster_utils.RewrapEthKey(key)
+		})
+		count += treasureKeys
+		return err
+	})
+	return count, err
+}
+
+// resealTreasureKeys replaces every treasure key of every session with what
+// reseal returns for it, and returns how many keys reseal changed.
+func resealTreasureKeys(tx *pop.Connection, reseal func(key string) (string, bool, error)) (count int, err error) {
+	rows := []treasureKeysRow{}
+	err = tx.RawQuery("SELECT id, treasure_idx_map from upload_sessions WHERE treasure_idx_map IS NOT NULL").All(&rows)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, row := range rows {
+		changed := false
+		for i, treasure := range row.TreasureIdxMap.Treasures {
+			if treasure.Key == "" {
+				continue
+			}
+			key, keyChanged, err := reseal(treasure.Key)
+			if err != nil {
+				return count, err
+			}
+			if keyChanged {
+				row.TreasureIdxMap.Treasures[i].Key = key
+				changed = true
+				count++
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		err = tx.RawQuery("UPDATE upload_sessions SET treasure_idx_map = ? WHERE id = ?",
+			row.TreasureIdxMap, row.ID).All(&[]treasureKeysRow{})
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// RestoreEthKey encrypts ethKey and stores it as the private key of the
+// session with sessionID, replacing whatever key it had.
+func RestoreEthKey(sessionID uuid.UUID, ethKey string) error {
+	encrypted, err := oyster_utils.EncryptEthKey(ethKey)
+	if err != nil {
+		return err
+	}
+	return updateEthKey(DB, "upload_sessions", sessionID, encrypted)
+}
+
+func updateEthKey(tx *pop.Connection, table string, id uuid.UUID, ethKey string) error {
+	return tx.RawQuery("UPDATE "+table+" SET eth_private_key = ? WHERE id = ?", ethKey, id).All(&[]ethKeyRow{})
+}
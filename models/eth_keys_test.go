@@ -0,0 +1,171 @@
+package models_test
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+const testNewMasterKey = "1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100"
+
+func (ms *ModelSuite) Test_EthKeysEncryptedOnSave() {
+	session := models.UploadSession{
+		GenesisHash:   "genHashEncrypted",
+		FileSizeBytes: 123,
+		NumChunks:     2,
+		ETHPrivateKey: "SOME_PRIVATE_KEY",
+	}
+	_, err := session.StartUploadSession()
+	ms.Nil(err)
+
+	ms.Nil(models.NewCompletedUpload(session))
+
+	storedSession := models.UploadSession{}
+	ms.Nil(ms.DB.Where("genesis_hash = ?", "genHashEncrypted").First(&storedSession))
+	ms.True(oyster_utils.IsEncryptedEthKey(storedSession.ETHPrivateKey))
+
+	storedUpload := models.CompletedUpload{}
+	ms.Nil(ms.DB.Where("genesis_hash = ?", "genHashEncrypted").First(&storedUpload))
+	ms.True(oyster_utils.IsEncryptedEthKey(storedUpload.ETHPrivateKey))
+
+	ethKey, err := oyster_utils.DecryptEthKey(storedUpload.ETHPrivateKey)
+	ms.Nil(err)
+	ms.Equal("SOME_PRIVATE_KEY", ethKey)
+}
+
+func (ms *ModelSuite) Test_EthKeysNotInJSON() {
+	session := models.UploadSession{ETHPrivateKey: "SOME_PRIVATE_KEY"}
+	upload := models.CompletedUpload{ETHPrivateKey: "SOME_PRIVATE_KEY"}
+
+	ms.False(strings.Contains(session.String(), "SOME_PRIVATE_KEY"))
+	ms.False(strings.Contains(upload.String(), "SOME_PRIVATE_KEY"))
+	ms.False(strings.Contains(models.CompletedUploads{upload}.String(), "SOME_PRIVATE_KEY"))
+}
+
+func (ms *ModelSuite) Test_EncryptPlaintextEthKeys() {
+	upload := models.CompletedUpload{
+		GenesisHash:   "genHashPlaintext",
+		ETHAddr:       "SOME_ETH_ADDRESS_PLAINTEXT",
+		ETHPrivateKey: "SOME_PRIVATE_KEY",
+	}
+	ms.Nil(ms.DB.Create(&upload))
+
+	// Put the key back in plain text, as rows written before keys were encrypted are.
+	err := ms.DB.RawQuery("UPDATE completed_uploads SET eth_private_key = ? WHERE id = ?",
+		"SOME_PRIVATE_KEY", upload.ID).All(&[]models.CompletedUpload{})
+	ms.Nil(err)
+
+	count, err := models.EncryptPlaintextEthKeys()
+	ms.Nil(err)
+	ms.Equal(1, count)
+
+	stored := models.CompletedUpload{}
+	ms.Nil(ms.DB.Find(&stored, upload.ID))
+	ethKey, err := oyster_utils.DecryptEthKey(stored.ETHPrivateKey)
+	ms.Nil(err)
+	ms.Equal("SOME_PRIVATE_KEY", ethKey)
+
+	// Running it again does nothing.
+	count, err = models.EncryptPlaintextEthKeys()
+	ms.Nil(err)
+	ms.Equal(0, count)
+}
+
+func (ms *ModelSuite) Test_RotateEthKeys() {
+	defer oyster_utils.SetEthKeyMasterKeys(testMasterKey)
+
+	upload := models.CompletedUpload{
+		GenesisHash:   "genHashRotate",
+		ETHAddr:       "SOME_ETH_ADDRESS_ROTATE",
+		ETHPrivateKey: "SOME_PRIVATE_KEY",
+	}
+	ms.Nil(ms.DB.Create(&upload))
+
+	oyster_utils.SetEthKeyMasterKeys(testNewMasterKey, testMasterKey)
+	count, err := models.RotateEthKeys()
+	ms.Nil(err)
+	ms.Equal(1, count)
+
+	// The old master key is no longer needed.
+	oyster_utils.SetEthKeyMasterKeys(testNewMasterKey)
+	stored := models.CompletedUpload{}
+	ms.Nil(ms.DB.Find(&stored, upload.ID))
+	ethKey, err := oyster_utils.DecryptEthKey(stored.ETHPrivateKey)
+	ms.Nil(err)
+	ms.Equal("SOME_PRIVATE_KEY", ethKey)
+}
+
+func (ms *ModelSuite) Test_RotateEthKeys_TreasureKeys() {
+	defer oyster_utils.SetEthKeyMasterKeys(testMasterKey)
+
+	session := models.UploadSession{
+		GenesisHash:   "genHashRotateTreasure",
+		FileSizeBytes: 123,
+		NumChunks:     2,
+		ETHPrivateKey: "SOME_PRIVATE_KEY",
+	}
+	session.SetTreasureMap([]models.TreasureMap{{Sector: 0, Idx: 1, Key: "SOME_TREASURE_KEY"}})
+	_, err := session.StartUploadSession()
+	ms.Nil(err)
+
+	oyster_utils.SetEthKeyMasterKeys(testNewMasterKey, testMasterKey)
+	count, err := models.RotateEthKeys()
+	ms.Nil(err)
+	ms.Equal(2, count)
+
+	oyster_utils.SetEthKeyMasterKeys(testNewMasterKey)
+	stored := models.UploadSession{}
+	ms.Nil(ms.DB.Find(&stored, session.ID))
+	treasures, err := stored.GetTreasureMap()
+	ms.Nil(err)
+	ms.Equal(1, len(treasures))
+	treasureKey, err := treasures[0].PrivateKey()
+	ms.Nil(err)
+	ms.Equal("SOME_TREASURE_KEY", treasureKey)
+}
+
+func (ms *ModelSuite) Test_RestoreEthKey() {
+	session := models.UploadSession{
+		GenesisHash:   "genHashRestore",
+		FileSizeBytes: 123,
+		NumChunks:     2,
+		ETHPrivateKey: "SOME_LOST_KEY",
+	}
+	_, err := session.StartUploadSession()
+	ms.Nil(err)
+
+	ms.Nil(models.RestoreEthKey(session.ID, "SOME_PRIVATE_KEY"))
+
+	stored := models.UploadSession{}
+	ms.Nil(ms.DB.Find(&stored, session.ID))
+	ethKey, err := oyster_utils.DecryptEthKey(stored.ETHPrivateKey)
+	ms.Nil(err)
+	ms.Equal("SOME_PRIVATE_KEY", ethKey)
+}
+
+func (ms *ModelSuite) Test_ReserveEthKeyIndex_Concurrent() {
+	const reservations = 10
+
+	idxs := make(chan int, reservations)
+	var wg sync.WaitGroup
+	for i := 0; i < reservations; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			idx, err := models.ReserveEthKeyIndex()
+			ms.Nil(err)
+			idxs <- idx
+		}()
+	}
+	wg.Wait()
+	close(idxs)
+
+	reserved := map[int]bool{}
+	for idx := range idxs {
+		ms.False(reserved[idx], "index %d was handed out twice", idx)
+		reserved[idx] = true
+	}
+	ms.Equal(reservations, len(reserved))
+}
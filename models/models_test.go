@@ -2,14 +2,19 @@ package models_test
 
 import (
 	"github.com/gobuffalo/suite"
+	"github.com/oysterprotocol/brokernode/utils"
 	"testing"
 )
 
+const testMasterKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
 type ModelSuite struct {
 	*suite.Model
 }
 
 func Test_ModelSuite(t *testing.T) {
+	oyster_utils.SetEthKeyMasterKeys(testMasterKey)
+
 	as := &ModelSuite{suite.NewModel()}
 	suite.Run(t, as)
 }
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+/*
+A PaymentTransfer is one PRL Transfer event sent to an upload session's
+invoice address. It only counts towards the session once it is buried under
+enough blocks to be safe from reorgs.
+*/
+
+const (
+	PaymentTransferUnconfirmed int = iota + 1
+	PaymentTransferConfirmed
+)
+
+type PaymentTransfer struct {
+	ID          uuid.UUID           `json:"id" db:"id"`
+	CreatedAt   time.Time           `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time           `json:"updatedAt" db:"updated_at"`
+	TxHash      string              `json:"txHash" db:"tx_hash"`
+	LogIndex    int                 `json:"logIndex" db:"log_index"`
+	BlockNumber int64               `json:"blockNumber" db:"block_number"`
+	BlockHash   string              `json:"blockHash" db:"block_hash"`
+	ToAddr      string              `json:"toAddr" db:"to_addr"`
+	Amount      oyster_utils.Amount `json:"amount" db:"amount"`
+	Status      int                 `json:"status" db:"status"`
+}
+
+// String is not required by pop and may be deleted
+func (p PaymentTransfer) String() string {
+	jp, _ := json.Marshal(p)
+	return string(jp)
+}
+
+// PaymentTransfers is not required by pop and may be deleted
+type PaymentTransfers []PaymentTransfer
+
+// String is not required by pop and may be deleted
+func (p PaymentTransfers) String() string {
+	jp, _ := json.Marshal(p)
+	return string(jp)
+}
+
+// Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
+// This method is not required and may be deleted.
+func (p *PaymentTransfer) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.Validate(
+		&validators.StringIsPresent{Field: p.TxHash, Name: "TxHash"},
+		&validators.StringIsPresent{Field: p.BlockHash, Name: "BlockHash"},
+		&validators.StringIsPresent{Field: p.ToAddr, Name: "ToAddr"},
+	), nil
+}
+
+// ValidateCreate gets run every time you call "pop.ValidateAndCreate" method.
+// This method is not required and may be deleted.
+func (p *PaymentTransfer) ValidateCreate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
+
+// ValidateUpdate gets run every time you call "pop.ValidateAndUpdate" method.
+// This method is not required and may be deleted.
+func (p *PaymentTransfer) ValidateUpdate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
+
+/**
+ * Callbacks
+ */
+
+func (p *PaymentTransfer) BeforeCreate(tx *pop.Connection) error {
+	// Defaults to PaymentTransferUnconfirmed
+	if p.Status == 0 {
+		p.Status = PaymentTransferUnconfirmed
+	}
+	return nil
+}
+
+/**
+ * Methods
+ */
+
+// RecordPaymentTransfer saves a transfer seen on chain. Seeing the same log
+// again, e.g. from both the subscription and the block poller, only refreshes
+// the block it was mined in.
+func RecordPaymentTransfer(transfer PaymentTransfer) error {
+	existing := []PaymentTransfer{}
+	err := DB.Where("tx_hash = ? AND log_index = ?", transfer.TxHash, transfer.LogIndex).All(&existing)
+	if err != nil {
+		return err
+	}
+
+	if len(existing) == 0 {
+		_, err = DB.ValidateAndCreate(&transfer)
+		return err
+	}
+
+	if existing[0].Status == PaymentTransferConfirmed {
+		return nil
+	}
+	existing[0].BlockNumber = transfer.BlockNumber
+	existing[0].BlockHash = transfer.BlockHash
+	_, err = DB.ValidateAndSave(&existing[0])
+	return err
+}
+
+// RemovePaymentTransfer forgets an unconfirmed transfer whose block was
+// reorged out of the chain.
+func RemovePaymentTransfer(txHash string, logIndex int) error {
+	return DB.RawQuery("DELETE from payment_transfers WHERE tx_hash = ? AND log_index = ? AND status = ?",
+		txHash, logIndex, PaymentTransferUnconfirmed).All(&[]PaymentTransfer{})
+}
+
+// GetUnconfirmedPaymentTransfers returns unconfirmed transfers mined at or
+// below maxBlockNumber.
+func GetUnconfirmedPaymentTransfers(maxBlockNumber int64) (transfers []PaymentTransfer, err error) {
+	transfers = []PaymentTransfer{}
+	err = DB.Where("status = ? AND block_number <= ? ORDER BY block_number asc",
+		PaymentTransferUnconfirmed, maxBlockNumber).All(&transfers)
+	return transfers, err
+}
+
+// ConfirmPaymentTransfer marks the transfer as confirmed and credits its
+// amount to the session it paid. Only the payment of the session is written,
+// so changes made to the rest of it meanwhile are kept.
+func ConfirmPaymentTransfer(transfer PaymentTransfer) error {
+	return DB.Transaction(func(tx *pop.Connection) error {
+		session, err := lockSessionByInvoiceAddress(tx, transfer.ToAddr)
+		if err != nil {
+			return err
+		}
+
+		transfer.Status = PaymentTransferConfirmed
+		if _, err = tx.ValidateAndSave(&transfer); err != nil {
+			return err
+		}
+
+		if session == nil {
+			// The session finished and was purged before the payment confirmed.
+			return nil
+		}
+
+		session.ApplyPayment(transfer.Amount)
+		return tx.RawQuery("UPDATE upload_sessions SET payment_received = ?, payment_status = ?, updated_at = ? WHERE id = ?",
+			session.PaymentReceived, session.PaymentStatus, time.Now(), session.ID).Exec()
+	})
+}
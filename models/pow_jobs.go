@@ -0,0 +1,267 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+)
+
+/*
+A PowJob is a bundle of chunks waiting for proof of work on a chunk channel.
+Jobs are kept in the database so queued work outlives the process. A worker
+claims a job with a lease, and a job whose lease runs out, because its worker
+crashed or hung, is claimed again by the next worker that polls. Jobs queued
+on a channel that no longer exists are claimed by any channel.
+*/
+
+const (
+	PowJobQueued int = iota + 1
+	PowJobClaimed
+	PowJobFailed
+)
+
+var (
+	// How long a worker owns a job it claimed.
+	PowJobLeaseDuration = 10 * time.Minute
+
+	// How many times a job is claimed before it fails and its chunks are
+	// sent back to be assigned again.
+	PowJobMaxAttempts = 5
+)
+
+var ErrPowJobLeaseLost = errors.New("pow job is no longer claimed by this worker")
+
+type PowJob struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updatedAt" db:"updated_at"`
+	ChannelID      string     `json:"channelID" db:"channel_id"`
+	BroadcastNodes string     `json:"broadcastNodes" db:"broadcast_nodes"` // Comma separated IRI node URLs
+	Status         int        `json:"status" db:"status"`
+	Attempts       int        `json:"attempts" db:"attempts"`
+	WorkerID       string     `json:"workerID" db:"worker_id"`
+	LeaseExpiresAt nulls.Time `json:"leaseExpiresAt" db:"lease_expires_at"`
+	LastError      string     `json:"lastError" db:"last_error"`
+}
+
+// String is not required by pop and may be deleted
+func (p PowJob) String() string {
+	jp, _ := json.Marshal(p)
+	return string(jp)
+}
+
+// PowJobs is not required by pop and may be deleted
+type PowJobs []PowJob
+
+// String is not required by pop and may be deleted
+func (p PowJobs) String() string {
+	jp, _ := json.Marshal(p)
+	return string(jp)
+}
+
+// Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
+// This method is not required and may be deleted.
+func (p *PowJob) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.Validate(
+		&validators.IntIsGreaterThan{Field: p.Status, Name: "Status", Compared: 0},
+		&validators.IntIsLessThan{Field: p.Status, Name: "Status", Compared: PowJobFailed + 1},
+	), nil
+}
+
+// ValidateCreate gets run every time you call "pop.ValidateAndCreate" method.
+// This method is not required and may be deleted.
+func (p *PowJob) ValidateCreate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
+
+// ValidateUpdate gets run every time you call "pop.ValidateAndUpdate" method.
+// This method is not required and may be deleted.
+func (p *PowJob) ValidateUpdate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
+
+/**
+ * Methods
+ */
+
+// EnqueuePowJob queues chunks for proof of work on the channel with channelID
+// and marks them Unverified.
+func EnqueuePowJob(channelID string, chunks []DataMap, broadcastNodes []string) (PowJob, error) {
+	job := PowJob{
+		ChannelID:      channelID,
+		BroadcastNodes: strings.Join(broadcastNodes, ","),
+		Status:         PowJobQueued,
+	}
+
+	err := DB.Transaction(func(tx *pop.Connection) error {
+		vErr, err := tx.ValidateAndCreate(&job)
+		if err == nil && vErr.HasAny() {
+			err = errors.New(vErr.Error())
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(chunks) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, len(chunks))
+		for i, chunk := range chunks {
+			ids[i] = chunk.ID
+		}
+		return DataMapQuery{IDs: ids}.On(tx).Update(map[string]interface{}{
+			"status":     Unverified,
+			"pow_job_id": job.ID.String(),
+		})
+	})
+
+	return job, err
+}
+
+// ClaimPowJob claims the oldest job workerID may do on the channel with
+// channelID, or returns nil if there is none. Jobs locked by another worker's
+// claim are skipped rather than waited on. A job that has been claimed
+// PowJobMaxAttempts times already is failed instead of claimed again.
+func ClaimPowJob(workerID string, channelID string) (*PowJob, error) {
+	var claimed *PowJob
+
+	err := DB.Transaction(func(tx *pop.Connection) error {
+		jobs := []PowJob{}
+		err := tx.RawQuery("SELECT * from pow_jobs WHERE "+
+			"(status = ? AND (channel_id = ? OR channel_id NOT IN (SELECT channel_id from chunk_channels))) OR "+
+			"(status = ? AND lease_expires_at <= ?) ORDER BY created_at LIMIT 1 FOR UPDATE SKIP LOCKED",
+			PowJobQueued, channelID, PowJobClaimed, time.Now()).All(&jobs)
+		if err != nil || len(jobs) == 0 {
+			return err
+		}
+
+		job := jobs[0]
+		if job.Attempts >= PowJobMaxAttempts {
+			if job.LastError == "" {
+				job.LastError = "lease expired"
+			}
+			return failPowJob(tx, &job)
+		}
+
+		job.ChannelID = channelID
+		job.WorkerID = workerID
+		job.Status = PowJobClaimed
+		job.Attempts++
+		job.LeaseExpiresAt = nulls.NewTime(time.Now().Add(PowJobLeaseDuration))
+		if _, err = tx.ValidateAndSave(&job); err != nil {
+			return err
+		}
+
+		claimed = &job
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// RenewLease extends the lease of a job the worker still owns by
+// PowJobLeaseDuration, so a job that runs longer than one lease is not
+// claimed by another worker.
+func (p *PowJob) RenewLease() error {
+	leaseExpiresAt := nulls.NewTime(time.Now().Add(PowJobLeaseDuration))
+	count, err := DB.RawQuery("UPDATE pow_jobs SET lease_expires_at = ?, updated_at = ? WHERE id = ? AND worker_id = ? AND status = ?",
+		leaseExpiresAt, time.Now(), p.ID, p.WorkerID, PowJobClaimed).ExecWithCount()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrPowJobLeaseLost
+	}
+
+	p.LeaseExpiresAt = leaseExpiresAt
+	return nil
+}
+
+// DataMaps returns the chunks of the job.
+func (p *PowJob) DataMaps() ([]DataMap, error) {
+	return DataMapQuery{PowJobID: p.ID.String(), Order: ChunkOrderAsc}.All()
+}
+
+// Nodes returns the IRI nodes the job should be broadcast to.
+func (p *PowJob) Nodes() []string {
+	if p.BroadcastNodes == "" {
+		return nil
+	}
+	return strings.Split(p.BroadcastNodes, ",")
+}
+
+// Complete removes the job once its chunks have been attached. Its chunks
+// stay Unverified until they are verified on the tangle.
+func (p *PowJob) Complete() error {
+	return DB.Transaction(func(tx *pop.Connection) error {
+		count, err := tx.RawQuery("DELETE from pow_jobs WHERE id = ? AND worker_id = ? AND status = ?",
+			p.ID, p.WorkerID, PowJobClaimed).ExecWithCount()
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrPowJobLeaseLost
+		}
+
+		return DataMapQuery{PowJobID: p.ID.String()}.On(tx).Update(map[string]interface{}{"pow_job_id": ""})
+	})
+}
+
+// Fail queues the job again after cause, or fails it once it has been tried
+// PowJobMaxAttempts times.
+func (p *PowJob) Fail(cause error) error {
+	p.LastError = cause.Error()
+	if len(p.LastError) > 255 {
+		p.LastError = p.LastError[:255]
+	}
+
+	return DB.Transaction(func(tx *pop.Connection) error {
+		jobs := []PowJob{}
+		err := tx.RawQuery("SELECT * from pow_jobs WHERE id = ? AND worker_id = ? AND status = ? FOR UPDATE",
+			p.ID, p.WorkerID, PowJobClaimed).All(&jobs)
+		if err != nil {
+			return err
+		}
+		if len(jobs) == 0 {
+			return ErrPowJobLeaseLost
+		}
+
+		jobs[0].LastError = p.LastError
+		if jobs[0].Attempts >= PowJobMaxAttempts {
+			err = failPowJob(tx, &jobs[0])
+		} else {
+			jobs[0].Status = PowJobQueued
+			jobs[0].WorkerID = ""
+			jobs[0].LeaseExpiresAt = nulls.Time{}
+			_, err = tx.ValidateAndSave(&jobs[0])
+		}
+		*p = jobs[0]
+		return err
+	})
+}
+
+// failPowJob fails job and sends its chunks back to be assigned again.
+func failPowJob(tx *pop.Connection, job *PowJob) error {
+	job.Status = PowJobFailed
+	job.WorkerID = ""
+	job.LeaseExpiresAt = nulls.Time{}
+	if _, err := tx.ValidateAndSave(job); err != nil {
+		return err
+	}
+
+	return DataMapQuery{PowJobID: job.ID.String()}.On(tx).Update(map[string]interface{}{
+		"status":     Unassigned,
+		"pow_job_id": "",
+	})
+}
@@ -0,0 +1,151 @@
+package models_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+func (ms *ModelSuite) enqueueTestPowJob(channelID string) (models.PowJob, []models.DataMap) {
+	_, err := models.BuildDataMaps("genHashPowJob", 2)
+	ms.Nil(err)
+
+	chunks := []models.DataMap{}
+	ms.Nil(ms.DB.Where("genesis_hash = ?", "genHashPowJob").All(&chunks))
+
+	job, err := models.EnqueuePowJob(channelID, chunks, []string{"http://node1:14265", "http://node2:14265"})
+	ms.Nil(err)
+	return job, chunks
+}
+
+func (ms *ModelSuite) Test_EnqueuePowJob() {
+	job, chunks := ms.enqueueTestPowJob("CHANNEL")
+
+	ms.Equal(models.PowJobQueued, job.Status)
+	ms.Equal([]string{"http://node1:14265", "http://node2:14265"}, job.Nodes())
+
+	queued, err := job.DataMaps()
+	ms.Nil(err)
+	ms.Equal(len(chunks), len(queued))
+	for _, chunk := range queued {
+		ms.Equal(models.Unverified, chunk.Status)
+	}
+}
+
+func (ms *ModelSuite) Test_ClaimPowJob() {
+	ms.Nil(ms.DB.Create(&models.ChunkChannel{ChannelID: "CHANNEL", EstReadyTime: time.Now()}))
+	ms.Nil(ms.DB.Create(&models.ChunkChannel{ChannelID: "OTHER", EstReadyTime: time.Now()}))
+	ms.enqueueTestPowJob("CHANNEL")
+
+	// Another channel that still exists leaves the job to its own channel.
+	job, err := models.ClaimPowJob("worker-other", "OTHER")
+	ms.Nil(err)
+	ms.Nil(job)
+
+	job, err = models.ClaimPowJob("worker", "CHANNEL")
+	ms.Nil(err)
+	ms.NotNil(job)
+	ms.Equal(models.PowJobClaimed, job.Status)
+	ms.Equal("worker", job.WorkerID)
+	ms.Equal(1, job.Attempts)
+	ms.True(job.LeaseExpiresAt.Time.After(time.Now()))
+
+	// A claimed job is not claimed again while its lease lasts.
+	again, err := models.ClaimPowJob("worker", "CHANNEL")
+	ms.Nil(err)
+	ms.Nil(again)
+}
+
+func (ms *ModelSuite) Test_ClaimPowJob_OrphanedChannel() {
+	ms.enqueueTestPowJob("GONE")
+
+	job, err := models.ClaimPowJob("worker", "CHANNEL")
+	ms.Nil(err)
+	ms.NotNil(job)
+	ms.Equal("CHANNEL", job.ChannelID)
+}
+
+func (ms *ModelSuite) Test_ClaimPowJob_ExpiredLease() {
+	ms.enqueueTestPowJob("CHANNEL")
+
+	crashed, err := models.ClaimPowJob("crashed-worker", "CHANNEL")
+	ms.Nil(err)
+	crashed.LeaseExpiresAt = nulls.NewTime(time.Now().Add(-time.Minute))
+	ms.Nil(ms.DB.Save(crashed))
+
+	job, err := models.ClaimPowJob("worker", "CHANNEL")
+	ms.Nil(err)
+	ms.NotNil(job)
+	ms.Equal(crashed.ID, job.ID)
+	ms.Equal(2, job.Attempts)
+
+	// The crashed worker no longer owns the job.
+	ms.Equal(models.ErrPowJobLeaseLost, crashed.Complete())
+	ms.Nil(job.Complete())
+}
+
+func (ms *ModelSuite) Test_PowJobRenewLease() {
+	ms.enqueueTestPowJob("CHANNEL")
+
+	job, err := models.ClaimPowJob("worker", "CHANNEL")
+	ms.Nil(err)
+	job.LeaseExpiresAt = nulls.NewTime(time.Now().Add(time.Second))
+	ms.Nil(ms.DB.Save(job))
+
+	ms.Nil(job.RenewLease())
+	ms.True(job.LeaseExpiresAt.Time.After(time.Now().Add(models.PowJobLeaseDuration - time.Minute)))
+
+	renewed := models.PowJob{}
+	ms.Nil(ms.DB.Find(&renewed, job.ID))
+	ms.True(renewed.LeaseExpiresAt.Time.After(time.Now().Add(time.Minute)))
+
+	// A worker whose job was claimed again cannot renew it.
+	stale := *job
+	stale.WorkerID = "crashed-worker"
+	ms.Equal(models.ErrPowJobLeaseLost, stale.RenewLease())
+}
+
+func (ms *ModelSuite) Test_PowJobComplete() {
+	ms.enqueueTestPowJob("CHANNEL")
+	job, _ := models.ClaimPowJob("worker", "CHANNEL")
+
+	ms.Nil(job.Complete())
+
+	count, err := ms.DB.Count(&models.PowJob{})
+	ms.Nil(err)
+	ms.Equal(0, count)
+
+	queued, err := job.DataMaps()
+	ms.Nil(err)
+	ms.Equal(0, len(queued))
+}
+
+func (ms *ModelSuite) Test_PowJobFail() {
+	defer func(maxAttempts int) { models.PowJobMaxAttempts = maxAttempts }(models.PowJobMaxAttempts)
+	models.PowJobMaxAttempts = 2
+
+	_, chunks := ms.enqueueTestPowJob("CHANNEL")
+
+	// Queued again while it has attempts left.
+	job, _ := models.ClaimPowJob("worker", "CHANNEL")
+	ms.Nil(job.Fail(errors.New("pow failed")))
+	ms.Equal(models.PowJobQueued, job.Status)
+	ms.Equal("pow failed", job.LastError)
+
+	// Failed once it has used them up, and its chunks are assigned again.
+	job, _ = models.ClaimPowJob("worker", "CHANNEL")
+	ms.Nil(job.Fail(errors.New("pow failed")))
+	ms.Equal(models.PowJobFailed, job.Status)
+
+	for _, chunk := range chunks {
+		ms.Nil(ms.DB.Find(&chunk, chunk.ID))
+		ms.Equal(models.Unassigned, chunk.Status)
+		ms.Equal("", chunk.PowJobID)
+	}
+
+	job, err := models.ClaimPowJob("worker", "CHANNEL")
+	ms.Nil(err)
+	ms.Nil(job)
+}
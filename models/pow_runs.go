@@ -0,0 +1,219 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+)
+
+/*
+A PowRun records one bundle of proof of work, either by a chunk channel or by
+a PoW provider. The rolling stats of a channel or provider are worked out from
+its last PowStatsWindow runs, and are what ready times are estimated with.
+*/
+
+var (
+	// How many of the last runs the stats are worked out from.
+	PowStatsWindow = 100
+
+	// Runs older than this are pruned.
+	PowRunMaxAge = 24 * time.Hour
+)
+
+type PowRun struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt  time.Time `json:"updatedAt" db:"updated_at"`
+	ChannelID  string    `json:"channelID" db:"channel_id"` // Set on the runs of a chunk channel
+	Provider   string    `json:"provider" db:"provider"`    // Set on the runs of a PoW provider
+	ChunkCount int       `json:"chunkCount" db:"chunk_count"`
+	ElapsedMs  int       `json:"elapsedMs" db:"elapsed_ms"`
+	Failed     bool      `json:"failed" db:"failed"`
+}
+
+// PowStats are the rolling stats of a chunk channel or PoW provider.
+type PowStats struct {
+	Name             string  `json:"name"`
+	Runs             int     `json:"runs"`
+	ChunksPerSecond  float64 `json:"chunksPerSecond"`
+	P50BundleSeconds float64 `json:"p50BundleSeconds"`
+	P95BundleSeconds float64 `json:"p95BundleSeconds"`
+	FailureRate      float64 `json:"failureRate"`
+}
+
+// String is not required by pop and may be deleted
+func (p PowRun) String() string {
+	jp, _ := json.Marshal(p)
+	return string(jp)
+}
+
+// PowRuns is not required by pop and may be deleted
+type PowRuns []PowRun
+
+// String is not required by pop and may be deleted
+func (p PowRuns) String() string {
+	jp, _ := json.Marshal(p)
+	return string(jp)
+}
+
+// Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
+// This method is not required and may be deleted.
+func (p *PowRun) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.Validate(
+		&validators.IntIsGreaterThan{Field: p.ChunkCount, Name: "ChunkCount", Compared: -1},
+		&validators.IntIsGreaterThan{Field: p.ElapsedMs, Name: "ElapsedMs", Compared: -1},
+	), nil
+}
+
+// ValidateCreate gets run every time you call "pop.ValidateAndCreate" method.
+// This method is not required and may be deleted.
+func (p *PowRun) ValidateCreate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
+
+// ValidateUpdate gets run every time you call "pop.ValidateAndUpdate" method.
+// This method is not required and may be deleted.
+func (p *PowRun) ValidateUpdate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
+
+/**
+ * Methods
+ */
+
+// RecordChannelPowRun records that the channel with channelID did the PoW for
+// numChunks chunks since startTime, or failed to.
+func RecordChannelPowRun(channelID string, startTime time.Time, numChunks int, failed bool) error {
+	return recordPowRun(PowRun{ChannelID: channelID}, startTime, numChunks, failed)
+}
+
+// RecordProviderPowRun records that provider did the PoW for numChunks chunks
+// since startTime, or failed to.
+func RecordProviderPowRun(provider string, startTime time.Time, numChunks int, failed bool) error {
+	return recordPowRun(PowRun{Provider: provider}, startTime, numChunks, failed)
+}
+
+func recordPowRun(run PowRun, startTime time.Time, numChunks int, failed bool) error {
+	run.ChunkCount = numChunks
+	run.ElapsedMs = int(time.Since(startTime) / time.Millisecond)
+	run.Failed = failed
+
+	vErr, err := DB.ValidateAndCreate(&run)
+	if err == nil && vErr.HasAny() {
+		err = errors.New(vErr.Error())
+	}
+	return err
+}
+
+// GetChannelPowStats returns the rolling stats of the channel with channelID.
+func GetChannelPowStats(channelID string) (PowStats, error) {
+	runs := []PowRun{}
+	err := DB.RawQuery("SELECT * from pow_runs WHERE channel_id = ? ORDER BY created_at DESC LIMIT ?",
+		channelID, PowStatsWindow).All(&runs)
+	return computePowStats(channelID, runs), err
+}
+
+// GetProviderPowStats returns the rolling stats of the PoW provider called
+// provider.
+func GetProviderPowStats(provider string) (PowStats, error) {
+	runs := []PowRun{}
+	err := DB.RawQuery("SELECT * from pow_runs WHERE provider = ? ORDER BY created_at DESC LIMIT ?",
+		provider, PowStatsWindow).All(&runs)
+	return computePowStats(provider, runs), err
+}
+
+// GetAllPowStats returns the rolling stats of every chunk channel, and of
+// every PoW provider with runs that have not been pruned.
+func GetAllPowStats() (channels []PowStats, providers []PowStats, err error) {
+	chunkChannels := []ChunkChannel{}
+	if err = DB.RawQuery("SELECT * from chunk_channels ORDER BY created_at;").All(&chunkChannels); err != nil {
+		return nil, nil, err
+	}
+	for _, channel := range chunkChannels {
+		stats, err := GetChannelPowStats(channel.ChannelID)
+		if err != nil {
+			return nil, nil, err
+		}
+		channels = append(channels, stats)
+	}
+
+	names := []PowRun{}
+	err = DB.RawQuery("SELECT DISTINCT provider from pow_runs WHERE provider != '' ORDER BY provider").All(&names)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range names {
+		stats, err := GetProviderPowStats(name.Provider)
+		if err != nil {
+			return nil, nil, err
+		}
+		providers = append(providers, stats)
+	}
+
+	return channels, providers, nil
+}
+
+// PrunePowRuns deletes the runs made before thresholdTime.
+func PrunePowRuns(thresholdTime time.Time) error {
+	return DB.RawQuery("DELETE from pow_runs WHERE created_at <= ?", thresholdTime).All(&[]PowRun{})
+}
+
+// TimePerChunk returns how long the PoW takes per chunk going by the stats,
+// failed runs being redone, or DefaultTimePerChunk before any run succeeded.
+func (s PowStats) TimePerChunk() time.Duration {
+	if s.ChunksPerSecond <= 0 {
+		return DefaultTimePerChunk
+	}
+
+	// Failing every run would never finish, cap it so the estimate stays finite.
+	successRate := math.Max(1-s.FailureRate, 0.1)
+	return time.Duration(float64(time.Second) / s.ChunksPerSecond / successRate)
+}
+
+func computePowStats(name string, runs []PowRun) PowStats {
+	stats := PowStats{Name: name, Runs: len(runs)}
+	if len(runs) == 0 {
+		return stats
+	}
+
+	var bundleTimes []float64
+	var chunks, failed, elapsedMs int
+	for _, run := range runs {
+		if run.Failed {
+			failed++
+			continue
+		}
+		chunks += run.ChunkCount
+		elapsedMs += run.ElapsedMs
+		bundleTimes = append(bundleTimes, float64(run.ElapsedMs)/1000)
+	}
+
+	stats.FailureRate = float64(failed) / float64(len(runs))
+	if elapsedMs > 0 {
+		stats.ChunksPerSecond = float64(chunks) / (float64(elapsedMs) / 1000)
+	}
+
+	sort.Float64s(bundleTimes)
+	stats.P50BundleSeconds = percentile(bundleTimes, 0.5)
+	stats.P95BundleSeconds = percentile(bundleTimes, 0.95)
+	return stats
+}
+
+// percentile returns the nearest-rank percentile p of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
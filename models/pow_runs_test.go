@@ -0,0 +1,68 @@
+package models_test
+
+import (
+	"time"
+
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+func (ms *ModelSuite) Test_GetChannelPowStats() {
+	stats, err := models.GetChannelPowStats("CHANNEL")
+	ms.Nil(err)
+	ms.Equal(0, stats.Runs)
+	ms.Equal(models.DefaultTimePerChunk, stats.TimePerChunk())
+
+	// Bundles of 10 chunks taking 1 to 20 seconds, and 5 failed runs.
+	for i := 1; i <= 20; i++ {
+		ms.Nil(models.RecordChannelPowRun("CHANNEL", time.Now().Add(-time.Duration(i)*time.Second), 10, false))
+	}
+	for i := 0; i < 5; i++ {
+		ms.Nil(models.RecordChannelPowRun("CHANNEL", time.Now(), 10, true))
+	}
+	// Runs of a provider are not the channel's.
+	ms.Nil(models.RecordProviderPowRun("local", time.Now(), 10, true))
+
+	stats, err = models.GetChannelPowStats("CHANNEL")
+	ms.Nil(err)
+	ms.Equal("CHANNEL", stats.Name)
+	ms.Equal(25, stats.Runs)
+	ms.InDelta(0.2, stats.FailureRate, 0.001)
+	ms.InDelta(200.0/210.0, stats.ChunksPerSecond, 0.01)
+	ms.InDelta(10, stats.P50BundleSeconds, 0.1)
+	ms.InDelta(19, stats.P95BundleSeconds, 0.1)
+}
+
+func (ms *ModelSuite) Test_GetChannelPowStats_Window() {
+	defer func(window int) { models.PowStatsWindow = window }(models.PowStatsWindow)
+	models.PowStatsWindow = 2
+
+	ms.Nil(models.RecordChannelPowRun("CHANNEL", time.Now(), 10, true))
+	ms.Nil(ms.DB.RawQuery("UPDATE pow_runs SET created_at = ?", time.Now().Add(-time.Hour)).Exec())
+	ms.Nil(models.RecordChannelPowRun("CHANNEL", time.Now().Add(-10*time.Second), 10, false))
+	ms.Nil(models.RecordChannelPowRun("CHANNEL", time.Now().Add(-10*time.Second), 10, false))
+
+	// The failed run is out of the window.
+	stats, err := models.GetChannelPowStats("CHANNEL")
+	ms.Nil(err)
+	ms.Equal(2, stats.Runs)
+	ms.Equal(0.0, stats.FailureRate)
+
+	ms.Nil(models.PrunePowRuns(time.Now().Add(-time.Minute)))
+	count, err := ms.DB.Count(&models.PowRun{})
+	ms.Nil(err)
+	ms.Equal(2, count)
+}
+
+func (ms *ModelSuite) Test_GetAllPowStats() {
+	ms.Nil(ms.DB.Create(&models.ChunkChannel{ChannelID: "CHANNEL", EstReadyTime: time.Now()}))
+	ms.Nil(models.RecordChannelPowRun("CHANNEL", time.Now().Add(-10*time.Second), 10, false))
+	ms.Nil(models.RecordProviderPowRun("local", time.Now().Add(-10*time.Second), 10, false))
+
+	channels, providers, err := models.GetAllPowStats()
+	ms.Nil(err)
+	ms.Equal(1, len(channels))
+	ms.Equal("CHANNEL", channels[0].Name)
+	ms.Equal(1, len(providers))
+	ms.Equal("local", providers[0].Name)
+	ms.InDelta(1, providers[0].ChunksPerSecond, 0.01)
+}
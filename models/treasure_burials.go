@@ -0,0 +1,166 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+/*
+A TreasureBurial tracks locking the PRL for one treasure of an upload session
+on chain. The main wallet sends the session wallet enough ETH to pay for a PRL
+transfer, the session wallet sends the treasure address its PRL, the main
+wallet sends the treasure address enough ETH to pay for gas, and the treasure
+address then calls bury() on the Oyster Pearl contract.
+
+Only one transaction of a burial is pending at a time. Its nonce and gas price
+are kept so a transaction that is not mined in time is replaced rather than
+sent again.
+*/
+
+type TreasureBurialStatus int
+
+// A failed transaction moves a burial back to the step before it, so the
+// step is retried on the next run, until too many of its transactions have
+// been reverted and it is given up on with TreasureBurialError. Statuses are
+// stored, so new ones are added at the end whatever step they belong to.
+const (
+	TreasureBurialNotStarted TreasureBurialStatus = iota + 1
+	TreasureBurialPRLProcessing
+	TreasureBurialPRLSent
+	TreasureBurialGasProcessing
+	TreasureBurialGasSent
+	TreasureBurialBuryProcessing
+	TreasureBurialSuccess
+	TreasureBurialSessionGasProcessing
+	TreasureBurialSessionGasSent
+	TreasureBurialError
+)
+
+type TreasureBurial struct {
+	ID               uuid.UUID            `json:"id" db:"id"`
+	CreatedAt        time.Time            `json:"createdAt" db:"created_at"`
+	UpdatedAt        time.Time            `json:"updatedAt" db:"updated_at"`
+	GenesisHash      string               `json:"genesisHash" db:"genesis_hash"`
+	Sector           int                  `json:"sector" db:"sector"`
+	Idx              int                  `json:"idx" db:"idx"`
+	ETHAddr          string               `json:"ethAddr" db:"eth_addr"`
+	Amount           oyster_utils.Amount  `json:"amount" db:"amount"`
+	SessionGasTxHash string               `json:"sessionGasTxHash" db:"session_gas_tx_hash"`
+	PRLTxHash        string               `json:"prlTxHash" db:"prl_tx_hash"`
+	GasTxHash        string               `json:"gasTxHash" db:"gas_tx_hash"`
+	BuryTxHash       string               `json:"buryTxHash" db:"bury_tx_hash"`
+	TxNonce          int64                `json:"txNonce" db:"tx_nonce"`
+	TxGasPrice       int64                `json:"txGasPrice" db:"tx_gas_price"`
+	Reverts          int                  `json:"reverts" db:"reverts"` // Transactions of the burial that were reverted
+	Status           TreasureBurialStatus `json:"status" db:"status"`
+}
+
+// String is not required by pop and may be deleted
+func (t TreasureBurial) String() string {
+	jt, _ := json.Marshal(t)
+	return string(jt)
+}
+
+// TreasureBurials is not required by pop and may be deleted
+type TreasureBurials []TreasureBurial
+
+// String is not required by pop and may be deleted
+func (t TreasureBurials) String() string {
+	jt, _ := json.Marshal(t)
+	return string(jt)
+}
+
+// Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
+// This method is not required and may be deleted.
+func (t *TreasureBurial) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.Validate(
+		&validators.StringIsPresent{Field: t.GenesisHash, Name: "GenesisHash"},
+		&validators.StringIsPresent{Field: t.ETHAddr, Name: "ETHAddr"},
+	), nil
+}
+
+// ValidateCreate gets run every time you call "pop.ValidateAndCreate" method.
+// This method is not required and may be deleted.
+func (t *TreasureBurial) ValidateCreate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
+
+// ValidateUpdate gets run every time you call "pop.ValidateAndUpdate" method.
+// This method is not required and may be deleted.
+func (t *TreasureBurial) ValidateUpdate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
+
+/**
+ * Callbacks
+ */
+
+func (t *TreasureBurial) BeforeCreate(tx *pop.Connection) error {
+	// Defaults to TreasureBurialNotStarted
+	if t.Status == 0 {
+		t.Status = TreasureBurialNotStarted
+	}
+	return nil
+}
+
+/**
+ * Methods
+ */
+
+// FindOrCreateTreasureBurial returns the burial of the treasure at
+// burial.Idx in the session, creating it from burial if there is none yet.
+func FindOrCreateTreasureBurial(burial TreasureBurial) (TreasureBurial, error) {
+	existing := []TreasureBurial{}
+	err := DB.Where("genesis_hash = ? AND idx = ?", burial.GenesisHash, burial.Idx).All(&existing)
+	if err != nil {
+		return burial, err
+	}
+	if len(existing) > 0 {
+		return existing[0], nil
+	}
+
+	_, err = DB.ValidateAndCreate(&burial)
+	return burial, err
+}
+
+// GetTreasureBurials returns every burial of a session.
+func GetTreasureBurials(genesisHash string) (burials []TreasureBurial, err error) {
+	burials = []TreasureBurial{}
+	err = DB.Where("genesis_hash = ? ORDER BY idx asc", genesisHash).All(&burials)
+	return burials, err
+}
+
+// GetBuriedTreasure returns the treasure buried in a sector of a session, or
+// nil if the sector holds no treasure or it is not buried yet.
+func GetBuriedTreasure(genesisHash string, sector int) (*TreasureBurial, error) {
+	burials := []TreasureBurial{}
+	err := DB.Where("genesis_hash = ? AND sector = ? AND status = ?",
+		genesisHash, sector, TreasureBurialSuccess).All(&burials)
+	if err != nil || len(burials) == 0 {
+		return nil, err
+	}
+	return &burials[0], nil
+}
+
+// CountBurialsToSendPRL returns how many burials of the session have yet to
+// send the treasure its PRL from the session wallet.
+func CountBurialsToSendPRL(genesisHash string) (int, error) {
+	return DB.Where("genesis_hash = ? AND status IN (?, ?, ?)", genesisHash, TreasureBurialNotStarted,
+		TreasureBurialSessionGasProcessing, TreasureBurialSessionGasSent).Count(&TreasureBurial{})
+}
+
+// TreasuresBuried reports whether all numTreasures treasures of the session
+// have been buried on chain.
+func TreasuresBuried(genesisHash string, numTreasures int) (bool, error) {
+	count, err := DB.Where("genesis_hash = ? AND status = ?", genesisHash, TreasureBurialSuccess).Count(&TreasureBurial{})
+	if err != nil {
+		return false, err
+	}
+	return count >= numTreasures, nil
+}
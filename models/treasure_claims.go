@@ -0,0 +1,149 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+)
+
+/*
+A TreasureClaim records a webnode claiming a buried treasure through the
+broker. There is at most one claim per treasure address, so the same treasure
+cannot be claimed twice.
+
+A claim is only recorded when it is made. A job then funds the treasure
+address with gas, unless it already holds enough, and sends the claim.
+*/
+
+type TreasureClaimStatus int
+
+// Statuses are stored, so new ones are added at the end whatever step they
+// belong to.
+const (
+	TreasureClaimProcessing TreasureClaimStatus = iota + 1
+	TreasureClaimSuccess
+	TreasureClaimNotStarted
+	TreasureClaimGasProcessing
+	TreasureClaimGasSent
+	TreasureClaimError = -1
+)
+
+var ErrTreasureAlreadyClaimed = errors.New("treasure has already been claimed")
+
+type TreasureClaim struct {
+	ID              uuid.UUID           `json:"id" db:"id"`
+	CreatedAt       time.Time           `json:"createdAt" db:"created_at"`
+	UpdatedAt       time.Time           `json:"updatedAt" db:"updated_at"`
+	GenesisHash     string              `json:"genesisHash" db:"genesis_hash"`
+	SectorIdx       int                 `json:"sectorIdx" db:"sector_idx"`
+	ETHAddr         string              `json:"ethAddr" db:"eth_addr"`
+	ReceiverEthAddr string              `json:"receiverEthAddr" db:"receiver_eth_addr"`
+	ETHPrivateKey   string              `json:"-" db:"eth_private_key"`
+	GasTxHash       string              `json:"gasTxHash" db:"gas_tx_hash"`
+	TxHash          string              `json:"txHash" db:"tx_hash"`
+	Status          TreasureClaimStatus `json:"status" db:"status"`
+}
+
+// String is not required by pop and may be deleted
+func (t TreasureClaim) String() string {
+	jt, _ := json.Marshal(t)
+	return string(jt)
+}
+
+// TreasureClaims is not required by pop and may be deleted
+type TreasureClaims []TreasureClaim
+
+// String is not required by pop and may be deleted
+func (t TreasureClaims) String() string {
+	jt, _ := json.Marshal(t)
+	return string(jt)
+}
+
+// Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
+// This method is not required and may be deleted.
+func (t *TreasureClaim) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.Validate(
+		&validators.StringIsPresent{Field: t.GenesisHash, Name: "GenesisHash"},
+		&validators.StringIsPresent{Field: t.ETHAddr, Name: "ETHAddr"},
+		&validators.StringIsPresent{Field: t.ReceiverEthAddr, Name: "ReceiverEthAddr"},
+	), nil
+}
+
+// ValidateCreate gets run every time you call "pop.ValidateAndCreate" method.
+// This method is not required and may be deleted.
+func (t *TreasureClaim) ValidateCreate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
+
+// ValidateUpdate gets run every time you call "pop.ValidateAndUpdate" method.
+// This method is not required and may be deleted.
+func (t *TreasureClaim) ValidateUpdate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
+
+/**
+ * Callbacks
+ */
+
+func (t *TreasureClaim) BeforeCreate(tx *pop.Connection) error {
+	// Defaults to TreasureClaimNotStarted
+	if t.Status == 0 {
+		t.Status = TreasureClaimNotStarted
+	}
+	return nil
+}
+
+/**
+ * Methods
+ */
+
+// StartTreasureClaim reserves the treasure at claim.ETHAddr for the caller,
+// to be claimed with the encrypted key claim.ETHPrivateKey. It returns
+// ErrTreasureAlreadyClaimed if the treasure is claimed or a claim is in
+// flight. A claim that failed before may be started again.
+func StartTreasureClaim(claim TreasureClaim) (TreasureClaim, error) {
+	err := DB.Transaction(func(tx *pop.Connection) error {
+		existing := []TreasureClaim{}
+		err := tx.RawQuery("SELECT * from treasure_claims WHERE eth_addr = ? FOR UPDATE", claim.ETHAddr).All(&existing)
+		if err != nil {
+			return err
+		}
+
+		if len(existing) == 0 {
+			claim.Status = TreasureClaimNotStarted
+			vErr, err := tx.ValidateAndCreate(&claim)
+			if err == nil && vErr.HasAny() {
+				err = errors.New(vErr.Error())
+			}
+			return err
+		}
+
+		if existing[0].Status != TreasureClaimError {
+			return ErrTreasureAlreadyClaimed
+		}
+
+		existing[0].ReceiverEthAddr = claim.ReceiverEthAddr
+		existing[0].ETHPrivateKey = claim.ETHPrivateKey
+		existing[0].GasTxHash = ""
+		existing[0].TxHash = ""
+		existing[0].Status = TreasureClaimNotStarted
+		claim = existing[0]
+		_, err = tx.ValidateAndSave(&claim)
+		return err
+	})
+
+	return claim, err
+}
+
+// GetPendingTreasureClaims returns the claims still waiting on a job.
+func GetPendingTreasureClaims() (claims []TreasureClaim, err error) {
+	claims = []TreasureClaim{}
+	err = DB.Where("status IN (?, ?, ?, ?)", TreasureClaimNotStarted, TreasureClaimGasProcessing,
+		TreasureClaimGasSent, TreasureClaimProcessing).All(&claims)
+	return claims, err
+}
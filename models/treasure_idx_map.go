@@ -0,0 +1,207 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gobuffalo/validate"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+/*
+TreasureIdxMap is where the treasure of every sector of a session is buried,
+and the key of the PRL buried with it. It is stored as JSON with a version, so
+the format can change without guessing at what a row holds. Keys are stored
+encrypted, see oyster_utils.EncryptEthKey, and only decrypted to be used. Rows written
+before the version was added are either an underscore joined list of the
+index in each sector, or a bare list of treasures, and are still read.
+*/
+
+const TreasureIdxMapVersion = 1
+
+var (
+	ErrUnknownTreasureIdxMapVersion = errors.New("unknown treasure idx map version")
+	ErrTreasureIdxMapSectorCount    = errors.New("treasure idx map does not have one treasure per sector")
+)
+
+type TreasureMap struct {
+	Sector int    `json:"sector"`
+	Idx    int    `json:"idx"` // chunk_idx of the data map the treasure is buried in
+	Key    string `json:"key"` // Encrypted once stored, see PrivateKey
+}
+
+type TreasureIdxMap struct {
+	Version   int           `json:"version"`
+	Treasures []TreasureMap `json:"treasures"`
+}
+
+// NewTreasureIdxMap returns the map of treasures buried at the index in each
+// sector given, with a new key for each.
+func NewTreasureIdxMap(sectorIndexes []int) (TreasureIdxMap, error) {
+	m := TreasureIdxMap{Version: TreasureIdxMapVersion}
+	for sector, index := range sectorIndexes {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return TreasureIdxMap{}, err
+		}
+		encryptedKey, err := oyster_utils.EncryptEthKey(hex.EncodeToString(crypto.FromECDSA(key)))
+		if err != nil {
+			return TreasureIdxMap{}, err
+		}
+		m.Treasures = append(m.Treasures, TreasureMap{
+			Sector: sector,
+			Idx:    sector*oyster_utils.FileSectorInChunkSize + index,
+			Key:    encryptedKey,
+		})
+	}
+	return m, nil
+}
+
+// PrivateKey returns the hex encoded key of the treasure, decrypted. Keys of
+// rows written before they were encrypted are returned as they are.
+func (t TreasureMap) PrivateKey() (string, error) {
+	if t.Key == "" || !oyster_utils.IsEncryptedEthKey(t.Key) {
+		return t.Key, nil
+	}
+	return oyster_utils.DecryptEthKey(t.Key)
+}
+
+func (m TreasureIdxMap) IsEmpty() bool {
+	return len(m.Treasures) == 0
+}
+
+// SectorIndexes returns the index of the treasure within each sector, in
+// sector order.
+func (m TreasureIdxMap) SectorIndexes() []int {
+	treasures := append([]TreasureMap{}, m.Treasures...)
+	sort.Slice(treasures, func(i, j int) bool { return treasures[i].Sector < treasures[j].Sector })
+
+	indexes := []int{}
+	for _, treasure := range treasures {
+		indexes = append(indexes, treasure.Idx-treasure.Sector*oyster_utils.FileSectorInChunkSize)
+	}
+	return indexes
+}
+
+// Validate checks there is one treasure in every sector of a session of
+// numChunks chunks, each buried within its sector.
+func (m TreasureIdxMap) Validate(numChunks int) error {
+	totalChunks := oyster_utils.GetTotalFileChunkIncludingBuriedPearlsUsingNumChunks(numChunks)
+	numSectors := totalChunks - numChunks
+	if len(m.Treasures) != numSectors {
+		return ErrTreasureIdxMapSectorCount
+	}
+
+	seen := map[int]bool{}
+	for _, treasure := range m.Treasures {
+		if treasure.Sector < 0 || treasure.Sector >= numSectors || seen[treasure.Sector] {
+			return ErrTreasureIdxMapSectorCount
+		}
+		seen[treasure.Sector] = true
+
+		sectorStart := treasure.Sector * oyster_utils.FileSectorInChunkSize
+		if treasure.Idx < sectorStart || treasure.Idx >= sectorStart+oyster_utils.FileSectorInChunkSize ||
+			treasure.Idx >= totalChunks {
+			return fmt.Errorf("treasure idx %d is outside of sector %d", treasure.Idx, treasure.Sector)
+		}
+	}
+	return nil
+}
+
+// treasureIdxMapValidator validates a non empty TreasureIdxMap against the
+// number of chunks of its session.
+type treasureIdxMapValidator struct {
+	Field     TreasureIdxMap
+	NumChunks int
+	Name      string
+}
+
+func (v *treasureIdxMapValidator) IsValid(errors *validate.Errors) {
+	if v.Field.IsEmpty() {
+		return
+	}
+	if err := v.Field.Validate(v.NumChunks); err != nil {
+		errors.Add(validate.GenerateKey(v.Name), err.Error())
+	}
+}
+
+// Scan implements sql.Scanner.
+func (m *TreasureIdxMap) Scan(src interface{}) error {
+	var raw string
+	switch v := src.(type) {
+	case nil:
+		*m = TreasureIdxMap{}
+		return nil
+	case []byte:
+		raw = string(v)
+	case string:
+		raw = v
+	default:
+		return fmt.Errorf("cannot scan %T into a TreasureIdxMap", src)
+	}
+
+	raw = strings.TrimSpace(raw)
+	switch {
+	case raw == "" || raw == "null":
+		*m = TreasureIdxMap{}
+	case strings.HasPrefix(raw, "{"):
+		scanned := TreasureIdxMap{}
+		if err := json.Unmarshal([]byte(raw), &scanned); err != nil {
+			return err
+		}
+		if scanned.Version != TreasureIdxMapVersion {
+			return ErrUnknownTreasureIdxMapVersion
+		}
+		*m = scanned
+	case strings.HasPrefix(raw, "["):
+		// Unversioned list of treasures.
+		*m = TreasureIdxMap{Version: TreasureIdxMapVersion}
+		if err := json.Unmarshal([]byte(raw), &m.Treasures); err != nil {
+			return err
+		}
+	default:
+		// Underscore joined index in each sector, without keys.
+		*m = TreasureIdxMap{Version: TreasureIdxMapVersion}
+		for sector, index := range oyster_utils.IntsSplit(raw, oyster_utils.IntsJoinDelim) {
+			m.Treasures = append(m.Treasures, TreasureMap{
+				Sector: sector,
+				Idx:    sector*oyster_utils.FileSectorInChunkSize + index,
+			})
+		}
+	}
+	return nil
+}
+
+// Value implements driver.Valuer. An empty map is stored as NULL, and keys
+// that are not encrypted yet are encrypted.
+func (m TreasureIdxMap) Value() (driver.Value, error) {
+	if m.IsEmpty() {
+		return nil, nil
+	}
+	m.Version = TreasureIdxMapVersion
+
+	// Copied, so the caller's treasures are left as they are.
+	m.Treasures = append([]TreasureMap{}, m.Treasures...)
+	for i, treasure := range m.Treasures {
+		if treasure.Key == "" || oyster_utils.IsEncryptedEthKey(treasure.Key) {
+			continue
+		}
+		encryptedKey, err := oyster_utils.EncryptEthKey(treasure.Key)
+		if err != nil {
+			return nil, err
+		}
+		m.Treasures[i].Key = encryptedKey
+	}
+
+	v, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(v), nil
+}
@@ -0,0 +1,72 @@
+package models_test
+
+import (
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+func (ms *ModelSuite) Test_TreasureIdxMap_ScanLegacyFormats() {
+	m := models.TreasureIdxMap{}
+	ms.Nil(m.Scan([]byte("5_78")))
+	ms.Equal([]int{5, 78}, m.SectorIndexes())
+	ms.Equal(oyster_utils.FileSectorInChunkSize+78, m.Treasures[1].Idx)
+	ms.Equal("", m.Treasures[1].Key)
+
+	m = models.TreasureIdxMap{}
+	ms.Nil(m.Scan(`[{"sector":0,"idx":5,"key":"firstKey"}]`))
+	ms.Equal(models.TreasureIdxMapVersion, m.Version)
+	ms.Equal([]models.TreasureMap{{Sector: 0, Idx: 5, Key: "firstKey"}}, m.Treasures)
+
+	ms.Nil(m.Scan(nil))
+	ms.True(m.IsEmpty())
+}
+
+func (ms *ModelSuite) Test_TreasureIdxMap_ScanUnknownVersion() {
+	m := models.TreasureIdxMap{}
+	err := m.Scan(`{"version":99,"treasures":[]}`)
+	ms.Equal(models.ErrUnknownTreasureIdxMapVersion, err)
+}
+
+func (ms *ModelSuite) Test_TreasureIdxMap_ValueRoundTrip() {
+	m, err := models.NewTreasureIdxMap([]int{7})
+	ms.Nil(err)
+	ms.True(oyster_utils.IsEncryptedEthKey(m.Treasures[0].Key))
+	key, err := m.Treasures[0].PrivateKey()
+	ms.Nil(err)
+	_, err = crypto.HexToECDSA(key)
+	ms.Nil(err)
+
+	v, err := m.Value()
+	ms.Nil(err)
+	scanned := models.TreasureIdxMap{}
+	ms.Nil(scanned.Scan(v))
+	ms.Equal(m, scanned)
+
+	v, err = models.TreasureIdxMap{}.Value()
+	ms.Nil(err)
+	ms.Nil(v)
+}
+
+func (ms *ModelSuite) Test_TreasureIdxMap_Validate() {
+	m, _ := models.NewTreasureIdxMap([]int{1})
+	ms.Nil(m.Validate(2))
+
+	// One treasure per sector.
+	m, _ = models.NewTreasureIdxMap([]int{1, 5})
+	ms.Equal(models.ErrTreasureIdxMapSectorCount, m.Validate(2))
+
+	// Buried past the last chunk.
+	m, _ = models.NewTreasureIdxMap([]int{3})
+	ms.NotNil(m.Validate(2))
+
+	u := models.UploadSession{
+		GenesisHash:    "genHashInvalidTreasure",
+		FileSizeBytes:  123,
+		NumChunks:      2,
+		TreasureIdxMap: m,
+	}
+	vErr, err := u.StartUploadSession()
+	ms.Nil(err)
+	ms.True(vErr.HasAny())
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/gobuffalo/pop/nulls"
+)
+
+/*
+UploadProgress summarizes how far the chunks of an upload have got. Once
+PurgeCompletedSessions has moved an upload's data maps to
+completed_data_maps, the progress is read from there.
+*/
+
+type UploadProgress struct {
+	GenesisHash         string            `json:"genesisHash"`
+	NumChunks           int               `json:"numChunks"`
+	Chunks              ChunkStatusCounts `json:"chunks"`
+	TreasureStatus      string            `json:"treasureStatus"`
+	DataMapsStatus      string            `json:"dataMapsStatus"`
+	Completed           bool              `json:"completed"`
+	EstimatedCompletion nulls.Time        `json:"estimatedCompletion"`
+}
+
+// ChunkStatusCounts holds how many chunks of an upload are in each status.
+type ChunkStatusCounts struct {
+	Pending    int `json:"pending"`
+	Unassigned int `json:"unassigned"`
+	Unverified int `json:"unverified"`
+	Complete   int `json:"complete"`
+	Confirmed  int `json:"confirmed"`
+	Error      int `json:"error"`
+}
+
+var ErrUploadNotFound = errors.New("no upload found for genesis hash")
+
+// GetUploadProgress returns the progress of the upload of genesisHash.
+func GetUploadProgress(genesisHash string) (UploadProgress, error) {
+	progress := UploadProgress{GenesisHash: genesisHash}
+
+	counts, err := DataMapQuery{GenesisHash: genesisHash}.StatusCounts()
+	if err != nil {
+		return progress, err
+	}
+
+	if len(counts) == 0 {
+		counts, err = CountCompletedDataMapsByStatus(genesisHash)
+		if err != nil {
+			return progress, err
+		}
+		progress.Completed = len(counts) > 0
+	}
+
+	for status, count := range counts {
+		progress.NumChunks += count
+		switch status {
+		case Pending:
+			progress.Chunks.Pending = count
+		case Unassigned:
+			progress.Chunks.Unassigned = count
+		case Unverified:
+			progress.Chunks.Unverified = count
+		case Complete:
+			progress.Chunks.Complete = count
+		case Confirmed:
+			progress.Chunks.Confirmed = count
+		case Error:
+			progress.Chunks.Error = count
+		}
+	}
+
+	if progress.Completed {
+		// Sessions are only purged once their treasure is buried.
+		progress.TreasureStatus = "buried"
+		progress.DataMapsStatus = "ready"
+		return progress, nil
+	}
+
+	// A session may have no data maps yet, or none at all if building them
+	// failed.
+	sessions := []UploadSession{}
+	if err = DB.Where("genesis_hash = ?", genesisHash).All(&sessions); err != nil {
+		return progress, err
+	}
+	if len(sessions) == 0 && len(counts) == 0 {
+		return progress, ErrUploadNotFound
+	}
+	if len(sessions) > 0 {
+		progress.TreasureStatus = sessions[0].GetTreasureStatus()
+		progress.DataMapsStatus = sessions[0].GetDataMapsStatus()
+	}
+
+	// Chunks that still have to go through proof of work.
+	remaining := progress.Chunks.Pending + progress.Chunks.Unassigned + progress.Chunks.Error
+	readyTime, err := EstimateReadyTime(remaining)
+	if err != nil {
+		return progress, err
+	}
+	if !readyTime.IsZero() {
+		progress.EstimatedCompletion = nulls.NewTime(readyTime)
+	}
+
+	return progress, nil
+}
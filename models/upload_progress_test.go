@@ -0,0 +1,92 @@
+package models_test
+
+import (
+	"time"
+
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+func (ms *ModelSuite) Test_GetUploadProgress() {
+	session := models.UploadSession{
+		GenesisHash:    "genHashProgress",
+		FileSizeBytes:  123,
+		NumChunks:      3,
+		TreasureStatus: models.TreasureBuried,
+	}
+	_, err := session.StartUploadSession()
+	ms.Nil(err)
+
+	dMaps := []models.DataMap{}
+	ms.Nil(ms.DB.Where("genesis_hash = ?", "genHashProgress").Order("chunk_idx asc").All(&dMaps))
+	dMaps[0].Status = models.Complete
+	ms.Nil(ms.DB.Save(&dMaps[0]))
+	dMaps[1].Status = models.Error
+	ms.Nil(ms.DB.Save(&dMaps[1]))
+
+	progress, err := models.GetUploadProgress("genHashProgress")
+	ms.Nil(err)
+	ms.Equal(len(dMaps), progress.NumChunks)
+	ms.Equal(1, progress.Chunks.Complete)
+	ms.Equal(1, progress.Chunks.Error)
+	ms.Equal(len(dMaps)-2, progress.Chunks.Pending)
+	ms.Equal("buried", progress.TreasureStatus)
+	ms.Equal("ready", progress.DataMapsStatus)
+	ms.False(progress.Completed)
+}
+
+func (ms *ModelSuite) Test_GetUploadProgress_Completed() {
+	for i := 0; i < 2; i++ {
+		ms.Nil(ms.DB.Create(&models.CompletedDataMap{
+			GenesisHash: "genHashProgressDone",
+			ChunkIdx:    i,
+			Status:      models.Complete,
+		}))
+	}
+
+	progress, err := models.GetUploadProgress("genHashProgressDone")
+	ms.Nil(err)
+	ms.True(progress.Completed)
+	ms.Equal(2, progress.NumChunks)
+	ms.Equal(2, progress.Chunks.Complete)
+	ms.Equal("buried", progress.TreasureStatus)
+	ms.False(progress.EstimatedCompletion.Valid)
+}
+
+func (ms *ModelSuite) Test_GetUploadProgress_NotFound() {
+	_, err := models.GetUploadProgress("genHashNoUpload")
+	ms.Equal(models.ErrUploadNotFound, err)
+}
+
+func (ms *ModelSuite) Test_EstimateReadyTime() {
+	readyTime, err := models.EstimateReadyTime(10)
+	ms.Nil(err)
+	ms.True(readyTime.IsZero()) // No channels
+
+	_, err = models.MakeChannels(2)
+	ms.Nil(err)
+
+	readyTime, err = models.EstimateReadyTime(0)
+	ms.Nil(err)
+	ms.True(readyTime.IsZero())
+
+	// Two fresh channels share the chunks.
+	readyTime, err = models.EstimateReadyTime(4)
+	ms.Nil(err)
+	ms.WithinDuration(time.Now().Add(2*models.DefaultTimePerChunk), readyTime, time.Second)
+
+	// A channel that is busy for longer than the other takes to do the
+	// chunks on its own is left out.
+	channels := []models.ChunkChannel{}
+	ms.Nil(ms.DB.All(&channels))
+	channels[0].EstReadyTime = time.Now().Add(10 * models.DefaultTimePerChunk)
+	ms.Nil(ms.DB.Save(&channels[0]))
+
+	readyTime, err = models.EstimateReadyTime(4)
+	ms.Nil(err)
+	ms.WithinDuration(time.Now().Add(4*models.DefaultTimePerChunk), readyTime, time.Second)
+
+	// It shares the chunks once the other catches up with it.
+	readyTime, err = models.EstimateReadyTime(12)
+	ms.Nil(err)
+	ms.WithinDuration(time.Now().Add(11*models.DefaultTimePerChunk), readyTime, time.Second)
+}
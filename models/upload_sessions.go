@@ -1,9 +1,11 @@
 package models
 
 import (
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"github.com/oysterprotocol/brokernode/utils"
-	"math"
+	"math/big"
 	"time"
 
 	"github.com/getsentry/raven-go"
@@ -21,14 +23,10 @@ const (
 )
 
 type Invoice struct {
-	Cost       float64      `json:"cost"`
-	EthAddress nulls.String `json:"ethAddress"`
-}
-
-type TreasureMap struct {
-	Sector int    `json:"sector"`
-	Idx    int    `json:"idx"`
-	Key    string `json:"key"`
+	Cost          oyster_utils.Amount `json:"cost"`
+	EthAddress    nulls.String        `json:"ethAddress"`
+	PriceQuotedAt time.Time           `json:"priceQuotedAt"`
+	ExpiresAt     time.Time           `json:"expiresAt"`
 }
 
 type UploadSession struct {
@@ -43,25 +41,65 @@ type UploadSession struct {
 
 	ETHAddrAlpha  nulls.String `json:"ethAddrAlpha" db:"eth_addr_alpha"`
 	ETHAddrBeta   nulls.String `json:"ethAddrBeta" db:"eth_addr_beta"`
-	ETHPrivateKey string       `db:"eth_private_key"`
-	// TODO: Floats shouldn't be used for prices, use https://github.com/shopspring/decimal.
-	TotalCost      float64 `json:"totalCost" db:"total_cost"`
-	PaymentStatus  int     `json:"paymentStatus" db:"payment_status"`
-	TreasureStatus int     `json:"treasureStatus" db:"treasure_status"`
+	ETHKeyIndex   nulls.Int    `json:"-" db:"eth_key_index"`   // BIP44 index the session's address is derived at
+	ETHPrivateKey string       `json:"-" db:"eth_private_key"` // Encrypted, see oyster_utils.EncryptEthKey
+
+	TotalCost       oyster_utils.Amount `json:"totalCost" db:"total_cost"`
+	PriceQuotedAt   nulls.Time          `json:"priceQuotedAt" db:"price_quoted_at"`
+	PaymentReceived oyster_utils.Amount `json:"paymentReceived" db:"payment_received"`
+	PaymentStatus   int                 `json:"paymentStatus" db:"payment_status"`
+	TreasureStatus  int                 `json:"treasureStatus" db:"treasure_status"`
+	DataMapsStatus  int                 `json:"dataMapsStatus" db:"data_maps_status"`
+
+	TreasureIdxMap TreasureIdxMap `json:"-" db:"treasure_idx_map"` // Holds the treasure keys, never sent to clients
+
+	// Commit-reveal of where the treasure is buried, see oyster_utils.TreasureCommitment
+	TreasureSecret         nulls.String `json:"-" db:"treasure_secret"`
+	PeerTreasureCommitment nulls.String `json:"-" db:"peer_treasure_commitment"`
+
+	// The beta broker's session, requoted along with the alpha's.
+	BetaEndpoint  nulls.String `json:"-" db:"beta_endpoint"`
+	BetaSessionID nulls.String `json:"-" db:"beta_session_id"`
+}
 
-	TreasureIdxMap nulls.String `json:"treasureIdxMap" db:"treasure_idx_map"`
-	// TreasureIdxMap slices.Int `json:"treasureIdxMap" db:"treasure_idx_map"`
+// How long the price quoted in an invoice can be paid for.
+var PriceQuoteTTL = 1 * time.Hour
+
+// StoragePeg returns the price of storing one GB for one year. The services
+// package replaces it with the peg read from the Oyster Pearl contract.
+var StoragePeg = func() oyster_utils.Amount {
+	return oyster_utils.AmountFromUnits(1)
 }
 
+const bytesPerGigaByte = 1000000000
+
 const (
 	PaymentStatusPending int = iota + 1
 	PaymentStatusPaid
+	PaymentStatusUnderpaid
+	PaymentStatusOverpaid
 	PaymentStatusError = -1
 )
 
 const (
 	TreasureUnburied int = iota + 1
 	TreasureBuried
+	// The session's treasure map was written before keys were stored with it,
+	// so its treasure can never be buried.
+	TreasureError
+)
+
+// Chunks can't be uploaded until the session's data maps are all built.
+const (
+	DataMapsPreparing int = iota + 1
+	DataMapsReady
+	// Building the data maps failed too many times in a row to carry on.
+	DataMapsError
+)
+
+var (
+	ErrNoTreasureCommitment   = errors.New("no treasure commitment was exchanged for the session")
+	ErrTreasureRevealMismatch = errors.New("revealed treasure secret does not match its commitment")
 )
 
 // String is not required by pop and may be deleted
@@ -90,6 +128,7 @@ func (u *UploadSession) Validate(tx *pop.Connection) (*validate.Errors, error) {
 		&validators.StringIsPresent{Field: u.GenesisHash, Name: "GenesisHash"},
 		&validators.IntIsPresent{Field: u.NumChunks, Name: "NumChunks"},
 		&validators.IntIsPresent{Field: u.FileSizeBytes, Name: "FileSize"},
+		&treasureIdxMapValidator{Field: u.TreasureIdxMap, NumChunks: u.NumChunks, Name: "TreasureIdxMap"},
 	), nil
 }
 
@@ -115,6 +154,11 @@ func (u *UploadSession) BeforeCreate(tx *pop.Connection) error {
 		u.Type = SessionTypeAlpha
 	}
 
+	// Defaults to dataMapsReady, StartUploadSession prepares them.
+	if u.DataMapsStatus == 0 {
+		u.DataMapsStatus = DataMapsReady
+	}
+
 	switch oyster_utils.BrokerMode {
 	case oyster_utils.ProdMode:
 		// Defaults to paymentStatusPending
@@ -151,31 +195,121 @@ func (u *UploadSession) BeforeCreate(tx *pop.Connection) error {
 	return nil
 }
 
+func (u *UploadSession) BeforeSave(tx *pop.Connection) error {
+	return encryptEthKey(&u.ETHPrivateKey)
+}
+
 /**
  * Methods
  */
 
-// StartUploadSession will generate dataMaps and save the session and dataMaps
-// to the DB.
+// StartUploadSession will save the session to the DB and start generating its
+// dataMaps. Sessions that fit in one batch are ready straight away, the others
+// are left preparing for the BuildDataMaps job to carry on with.
 func (u *UploadSession) StartUploadSession() (vErr *validate.Errors, err error) {
 	if u.Type == SessionTypeAlpha {
 		u.calculatePayment()
 	}
 
+	u.DataMapsStatus = DataMapsPreparing
 	vErr, err = DB.ValidateAndCreate(u)
 	if err != nil || len(vErr.Errors) > 0 {
 		return
 	}
 
-	vErr, err = BuildDataMaps(u.GenesisHash, u.NumChunks)
+	preparing, err := BuildDataMapsBatch(u.ID)
+	if err == nil && !preparing {
+		u.DataMapsStatus = DataMapsReady
+	}
 	return
 }
 
+// Preparing returns whether the session's data maps are still being built.
+func (u *UploadSession) Preparing() bool {
+	return u.DataMapsStatus == DataMapsPreparing
+}
+
+// DataMapsFailed returns whether building the session's data maps was given
+// up on.
+func (u *UploadSession) DataMapsFailed() bool {
+	return u.DataMapsStatus == DataMapsError
+}
+
+// MarkDataMapsFailed gives up on building the data maps of the session with
+// id, if it is still preparing.
+func MarkDataMapsFailed(id uuid.UUID) error {
+	return DB.RawQuery("UPDATE upload_sessions SET data_maps_status = ?, updated_at = ? WHERE id = ? AND data_maps_status = ?",
+		DataMapsError, time.Now(), id, DataMapsPreparing).Exec()
+}
+
+// BuildDataMapsBatch builds the next DataMapsBatchSize data maps of the
+// preparing session with id, and marks the session ready once they are all
+// built. Returns whether the session is still preparing.
+func BuildDataMapsBatch(id uuid.UUID) (preparing bool, err error) {
+	err = DB.Transaction(func(tx *pop.Connection) error {
+		// Locks the session so no one else builds its data maps meanwhile.
+		sessions := []UploadSession{}
+		err := tx.RawQuery("SELECT * from upload_sessions WHERE id = ? FOR UPDATE", id).All(&sessions)
+		if err != nil || len(sessions) == 0 || !sessions[0].Preparing() {
+			return err
+		}
+		session := sessions[0]
+
+		// The data maps built so far are the progress, and the next one's hash
+		// follows on from the last one's.
+		start := 0
+		currHash := session.GenesisHash
+		last, err := DataMapQuery{GenesisHash: session.GenesisHash, Order: ChunkOrderDesc}.On(tx).Paginate(1, 1).All()
+		if err != nil {
+			return err
+		}
+		if len(last) > 0 {
+			start = last[0].ChunkIdx + 1
+			currHash = oyster_utils.HashString(last[0].Hash, sha256.New())
+		}
+
+		total := totalDataMaps(session.NumChunks)
+		end := start + DataMapsBatchSize
+		if end > total {
+			end = total
+		}
+
+		_, vErr, err := buildDataMapsBatch(tx, session.GenesisHash, currHash, start, end)
+		if err == nil && vErr.HasAny() {
+			err = errors.New(vErr.Error())
+		}
+		if err != nil {
+			return err
+		}
+
+		if end < total {
+			preparing = true
+			return nil
+		}
+		return tx.RawQuery("UPDATE upload_sessions SET data_maps_status = ?, updated_at = ? WHERE id = ?",
+			DataMapsReady, time.Now(), id).Exec()
+	})
+
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return true, err
+	}
+	return preparing, nil
+}
+
+// GetPreparingSessions returns the sessions whose data maps are still being
+// built, oldest first.
+func GetPreparingSessions() ([]UploadSession, error) {
+	sessions := []UploadSession{}
+	err := DB.Where("data_maps_status = ?", DataMapsPreparing).Order("created_at asc").All(&sessions)
+	return sessions, err
+}
+
 // TODO: Chunk this to smaller batches?
 // DataMapsForSession fetches the datamaps associated with the session.
 func (u *UploadSession) DataMapsForSession() (dMaps *[]DataMap, err error) {
-	dMaps = &[]DataMap{}
-	err = DB.RawQuery("SELECT * from data_maps WHERE genesis_hash = ? ORDER BY chunk_idx asc", u.GenesisHash).All(dMaps)
+	dataMaps, err := DataMapQuery{GenesisHash: u.GenesisHash, Order: ChunkOrderAsc}.All()
+	dMaps = &dataMaps
 
 	return
 }
@@ -190,61 +324,115 @@ func (u *UploadSession) GetInvoice() Invoice {
 		ethAddress = u.ETHAddrAlpha
 	}
 
-	return Invoice{
+	invoice := Invoice{
 		EthAddress: ethAddress,
 		Cost:       u.TotalCost,
 	}
+	if u.PriceQuotedAt.Valid {
+		invoice.PriceQuotedAt = u.PriceQuotedAt.Time
+		invoice.ExpiresAt = u.PriceQuotedAt.Time.Add(PriceQuoteTTL)
+	}
+	return invoice
 }
 
+// calculatePayment quotes the price of the session, prorated by the exact
+// size of the file and the storage length, and rounded up to the wei.
 func (u *UploadSession) calculatePayment() {
-	storagePeg := getStoragePeg()
-	fileSizeGigaBytes := int(math.Ceil(float64(u.FileSizeBytes / 1000000000)))
-	if fileSizeGigaBytes < 1 {
-		fileSizeGigaBytes = 1
+	fileSizeBytes := int64(oyster_utils.ConvertToByte(u.FileSizeBytes))
+
+	cost := new(big.Int).Mul(StoragePeg().Wei(), big.NewInt(fileSizeBytes*int64(u.StorageLengthInYears)))
+	cost.Add(cost, big.NewInt(bytesPerGigaByte-1))
+	cost.Div(cost, big.NewInt(bytesPerGigaByte))
+
+	u.TotalCost = oyster_utils.AmountFromWei(cost)
+	u.PriceQuotedAt = nulls.NewTime(time.Now())
+}
+
+// QuoteExpired is true once the session's price can no longer be paid.
+func (u *UploadSession) QuoteExpired() bool {
+	return !u.PriceQuotedAt.Valid || time.Since(u.PriceQuotedAt.Time) > PriceQuoteTTL
+}
+
+// Requote prices the session again at the current storage peg.
+func (u *UploadSession) Requote() (*validate.Errors, error) {
+	u.calculatePayment()
+	return DB.ValidateAndSave(u)
+}
+
+// RevealTreasure takes the secret the alpha broker revealed, checks it
+// against the commitment it sent, and sets the treasure indexes from both
+// secrets. Returns this broker's secret to reveal in turn.
+func (u *UploadSession) RevealTreasure(peerSecret string) (string, error) {
+	if !u.TreasureSecret.Valid || !u.PeerTreasureCommitment.Valid {
+		return "", ErrNoTreasureCommitment
+	}
+	if !oyster_utils.VerifyTreasureReveal(peerSecret, u.PeerTreasureCommitment.String) {
+		return "", ErrTreasureRevealMismatch
 	}
 
-	u.TotalCost = float64(storagePeg * u.StorageLengthInYears * fileSizeGigaBytes)
+	indexes, err := oyster_utils.TreasureIndexesFromSecrets(oyster_utils.ConvertToByte(u.FileSizeBytes),
+		peerSecret, u.TreasureSecret.String)
+	if err != nil {
+		return "", err
+	}
+
+	if u.TreasureIdxMap, err = NewTreasureIdxMap(indexes); err != nil {
+		return "", err
+	}
+	vErr, err := DB.ValidateAndSave(u)
+	if err == nil && vErr.HasAny() {
+		err = errors.New(vErr.Error())
+	}
+	if err != nil {
+		return "", err
+	}
+	return u.TreasureSecret.String, nil
 }
 
 func (u *UploadSession) GetTreasureMap() ([]TreasureMap, error) {
-	var err error
-	treasureIndex := []TreasureMap{}
-	if u.TreasureIdxMap.Valid {
-		// only do this if the string value is valid
-		err = json.Unmarshal([]byte(u.TreasureIdxMap.String), &treasureIndex)
-		if err != nil {
-			raven.CaptureError(err, nil)
-		}
-	}
-	return treasureIndex, err
+	return append([]TreasureMap{}, u.TreasureIdxMap.Treasures...), nil
 }
 
 func (u *UploadSession) SetTreasureMap(treasureIndexMap []TreasureMap) error {
-	var err error
-	u.TreasureIdxMap = nulls.String{}
-	DB.ValidateAndSave(u)
-	treasureString, err := json.Marshal(treasureIndexMap)
+	u.TreasureIdxMap = TreasureIdxMap{Version: TreasureIdxMapVersion, Treasures: treasureIndexMap}
+	vErr, err := DB.ValidateAndSave(u)
+	if err == nil && vErr.HasAny() {
+		err = errors.New(vErr.Error())
+	}
 	if err != nil {
 		raven.CaptureError(err, nil)
-		return err
 	}
-	u.TreasureIdxMap = nulls.String{string(treasureString), true}
-	DB.ValidateAndSave(u)
-	return nil
+	return err
 }
 
 func (u *UploadSession) BulkMarkDataMapsAsUnassigned() error {
-	err := DB.RawQuery("UPDATE data_maps SET status = ? "+
-		"WHERE genesis_hash = ? AND status = ? AND message != ?",
-		Unassigned,
-		u.GenesisHash,
-		Pending,
-		DataMap{}.Message).All(&[]DataMap{})
-	return err
+	return DataMapQuery{
+		GenesisHash: u.GenesisHash,
+		Statuses:    []DataMapStatus{Pending},
+		WithMessage: true,
+	}.UpdateStatus(Unassigned)
 }
 
-func getStoragePeg() int {
-	return 1 // TODO: write code to query smart contract to get real storage peg
+func (u *UploadSession) GetTreasureStatus() string {
+	switch u.TreasureStatus {
+	case TreasureUnburied:
+		return "unburied"
+	case TreasureBuried:
+		return "buried"
+	default:
+		return "error"
+	}
+}
+
+func (u *UploadSession) GetDataMapsStatus() string {
+	switch u.DataMapsStatus {
+	case DataMapsPreparing:
+		return "preparing"
+	case DataMapsReady:
+		return "ready"
+	default:
+		return "error"
+	}
 }
 
 func (u *UploadSession) GetPaymentStatus() string {
@@ -253,16 +441,100 @@ func (u *UploadSession) GetPaymentStatus() string {
 		return "pending"
 	case PaymentStatusPaid:
 		return "paid"
+	case PaymentStatusUnderpaid:
+		return "underpaid"
+	case PaymentStatusOverpaid:
+		return "overpaid"
 	default:
 		return "error"
 	}
 }
 
+// ApplyPayment credits a confirmed PRL transfer to the session and updates
+// PaymentStatus by comparing everything received so far with TotalCost.
+func (u *UploadSession) ApplyPayment(amount oyster_utils.Amount) {
+	u.PaymentReceived = u.PaymentReceived.Add(amount)
+
+	switch u.PaymentReceived.Cmp(u.TotalCost) {
+	case -1:
+		u.PaymentStatus = PaymentStatusUnderpaid
+	case 1:
+		u.PaymentStatus = PaymentStatusOverpaid
+	default:
+		u.PaymentStatus = PaymentStatusPaid
+	}
+}
+
+// GetUnpaidAlphaSession returns the alpha session for genesisHash if no
+// payment has been received for it yet, or nil.
+func GetUnpaidAlphaSession(genesisHash string) (*UploadSession, error) {
+	sessions := []UploadSession{}
+	err := DB.Where("genesis_hash = ? AND type = ? AND payment_status = ?",
+		genesisHash, SessionTypeAlpha, PaymentStatusPending).All(&sessions)
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+	return &sessions[0], nil
+}
+
+// GetUnpaidBetaSession returns the beta session for genesisHash if no
+// payment has been received for it yet, or nil.
+func GetUnpaidBetaSession(genesisHash string) (*UploadSession, error) {
+	sessions := []UploadSession{}
+	err := DB.Where("genesis_hash = ? AND type = ? AND payment_status = ?",
+		genesisHash, SessionTypeBeta, PaymentStatusPending).All(&sessions)
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+	return &sessions[0], nil
+}
+
+// Delete removes the session and its data maps.
+func (u *UploadSession) Delete() error {
+	return DB.Transaction(func(tx *pop.Connection) error {
+		// Destroyed first so a batch of data maps still being built is
+		// waited for, and deleted too.
+		err := tx.Destroy(u)
+		if err != nil {
+			return err
+		}
+		return DataMapQuery{GenesisHash: u.GenesisHash}.On(tx).Delete()
+	})
+}
+
+// GetSessionByInvoiceAddress returns the session whose invoice is paid to
+// ethAddr, or nil if there is none.
+func GetSessionByInvoiceAddress(ethAddr string) (*UploadSession, error) {
+	return getSessionByInvoiceAddress(DB, ethAddr)
+}
+
+func getSessionByInvoiceAddress(tx *pop.Connection, ethAddr string) (*UploadSession, error) {
+	return selectSessionByInvoiceAddress(tx, ethAddr, "")
+}
+
+// lockSessionByInvoiceAddress is getSessionByInvoiceAddress, locking the
+// session until tx ends.
+func lockSessionByInvoiceAddress(tx *pop.Connection, ethAddr string) (*UploadSession, error) {
+	return selectSessionByInvoiceAddress(tx, ethAddr, " FOR UPDATE")
+}
+
+func selectSessionByInvoiceAddress(tx *pop.Connection, ethAddr string, lock string) (*UploadSession, error) {
+	sessions := []UploadSession{}
+	err := tx.RawQuery("SELECT * from upload_sessions WHERE "+
+		"(type = ? AND eth_addr_alpha = ?) OR (type = ? AND eth_addr_beta = ?)"+lock,
+		SessionTypeAlpha, ethAddr, SessionTypeBeta, ethAddr).All(&sessions)
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+	return &sessions[0], nil
+}
+
 func GetSessionsByAge() ([]UploadSession, error) {
 	sessionsByAge := []UploadSession{}
 
-	err := DB.RawQuery("SELECT * from upload_sessions WHERE payment_status = ? AND "+
-		"treasure_status = ? ORDER BY created_at asc", PaymentStatusPaid, TreasureBuried).All(&sessionsByAge)
+	err := DB.RawQuery("SELECT * from upload_sessions WHERE payment_status IN (?, ?) AND "+
+		"treasure_status = ? ORDER BY created_at asc",
+		PaymentStatusPaid, PaymentStatusOverpaid, TreasureBuried).All(&sessionsByAge)
 
 	if err != nil {
 		raven.CaptureError(err, nil)
@@ -277,8 +549,8 @@ func GetSessionsByAge() ([]UploadSession, error) {
 func GetSessionsThatNeedTreasure() ([]UploadSession, error) {
 	unburiedSessions := []UploadSession{}
 
-	err := DB.Where("payment_status = ? AND treasure_status = ?",
-		PaymentStatusPaid, TreasureUnburied).All(&unburiedSessions)
+	err := DB.Where("payment_status IN (?, ?) AND treasure_status = ? AND data_maps_status = ?",
+		PaymentStatusPaid, PaymentStatusOverpaid, TreasureUnburied, DataMapsReady).All(&unburiedSessions)
 
 	return unburiedSessions, err
 }
@@ -286,8 +558,8 @@ func GetSessionsThatNeedTreasure() ([]UploadSession, error) {
 func GetReadySessions() ([]UploadSession, error) {
 	readySessions := []UploadSession{}
 
-	err := DB.Where("payment_status = ? AND treasure_status = ?",
-		PaymentStatusPaid, TreasureBuried).All(&readySessions)
+	err := DB.Where("payment_status IN (?, ?) AND treasure_status = ?",
+		PaymentStatusPaid, PaymentStatusOverpaid, TreasureBuried).All(&readySessions)
 
 	return readySessions, err
 }
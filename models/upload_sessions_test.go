@@ -1,8 +1,9 @@
 package models_test
 
 import (
-	"fmt"
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/utils"
 	"time"
 )
 
@@ -31,10 +32,119 @@ func (ms *ModelSuite) Test_StartUploadSession() {
 	ms.Equal(fileSizeBytes, uSession.FileSizeBytes)
 	ms.Equal(2, uSession.NumChunks)
 	ms.Equal(models.SessionTypeAlpha, uSession.Type)
-	ms.Equal(2.0, uSession.TotalCost)
+	ms.Equal("0.000000124", uSession.TotalCost.String()) // 62 bytes for 2 years
+	ms.True(uSession.PriceQuotedAt.Valid)
 	ms.Equal(2, uSession.StorageLengthInYears)
 }
 
+func (ms *ModelSuite) Test_StartUploadSession_PreparesInBatches() {
+	defer func(batchSize int) { models.DataMapsBatchSize = batchSize }(models.DataMapsBatchSize)
+	models.DataMapsBatchSize = 3
+
+	// The same data maps built at once, to compare with.
+	_, err := models.BuildDataMaps("genHashBatches", 7)
+	ms.Nil(err)
+	expected, err := models.DataMapQuery{GenesisHash: "genHashBatches", Order: models.ChunkOrderAsc}.All()
+	ms.Nil(err)
+	ms.Nil(models.DataMapQuery{GenesisHash: "genHashBatches"}.Delete())
+
+	u := models.UploadSession{
+		GenesisHash:   "genHashBatches",
+		FileSizeBytes: 123,
+		NumChunks:     7,
+	}
+	vErr, err := u.StartUploadSession()
+	ms.Nil(err)
+	ms.Equal(0, len(vErr.Errors))
+	ms.True(u.Preparing())
+
+	sessions, err := models.GetPreparingSessions()
+	ms.Nil(err)
+	ms.Equal(1, len(sessions))
+
+	for preparing := true; preparing; {
+		preparing, err = models.BuildDataMapsBatch(u.ID)
+		ms.Nil(err)
+	}
+
+	session := models.UploadSession{}
+	ms.Nil(ms.DB.Find(&session, u.ID))
+	ms.False(session.Preparing())
+
+	// Building a session that is ready adds nothing.
+	preparing, err := models.BuildDataMapsBatch(u.ID)
+	ms.Nil(err)
+	ms.False(preparing)
+
+	dataMaps, err := models.DataMapQuery{GenesisHash: "genHashBatches", Order: models.ChunkOrderAsc}.All()
+	ms.Nil(err)
+	ms.Equal(len(expected), len(dataMaps))
+	for i := range expected {
+		ms.Equal(i, dataMaps[i].ChunkIdx)
+		ms.Equal(expected[i].Hash, dataMaps[i].Hash)
+		ms.Equal(expected[i].Address, dataMaps[i].Address)
+	}
+}
+
+func (ms *ModelSuite) Test_StartUploadSession_ProratesPrice() {
+	storagePeg := models.StoragePeg
+	defer func() { models.StoragePeg = storagePeg }()
+	models.StoragePeg = func() oyster_utils.Amount {
+		return oyster_utils.AmountFromUnits(2)
+	}
+
+	u := models.UploadSession{
+		Type:                 models.SessionTypeAlpha,
+		GenesisHash:          "genHashProrated",
+		FileSizeBytes:        oyster_utils.ConvertToTrytes(250000000), // a quarter GB
+		NumChunks:            2,
+		StorageLengthInYears: 3,
+	}
+	_, err := u.StartUploadSession()
+	ms.Nil(err)
+
+	ms.Equal("1.5", u.TotalCost.String())
+}
+
+func (ms *ModelSuite) Test_GetInvoice_QuoteExpiry() {
+	quotedAt := time.Now().Add(-models.PriceQuoteTTL - time.Minute)
+	u := models.UploadSession{
+		Type:          models.SessionTypeAlpha,
+		TotalCost:     oyster_utils.AmountFromUnits(1),
+		PriceQuotedAt: nulls.NewTime(quotedAt),
+	}
+
+	invoice := u.GetInvoice()
+	ms.Equal(quotedAt, invoice.PriceQuotedAt)
+	ms.Equal(quotedAt.Add(models.PriceQuoteTTL), invoice.ExpiresAt)
+	ms.True(u.QuoteExpired())
+
+	u.PriceQuotedAt = nulls.NewTime(time.Now())
+	ms.False(u.QuoteExpired())
+}
+
+func (ms *ModelSuite) Test_GetUnpaidAlphaSession() {
+	u := models.UploadSession{
+		Type:          models.SessionTypeAlpha,
+		GenesisHash:   "genHashUnpaid",
+		FileSizeBytes: 123,
+		NumChunks:     2,
+	}
+	_, err := u.StartUploadSession()
+	ms.Nil(err)
+
+	session, err := models.GetUnpaidAlphaSession("genHashUnpaid")
+	ms.Nil(err)
+	ms.Equal(u.ID, session.ID)
+
+	u.PaymentStatus = models.PaymentStatusPaid
+	ms.Nil(ms.DB.Save(&u))
+
+	session, err = models.GetUnpaidAlphaSession("genHashUnpaid")
+	ms.Nil(err)
+	ms.Nil(session)
+}
+
 func (ms *ModelSuite) Test_DataMapsForSession() {
 	genHash := "genHashTest"
 	fileSizeBytes := 123
@@ -71,29 +181,32 @@ func (ms *ModelSuite) Test_DataMapsForSession() {
 func (ms *ModelSuite) Test_TreasureMapGetterAndSetter() {
 	genHash := "genHashTest"
 	fileSizeBytes := 123
-	numChunks := 2
+	numChunks := 2*oyster_utils.FileSectorInChunkSize + 100 // Three sectors
 	storageLengthInYears := 3
 
 	// This map seems pointless but it makes the testing
 	// in the for loop later on a bit simpler
 	t := map[int]models.TreasureMap{}
 	t[5] = models.TreasureMap{
-		Sector: 1,
+		Sector: 0,
 		Idx:    5,
 		Key:    "firstKey",
 	}
-	t[78] = models.TreasureMap{
-		Sector: 2,
-		Idx:    78,
+	t[oyster_utils.FileSectorInChunkSize+78] = models.TreasureMap{
+		Sector: 1,
+		Idx:    oyster_utils.FileSectorInChunkSize + 78,
 		Key:    "secondKey",
 	}
+	t[2*oyster_utils.FileSectorInChunkSize+99] = models.TreasureMap{
+		Sector: 2,
+		Idx:    2*oyster_utils.FileSectorInChunkSize + 99,
+		Key:    "thirdKey",
+	}
 
 	treasureIndexArray := make([]models.TreasureMap, 0)
 	treasureIndexArray = append(treasureIndexArray, t[5])
-	treasureIndexArray = append(treasureIndexArray, t[78])
-
-	// do not format this.  It needs to not have new lines in it
-	testMap := `[{"sector":` + fmt.Sprint(t[5].Sector) + `,"idx":` + fmt.Sprint(t[5].Idx) + `,"key":"` + fmt.Sprint(t[5].Key) + `"},{"sector":` + fmt.Sprint(t[78].Sector) + `,"idx":` + fmt.Sprint(t[78].Idx) + `,"key":"` + fmt.Sprint(t[78].Key) + `"}]`
+	treasureIndexArray = append(treasureIndexArray, t[oyster_utils.FileSectorInChunkSize+78])
+	treasureIndexArray = append(treasureIndexArray, t[2*oyster_utils.FileSectorInChunkSize+99])
 
 	u := models.UploadSession{
 		GenesisHash:          genHash,
@@ -111,17 +224,23 @@ func (ms *ModelSuite) Test_TreasureMapGetterAndSetter() {
 	session := models.UploadSession{}
 	err = ms.DB.Where("genesis_hash = ?", u.GenesisHash).First(&session)
 
-	ms.Equal(testMap, session.TreasureIdxMap.String)
+	ms.Equal(models.TreasureIdxMapVersion, session.TreasureIdxMap.Version)
+	ms.Equal(3, len(session.TreasureIdxMap.Treasures))
 
 	ms.Equal(treasureIndexArray, treasureIdxMap)
-	ms.Equal(2, len(treasureIdxMap))
+	ms.Equal(3, len(treasureIdxMap))
 
-	for _, entry := range treasureIdxMap {
+	// The keys are stored encrypted.
+	for _, entry := range session.TreasureIdxMap.Treasures {
 		_, ok := t[entry.Idx]
 		ms.Equal(true, ok)
 		ms.Equal(t[entry.Idx].Sector, entry.Sector)
-		ms.Equal(t[entry.Idx].Key, entry.Key)
 		ms.Equal(t[entry.Idx].Idx, entry.Idx)
+		ms.True(oyster_utils.IsEncryptedEthKey(entry.Key))
+
+		key, err := entry.PrivateKey()
+		ms.Nil(err)
+		ms.Equal(t[entry.Idx].Key, key)
 	}
 }
 
@@ -204,3 +323,55 @@ func (ms *ModelSuite) Test_GetSessionsByAge() {
 	ms.Equal("genHash2", sessions[2].GenesisHash)
 	ms.Equal(3, len(sessions))
 }
+
+func (ms *ModelSuite) Test_RevealTreasure() {
+	alphaSecret, _ := oyster_utils.NewTreasureSecret()
+	betaSecret, _ := oyster_utils.NewTreasureSecret()
+	u := models.UploadSession{
+		Type:                   models.SessionTypeBeta,
+		GenesisHash:            "genHashReveal",
+		FileSizeBytes:          123,
+		NumChunks:              2,
+		TreasureSecret:         nulls.NewString(betaSecret),
+		PeerTreasureCommitment: nulls.NewString(oyster_utils.TreasureCommitment(alphaSecret)),
+	}
+	_, err := u.StartUploadSession()
+	ms.Nil(err)
+
+	otherSecret, _ := oyster_utils.NewTreasureSecret()
+	_, err = u.RevealTreasure(otherSecret)
+	ms.Equal(models.ErrTreasureRevealMismatch, err)
+	ms.True(u.TreasureIdxMap.IsEmpty())
+
+	revealed, err := u.RevealTreasure(alphaSecret)
+	ms.Nil(err)
+	ms.Equal(betaSecret, revealed)
+
+	expected, _ := oyster_utils.TreasureIndexesFromSecrets(oyster_utils.ConvertToByte(123), alphaSecret, betaSecret)
+	session := models.UploadSession{}
+	ms.Nil(ms.DB.Find(&session, u.ID))
+	ms.Equal(expected, session.TreasureIdxMap.SectorIndexes())
+}
+
+func (ms *ModelSuite) Test_RevealTreasure_Invalid() {
+	alphaSecret, _ := oyster_utils.NewTreasureSecret()
+	betaSecret, _ := oyster_utils.NewTreasureSecret()
+	u := models.UploadSession{
+		Type:        models.SessionTypeBeta,
+		GenesisHash: "genHashRevealInvalid",
+		// Far more sectors than the session has chunks for.
+		FileSizeBytes:          6 * oyster_utils.FileSectorInChunkSize * oyster_utils.FileChunkSizeInByte,
+		NumChunks:              2,
+		TreasureSecret:         nulls.NewString(betaSecret),
+		PeerTreasureCommitment: nulls.NewString(oyster_utils.TreasureCommitment(alphaSecret)),
+	}
+	_, err := u.StartUploadSession()
+	ms.Nil(err)
+
+	_, err = u.RevealTreasure(alphaSecret)
+	ms.NotNil(err)
+
+	session := models.UploadSession{}
+	ms.Nil(ms.DB.Find(&session, u.ID))
+	ms.True(session.TreasureIdxMap.IsEmpty())
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"time"
+
+	"github.com/iotaledger/giota"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/pkg/errors"
+)
+
+/*
+Every chunk keeps the trytes it was attached to the tangle with, so a failed
+broadcast does not throw away its PoW. Broadcasts are retried with backoff,
+then left to UpdateTimeOutDataMaps, which broadcasts the kept trytes again
+until they are too old to be confirmed. Only then is the PoW lost and the
+chunk sent to be attached again.
+*/
+
+var (
+	// How many times a failed broadcast is retried right away.
+	IotaBroadcastRetries = 3
+
+	// Wait before the first retry, doubled on every retry after it.
+	iotaBroadcastBackoff = time.Second
+
+	// How long after being attached trytes are still broadcast. The tips
+	// they approve are too old to be confirmed after it.
+	AttachedTrytesMaxAge = 10 * time.Minute
+)
+
+func (s *IotaService) broadcastWithRetry(trytes []giota.Transaction, broadcastNodes []string) error {
+	backoff := iotaBroadcastBackoff
+
+	for attempt := 0; ; attempt++ {
+		err := s.Nodes.Broadcast(trytes, broadcastNodes)
+		if err == nil || attempt >= IotaBroadcastRetries {
+			return err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+		// The nodes that failed are skipped, pick healthy ones again.
+		broadcastNodes = nil
+	}
+}
+
+// keepAttachedTrytes stores on each chunk the transaction it was attached in.
+func keepAttachedTrytes(chunks []models.DataMap, trytes []giota.Transaction) error {
+	byAddress := map[giota.Address]giota.Transaction{}
+	for _, tx := range trytes {
+		byAddress[tx.Address] = tx
+	}
+
+	for _, chunk := range chunks {
+		tx, ok := byAddress[giota.Address(chunk.Address)]
+		if !ok {
+			continue
+		}
+		if err := models.SetDataMapAttachedTrytes(chunk.ID, string(tx.Trytes())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AttachedTransactions splits chunks into those whose kept trytes can still be
+// broadcast, with their transactions, and those whose PoW is lost.
+func AttachedTransactions(chunks []models.DataMap) (transactions []giota.Transaction,
+	attached []models.DataMap, lost []models.DataMap) {
+
+	for _, chunk := range chunks {
+		tx, err := attachedTransaction(chunk)
+		if err != nil || time.Since(attachmentTime(tx)) > AttachedTrytesMaxAge {
+			lost = append(lost, chunk)
+			continue
+		}
+		transactions = append(transactions, *tx)
+		attached = append(attached, chunk)
+	}
+	return transactions, attached, lost
+}
+
+func attachedTransaction(chunk models.DataMap) (*giota.Transaction, error) {
+	if chunk.AttachedTrytes == "" {
+		return nil, errors.New("chunk has not been attached")
+	}
+	return giota.NewTransaction(giota.Trytes(chunk.AttachedTrytes))
+}
+
+// attachmentTime returns when tx was attached, from its attachment timestamp
+// in milliseconds.
+func attachmentTime(tx *giota.Transaction) time.Time {
+	millis := tx.AttachmentTimestamp.Trits().Int()
+	return time.Unix(0, millis*int64(time.Millisecond))
+}
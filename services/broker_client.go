@@ -0,0 +1,252 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+/*
+Brokers call each other with signed requests. The signature is an HMAC-SHA256,
+keyed with BROKER_SECRET, of the timestamp, method, path and body of the
+request. Requests that fail or get a 5xx are retried with backoff, a 4xx means
+the other broker refused and is not retried. Without a secret requests are
+neither sent nor accepted.
+*/
+
+const (
+	BrokerTimestampHeader = "X-Broker-Timestamp"
+	BrokerSignatureHeader = "X-Broker-Signature"
+
+	// How far a signed request's timestamp may be from now.
+	BrokerSignatureMaxAge = 5 * time.Minute
+)
+
+var (
+	// How other brokers reach this one, set by BROKER_ENDPOINT. This broker
+	// does not join the peer registry while it is empty.
+	BrokerEndpoint string
+
+	// Brokers to register with before any have registered with us, set by
+	// BROKER_PEERS as a comma separated list.
+	BrokerPeers []string
+
+	// Scheme and port used for brokers given without them.
+	BrokerURLScheme = "http"
+	BrokerPort      = "3000"
+
+	// How long a single request to another broker may take.
+	BrokerRequestTimeout = 10 * time.Second
+
+	// How many times a failed request to another broker is retried.
+	BrokerRequestRetries = 3
+
+	// Wait before the first retry, doubled on every retry after it.
+	brokerRetryBackoff = 500 * time.Millisecond
+
+	brokerSecret []byte
+)
+
+var (
+	ErrNoBrokerSecret         = errors.New("BROKER_SECRET is not set")
+	ErrBrokerUnsigned         = errors.New("broker request is not signed")
+	ErrBrokerInvalidSignature = errors.New("broker request signature is invalid")
+	ErrBrokerSignatureExpired = errors.New("broker request signature has expired")
+)
+
+// BrokerError is returned when another broker answers with an error status.
+type BrokerError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *BrokerError) Error() string {
+	return fmt.Sprintf("broker responded %d: %s", e.StatusCode, e.Body)
+}
+
+// Refused tells whether the broker turned the request down, rather than
+// failing to handle it.
+func (e *BrokerError) Refused() bool {
+	return e.StatusCode >= 400 && e.StatusCode < 500
+}
+
+// Sent to another broker to register this one in its peer registry.
+type BrokerRegistrationReq struct {
+	Endpoint   string `json:"endpoint"`
+	EthAddress string `json:"ethAddress"`
+	Capacity   int    `json:"capacity"`
+}
+
+// Sent to the brokers this one is registered with to say it is still up.
+type BrokerHeartbeatReq struct {
+	Endpoint string `json:"endpoint"`
+	Capacity int    `json:"capacity"`
+}
+
+func init() {
+	BrokerEndpoint = os.Getenv("BROKER_ENDPOINT")
+	for _, peer := range strings.Split(os.Getenv("BROKER_PEERS"), ",") {
+		if peer = strings.TrimSpace(peer); peer != "" {
+			BrokerPeers = append(BrokerPeers, peer)
+		}
+	}
+	if scheme := os.Getenv("BROKER_URL_SCHEME"); scheme != "" {
+		BrokerURLScheme = scheme
+	}
+	if port := os.Getenv("BROKER_PORT"); port != "" {
+		BrokerPort = port
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("BROKER_REQUEST_TIMEOUT")); err == nil {
+		BrokerRequestTimeout = timeout
+	}
+	if retries, err := strconv.Atoi(os.Getenv("BROKER_REQUEST_RETRIES")); err == nil && retries >= 0 {
+		BrokerRequestRetries = retries
+	}
+	SetBrokerSecret(os.Getenv("BROKER_SECRET"))
+}
+
+// SetBrokerSecret sets the secret requests between brokers are signed with.
+// Requests are refused both ways while it is empty.
+func SetBrokerSecret(secret string) {
+	brokerSecret = []byte(secret)
+}
+
+// BrokerURL returns the URL of path on broker, which may be given as a host,
+// host:port or full URL.
+func BrokerURL(broker string, path string) (string, error) {
+	if !strings.Contains(broker, "://") {
+		broker = BrokerURLScheme + "://" + broker
+	}
+
+	brokerURL, err := url.Parse(broker)
+	if err != nil || brokerURL.Host == "" {
+		return "", errors.Errorf("invalid broker address %q", broker)
+	}
+	if brokerURL.Port() == "" {
+		brokerURL.Host = net.JoinHostPort(brokerURL.Hostname(), BrokerPort)
+	}
+	brokerURL.Path = path
+
+	return brokerURL.String(), nil
+}
+
+// PostToBroker POSTs reqBody as JSON to path on broker and parses the
+// response into resBody.
+func PostToBroker(broker string, path string, reqBody interface{}, resBody interface{}) error {
+	if len(brokerSecret) == 0 {
+		return ErrNoBrokerSecret
+	}
+
+	brokerURL, err := BrokerURL(broker, path)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return errors.Wrap(err, "could not encode broker request")
+	}
+
+	client := &http.Client{Timeout: BrokerRequestTimeout}
+	backoff := brokerRetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		err = postToBroker(client, brokerURL, body, resBody)
+
+		brokerErr, isBrokerErr := err.(*BrokerError)
+		if err == nil || (isBrokerErr && brokerErr.Refused()) || attempt >= BrokerRequestRetries {
+			return err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func postToBroker(client *http.Client, brokerURL string, body []byte, resBody interface{}) error {
+	req, err := http.NewRequest("POST", brokerURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "could not create broker request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	SignBrokerRequest(req, body)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "broker request failed")
+	}
+	defer res.Body.Close()
+
+	resBytes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrap(err, "could not read broker response")
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return &BrokerError{StatusCode: res.StatusCode, Body: string(resBytes)}
+	}
+
+	return errors.Wrap(json.Unmarshal(resBytes, resBody), "could not parse broker response")
+}
+
+// SignBrokerRequest signs req, sent with body, for another broker to verify.
+func SignBrokerRequest(req *http.Request, body []byte) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(BrokerTimestampHeader, timestamp)
+	req.Header.Set(BrokerSignatureHeader, brokerSignature(timestamp, req.Method, req.URL.Path, body))
+}
+
+// VerifyBrokerRequest checks req was signed by a broker sharing our secret.
+// The body is read and put back for the handler.
+func VerifyBrokerRequest(req *http.Request) error {
+	if len(brokerSecret) == 0 {
+		return ErrNoBrokerSecret
+	}
+
+	timestamp := req.Header.Get(BrokerTimestampHeader)
+	signature := req.Header.Get(BrokerSignatureHeader)
+	if timestamp == "" || signature == "" {
+		return ErrBrokerUnsigned
+	}
+
+	unixTime, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrBrokerInvalidSignature
+	}
+	age := time.Since(time.Unix(unixTime, 0))
+	if age > BrokerSignatureMaxAge || age < -BrokerSignatureMaxAge {
+		return ErrBrokerSignatureExpired
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return errors.Wrap(err, "could not read broker request")
+	}
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	expected := brokerSignature(timestamp, req.Method, req.URL.Path, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrBrokerInvalidSignature
+	}
+	return nil
+}
+
+func brokerSignature(timestamp string, method string, path string, body []byte) string {
+	mac := hmac.New(sha256.New, brokerSecret)
+	mac.Write([]byte(timestamp + "\n" + method + "\n" + path + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
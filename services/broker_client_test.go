@@ -0,0 +1,135 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type brokerTestBody struct {
+	Value string `json:"value"`
+}
+
+func setUpBrokerClientTest() func() {
+	retryBackoff := brokerRetryBackoff
+	brokerRetryBackoff = time.Millisecond
+	SetBrokerSecret("testSecret")
+
+	return func() {
+		brokerRetryBackoff = retryBackoff
+		SetBrokerSecret("")
+	}
+}
+
+func Test_BrokerURL(t *testing.T) {
+	cases := map[string]string{
+		"1.2.3.4":               "http://1.2.3.4:3000/api/v2/upload-sessions/beta",
+		"1.2.3.4:4000":          "http://1.2.3.4:4000/api/v2/upload-sessions/beta",
+		"https://beta.example":  "https://beta.example:3000/api/v2/upload-sessions/beta",
+		"http://1.2.3.4:4000/x": "http://1.2.3.4:4000/api/v2/upload-sessions/beta",
+	}
+	for broker, expected := range cases {
+		brokerURL, err := BrokerURL(broker, "/api/v2/upload-sessions/beta")
+		if err != nil || brokerURL != expected {
+			t.Fatalf("expected %v for %v but got %v, %v", expected, broker, brokerURL, err)
+		}
+	}
+}
+
+func Test_PostToBroker_Signed(t *testing.T) {
+	defer setUpBrokerClientTest()()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := VerifyBrokerRequest(r); err != nil {
+			w.WriteHeader(401)
+			return
+		}
+		req := brokerTestBody{}
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(brokerTestBody{Value: req.Value + "Res"})
+	}))
+	defer server.Close()
+
+	res := brokerTestBody{}
+	if err := PostToBroker(server.URL, "/beta", brokerTestBody{Value: "test"}, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Value != "testRes" {
+		t.Fatalf("unexpected response %+v", res)
+	}
+}
+
+func Test_PostToBroker_RetriesFailures(t *testing.T) {
+	defer setUpBrokerClientTest()()
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts <= BrokerRequestRetries {
+			w.WriteHeader(503)
+			return
+		}
+		w.Write([]byte(`{"value":"ok"}`))
+	}))
+	defer server.Close()
+
+	res := brokerTestBody{}
+	if err := PostToBroker(server.URL, "/beta", brokerTestBody{}, &res); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != BrokerRequestRetries+1 {
+		t.Fatalf("expected %v attempts but got %v", BrokerRequestRetries+1, attempts)
+	}
+}
+
+func Test_PostToBroker_RefusalIsNotRetried(t *testing.T) {
+	defer setUpBrokerClientTest()()
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(422)
+	}))
+	defer server.Close()
+
+	err := PostToBroker(server.URL, "/beta", brokerTestBody{}, &brokerTestBody{})
+	brokerErr, ok := err.(*BrokerError)
+	if !ok || !brokerErr.Refused() {
+		t.Fatalf("expected a refusal but got %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected 1 attempt but got %v", attempts)
+	}
+}
+
+func Test_VerifyBrokerRequest(t *testing.T) {
+	defer setUpBrokerClientTest()()
+
+	req := httptest.NewRequest("POST", "/beta", nil)
+	if err := VerifyBrokerRequest(req); err != ErrBrokerUnsigned {
+		t.Fatalf("expected ErrBrokerUnsigned but got %v", err)
+	}
+
+	req.Header.Set(BrokerTimestampHeader, "1")
+	req.Header.Set(BrokerSignatureHeader, "abc")
+	if err := VerifyBrokerRequest(req); err != ErrBrokerSignatureExpired {
+		t.Fatalf("expected ErrBrokerSignatureExpired but got %v", err)
+	}
+
+	SignBrokerRequest(req, []byte("other body"))
+	if err := VerifyBrokerRequest(req); err != ErrBrokerInvalidSignature {
+		t.Fatalf("expected ErrBrokerInvalidSignature but got %v", err)
+	}
+
+	// Nothing is accepted without a secret to check it with.
+	SetBrokerSecret("")
+	SignBrokerRequest(req, nil)
+	if err := VerifyBrokerRequest(req); err != ErrNoBrokerSecret {
+		t.Fatalf("expected ErrNoBrokerSecret but got %v", err)
+	}
+	if err := PostToBroker("1.2.3.4", "/beta", brokerTestBody{}, &brokerTestBody{}); err != ErrNoBrokerSecret {
+		t.Fatalf("expected ErrNoBrokerSecret but got %v", err)
+	}
+}
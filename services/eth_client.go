@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/getsentry/raven-go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// How long a single request to the ethereum node may take.
+	EthCallTimeout = 30 * time.Second
+
+	// How long dialing the ethereum node may take.
+	EthDialTimeout = 10 * time.Second
+
+	// Bounds of the wait between failed dial attempts.
+	ethMinReconnectBackoff = 1 * time.Second
+	ethMaxReconnectBackoff = 2 * time.Minute
+)
+
+var (
+	ErrEthNodeUnreachable = errors.New("ethereum node is unreachable")
+	ErrEthCallTimeout     = errors.New("ethereum node did not answer in time")
+)
+
+// Singleton client
+var (
+	client           *ethclient.Client
+	mtx              sync.Mutex
+	lastDialAttempt  time.Time
+	reconnectBackoff time.Duration
+
+	// Held while dialing so only one caller dials at a time. mtx is not held
+	// while dialing, so callers never wait on it for a slow dial.
+	dialMtx sync.Mutex
+)
+
+// sharedClient lazily dials the ethereum node. After a failed dial it
+// refuses to redial until the backoff has passed, doubling the backoff on
+// every consecutive failure.
+func sharedClient() (*ethclient.Client, error) {
+	if c := currentClient(); c != nil {
+		return c, nil
+	}
+
+	// Callers arriving during a dial wait for it rather than dialing again.
+	dialMtx.Lock()
+	defer dialMtx.Unlock()
+
+	mtx.Lock()
+	if client != nil {
+		defer mtx.Unlock()
+		return client, nil
+	}
+	if time.Since(lastDialAttempt) < reconnectBackoff {
+		mtx.Unlock()
+		return nil, ErrEthNodeUnreachable
+	}
+	lastDialAttempt = time.Now()
+	mtx.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), EthDialTimeout)
+	defer cancel()
+
+	c, err := ethclient.DialContext(ctx, ethUrl)
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if err != nil {
+		reconnectBackoff = nextReconnectBackoff(reconnectBackoff)
+		raven.CaptureError(err, nil)
+		return nil, errors.Wrap(ErrEthNodeUnreachable, err.Error())
+	}
+
+	// Sets Singleton
+	client = c
+	reconnectBackoff = 0
+
+	return client, nil
+}
+
+func currentClient() *ethclient.Client {
+	mtx.Lock()
+	defer mtx.Unlock()
+	return client
+}
+
+// dropClient closes the shared client so the next call redials.
+func dropClient() {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if client == nil {
+		return
+	}
+	client.Close()
+	client = nil
+	reconnectBackoff = nextReconnectBackoff(reconnectBackoff)
+	lastDialAttempt = time.Now()
+}
+
+// handleCallError drops the shared client if err shows the connection to
+// the node is gone, and returns err unchanged. A call that timed out is
+// reported as ErrEthCallTimeout and keeps the connection, a slow node is not
+// a dropped one.
+func handleCallError(err error) error {
+	if errors.Cause(err) == context.DeadlineExceeded {
+		return errors.Wrap(ErrEthCallTimeout, err.Error())
+	}
+	if isConnectionError(err) {
+		dropClient()
+	}
+	return err
+}
+
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	switch errors.Cause(err) {
+	case rpc.ErrClientQuit, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	}
+	_, isNetErr := errors.Cause(err).(net.Error)
+	return isNetErr
+}
+
+func nextReconnectBackoff(current time.Duration) time.Duration {
+	if current < ethMinReconnectBackoff {
+		return ethMinReconnectBackoff
+	}
+	if current*2 > ethMaxReconnectBackoff {
+		return ethMaxReconnectBackoff
+	}
+	return current * 2
+}
+
+// ethCallContext returns the context every request to the node runs with.
+func ethCallContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), EthCallTimeout)
+}
+
+// checkHealth reports whether the ethereum node can currently be reached.
+func checkHealth() error {
+	ethCl, err := backend()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := ethCallContext()
+	defer cancel()
+
+	// Any cheap read works as a liveness check.
+	if _, err = ethCl.SuggestGasPrice(ctx); err != nil {
+		handleCallError(err)
+		return errors.Wrap(ErrEthNodeUnreachable, err.Error())
+	}
+	return nil
+}
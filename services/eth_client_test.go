@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+)
+
+func Test_NextReconnectBackoff(t *testing.T) {
+	if nextReconnectBackoff(0) != ethMinReconnectBackoff {
+		t.Fatalf("the first backoff should be the minimum backoff")
+	}
+
+	if nextReconnectBackoff(4*time.Second) != 8*time.Second {
+		t.Fatalf("backoff should double on every consecutive failure")
+	}
+
+	if nextReconnectBackoff(ethMaxReconnectBackoff) != ethMaxReconnectBackoff {
+		t.Fatalf("backoff should never exceed the maximum backoff")
+	}
+}
+
+func Test_IsConnectionError(t *testing.T) {
+	connectionErrors := []error{
+		rpc.ErrClientQuit,
+		io.EOF,
+		errors.Wrap(io.ErrUnexpectedEOF, "could not get gas price"),
+	}
+	for _, err := range connectionErrors {
+		if !isConnectionError(err) {
+			t.Fatalf("%v should be treated as a dropped connection", err)
+		}
+	}
+
+	if isConnectionError(nil) || isConnectionError(ErrInsufficientFunds) || isConnectionError(context.DeadlineExceeded) {
+		t.Fatalf("only connection failures should be treated as a dropped connection")
+	}
+}
+
+func Test_HandleCallError_Timeout(t *testing.T) {
+	err := handleCallError(errors.Wrap(context.DeadlineExceeded, "could not get gas price"))
+	if errors.Cause(err) != ErrEthCallTimeout {
+		t.Fatalf("expected ErrEthCallTimeout but got %v", err)
+	}
+}
+
+func Test_SharedClient_BacksOffAfterFailedDial(t *testing.T) {
+	defer func(url string) {
+		ethUrl = url
+		reconnectBackoff = 0
+		lastDialAttempt = time.Time{}
+	}(ethUrl)
+
+	ethUrl = "ws://127.0.0.1:1"
+	reconnectBackoff = 0
+	lastDialAttempt = time.Time{}
+
+	if _, err := sharedClient(); err == nil {
+		t.Fatalf("dialing an unreachable node should fail")
+	}
+
+	// A second call inside the backoff window should not redial.
+	_, err := sharedClient()
+	if err != ErrEthNodeUnreachable {
+		t.Fatalf("expected ErrEthNodeUnreachable while backing off but got %v", err)
+	}
+}
+
+func Test_CheckHealth(t *testing.T) {
+	setUpSimulatedChain(t)
+	defer tearDownSimulatedChain()
+
+	if err := checkHealth(); err != nil {
+		t.Fatalf("checkHealth should pass against a reachable node: %v", err)
+	}
+}
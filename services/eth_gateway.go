@@ -2,54 +2,146 @@ package services
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"encoding/hex"
-	"fmt"
 	"github.com/getsentry/raven-go"
 	"github.com/joho/godotenv"
 	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/utils"
+	"github.com/pkg/errors"
 	"log"
+	"math/big"
 	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 )
 
+//go:generate abigen --abi contracts/OysterPearl.abi --pkg services --type OysterPearl --out oyster_pearl.go
+
 type Eth struct {
 	SendGas             SendGas
 	ClaimPRLs           ClaimPRLs
 	GenerateEthAddr     GenerateEthAddr
 	BuryPrl             BuryPrl
+	ClaimTreasure       ClaimTreasure
 	SendETH             SendETH
 	SendPRL             SendPRL
 	GetGasPrice         GetGasPrice
 	SubscribeToTransfer SubscribeToTransfer
+	FilterTransfers     FilterTransfers
+	GetBlockHash        GetBlockHash
 	CheckBalance        CheckBalance
+	CheckPRLBalance     CheckPRLBalance
 	GetCurrentBlock     GetCurrentBlock
+	GetStoragePeg       GetStoragePeg
+	CheckHealth         CheckHealth
 }
 
 type SendGas func([]models.CompletedUpload) error
 type ClaimPRLs func([]models.CompletedUpload) error
-type GenerateEthAddr func() (addr string, privKey string, err error)
-type BuryPrl func()
-type SendETH func(fromAddr common.Address, toAddr common.Address, amt float64)
-type SendPRL func(fromAddr common.Address, toAddr common.Address, amt float64)
-type GetGasPrice func() (uint64, error)
-type SubscribeToTransfer func(brokerAddr common.Address, outCh chan<- types.Log)
-type CheckBalance func(common.Address)
-type GetCurrentBlock func()
-
-// Singleton client
+type GenerateEthAddr func() (addr string, privKey string, keyIndex int, err error)
+type BuryPrl func(session models.UploadSession, treasureMap []models.TreasureMap) error
+type ClaimTreasure func(claim *models.TreasureClaim) error
+type SendETH func(fromKey *ecdsa.PrivateKey, toAddr common.Address, amt oyster_utils.Amount) (*types.Transaction, error)
+type SendPRL func(fromKey *ecdsa.PrivateKey, toAddr common.Address, amt oyster_utils.Amount) (*types.Transaction, error)
+type GetGasPrice func() (*big.Int, error)
+type SubscribeToTransfer func(outCh chan<- types.Log, done <-chan struct{})
+type FilterTransfers func(fromBlock uint64, toBlock uint64) ([]types.Log, error)
+type GetBlockHash func(blockNumber uint64) (common.Hash, error)
+type CheckBalance func(common.Address) (*big.Int, error)
+type CheckPRLBalance func(common.Address) (*big.Int, error)
+type GetCurrentBlock func() (*types.Block, error)
+type GetStoragePeg func() oyster_utils.Amount
+type CheckHealth func() error
+
+// ethBackend is the subset of the ethclient API used by the gateway. Both
+// *ethclient.Client and go-ethereum's simulated backend satisfy it.
+type ethBackend interface {
+	bind.ContractBackend
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// ethChainReader is the part of the ethclient API that reads blocks and the
+// chain id. go-ethereum's simulated backend does not implement it.
+type ethChainReader interface {
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	NetworkID(ctx context.Context) (*big.Int, error)
+}
+
+const (
+	// Gas needed for a plain ETH transfer.
+	GasLimitETHSend uint64 = 21000
+
+	// Gas needed for an ERC20 transfer() on the PRL contract.
+	GasLimitPRLSend uint64 = 60000
+
+	// Gas needed for a treasure address to call bury() on the PRL contract.
+	GasLimitPRLBury uint64 = 100000
+
+	// Gas needed for a treasure address to call claim() on the PRL contract.
+	GasLimitPRLClaim uint64 = 100000
+
+	// How long to wait for a submitted transfer to be mined. A burial
+	// transaction that takes longer is replaced at a higher gas price.
+	EthTransferTimeout = 1 * time.Hour
+
+	// How much more a replacement transaction pays for gas. Nodes refuse
+	// replacements paying less than 10% more.
+	GasPriceBumpPercent = 12
+
+	// How many reverted transactions a treasure burial is retried after
+	// before it is given up on.
+	MaxBurialReverts = 3
+
+	// How many contract calls worth of gas an address is funded with, so a
+	// call can be replaced at a higher gas price.
+	GasFundingMargin uint64 = 2
+)
+
 var (
-	ethUrl            string
-	MainWalletAddress common.Address
-	MainWalletKey     string
-	client            *ethclient.Client
-	mtx               sync.Mutex
-	EthWrapper        Eth
+	ErrInvalidPrivateKey   = errors.New("invalid ethereum private key")
+	ErrInsufficientFunds   = errors.New("insufficient funds for transfer")
+	ErrNoContractAddress   = errors.New("no oyster pearl contract address configured")
+	ErrTransactionReverted = errors.New("ethereum transaction was reverted")
+	ErrNotTransferLog      = errors.New("log is not a PRL Transfer event")
+	ErrTreasureNotBuried   = errors.New("treasure address is not buried")
+	ErrNoChainReader       = errors.New("ethereum backend cannot read blocks")
+)
+
+// Topic of the ERC20 Transfer(address,address,uint256) event.
+var TransferEventSignature = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+var (
+	ethUrl             string
+	MainWalletAddress  common.Address
+	MainWalletKey      string
+	OysterPearlAddress common.Address
+	EthWrapper         Eth
+
+	// Serializes nonce lookup and submission so concurrent sends from the
+	// same wallet do not reuse a nonce.
+	sendMtx sync.Mutex
+
+	// Replaces the shared client when set, used to run against a simulated chain.
+	backendOverride ethBackend
+
+	// Id of the chain transactions are signed for, from ETH_CHAIN_ID or else
+	// read from the node.
+	ethChainID    *big.Int
+	ethChainIDMtx sync.Mutex
+
+	// Returns the signer every transaction is signed with.
+	chainSigner = eip155Signer
 )
 
 func init() {
@@ -60,166 +152,1160 @@ func init() {
 		raven.CaptureError(err, nil)
 	}
 
-	MainWalletAddress := os.Getenv("MAIN_WALLET_ADDRESS")
-	MainWalletKey := os.Getenv("MAIN_WALLET_KEY")
-	ethUrl := os.Getenv("ETH_NODE_URL")
-
-	fmt.Println(MainWalletAddress)
-	fmt.Println(MainWalletKey)
-	fmt.Println(ethUrl)
+	MainWalletAddress = common.HexToAddress(os.Getenv("MAIN_WALLET_ADDRESS"))
+	MainWalletKey = os.Getenv("MAIN_WALLET_KEY")
+	ethUrl = os.Getenv("ETH_NODE_URL")
+	OysterPearlAddress = common.HexToAddress(os.Getenv("OYSTER_PEARL_ADDRESS"))
+	if chainID, ok := new(big.Int).SetString(os.Getenv("ETH_CHAIN_ID"), 10); ok {
+		ethChainID = chainID
+	}
 
 	EthWrapper = Eth{
-		SendGas:         sendGas,
-		ClaimPRLs:       claimPRLs,
-		GenerateEthAddr: generateEthAddr,
-		BuryPrl:         buryPrl,
-		SendETH:         sendETH,
-		SendPRL:         sendPRL,
-		//GetGasPrice:     getGasPrice,
+		SendGas:             sendGas,
+		ClaimPRLs:           claimPRLs,
+		GenerateEthAddr:     generateEthAddr,
+		BuryPrl:             buryPrl,
+		ClaimTreasure:       claimTreasure,
+		SendETH:             sendETH,
+		SendPRL:             sendPRL,
+		GetGasPrice:         getGasPrice,
 		SubscribeToTransfer: subscribeToTransfer,
+		FilterTransfers:     filterTransfers,
+		GetBlockHash:        getBlockHash,
 		CheckBalance:        checkBalance,
+		CheckPRLBalance:     checkPRLBalance,
 		GetCurrentBlock:     getCurrentBlock,
+		GetStoragePeg:       getStoragePeg,
+		CheckHealth:         checkHealth,
+	}
+
+	// Sessions are priced with the peg read from the contract.
+	models.StoragePeg = func() oyster_utils.Amount {
+		return EthWrapper.GetStoragePeg()
 	}
 }
 
-func sharedClient() (c *ethclient.Client, err error) {
-	if client != nil {
-		return client, nil
+// backend returns the chain the gateway talks to.
+func backend() (ethBackend, error) {
+	if backendOverride != nil {
+		return backendOverride, nil
 	}
 
-	// check-lock-check pattern to avoid excessive locking.
-	mtx.Lock()
-	defer mtx.Unlock()
+	c, err := sharedClient()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// chainReader returns the backend as an ethChainReader.
+func chainReader() (ethChainReader, error) {
+	ethCl, err := backend()
+	if err != nil {
+		return nil, err
+	}
 
-	if client != nil {
-		c, err = ethclient.Dial(ethUrl)
+	reader, ok := ethCl.(ethChainReader)
+	if !ok {
+		return nil, ErrNoChainReader
+	}
+	return reader, nil
+}
+
+// eip155Signer returns the signer for the chain the gateway talks to, so
+// transactions can't be replayed on another chain.
+func eip155Signer() (types.Signer, error) {
+	ethChainIDMtx.Lock()
+	defer ethChainIDMtx.Unlock()
+
+	if ethChainID == nil {
+		reader, err := chainReader()
 		if err != nil {
-			fmt.Println("Failed to connect to Etherum node.")
-			return
+			return nil, err
 		}
 
-		// Sets Singleton
-		client = c
-	}
+		ctx, cancel := ethCallContext()
+		defer cancel()
 
-	return client, err
+		chainID, err := reader.NetworkID(ctx)
+		if err != nil {
+			return nil, errors.Wrap(handleCallError(err), "could not get chain id")
+		}
+		ethChainID = chainID
+	}
+	return types.NewEIP155Signer(ethChainID), nil
 }
 
-func generateEthAddr() (addr string, privKey string, err error) {
-	ethAccount, err := crypto.GenerateKey()
+// newTransactor returns transact options that sign for key with chainSigner.
+// bind's own transactors sign without replay protection.
+func newTransactor(key *ecdsa.PrivateKey) (*bind.TransactOpts, error) {
+	signer, err := chainSigner()
 	if err != nil {
-		return
+		return nil, err
+	}
+
+	keyAddr := crypto.PubkeyToAddress(key.PublicKey)
+	return &bind.TransactOpts{
+		From: keyAddr,
+		Signer: func(_ types.Signer, address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if address != keyAddr {
+				return nil, errors.New("not authorized to sign this account")
+			}
+			return types.SignTx(tx, signer, key)
+		},
+	}, nil
+}
+
+// generateEthAddr derives a new address from the broker's HD wallet and
+// returns it with its private key, encrypted for storage, and its derivation
+// index.
+func generateEthAddr() (addr string, privKey string, keyIndex int, err error) {
+	// Fail before reserving an index if no mnemonic is configured.
+	if _, err = sessionAccount(); err != nil {
+		return "", "", 0, err
 	}
 
+	var ethAccount *ecdsa.PrivateKey
+	for {
+		keyIndex, err = models.ReserveEthKeyIndex()
+		if err != nil {
+			return "", "", 0, err
+		}
+
+		ethAccount, err = DeriveSessionKey(keyIndex)
+		if err == ErrInvalidChildKey {
+			// Vanishingly rare, BIP32 says to skip to the next index.
+			continue
+		}
+		if err != nil {
+			return "", "", 0, err
+		}
+		break
+	}
+
+	privKey, err = oyster_utils.EncryptEthKey(hex.EncodeToString(crypto.FromECDSA(ethAccount)))
+	if err != nil {
+		return "", "", 0, err
+	}
 	addr = crypto.PubkeyToAddress(ethAccount.PublicKey).Hex()
-	privKey = hex.EncodeToString(ethAccount.D.Bytes())
 
 	return
 }
 
-func buryPrl() {
-	// TODO
+// decryptPrivateKey opens a private key encrypted for storage.
+func decryptPrivateKey(encryptedKey string) (*ecdsa.PrivateKey, error) {
+	plainKey, err := oyster_utils.DecryptEthKey(encryptedKey)
+	if err != nil {
+		return nil, err
+	}
 
-	/*
-		At a high level, what this method will have to do is send PRLs from the transaction address to each 'treasure'
-		address, and invoke the smart contract bury() function on them.
-	*/
+	privateKey, err := crypto.HexToECDSA(plainKey)
+	if err != nil {
+		return nil, ErrInvalidPrivateKey
+	}
+	return privateKey, nil
 }
 
-func sendGas(completedUploads []models.CompletedUpload) error {
-	//gas, err := GetGasPrice()
-	//for _, completedUpload := range completedUploads {
-	//	Eth.SendETH(MainWalletAddress, completedUpload.ETHAddr, float64(gas))
-	//}
-	//if err != nil {
-	//	return err
-	//}
+// buryPrl locks the PRL of every treasure in the session on chain. Each call
+// moves every burial forward by as many steps as are already possible, so it
+// is meant to be called repeatedly until models.TreasuresBuried reports the
+// session as done. Progress is kept in the treasure_burials table, so a
+// restart picks up where the last run stopped.
+func buryPrl(session models.UploadSession, treasureMap []models.TreasureMap) error {
+	if len(treasureMap) == 0 {
+		return nil
+	}
+
+	sessionKey, err := decryptPrivateKey(session.ETHPrivateKey)
+	if err != nil {
+		return err
+	}
+
+	mainWalletKey, err := crypto.HexToECDSA(MainWalletKey)
+	if err != nil {
+		return ErrInvalidPrivateKey
+	}
+
+	// The session's payment is split evenly between its treasures, the last
+	// treasure also gets the wei left over by the division.
+	prlPerTreasure := session.TotalCost.Div(int64(len(treasureMap)))
+	prlRemainder := session.TotalCost.Sub(prlPerTreasure.Mul(int64(len(treasureMap))))
+
+	var lastErr error
+	for i, entry := range treasureMap {
+		amount := prlPerTreasure
+		if i == len(treasureMap)-1 {
+			amount = amount.Add(prlRemainder)
+		}
+
+		plainKey, err := entry.PrivateKey()
+		if err != nil {
+			raven.CaptureError(err, nil)
+			lastErr = err
+			continue
+		}
+		treasureKey, err := crypto.HexToECDSA(plainKey)
+		if err != nil {
+			raven.CaptureError(err, nil)
+			lastErr = ErrInvalidPrivateKey
+			continue
+		}
+
+		burial, err := models.FindOrCreateTreasureBurial(models.TreasureBurial{
+			GenesisHash: session.GenesisHash,
+			Sector:      entry.Sector,
+			Idx:         entry.Idx,
+			ETHAddr:     crypto.PubkeyToAddress(treasureKey.PublicKey).Hex(),
+			Amount:      amount,
+		})
+		if err != nil {
+			raven.CaptureError(err, nil)
+			lastErr = err
+			continue
+		}
+
+		if err = advanceBurial(&burial, sessionKey, mainWalletKey, treasureKey); err != nil {
+			raven.CaptureError(err, nil)
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// A burialStep is one transaction of a burial. A burial at start sends the
+// transaction and moves to pending, and moves on to success once it is mined.
+type burialStep struct {
+	start   models.TreasureBurialStatus
+	pending models.TreasureBurialStatus
+	success models.TreasureBurialStatus
+	txHash  *string
+
+	// Sends the transaction, replacing replace if it is set.
+	send func(replace *pendingTx) (*types.Transaction, error)
+
+	// Reports whether the step's effect is already on chain. Steps whose
+	// effect can't be told apart from another burial's leave it nil.
+	done func() (bool, error)
+}
+
+// advanceBurial runs the next steps of a single burial until it has to wait
+// for a transaction to be mined.
+func advanceBurial(burial *models.TreasureBurial, sessionKey *ecdsa.PrivateKey,
+	mainWalletKey *ecdsa.PrivateKey, treasureKey *ecdsa.PrivateKey) error {
+
+	sessionAddr := crypto.PubkeyToAddress(sessionKey.PublicKey)
+	treasureAddr := common.HexToAddress(burial.ETHAddr)
+
+	steps := []burialStep{{
+		start:   models.TreasureBurialNotStarted,
+		pending: models.TreasureBurialSessionGasProcessing,
+		success: models.TreasureBurialSessionGasSent,
+		txHash:  &burial.SessionGasTxHash,
+		send: func(replace *pendingTx) (*types.Transaction, error) {
+			return sendContractGas(mainWalletKey, sessionAddr, GasLimitPRLSend, replace)
+		},
+		done: func() (bool, error) {
+			// The session wallet pays for the PRL transfer of every burial
+			// of the session still to send one.
+			toSend, err := models.CountBurialsToSendPRL(burial.GenesisHash)
+			if err != nil {
+				return false, err
+			}
+			return hasGasFor(sessionAddr, GasLimitPRLSend*uint64(toSend))
+		},
+	}, {
+		start:   models.TreasureBurialSessionGasSent,
+		pending: models.TreasureBurialPRLProcessing,
+		success: models.TreasureBurialPRLSent,
+		txHash:  &burial.PRLTxHash,
+		send: func(replace *pendingTx) (*types.Transaction, error) {
+			return sendPRLWei(sessionKey, treasureAddr, burial.Amount.Wei(), replace)
+		},
+		done: func() (bool, error) {
+			balance, err := checkPRLBalance(treasureAddr)
+			return err == nil && balance.Cmp(burial.Amount.Wei()) >= 0, err
+		},
+	}, {
+		start:   models.TreasureBurialPRLSent,
+		pending: models.TreasureBurialGasProcessing,
+		success: models.TreasureBurialGasSent,
+		txHash:  &burial.GasTxHash,
+		send: func(replace *pendingTx) (*types.Transaction, error) {
+			return sendContractGas(mainWalletKey, treasureAddr, GasLimitPRLBury, replace)
+		},
+		done: func() (bool, error) {
+			return hasGasFor(treasureAddr, GasLimitPRLBury)
+		},
+	}, {
+		start:   models.TreasureBurialGasSent,
+		pending: models.TreasureBurialBuryProcessing,
+		success: models.TreasureBurialSuccess,
+		txHash:  &burial.BuryTxHash,
+		send: func(replace *pendingTx) (*types.Transaction, error) {
+			return bury(treasureKey, replace)
+		},
+		done: func() (bool, error) {
+			return isBuried(treasureAddr)
+		},
+	}}
+
+	for {
+		var step *burialStep
+		for i := range steps {
+			if burial.Status == steps[i].start || burial.Status == steps[i].pending {
+				step = &steps[i]
+			}
+		}
+		if step == nil {
+			// Done.
+			return nil
+		}
+
+		prevStatus := burial.Status
+		var err error
+		if burial.Status == step.start {
+			err = sendBurialTx(burial, step)
+		} else {
+			err = awaitBurialTx(burial, step)
+		}
+
+		if err != nil {
+			return err
+		}
+		if burial.Status == prevStatus {
+			// Waiting on a transaction.
+			return nil
+		}
+		if _, err = models.DB.ValidateAndSave(burial); err != nil {
+			return err
+		}
+	}
+}
+
+// sendBurialTx sends the transaction of step, unless its effect is already on
+// chain from a transaction we lost track of.
+func sendBurialTx(burial *models.TreasureBurial, step *burialStep) error {
+	if step.done != nil {
+		done, err := step.done()
+		if err != nil {
+			return err
+		}
+		if done {
+			burial.Status = step.success
+			return nil
+		}
+	}
+
+	tx, err := step.send(nil)
+	if err != nil {
+		return err
+	}
+	setBurialTx(burial, step, tx)
+	burial.Status = step.pending
 	return nil
 }
 
-// TODO: Don't use floats for money transactions!
-func sendETH(fromAddr common.Address, toAddr common.Address, amt float64) {
-	// TODO
+// awaitBurialTx moves the burial on once the pending transaction of step is
+// mined. A transaction that is not mined in time is replaced by one with the
+// same nonce and a higher gas price, so it can never be mined twice.
+func awaitBurialTx(burial *models.TreasureBurial, step *burialStep) error {
+	status, stuck, err := burialTxStatus(*step.txHash, burial.UpdatedAt, step.pending, step.success, step.start)
+	if err == nil && status == step.start {
+		recordBurialRevert(burial, status)
+		return nil
+	}
+	if err != nil || !stuck {
+		burial.Status = status
+		return err
+	}
+
+	tx, err := step.send(&pendingTx{
+		nonce:    uint64(burial.TxNonce),
+		gasPrice: big.NewInt(burial.TxGasPrice),
+	})
+	if isNonceTooLow(err) {
+		// A transaction we replaced earlier was mined after all.
+		done := false
+		if step.done != nil {
+			if done, err = step.done(); err != nil {
+				return err
+			}
+		}
+		burial.Status = step.start
+		if done {
+			burial.Status = step.success
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	setBurialTx(burial, step, tx)
+	_, err = models.DB.ValidateAndSave(burial)
+	return err
+}
+
+// recordBurialRevert moves burial back to retry, the step its transaction was
+// reverted in, or gives up on it once MaxBurialReverts of its transactions
+// have been reverted, as every retry burns the gas it was funded with.
+func recordBurialRevert(burial *models.TreasureBurial, retry models.TreasureBurialStatus) {
+	burial.Reverts++
+	if burial.Reverts < MaxBurialReverts {
+		burial.Status = retry
+		return
+	}
+
+	burial.Status = models.TreasureBurialError
+	raven.CaptureError(errors.Wrapf(ErrTransactionReverted, "gave up burying treasure %s of %s after %d reverts",
+		burial.ETHAddr, burial.GenesisHash, burial.Reverts), nil)
 }
 
-func claimPRLs(completedUploads []models.CompletedUpload) error {
+func setBurialTx(burial *models.TreasureBurial, step *burialStep, tx *types.Transaction) {
+	*step.txHash = tx.Hash().Hex()
+	burial.TxNonce = int64(tx.Nonce())
+	burial.TxGasPrice = tx.GasPrice().Int64()
+}
+
+// burialTxStatus returns the burial status a transaction leads to: success
+// once it is mined, failure if it was reverted, and pending otherwise. stuck
+// reports a pending transaction that has not been mined for
+// EthTransferTimeout.
+func burialTxStatus(txHash string, sentAt time.Time, pending models.TreasureBurialStatus,
+	success models.TreasureBurialStatus, failure models.TreasureBurialStatus) (status models.TreasureBurialStatus, stuck bool, err error) {
+
+	mined, succeeded, err := txMined(txHash)
+	if err != nil {
+		return pending, false, err
+	}
+	if !mined {
+		return pending, time.Since(sentAt) > EthTransferTimeout, nil
+	}
+	if !succeeded {
+		return failure, false, nil
+	}
+	return success, false, nil
+}
+
+// txMined reports whether a transaction has been mined, and if so whether it
+// succeeded.
+func txMined(txHash string) (mined bool, succeeded bool, err error) {
+	ethCl, err := backend()
+	if err != nil {
+		return false, false, err
+	}
+
+	ctx, cancel := ethCallContext()
+	defer cancel()
+
+	receipt, err := ethCl.TransactionReceipt(ctx, common.HexToHash(txHash))
+	if err == ethereum.NotFound || (err == nil && receipt == nil) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, errors.Wrap(handleCallError(err), "could not get transaction receipt")
+	}
 
-	//for _, completedUpload := range completedUploads {
-	//	/* TODO:
-	//
-	//	    for each completed upload, get its PRL balance from its ETH
-	//		address (completedUpload.ETHAddr) by calling CheckBalance.
-	//
-	//	    Then, using SendPRL, create a transaction with each
-	//	    completedUpload.ETHAddr as the "fromAddr" address, the broker's
-	//	    main wallet (MainWalletAddress) as the "toAddr" address, and the PRL
-	//	    balance of completedUpload.ETHAddr as the "amt" to send, and
-	//	    subscribe to the event with SubscribeToTransfer.
-	//	*/
-	//}
-	//if err != nil {
-	//	return err
-	//}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		raven.CaptureError(errors.Wrap(ErrTransactionReverted, txHash), nil)
+		return true, false, nil
+	}
+	return true, true, nil
+}
+
+// A pendingTx is a sent transaction that has not been mined.
+type pendingTx struct {
+	nonce    uint64
+	gasPrice *big.Int
+}
 
+// txGasPrice returns the gas price to send a transaction at. A transaction
+// replacing replace pays enough more than it for nodes to accept it.
+func txGasPrice(replace *pendingTx) (*big.Int, error) {
+	gasPrice, err := getGasPrice()
+	if err != nil || replace == nil {
+		return gasPrice, err
+	}
+
+	bumped := new(big.Int).Mul(replace.gasPrice, big.NewInt(100+GasPriceBumpPercent))
+	bumped.Div(bumped, big.NewInt(100))
+	bumped.Add(bumped, big.NewInt(1))
+	if bumped.Cmp(gasPrice) > 0 {
+		return bumped, nil
+	}
+	return gasPrice, nil
+}
+
+// txNonce returns the nonce to send a transaction from addr with, the nonce
+// of replace if it is set.
+func txNonce(ctx context.Context, ethCl ethBackend, addr common.Address, replace *pendingTx) (uint64, error) {
+	if replace != nil {
+		return replace.nonce, nil
+	}
+
+	nonce, err := ethCl.PendingNonceAt(ctx, addr)
+	if err != nil {
+		return 0, errors.Wrap(handleCallError(err), "could not get nonce")
+	}
+	return nonce, nil
+}
+
+// isNonceTooLow reports whether a transaction was refused because a
+// transaction with its nonce has already been mined.
+func isNonceTooLow(err error) bool {
+	return err != nil && strings.Contains(err.Error(), core.ErrNonceTooLow.Error())
+}
+
+// sendContractGas sends addr enough ETH to make one contract call using up to
+// gasLimit gas, with GasFundingMargin to spare for replacing the call.
+func sendContractGas(mainWalletKey *ecdsa.PrivateKey, addr common.Address, gasLimit uint64, replace *pendingTx) (*types.Transaction, error) {
+	gasPrice, err := getGasPrice()
+	if err != nil {
+		return nil, err
+	}
+
+	gasToSend := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gasLimit*GasFundingMargin))
+	return sendETHWei(mainWalletKey, addr, gasToSend, replace)
+}
+
+// hasGasFor reports whether addr holds enough ETH to make a contract call
+// using up to gasLimit gas at the current gas price.
+func hasGasFor(addr common.Address, gasLimit uint64) (bool, error) {
+	gasPrice, err := getGasPrice()
+	if err != nil {
+		return false, err
+	}
+
+	balance, err := checkBalance(addr)
+	if err != nil {
+		return false, err
+	}
+	return balance.Cmp(new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gasLimit))) >= 0, nil
+}
+
+// fundedTransactor returns transact options for a contract call of up to
+// gasLimit gas from an address funded by sendContractGas. It pays the current
+// gas price, or as much as the funding covers if the price has risen past it
+// since.
+func fundedTransactor(key *ecdsa.PrivateKey, gasLimit uint64, replace *pendingTx) (*bind.TransactOpts, error) {
+	gasPrice, err := txGasPrice(replace)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := checkBalance(crypto.PubkeyToAddress(key.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+	if affordable := new(big.Int).Div(balance, new(big.Int).SetUint64(gasLimit)); affordable.Cmp(gasPrice) < 0 {
+		gasPrice = affordable
+	}
+	if gasPrice.Sign() <= 0 {
+		return nil, ErrInsufficientFunds
+	}
+
+	opts, err := newTransactor(key)
+	if err != nil {
+		return nil, err
+	}
+	opts.GasPrice = gasPrice
+	opts.GasLimit = gasLimit
+	if replace != nil {
+		opts.Nonce = new(big.Int).SetUint64(replace.nonce)
+	}
+	return opts, nil
+}
+
+// bury calls bury() on the PRL contract from the treasure address.
+func bury(treasureKey *ecdsa.PrivateKey, replace *pendingTx) (*types.Transaction, error) {
+	contract, err := oysterPearlContract()
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := fundedTransactor(treasureKey, GasLimitPRLBury, replace)
+	if err != nil {
+		return nil, err
+	}
+
+	sendMtx.Lock()
+	defer sendMtx.Unlock()
+
+	ctx, cancel := ethCallContext()
+	defer cancel()
+	opts.Context = ctx
+
+	tx, err := contract.Bury(opts)
+	if err != nil {
+		return nil, errors.Wrap(handleCallError(err), "could not bury PRL")
+	}
+	return tx, nil
+}
+
+// claimTreasure moves a treasure claim forward by as many steps as are
+// already possible. The treasure address is funded with gas unless it already
+// holds enough, then claims the PRL buried at it for the claim's receiver,
+// with the claim fee going to the broker's main wallet. It is meant to be
+// called repeatedly until the claim succeeds or fails, progress is saved on
+// the claim.
+func claimTreasure(claim *models.TreasureClaim) error {
+	treasureKey, err := decryptPrivateKey(claim.ETHPrivateKey)
+	if err != nil {
+		return err
+	}
+	treasureAddr := crypto.PubkeyToAddress(treasureKey.PublicKey)
+
+	for {
+		prevStatus := claim.Status
+
+		switch claim.Status {
+		case models.TreasureClaimNotStarted:
+			err = startTreasureClaim(claim, treasureAddr)
+		case models.TreasureClaimGasProcessing:
+			claim.Status, err = claimTxStatus(claim.GasTxHash, claim.Status,
+				models.TreasureClaimGasSent, models.TreasureClaimNotStarted)
+		case models.TreasureClaimGasSent:
+			var tx *types.Transaction
+			if tx, err = sendClaim(treasureKey, common.HexToAddress(claim.ReceiverEthAddr)); err == nil {
+				claim.TxHash = tx.Hash().Hex()
+				claim.Status = models.TreasureClaimProcessing
+			}
+		case models.TreasureClaimProcessing:
+			claim.Status, err = claimTxStatus(claim.TxHash, claim.Status,
+				models.TreasureClaimSuccess, models.TreasureClaimError)
+		}
+
+		if err != nil {
+			return err
+		}
+		if claim.Status == prevStatus {
+			// Waiting on a transaction, or done.
+			return nil
+		}
+		if _, err = models.DB.ValidateAndSave(claim); err != nil {
+			return err
+		}
+	}
+}
+
+// startTreasureClaim funds the treasure address with gas for the claim. An
+// address that still holds gas, from an earlier claim that failed, is not
+// funded again.
+func startTreasureClaim(claim *models.TreasureClaim, treasureAddr common.Address) error {
+	buried, err := isBuried(treasureAddr)
+	if err != nil {
+		return err
+	}
+	if !buried {
+		raven.CaptureError(errors.Wrap(ErrTreasureNotBuried, treasureAddr.Hex()), nil)
+		claim.Status = models.TreasureClaimError
+		return nil
+	}
+
+	funded, err := hasGasFor(treasureAddr, GasLimitPRLClaim)
+	if err != nil {
+		return err
+	}
+	if funded {
+		claim.Status = models.TreasureClaimGasSent
+		return nil
+	}
+
+	mainWalletKey, err := crypto.HexToECDSA(MainWalletKey)
+	if err != nil {
+		return ErrInvalidPrivateKey
+	}
+
+	tx, err := sendContractGas(mainWalletKey, treasureAddr, GasLimitPRLClaim, nil)
+	if err != nil {
+		return err
+	}
+	claim.GasTxHash = tx.Hash().Hex()
+	claim.Status = models.TreasureClaimGasProcessing
 	return nil
 }
 
-func sendPRL(fromAddr common.Address, toAddr common.Address, amt float64) {
-	// TODO
+// claimTxStatus returns the claim status a transaction leads to: success
+// once it is mined, failure if it was reverted, and pending otherwise.
+func claimTxStatus(txHash string, pending models.TreasureClaimStatus,
+	success models.TreasureClaimStatus, failure models.TreasureClaimStatus) (models.TreasureClaimStatus, error) {
+
+	mined, succeeded, err := txMined(txHash)
+	if err != nil || !mined {
+		return pending, err
+	}
+	if !succeeded {
+		return failure, nil
+	}
+	return success, nil
 }
 
-//func GetGasPrice() (uint64, error) {
-//	//ctx := context.Background() // TODO: Should we have some timeout or cancel?
-//
-//	//TODO:  Decide whether 'SuggestGasPrice' or 'EstimateGasPrice' is the better method, then
-//	// return the gas and the error
-//	//gas, errEstimator := client.SuggestGasPrice(ctx)
-//}
+// sendClaim calls claim() on the PRL contract from the treasure address.
+func sendClaim(treasureKey *ecdsa.PrivateKey, receiverAddr common.Address) (*types.Transaction, error) {
+	contract, err := oysterPearlContract()
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := fundedTransactor(treasureKey, GasLimitPRLClaim, nil)
+	if err != nil {
+		return nil, err
+	}
 
-// SubscribeToTransfer will subscribe to transfer events
-// sending PRL to the brokerAddr given. Notifications
-// will be sent in the out channel provided.
-func subscribeToTransfer(brokerAddr common.Address, outCh chan<- types.Log) {
-	ethCl, _ := sharedClient()
+	sendMtx.Lock()
+	defer sendMtx.Unlock()
 
-	ctx := context.Background() // TODO: Should we have some timeout or cancel?
+	ctx, cancel := ethCallContext()
+	defer cancel()
+	opts.Context = ctx
 
-	q := ethereum.FilterQuery{
-		FromBlock: nil, // TODO: Figure out how to get current block in GetCurrentBlock
-		Addresses: []common.Address{brokerAddr},
-		Topics:    nil, // TODO: scope this to just oyster's contract.
+	tx, err := contract.Claim(opts, receiverAddr, MainWalletAddress)
+	if err != nil {
+		return nil, errors.Wrap(handleCallError(err), "could not claim treasure")
 	}
-	// Adapt msg sent from the subscription before passing it to outCh.
-	ethCl.SubscribeFilterLogs(ctx, q, outCh)
+	return tx, nil
 }
 
-func checkBalance(addr common.Address) {
-	//ctx := context.Background() // TODO: Should we have some timeout or cancel?
-	//client.BalanceAt(ctx, addr)
+// isBuried reports whether addr has been buried on the PRL contract.
+func isBuried(addr common.Address) (bool, error) {
+	contract, err := oysterPearlContract()
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := ethCallContext()
+	defer cancel()
+
+	buried, err := contract.Buried(&bind.CallOpts{Context: ctx}, addr)
+	if err != nil {
+		return false, errors.Wrap(handleCallError(err), "could not check buried status")
+	}
+	return buried, nil
 }
 
-func getCurrentBlock() {
+// sendGas funds each completed upload's address from the main wallet with
+// enough ETH to pay for one PRL transfer.
+func sendGas(completedUploads []models.CompletedUpload) error {
+	gasPrice, err := getGasPrice()
+	if err != nil {
+		return err
+	}
+
+	mainWalletKey, err := crypto.HexToECDSA(MainWalletKey)
+	if err != nil {
+		return ErrInvalidPrivateKey
+	}
+
+	gasToSend := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(GasLimitPRLSend))
+
+	var lastErr error
+	for _, completedUpload := range completedUploads {
+		tx, err := sendETHWei(mainWalletKey, common.HexToAddress(completedUpload.ETHAddr), gasToSend, nil)
+		if err != nil {
+			raven.CaptureError(err, nil)
+			models.SetGasStatusByAddress(completedUpload.ETHAddr, models.GasTransferError)
+			lastErr = err
+			continue
+		}
+
+		models.SetGasStatusByAddress(completedUpload.ETHAddr, models.GasTransferProcessing)
+		go confirmGasTransfer(tx, completedUpload.ETHAddr)
+	}
 
+	return lastErr
 }
 
-/* TODO will be using channels/workers for subscribe to transaction events
+func sendETH(fromKey *ecdsa.PrivateKey, toAddr common.Address, amt oyster_utils.Amount) (*types.Transaction, error) {
+	return sendETHWei(fromKey, toAddr, amt.Wei(), nil)
+}
 
-	-there is an example of a channel/worker in iota_wrappers.go
-	-when you see a successful transaction event, will need to change the status
-    of the correct row in the completed_uploads table.
+// sendETHWei sends amt wei from fromKey to toAddr, replacing replace if it is
+// set.
+func sendETHWei(fromKey *ecdsa.PrivateKey, toAddr common.Address, amt *big.Int, replace *pendingTx) (*types.Transaction, error) {
+	if fromKey == nil {
+		return nil, ErrInvalidPrivateKey
+	}
 
-	-to indicate that a gas transfers has succeedded, call this method:
+	ethCl, err := backend()
+	if err != nil {
+		return nil, err
+	}
 
-    models.SetGasStatusByAddress(address, models.GasTransferSuccess)
+	gasPrice, err := txGasPrice(replace)
+	if err != nil {
+		return nil, err
+	}
 
-    -to indicate that a PRL transfer succeeded, call this:
+	fromAddr := crypto.PubkeyToAddress(fromKey.PublicKey)
+	balance, err := checkBalance(fromAddr)
+	if err != nil {
+		return nil, err
+	}
 
-    models.SetPRLStatusByAddress(address, models.PRLClaimSuccess)
+	fee := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(GasLimitETHSend))
+	if balance.Cmp(new(big.Int).Add(amt, fee)) < 0 {
+		return nil, ErrInsufficientFunds
+	}
 
-    Both methods currently expect address to be a string (change that if you want)
-    and expect "address" to be the "to" address of the gas transaction or the "from"
-    address of the PRL transaction.  In other words, *not* the broker's main wallet
-    address.
+	sendMtx.Lock()
+	defer sendMtx.Unlock()
+
+	ctx, cancel := ethCallContext()
+	defer cancel()
+
+	nonce, err := txNonce(ctx, ethCl, fromAddr, replace)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := chainSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	tx := types.NewTransaction(nonce, toAddr, amt, GasLimitETHSend, gasPrice, nil)
+	signedTx, err := types.SignTx(tx, signer, fromKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not sign ETH transfer")
+	}
+
+	if err = ethCl.SendTransaction(ctx, signedTx); err != nil {
+		return nil, errors.Wrap(handleCallError(err), "could not send ETH transfer")
+	}
+
+	return signedTx, nil
+}
+
+// claimPRLs moves the full PRL balance of each completed upload's address
+// back to the broker's main wallet.
+func claimPRLs(completedUploads []models.CompletedUpload) error {
+	var lastErr error
+	for _, completedUpload := range completedUploads {
+		privateKey, err := decryptPrivateKey(completedUpload.ETHPrivateKey)
+		if err != nil {
+			raven.CaptureError(err, nil)
+			models.SetPRLStatusByAddress(completedUpload.ETHAddr, models.PRLClaimError)
+			lastErr = err
+			continue
+		}
+
+		balance, err := checkPRLBalance(crypto.PubkeyToAddress(privateKey.PublicKey))
+		if err != nil {
+			raven.CaptureError(err, nil)
+			lastErr = err
+			continue
+		}
+
+		if balance.Sign() <= 0 {
+			// Nothing left to claim.
+			models.SetPRLStatusByAddress(completedUpload.ETHAddr, models.PRLClaimSuccess)
+			continue
+		}
+
+		tx, err := sendPRLWei(privateKey, MainWalletAddress, balance, nil)
+		if err != nil {
+			raven.CaptureError(err, nil)
+			models.SetPRLStatusByAddress(completedUpload.ETHAddr, models.PRLClaimError)
+			lastErr = err
+			continue
+		}
+
+		models.SetPRLStatusByAddress(completedUpload.ETHAddr, models.PRLClaimProcessing)
+		go confirmPRLClaim(tx, completedUpload.ETHAddr)
+	}
+
+	return lastErr
+}
+
+func sendPRL(fromKey *ecdsa.PrivateKey, toAddr common.Address, amt oyster_utils.Amount) (*types.Transaction, error) {
+	return sendPRLWei(fromKey, toAddr, amt.Wei(), nil)
+}
+
+// sendPRLWei sends amt PRL wei from fromKey to toAddr, replacing replace if it
+// is set.
+func sendPRLWei(fromKey *ecdsa.PrivateKey, toAddr common.Address, amt *big.Int, replace *pendingTx) (*types.Transaction, error) {
+	if fromKey == nil {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	// The transfer being replaced may have been mined already, which the node
+	// reports once it sees the nonce.
+	if replace == nil {
+		balance, err := checkPRLBalance(crypto.PubkeyToAddress(fromKey.PublicKey))
+		if err != nil {
+			return nil, err
+		}
+		if balance.Cmp(amt) < 0 {
+			return nil, ErrInsufficientFunds
+		}
+	}
+
+	contract, err := oysterPearlContract()
+	if err != nil {
+		return nil, err
+	}
+
+	gasPrice, err := txGasPrice(replace)
+	if err != nil {
+		return nil, err
+	}
+
+	sendMtx.Lock()
+	defer sendMtx.Unlock()
+
+	ctx, cancel := ethCallContext()
+	defer cancel()
+
+	opts, err := newTransactor(fromKey)
+	if err != nil {
+		return nil, err
+	}
+	opts.GasPrice = gasPrice
+	opts.GasLimit = GasLimitPRLSend
+	opts.Context = ctx
+	if replace != nil {
+		opts.Nonce = new(big.Int).SetUint64(replace.nonce)
+	}
 
-    These methods live in models/completed_uploads.go
-*/
+	tx, err := contract.Transfer(opts, toAddr, amt)
+	if err != nil {
+		return nil, errors.Wrap(handleCallError(err), "could not send PRL transfer")
+	}
+
+	return tx, nil
+}
+
+func getGasPrice() (*big.Int, error) {
+	ethCl, err := backend()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := ethCallContext()
+	defer cancel()
+
+	gasPrice, err := ethCl.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, errors.Wrap(handleCallError(err), "could not get gas price")
+	}
+	return gasPrice, nil
+}
+
+// SubscribeToTransfer will subscribe to PRL Transfer events.
+// Notifications, including logs removed by a reorg, will be
+// sent in the out channel provided.
+// The subscription is re-established with backoff whenever the connection
+// to the node drops, until done is closed. outCh is closed once it stops.
+func subscribeToTransfer(outCh chan<- types.Log, done <-chan struct{}) {
+	q := transferQuery()
+
+	go func() {
+		defer close(outCh)
+
+		backoff := time.Duration(0)
+		for {
+			subscribed, err := watchFilterLogs(q, outCh, done)
+			if err != nil {
+				raven.CaptureError(err, nil)
+			}
+			if subscribed {
+				// Only consecutive failures to subscribe back off further.
+				backoff = 0
+			}
+
+			backoff = nextReconnectBackoff(backoff)
+			select {
+			case <-done:
+				return
+			case <-time.After(backoff):
+			}
+		}
+	}()
+}
+
+// watchFilterLogs subscribes to logs matching q and blocks until the
+// subscription fails or done is closed. subscribed reports whether the
+// subscription was established.
+func watchFilterLogs(q ethereum.FilterQuery, outCh chan<- types.Log, done <-chan struct{}) (subscribed bool, err error) {
+	ethCl, err := backend()
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := ethCallContext()
+	sub, err := ethCl.SubscribeFilterLogs(ctx, q, outCh)
+	cancel()
+	if err != nil {
+		return false, handleCallError(err)
+	}
+	defer sub.Unsubscribe()
+
+	select {
+	case <-done:
+		return true, nil
+	case err = <-sub.Err():
+		dropClient()
+		return true, err
+	}
+}
+
+// filterTransfers returns the PRL Transfer events mined between fromBlock
+// and toBlock, inclusive.
+func filterTransfers(fromBlock uint64, toBlock uint64) ([]types.Log, error) {
+	ethCl, err := backend()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := ethCallContext()
+	defer cancel()
+
+	q := transferQuery()
+	q.FromBlock = new(big.Int).SetUint64(fromBlock)
+	q.ToBlock = new(big.Int).SetUint64(toBlock)
+
+	logs, err := ethCl.FilterLogs(ctx, q)
+	if err != nil {
+		return nil, errors.Wrap(handleCallError(err), "could not filter PRL transfers")
+	}
+	return logs, nil
+}
+
+func transferQuery() ethereum.FilterQuery {
+	return ethereum.FilterQuery{
+		Addresses: []common.Address{OysterPearlAddress},
+		Topics:    [][]common.Hash{{TransferEventSignature}},
+	}
+}
+
+// DecodeTransferLog returns the recipient and amount of a PRL Transfer event.
+func DecodeTransferLog(log types.Log) (toAddr common.Address, amount *big.Int, err error) {
+	if len(log.Topics) != 3 || log.Topics[0] != TransferEventSignature || len(log.Data) != 32 {
+		return toAddr, nil, ErrNotTransferLog
+	}
+
+	toAddr = common.BytesToAddress(log.Topics[2].Bytes())
+	amount = new(big.Int).SetBytes(log.Data)
+	return toAddr, amount, nil
+}
+
+// checkBalance returns the ETH balance of addr in wei.
+func checkBalance(addr common.Address) (*big.Int, error) {
+	ethCl, err := backend()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := ethCallContext()
+	defer cancel()
+
+	balance, err := ethCl.BalanceAt(ctx, addr, nil)
+	if err != nil {
+		return nil, errors.Wrap(handleCallError(err), "could not get ETH balance")
+	}
+	return balance, nil
+}
+
+// checkPRLBalance returns the PRL balance of addr in the token's smallest unit.
+func checkPRLBalance(addr common.Address) (*big.Int, error) {
+	contract, err := oysterPearlContract()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := ethCallContext()
+	defer cancel()
+
+	balance, err := contract.BalanceOf(&bind.CallOpts{Context: ctx}, addr)
+	if err != nil {
+		return nil, errors.Wrap(handleCallError(err), "could not get PRL balance")
+	}
+	return balance, nil
+}
+
+func getCurrentBlock() (*types.Block, error) {
+	ethCl, err := chainReader()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := ethCallContext()
+	defer cancel()
+
+	block, err := ethCl.BlockByNumber(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(handleCallError(err), "could not get current block")
+	}
+	return block, nil
+}
+
+// getBlockHash returns the hash of the canonical block at blockNumber.
+func getBlockHash(blockNumber uint64) (common.Hash, error) {
+	ethCl, err := chainReader()
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	ctx, cancel := ethCallContext()
+	defer cancel()
+
+	header, err := ethCl.HeaderByNumber(ctx, new(big.Int).SetUint64(blockNumber))
+	if err != nil {
+		return common.Hash{}, errors.Wrap(handleCallError(err), "could not get block header")
+	}
+	return header.Hash(), nil
+}
+
+func oysterPearlContract() (*OysterPearl, error) {
+	if OysterPearlAddress == (common.Address{}) {
+		return nil, ErrNoContractAddress
+	}
+
+	ethCl, err := backend()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewOysterPearl(OysterPearlAddress, ethCl)
+}
+
+// confirmGasTransfer waits for tx to be mined and records the outcome.
+func confirmGasTransfer(tx *types.Transaction, addr string) {
+	if err := waitForTransfer(tx); err != nil {
+		raven.CaptureError(err, nil)
+		models.SetGasStatusByAddress(addr, models.GasTransferError)
+		return
+	}
+	models.SetGasStatusByAddress(addr, models.GasTransferSuccess)
+}
+
+// confirmPRLClaim waits for tx to be mined and records the outcome.
+func confirmPRLClaim(tx *types.Transaction, addr string) {
+	if err := waitForTransfer(tx); err != nil {
+		raven.CaptureError(err, nil)
+		models.SetPRLStatusByAddress(addr, models.PRLClaimError)
+		return
+	}
+	models.SetPRLStatusByAddress(addr, models.PRLClaimSuccess)
+}
+
+func waitForTransfer(tx *types.Transaction) error {
+	ethCl, err := backend()
+	if err != nil {
+		return err
+	}
+
+	// Mining can take far longer than a single call, so only bound it loosely.
+	ctx, cancel := context.WithTimeout(context.Background(), EthTransferTimeout)
+	defer cancel()
+
+	receipt, err := bind.WaitMined(ctx, ethCl, tx)
+	if err != nil {
+		return err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return ErrTransactionReverted
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/utils"
 )
 
 var EthMock Eth
@@ -19,5 +20,14 @@ func SetUpMock() {
 		SendGas: func([]models.CompletedUpload) error {
 			return nil
 		},
+		BuryPrl: func(models.UploadSession, []models.TreasureMap) error {
+			return nil
+		},
+		GetStoragePeg: func() oyster_utils.Amount {
+			return oyster_utils.AmountFromUnits(1)
+		},
+		CheckHealth: func() error {
+			return nil
+		},
 	}
 }
@@ -0,0 +1,388 @@
+package services_test
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+func mustParseAmount(t *testing.T, s string) oyster_utils.Amount {
+	amount, err := oyster_utils.ParseAmount(s)
+	if err != nil {
+		t.Fatalf("could not parse amount %s: %v", s, err)
+	}
+	return amount
+}
+
+func Test_GetGasPrice(t *testing.T) {
+	services.SetUpSimulatedChain(t)
+	defer services.TearDownSimulatedChain()
+
+	gasPrice, err := services.EthWrapper.GetGasPrice()
+	if err != nil {
+		t.Fatalf("getGasPrice should not have errored: %v", err)
+	}
+	if gasPrice.Sign() <= 0 {
+		t.Fatalf("getGasPrice should have returned a positive gas price")
+	}
+}
+
+func Test_EIP155Signer(t *testing.T) {
+	defer services.SetEthChainID(nil)
+	services.SetEthChainID(big.NewInt(3))
+
+	signer, err := services.EIP155Signer()
+	if err != nil {
+		t.Fatalf("EIP155Signer should not have errored: %v", err)
+	}
+
+	key, _ := crypto.GenerateKey()
+	tx := types.NewTransaction(0, common.Address{}, big.NewInt(1), services.GasLimitETHSend, big.NewInt(1), nil)
+	signedTx, err := types.SignTx(tx, signer, key)
+	if err != nil {
+		t.Fatalf("SignTx should not have errored: %v", err)
+	}
+	if !signedTx.Protected() || signedTx.ChainId().Cmp(big.NewInt(3)) != 0 {
+		t.Fatalf("transactions should be signed with replay protection for chain 3")
+	}
+}
+
+func Test_GetCurrentBlock_SimulatedBackend(t *testing.T) {
+	services.SetUpSimulatedChain(t)
+	defer services.TearDownSimulatedChain()
+
+	if _, err := services.EthWrapper.GetCurrentBlock(); err != services.ErrNoChainReader {
+		t.Fatalf("expected ErrNoChainReader but got %v", err)
+	}
+}
+
+func Test_GetBlockHash_SimulatedBackend(t *testing.T) {
+	services.SetUpSimulatedChain(t)
+	defer services.TearDownSimulatedChain()
+
+	if _, err := services.EthWrapper.GetBlockHash(0); err != services.ErrNoChainReader {
+		t.Fatalf("expected ErrNoChainReader but got %v", err)
+	}
+}
+
+func Test_SendETH(t *testing.T) {
+	sim, key := services.SetUpSimulatedChain(t)
+	defer services.TearDownSimulatedChain()
+
+	toAddr := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	tx, err := services.EthWrapper.SendETH(key, toAddr, mustParseAmount(t, "0.5"))
+	if err != nil {
+		t.Fatalf("sendETH should not have errored: %v", err)
+	}
+	sim.Commit()
+
+	if err := services.WaitForTransfer(tx); err != nil {
+		t.Fatalf("ETH transfer should have been mined: %v", err)
+	}
+
+	balance, err := services.EthWrapper.CheckBalance(toAddr)
+	if err != nil {
+		t.Fatalf("checkBalance should not have errored: %v", err)
+	}
+
+	expected := new(big.Int).Div(big.NewInt(params.Ether), big.NewInt(2))
+	if balance.Cmp(expected) != 0 {
+		t.Fatalf("expected balance of %v but got %v", expected, balance)
+	}
+}
+
+func Test_SendETH_ConsecutiveSendsUseNewNonces(t *testing.T) {
+	sim, key := services.SetUpSimulatedChain(t)
+	defer services.TearDownSimulatedChain()
+
+	toAddr := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	first, err := services.EthWrapper.SendETH(key, toAddr, oyster_utils.AmountFromUnits(1))
+	if err != nil {
+		t.Fatalf("first sendETH should not have errored: %v", err)
+	}
+	second, err := services.EthWrapper.SendETH(key, toAddr, oyster_utils.AmountFromUnits(1))
+	if err != nil {
+		t.Fatalf("second sendETH should not have errored: %v", err)
+	}
+	sim.Commit()
+
+	if first.Nonce() == second.Nonce() {
+		t.Fatalf("consecutive sends from one wallet must not share a nonce")
+	}
+}
+
+func Test_SendETH_InsufficientFunds(t *testing.T) {
+	services.SetUpSimulatedChain(t)
+	defer services.TearDownSimulatedChain()
+
+	emptyKey, _ := crypto.GenerateKey()
+	toAddr := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	_, err := services.EthWrapper.SendETH(emptyKey, toAddr, oyster_utils.AmountFromUnits(1))
+	if err != services.ErrInsufficientFunds {
+		t.Fatalf("expected ErrInsufficientFunds but got %v", err)
+	}
+}
+
+func Test_SendETH_NoKey(t *testing.T) {
+	services.SetUpSimulatedChain(t)
+	defer services.TearDownSimulatedChain()
+
+	_, err := services.EthWrapper.SendETH(nil, common.Address{}, oyster_utils.AmountFromUnits(1))
+	if err != services.ErrInvalidPrivateKey {
+		t.Fatalf("expected ErrInvalidPrivateKey but got %v", err)
+	}
+}
+
+func Test_SendGas(t *testing.T) {
+	sim, _ := services.SetUpSimulatedChain(t)
+	defer services.TearDownSimulatedChain()
+
+	_, uploadKey, _, _ := services.EthWrapper.GenerateEthAddr()
+	privateKey, _ := services.DecryptPrivateKey(uploadKey)
+	uploadAddr := crypto.PubkeyToAddress(privateKey.PublicKey)
+
+	err := services.EthWrapper.SendGas([]models.CompletedUpload{{
+		GenesisHash:   "sendGasGenHash",
+		ETHAddr:       uploadAddr.Hex(),
+		ETHPrivateKey: uploadKey,
+	}})
+	if err != nil {
+		t.Fatalf("sendGas should not have errored: %v", err)
+	}
+	sim.Commit()
+
+	gasPrice, _ := services.EthWrapper.GetGasPrice()
+	expected := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(services.GasLimitPRLSend))
+
+	balance, _ := services.EthWrapper.CheckBalance(uploadAddr)
+	if balance.Cmp(expected) != 0 {
+		t.Fatalf("sendGas should have sent %v wei but address holds %v", expected, balance)
+	}
+}
+
+func Test_SendGas_InvalidMainWalletKey(t *testing.T) {
+	services.SetUpSimulatedChain(t)
+	defer services.TearDownSimulatedChain()
+
+	services.MainWalletKey = "not_a_key"
+
+	err := services.EthWrapper.SendGas([]models.CompletedUpload{})
+	if err != services.ErrInvalidPrivateKey {
+		t.Fatalf("expected ErrInvalidPrivateKey but got %v", err)
+	}
+}
+
+func Test_CheckPRLBalance_NoContractAddress(t *testing.T) {
+	services.SetUpSimulatedChain(t)
+	defer services.TearDownSimulatedChain()
+
+	_, err := services.EthWrapper.CheckPRLBalance(services.MainWalletAddress)
+	if err != services.ErrNoContractAddress {
+		t.Fatalf("expected ErrNoContractAddress but got %v", err)
+	}
+}
+
+func Test_SendPRL_NoContractDeployed(t *testing.T) {
+	_, key := services.SetUpSimulatedChain(t)
+	defer services.TearDownSimulatedChain()
+
+	services.OysterPearlAddress = common.HexToAddress("0x0000000000000000000000000000000000000def")
+
+	_, err := services.EthWrapper.SendPRL(key, common.Address{}, oyster_utils.AmountFromUnits(1))
+	if err == nil {
+		t.Fatalf("sendPRL should error when there is no contract at the PRL address")
+	}
+}
+
+func Test_SubscribeToTransfer_StopsWhenDone(t *testing.T) {
+	services.SetUpSimulatedChain(t)
+	defer services.TearDownSimulatedChain()
+
+	transferLogs := make(chan types.Log)
+	done := make(chan struct{})
+	services.EthWrapper.SubscribeToTransfer(transferLogs, done)
+	close(done)
+
+	select {
+	case _, ok := <-transferLogs:
+		if ok {
+			t.Fatalf("no transfers were made")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the subscription should have stopped once done was closed")
+	}
+}
+
+func Test_BurialTxStatus(t *testing.T) {
+	sim, key := services.SetUpSimulatedChain(t)
+	defer services.TearDownSimulatedChain()
+
+	toAddr := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	tx, err := services.EthWrapper.SendETH(key, toAddr, mustParseAmount(t, "0.1"))
+	if err != nil {
+		t.Fatalf("sendETH should not have errored: %v", err)
+	}
+
+	status, stuck, err := services.BurialTxStatus(tx.Hash().Hex(), time.Now(), models.TreasureBurialGasProcessing,
+		models.TreasureBurialGasSent, models.TreasureBurialPRLSent)
+	if err != nil || status != models.TreasureBurialGasProcessing || stuck {
+		t.Fatalf("an unmined transaction should leave the burial waiting, got %v %v", status, err)
+	}
+
+	status, stuck, _ = services.BurialTxStatus(tx.Hash().Hex(), time.Now().Add(-2*services.EthTransferTimeout), models.TreasureBurialGasProcessing,
+		models.TreasureBurialGasSent, models.TreasureBurialPRLSent)
+	if status != models.TreasureBurialGasProcessing || !stuck {
+		t.Fatalf("a transaction missing for too long should be replaced rather than sent again, got %v", status)
+	}
+
+	sim.Commit()
+
+	status, stuck, err = services.BurialTxStatus(tx.Hash().Hex(), time.Now(), models.TreasureBurialGasProcessing,
+		models.TreasureBurialGasSent, models.TreasureBurialPRLSent)
+	if err != nil || status != models.TreasureBurialGasSent || stuck {
+		t.Fatalf("a mined transaction should move the burial forward, got %v %v", status, err)
+	}
+}
+
+func Test_RecordBurialRevert(t *testing.T) {
+	burial := models.TreasureBurial{Status: models.TreasureBurialGasProcessing}
+
+	for i := 1; i < services.MaxBurialReverts; i++ {
+		services.RecordBurialRevert(&burial, models.TreasureBurialPRLSent)
+		if burial.Status != models.TreasureBurialPRLSent || burial.Reverts != i {
+			t.Fatalf("a reverted transaction should be retried, got %v after %d reverts", burial.Status, burial.Reverts)
+		}
+	}
+
+	services.RecordBurialRevert(&burial, models.TreasureBurialPRLSent)
+	if burial.Status != models.TreasureBurialError {
+		t.Fatalf("a burial should be given up on after %d reverts, got %v", services.MaxBurialReverts, burial.Status)
+	}
+}
+
+func Test_ReplacementGasPrice(t *testing.T) {
+	services.SetUpSimulatedChain(t)
+	defer services.TearDownSimulatedChain()
+
+	gasPrice, err := services.ReplacementGasPrice(big.NewInt(100))
+	if err != nil {
+		t.Fatalf("ReplacementGasPrice should not have errored: %v", err)
+	}
+	if gasPrice.Cmp(big.NewInt(110)) <= 0 {
+		t.Fatalf("a replacement should pay more than 10%% above the transaction it replaces, got %v", gasPrice)
+	}
+}
+
+func Test_BuryPrl_InvalidSessionKey(t *testing.T) {
+	services.SetUpSimulatedChain(t)
+	defer services.TearDownSimulatedChain()
+
+	session := models.UploadSession{GenesisHash: "genHash", ETHPrivateKey: "notakey",
+		TotalCost: oyster_utils.AmountFromUnits(1)}
+	err := services.EthWrapper.BuryPrl(session, []models.TreasureMap{{Sector: 1, Idx: 5, Key: "alsonotakey"}})
+	if err != oyster_utils.ErrEthKeyNotEncrypted {
+		t.Fatalf("expected ErrEthKeyNotEncrypted but got %v", err)
+	}
+}
+
+func Test_Bury_NoContractAddress(t *testing.T) {
+	_, key := services.SetUpSimulatedChain(t)
+	defer services.TearDownSimulatedChain()
+
+	if _, err := services.Bury(key, nil); err != services.ErrNoContractAddress {
+		t.Fatalf("expected ErrNoContractAddress but got %v", err)
+	}
+}
+
+func Test_ClaimTreasure_NoContractAddress(t *testing.T) {
+	services.SetUpSimulatedChain(t)
+	defer services.TearDownSimulatedChain()
+
+	treasureKey, _ := crypto.GenerateKey()
+	encryptedKey, _ := oyster_utils.EncryptEthKey(hex.EncodeToString(crypto.FromECDSA(treasureKey)))
+	claim := models.TreasureClaim{ETHPrivateKey: encryptedKey, Status: models.TreasureClaimNotStarted}
+
+	if err := services.EthWrapper.ClaimTreasure(&claim); err != services.ErrNoContractAddress {
+		t.Fatalf("expected ErrNoContractAddress but got %v", err)
+	}
+	if claim.Status != models.TreasureClaimNotStarted {
+		t.Fatalf("a claim that could not be checked should be left to try again, got %v", claim.Status)
+	}
+}
+
+func Test_GenerateEthAddr_EncryptsKey(t *testing.T) {
+	oyster_utils.SetEthKeyMasterKeys(services.TestMasterKey)
+	services.SetBrokerMnemonic(services.TestMnemonic)
+
+	addr, encryptedKey, keyIndex, err := services.EthWrapper.GenerateEthAddr()
+	if err != nil {
+		t.Fatalf("generateEthAddr should not have errored: %v", err)
+	}
+	if !oyster_utils.IsEncryptedEthKey(encryptedKey) {
+		t.Fatalf("generateEthAddr should only return encrypted keys")
+	}
+
+	privateKey, err := services.DecryptPrivateKey(encryptedKey)
+	if err != nil {
+		t.Fatalf("decryptPrivateKey should not have errored: %v", err)
+	}
+	if crypto.PubkeyToAddress(privateKey.PublicKey).Hex() != addr {
+		t.Fatalf("decrypted key does not control the generated address")
+	}
+
+	derivedKey, err := services.DeriveSessionKey(keyIndex)
+	if err != nil {
+		t.Fatalf("DeriveSessionKey should not have errored: %v", err)
+	}
+	if crypto.PubkeyToAddress(derivedKey.PublicKey).Hex() != addr {
+		t.Fatalf("generated address is not the one derived at its index")
+	}
+}
+
+func Test_GenerateEthAddr_NewIndexEachTime(t *testing.T) {
+	oyster_utils.SetEthKeyMasterKeys(services.TestMasterKey)
+	services.SetBrokerMnemonic(services.TestMnemonic)
+
+	addr1, _, keyIndex1, err := services.EthWrapper.GenerateEthAddr()
+	if err != nil {
+		t.Fatalf("generateEthAddr should not have errored: %v", err)
+	}
+	addr2, _, keyIndex2, err := services.EthWrapper.GenerateEthAddr()
+	if err != nil {
+		t.Fatalf("generateEthAddr should not have errored: %v", err)
+	}
+	if keyIndex2 <= keyIndex1 || addr1 == addr2 {
+		t.Fatalf("generateEthAddr reused index %d", keyIndex1)
+	}
+}
+
+func Test_GenerateEthAddr_NoMnemonic(t *testing.T) {
+	defer services.SetBrokerMnemonic(services.TestMnemonic)
+	services.SetBrokerMnemonic("")
+
+	if _, _, _, err := services.EthWrapper.GenerateEthAddr(); err != services.ErrNoMnemonic {
+		t.Fatalf("expected ErrNoMnemonic but got %v", err)
+	}
+}
+
+func Test_GenerateEthAddr_NoMasterKey(t *testing.T) {
+	defer oyster_utils.SetEthKeyMasterKeys(services.TestMasterKey)
+	oyster_utils.SetEthKeyMasterKeys("")
+	services.SetBrokerMnemonic(services.TestMnemonic)
+
+	if _, _, _, err := services.EthWrapper.GenerateEthAddr(); err != oyster_utils.ErrNoMasterKey {
+		t.Fatalf("expected ErrNoMasterKey but got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+// Exposes the gateway's internals to the services_test package.
+var (
+	SetUpSimulatedChain    = setUpSimulatedChain
+	TearDownSimulatedChain = tearDownSimulatedChain
+	DecryptPrivateKey      = decryptPrivateKey
+	WaitForTransfer        = waitForTransfer
+	BurialTxStatus         = burialTxStatus
+	RecordBurialRevert     = recordBurialRevert
+	Bury                   = bury
+	EIP155Signer           = eip155Signer
+)
+
+const (
+	TestMnemonic  = testMnemonic
+	TestMasterKey = testMasterKey
+)
+
+// ReplacementGasPrice returns the gas price a transaction replacing one that
+// paid gasPrice is sent at.
+func ReplacementGasPrice(gasPrice *big.Int) (*big.Int, error) {
+	return txGasPrice(&pendingTx{gasPrice: gasPrice})
+}
+
+// SetEthChainID sets the chain id transactions are signed for.
+func SetEthChainID(chainID *big.Int) {
+	ethChainIDMtx.Lock()
+	defer ethChainIDMtx.Unlock()
+	ethChainID = chainID
+}
+
+// DoPowJob does the PoW of job on the channel with channelID.
+func (s *IotaService) DoPowJob(job *models.PowJob, channelID string) error {
+	return s.doPowJob(job, channelID)
+}
+
+const testMasterKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+// setUpSimulatedChain points the gateway at an in-memory chain in which a
+// freshly generated main wallet holds 100 ETH.
+func setUpSimulatedChain(t *testing.T) (*backends.SimulatedBackend, *ecdsa.PrivateKey) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	funds := new(big.Int).Mul(big.NewInt(100), big.NewInt(params.Ether))
+	sim := backends.NewSimulatedBackend(core.GenesisAlloc{addr: {Balance: funds}})
+
+	backendOverride = sim
+	// The simulated backend only recovers senders of homestead signatures.
+	chainSigner = func() (types.Signer, error) { return types.HomesteadSigner{}, nil }
+	oyster_utils.SetEthKeyMasterKeys(testMasterKey)
+	SetBrokerMnemonic(testMnemonic)
+	MainWalletAddress = addr
+	MainWalletKey = hex.EncodeToString(crypto.FromECDSA(key))
+
+	return sim, key
+}
+
+func tearDownSimulatedChain() {
+	backendOverride = nil
+	chainSigner = eip155Signer
+	OysterPearlAddress = common.Address{}
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tyler-smith/go-bip39"
+)
+
+/*
+Session addresses are derived from the broker's master mnemonic following
+BIP32/BIP44, at m/44'/60'/0'/0/<index>, the path most ethereum wallets use.
+Any session key can be recovered from the mnemonic and the session's
+derivation index alone.
+
+The mnemonic is read from BROKER_MNEMONIC, or from the file named by
+BROKER_MNEMONIC_FILE.
+*/
+
+const hardenedKeyStart uint32 = 0x80000000
+
+// BIP44 path of the session addresses, without the address index.
+var sessionKeyPath = []uint32{
+	hardenedKeyStart + 44, // purpose
+	hardenedKeyStart + 60, // coin type, ethereum
+	hardenedKeyStart + 0,  // account
+	0,                     // external chain
+}
+
+var (
+	ErrNoMnemonic      = errors.New("no broker mnemonic configured")
+	ErrInvalidMnemonic = errors.New("broker mnemonic is not a valid BIP39 mnemonic")
+	ErrInvalidChildKey = errors.New("derivation index does not give a valid key, use the next index")
+	ErrInvalidKeyIndex = errors.New("derivation index must be between 0 and 2^31-1")
+)
+
+// Extended key of m/44'/60'/0'/0, derived once from the mnemonic.
+var (
+	sessionAccountMtx   sync.Mutex
+	sessionAccountKey   *extendedKey
+	sessionAccountErr   error
+	sessionAccountSetUp bool
+)
+
+// extendedKey is a BIP32 extended private key.
+type extendedKey struct {
+	key       []byte // 32 bytes
+	chainCode []byte // 32 bytes
+}
+
+// SetBrokerMnemonic replaces the mnemonic read from the environment.
+func SetBrokerMnemonic(mnemonic string) error {
+	sessionAccountMtx.Lock()
+	defer sessionAccountMtx.Unlock()
+
+	sessionAccountSetUp = true
+	sessionAccountKey, sessionAccountErr = sessionAccountFromMnemonic(mnemonic)
+	return sessionAccountErr
+}
+
+// DeriveSessionKey returns the private key of the session address at index.
+func DeriveSessionKey(index int) (*ecdsa.PrivateKey, error) {
+	if index < 0 || uint64(index) >= uint64(hardenedKeyStart) {
+		return nil, ErrInvalidKeyIndex
+	}
+
+	account, err := sessionAccount()
+	if err != nil {
+		return nil, err
+	}
+
+	child, err := account.child(uint32(index))
+	if err != nil {
+		return nil, err
+	}
+	return crypto.ToECDSA(child.key)
+}
+
+// sessionAccount lazily derives the extended key every session address is
+// a child of.
+func sessionAccount() (*extendedKey, error) {
+	sessionAccountMtx.Lock()
+	defer sessionAccountMtx.Unlock()
+
+	if !sessionAccountSetUp {
+		sessionAccountSetUp = true
+
+		mnemonic := os.Getenv("BROKER_MNEMONIC")
+		if mnemonicFile := os.Getenv("BROKER_MNEMONIC_FILE"); mnemonic == "" && mnemonicFile != "" {
+			contents, err := ioutil.ReadFile(mnemonicFile)
+			if err != nil {
+				sessionAccountErr = err
+				return nil, err
+			}
+			mnemonic = string(contents)
+		}
+		sessionAccountKey, sessionAccountErr = sessionAccountFromMnemonic(mnemonic)
+	}
+	return sessionAccountKey, sessionAccountErr
+}
+
+func sessionAccountFromMnemonic(mnemonic string) (*extendedKey, error) {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	if mnemonic == "" {
+		return nil, ErrNoMnemonic
+	}
+
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	if err != nil {
+		return nil, ErrInvalidMnemonic
+	}
+
+	key, err := newMasterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range sessionKeyPath {
+		if key, err = key.child(index); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// newMasterKey derives the BIP32 master key from a seed.
+func newMasterKey(seed []byte) (*extendedKey, error) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	if !isValidPrivateKey(sum[:32]) {
+		return nil, ErrInvalidChildKey
+	}
+	return &extendedKey{key: sum[:32], chainCode: sum[32:]}, nil
+}
+
+// child derives the private child key at index, hardened if index is at
+// least 2^31.
+func (k *extendedKey) child(index uint32) (*extendedKey, error) {
+	var data []byte
+	if index >= hardenedKeyStart {
+		data = append([]byte{0x00}, k.key...)
+	} else {
+		privateKey, err := crypto.ToECDSA(k.key)
+		if err != nil {
+			return nil, err
+		}
+		data = crypto.CompressPubkey(&privateKey.PublicKey)
+	}
+	indexBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(indexBytes, index)
+	data = append(data, indexBytes...)
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	if new(big.Int).SetBytes(sum[:32]).Cmp(crypto.S256().Params().N) >= 0 {
+		return nil, ErrInvalidChildKey
+	}
+
+	childKey := new(big.Int).Add(new(big.Int).SetBytes(sum[:32]), new(big.Int).SetBytes(k.key))
+	childKey.Mod(childKey, crypto.S256().Params().N)
+	if childKey.Sign() == 0 {
+		return nil, ErrInvalidChildKey
+	}
+
+	return &extendedKey{key: math.PaddedBigBytes(childKey, 32), chainCode: sum[32:]}, nil
+}
+
+func isValidPrivateKey(key []byte) bool {
+	k := new(big.Int).SetBytes(key)
+	return k.Sign() > 0 && k.Cmp(crypto.S256().Params().N) < 0
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func Test_NewMasterKey(t *testing.T) {
+	// BIP32 test vector 1.
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+
+	master, err := newMasterKey(seed)
+	if err != nil {
+		t.Fatalf("newMasterKey should not have errored: %v", err)
+	}
+	if hex.EncodeToString(master.key) != "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35" {
+		t.Fatalf("wrong master key %x", master.key)
+	}
+	if hex.EncodeToString(master.chainCode) != "873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508" {
+		t.Fatalf("wrong master chain code %x", master.chainCode)
+	}
+
+	// m/0H/1
+	child, err := master.child(hardenedKeyStart + 0)
+	if err == nil {
+		child, err = child.child(1)
+	}
+	if err != nil {
+		t.Fatalf("child should not have errored: %v", err)
+	}
+	if hex.EncodeToString(child.key) != "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368" {
+		t.Fatalf("wrong child key %x", child.key)
+	}
+}
+
+func Test_DeriveSessionKey(t *testing.T) {
+	if err := SetBrokerMnemonic(testMnemonic); err != nil {
+		t.Fatalf("SetBrokerMnemonic should not have errored: %v", err)
+	}
+
+	expected := map[int]string{
+		0: "0x9858EfFD232B4033E47d90003D41EC34EcaEda94",
+		1: "0x6Fac4D18c912343BF86fa7049364Dd4E424Ab9C0",
+	}
+	for index, addr := range expected {
+		key, err := DeriveSessionKey(index)
+		if err != nil {
+			t.Fatalf("DeriveSessionKey should not have errored: %v", err)
+		}
+		if crypto.PubkeyToAddress(key.PublicKey).Hex() != addr {
+			t.Fatalf("expected %s at index %d but got %s", addr, index,
+				crypto.PubkeyToAddress(key.PublicKey).Hex())
+		}
+	}
+}
+
+func Test_DeriveSessionKey_InvalidIndex(t *testing.T) {
+	SetBrokerMnemonic(testMnemonic)
+
+	if _, err := DeriveSessionKey(-1); err != ErrInvalidKeyIndex {
+		t.Fatalf("expected ErrInvalidKeyIndex but got %v", err)
+	}
+	if _, err := DeriveSessionKey(1 << 31); err != ErrInvalidKeyIndex {
+		t.Fatalf("expected ErrInvalidKeyIndex but got %v", err)
+	}
+}
+
+func Test_SetBrokerMnemonic_Invalid(t *testing.T) {
+	defer SetBrokerMnemonic(testMnemonic)
+
+	if err := SetBrokerMnemonic("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon"); err != ErrInvalidMnemonic {
+		t.Fatalf("expected ErrInvalidMnemonic but got %v", err)
+	}
+	if _, err := DeriveSessionKey(0); err != ErrInvalidMnemonic {
+		t.Fatalf("expected ErrInvalidMnemonic but got %v", err)
+	}
+}
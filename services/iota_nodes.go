@@ -0,0 +1,264 @@
+package services
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	raven "github.com/getsentry/raven-go"
+	"github.com/iotaledger/giota"
+	"github.com/pkg/errors"
+)
+
+/*
+IotaNodePool spreads IOTA traffic over the IRI nodes of the config. A node is
+healthy when getNodeInfo answers and the node is synced: its solid subtangle
+milestone has caught up with its latest milestone, and its latest milestone
+is not behind the most recent one any node reports. Reads go to the healthy
+nodes in turn and move on to the next node when one cannot be reached. A node
+that answers with an IRI error stays healthy, the request is what failed.
+Broadcasts fan out to several healthy nodes at once.
+*/
+
+var (
+	// How often the nodes are health-checked.
+	IotaNodeHealthCheckInterval = 30 * time.Second
+
+	// How many milestones a node may lag and still count as synced.
+	IotaNodeMaxMilestoneLag int64 = 1
+
+	// How many nodes a bundle is broadcast to.
+	IotaBroadcastFanOut = 3
+)
+
+var ErrNoHealthyIotaNodes = errors.New("no healthy IRI node is available")
+
+type iotaNode struct {
+	url     string
+	api     *giota.API
+	healthy bool
+}
+
+type IotaNodePool struct {
+	nodes []*iotaNode
+	next  int
+	mutex sync.Mutex
+}
+
+// NewIotaNodePool returns a pool of the nodes at urls. Nodes count as healthy
+// until they are checked or fail a request.
+func NewIotaNodePool(urls []string) *IotaNodePool {
+	pool := &IotaNodePool{}
+	for _, url := range urls {
+		pool.nodes = append(pool.nodes, &iotaNode{url: url, api: giota.NewAPI(url, nil), healthy: true})
+	}
+	return pool
+}
+
+// CheckHealth asks every node for its node info and marks which are synced.
+func (p *IotaNodePool) CheckHealth() {
+	infos := make([]*giota.GetNodeInfoResponse, len(p.nodes))
+
+	var wg sync.WaitGroup
+	for i, node := range p.nodes {
+		wg.Add(1)
+		go func(i int, node *iotaNode) {
+			defer wg.Done()
+			info, err := node.api.GetNodeInfo()
+			if err != nil {
+				raven.CaptureError(errors.Wrap(err, "getNodeInfo failed on "+node.url), nil)
+				return
+			}
+			infos[i] = info
+		}(i, node)
+	}
+	wg.Wait()
+
+	var latestMilestone int64
+	for _, info := range infos {
+		if info != nil && info.LatestMilestoneIndex > latestMilestone {
+			latestMilestone = info.LatestMilestoneIndex
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for i, node := range p.nodes {
+		info := infos[i]
+		node.healthy = info != nil &&
+			info.LatestMilestoneIndex-info.LatestSolidSubtangleMilestoneIndex <= IotaNodeMaxMilestoneLag &&
+			latestMilestone-info.LatestMilestoneIndex <= IotaNodeMaxMilestoneLag
+	}
+}
+
+// HealthyNodes returns the URLs of the nodes that are healthy.
+func (p *IotaNodePool) HealthyNodes() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var urls []string
+	for _, node := range p.nodes {
+		if node.healthy {
+			urls = append(urls, node.url)
+		}
+	}
+	return urls
+}
+
+// BroadcastNodes returns the healthy nodes a bundle should be broadcast to,
+// starting from the next node in turn.
+func (p *IotaNodePool) BroadcastNodes() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var urls []string
+	for i := 0; i < len(p.nodes) && len(urls) < IotaBroadcastFanOut; i++ {
+		node := p.nodes[(p.next+i)%len(p.nodes)]
+		if node.healthy {
+			urls = append(urls, node.url)
+		}
+	}
+	if len(p.nodes) > 0 {
+		p.next = (p.next + 1) % len(p.nodes)
+	}
+	return urls
+}
+
+// Next returns the API of the next healthy node.
+func (p *IotaNodePool) Next() (*giota.API, error) {
+	node, err := p.nextNode()
+	if err != nil {
+		return nil, err
+	}
+	return node.api, nil
+}
+
+func (p *IotaNodePool) nextNode() (*iotaNode, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for i := 0; i < len(p.nodes); i++ {
+		node := p.nodes[p.next]
+		p.next = (p.next + 1) % len(p.nodes)
+		if node.healthy {
+			return node, nil
+		}
+	}
+	return nil, ErrNoHealthyIotaNodes
+}
+
+func (p *IotaNodePool) markUnhealthy(node *iotaNode) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	node.healthy = false
+}
+
+// isNodeFailure tells whether err means the node could not be reached or did
+// not answer in time, rather than IRI turning the request down.
+func isNodeFailure(err error) bool {
+	err = errors.Cause(err)
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return err == io.ErrUnexpectedEOF
+}
+
+// read calls do on the healthy nodes in turn until one succeeds, or one
+// turns the request down.
+func (p *IotaNodePool) read(do func(api *giota.API) error) error {
+	err := ErrNoHealthyIotaNodes
+	for i := 0; i < len(p.nodes); i++ {
+		node, nodeErr := p.nextNode()
+		if nodeErr != nil {
+			return err
+		}
+		if err = do(node.api); err == nil || !isNodeFailure(err) {
+			return err
+		}
+		p.markUnhealthy(node)
+	}
+	return err
+}
+
+func (p *IotaNodePool) FindTransactions(req *giota.FindTransactionsRequest) (*giota.FindTransactionsResponse, error) {
+	var res *giota.FindTransactionsResponse
+	err := p.read(func(api *giota.API) (err error) {
+		res, err = api.FindTransactions(req)
+		return
+	})
+	return res, err
+}
+
+func (p *IotaNodePool) GetTrytes(hashes []giota.Trytes) (*giota.GetTrytesResponse, error) {
+	var res *giota.GetTrytesResponse
+	err := p.read(func(api *giota.API) (err error) {
+		res, err = api.GetTrytes(hashes)
+		return
+	})
+	return res, err
+}
+
+func (p *IotaNodePool) GetTransactionsToApprove(depth int64) (*giota.GetTransactionsToApproveResponse, error) {
+	var res *giota.GetTransactionsToApproveResponse
+	err := p.read(func(api *giota.API) (err error) {
+		res, err = api.GetTransactionsToApprove(depth, giota.DefaultNumberOfWalks, "")
+		return
+	})
+	return res, err
+}
+
+// Broadcast broadcasts and stores trytes on every node of urls at once, or on
+// BroadcastNodes when urls is empty. Succeeds when at least one node took
+// them.
+func (p *IotaNodePool) Broadcast(trytes []giota.Transaction, urls []string) error {
+	var nodes []*iotaNode
+	for _, url := range urls {
+		if node := p.node(url); node != nil {
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == 0 {
+		for _, url := range p.BroadcastNodes() {
+			nodes = append(nodes, p.node(url))
+		}
+	}
+	if len(nodes) == 0 {
+		return ErrNoHealthyIotaNodes
+	}
+
+	errs := make([]error, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node *iotaNode) {
+			defer wg.Done()
+			if errs[i] = node.api.BroadcastTransactions(trytes); errs[i] == nil {
+				errs[i] = node.api.StoreTransactions(trytes)
+			}
+			if errs[i] != nil {
+				if isNodeFailure(errs[i]) {
+					p.markUnhealthy(node)
+				}
+				errs[i] = errors.Wrap(errs[i], "broadcast failed on "+node.url)
+			}
+		}(i, node)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	return errs[0]
+}
+
+func (p *IotaNodePool) node(url string) *iotaNode {
+	for _, node := range p.nodes {
+		if node.url == url {
+			return node
+		}
+	}
+	return nil
+}
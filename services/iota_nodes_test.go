@@ -0,0 +1,158 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/iotaledger/giota"
+)
+
+// fakeIriNode answers IRI commands as a node at the milestones given, or
+// drops the connection of every command when down. Answers every command with
+// an IRI error once rejecting. Counts the commands it was sent.
+type fakeIriNode struct {
+	*httptest.Server
+	mutex     sync.Mutex
+	commands  map[string]int
+	rejecting bool
+}
+
+func newFakeIriNode(latestMilestone int64, solidMilestone int64, down bool) *fakeIriNode {
+	node := &fakeIriNode{commands: map[string]int{}}
+	node.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&req)
+		command, _ := req["command"].(string)
+
+		node.mutex.Lock()
+		node.commands[command]++
+		rejecting := node.rejecting
+		node.mutex.Unlock()
+
+		if down {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		if rejecting {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid addresses input"})
+			return
+		}
+
+		switch command {
+		case "getNodeInfo":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"latestMilestoneIndex":               latestMilestone,
+				"latestSolidSubtangleMilestoneIndex": solidMilestone,
+			})
+		case "findTransactions":
+			json.NewEncoder(w).Encode(map[string]interface{}{"hashes": []string{}})
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{})
+		}
+	}))
+	return node
+}
+
+func (n *fakeIriNode) count(command string) int {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.commands[command]
+}
+
+func Test_IotaNodePool_CheckHealth(t *testing.T) {
+	synced := newFakeIriNode(100, 100, false)
+	defer synced.Close()
+	notSolid := newFakeIriNode(100, 90, false)
+	defer notSolid.Close()
+	behind := newFakeIriNode(95, 95, false)
+	defer behind.Close()
+	down := newFakeIriNode(0, 0, true)
+	defer down.Close()
+
+	pool := NewIotaNodePool([]string{synced.URL, notSolid.URL, behind.URL, down.URL})
+	if len(pool.HealthyNodes()) != 4 {
+		t.Fatalf("IotaNodePool: nodes should count as healthy until they are checked")
+	}
+
+	pool.CheckHealth()
+	healthy := pool.HealthyNodes()
+	if len(healthy) != 1 || healthy[0] != synced.URL {
+		t.Fatalf("IotaNodePool: only the synced node should be healthy, got %v", healthy)
+	}
+}
+
+func Test_IotaNodePool_ReadsFailOver(t *testing.T) {
+	down := newFakeIriNode(0, 0, true)
+	defer down.Close()
+	up := newFakeIriNode(100, 100, false)
+	defer up.Close()
+
+	pool := NewIotaNodePool([]string{down.URL, up.URL})
+	_, err := pool.FindTransactions(&giota.FindTransactionsRequest{Command: "findTransactions"})
+	if err != nil {
+		t.Fatalf("IotaNodePool: should have moved on to the node that is up, got %v", err)
+	}
+
+	// The node that failed is skipped until it is healthy again.
+	pool.FindTransactions(&giota.FindTransactionsRequest{Command: "findTransactions"})
+	if down.count("findTransactions") != 1 || up.count("findTransactions") != 2 {
+		t.Fatalf("IotaNodePool: expected 1 read on the node that is down and 2 on the node that is up, "+
+			"got %d and %d", down.count("findTransactions"), up.count("findTransactions"))
+	}
+}
+
+func Test_IotaNodePool_RejectionKeepsNodeHealthy(t *testing.T) {
+	node := newFakeIriNode(100, 100, false)
+	defer node.Close()
+	node.rejecting = true
+
+	pool := NewIotaNodePool([]string{node.URL})
+	if _, err := pool.FindTransactions(&giota.FindTransactionsRequest{Command: "findTransactions"}); err == nil {
+		t.Fatalf("IotaNodePool: expected the IRI error")
+	}
+	if len(pool.HealthyNodes()) != 1 {
+		t.Fatalf("IotaNodePool: a node turning a request down should stay healthy")
+	}
+}
+
+func Test_IotaNodePool_BroadcastFansOut(t *testing.T) {
+	defer func(fanOut int) { IotaBroadcastFanOut = fanOut }(IotaBroadcastFanOut)
+	IotaBroadcastFanOut = 2
+
+	var nodes []*fakeIriNode
+	var urls []string
+	for i := 0; i < 3; i++ {
+		node := newFakeIriNode(100, 100, false)
+		defer node.Close()
+		nodes = append(nodes, node)
+		urls = append(urls, node.URL)
+	}
+	pool := NewIotaNodePool(urls)
+
+	tx, err := giota.NewTransaction(giota.Trytes(strings.Repeat("9", 2673)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broadcastNodes := pool.BroadcastNodes()
+	if len(broadcastNodes) != 2 {
+		t.Fatalf("IotaNodePool: expected to broadcast to 2 nodes, got %v", broadcastNodes)
+	}
+	if err := pool.Broadcast([]giota.Transaction{*tx}, broadcastNodes); err != nil {
+		t.Fatal(err)
+	}
+
+	broadcasts := 0
+	for _, node := range nodes {
+		broadcasts += node.count("broadcastTransactions")
+	}
+	if broadcasts != 2 {
+		t.Fatalf("IotaNodePool: expected the bundle to be broadcast to 2 nodes, got %d", broadcasts)
+	}
+}
@@ -1,11 +1,12 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"math"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -14,22 +15,24 @@ import (
 	"github.com/iotaledger/giota"
 	"github.com/joho/godotenv"
 	"github.com/oysterprotocol/brokernode/models"
+	"github.com/pkg/errors"
 )
 
-type ChunkTracker struct {
-	ChunkCount  int
-	ElapsedTime time.Duration
-}
-
-type PowJob struct {
-	Chunks         []models.DataMap
-	BroadcastNodes []string
+type PowChannel struct {
+	ChannelID string
 }
 
-type PowChannel struct {
-	ChannelID     string
-	ChunkTrackers *[]ChunkTracker
-	Channel       chan PowJob
+// IotaConfig is how an IotaService reaches and writes to the tangle.
+type IotaConfig struct {
+	NodeURLs     []string // IRI nodes, such as http://localhost:14265
+	Seed         giota.Trytes
+	MinWeightMag int64
+	Depth        int64
+	Tag          giota.Trytes
+
+	PowProvider string   // see NewPowProvider
+	PowServers  []string // used by the pool PoW provider
+	PowProcs    int      // number of PoW channels, NumCPU()-1 when 0
 }
 
 type IotaService struct {
@@ -37,12 +40,25 @@ type IotaService struct {
 	VerifyChunkMessagesMatchRecord VerifyChunkMessagesMatchRecord
 	VerifyChunksMatchRecord        VerifyChunksMatchRecord
 	ChunksMatch                    ChunksMatch
+	BroadcastTransactions          BroadcastTransactions
+
+	// PoW channels by channel ID, made by Start.
+	Channel map[string]PowChannel
+
+	// The IRI nodes all IOTA traffic goes to.
+	Nodes *IotaNodePool
+
+	config  IotaConfig
+	pow     PowProvider
+	workers *sync.WaitGroup
+	cancel  context.CancelFunc // stops the workers and health checks
 }
 
 type SendChunksToChannel func([]models.DataMap, *models.ChunkChannel)
 type VerifyChunkMessagesMatchRecord func([]models.DataMap) (filteredChunks FilteredChunk, err error)
 type VerifyChunksMatchRecord func([]models.DataMap, bool) (filteredChunks FilteredChunk, err error)
 type ChunksMatch func(giota.Transaction, models.DataMap, bool) bool
+type BroadcastTransactions func([]giota.Transaction) error
 
 type FilteredChunk struct {
 	MatchesTangle      []models.DataMap
@@ -56,271 +72,405 @@ const (
 	maxTimestampTrytes = "MMMMMMMMM"
 )
 
-var (
-	// PowProcs is number of concurrent processes (default is NumCPU()-1)
-	PowProcs    int
-	IotaWrapper IotaService
-	//This mutex was added by us.
-	mutex        = &sync.Mutex{}
-	seed         giota.Trytes
-	minDepth     = int64(giota.DefaultNumberOfWalks)
-	minWeightMag = int64(9)
-	bestPow      giota.PowFunc
-	powName      string
-	Channel      = map[string]PowChannel{}
-	wg           sync.WaitGroup
-	api          *giota.API
-)
+var ErrNoIotaNodes = errors.New("no IRI node is configured")
 
-func init() {
+// How often an idle PoW worker looks for a job to claim.
+var PowJobPollInterval = time.Second
 
-	// Load ENV variables
-	err := godotenv.Load()
-	if err != nil {
-		log.Println("Error loading .env file")
-		raven.CaptureError(err, nil)
+// DefaultIotaConfig returns the config the broker uses for anything not set.
+func DefaultIotaConfig() IotaConfig {
+	powProcs := runtime.NumCPU()
+	if powProcs != 1 {
+		powProcs--
 	}
 
-	host_ip := os.Getenv("HOST_IP")
-	if host_ip == "" {
-		raven.CaptureError(err, nil)
-		panic("Invalid IRI host: Check the .env file for HOST_IP")
+	return IotaConfig{
+		Seed:         "OYSTERPRLOYSTERPRLOYSTERPRLOYSTERPRLOYSTERPRLOYSTERPRLOYSTERPRLOYSTERPRLOYSTERPRL",
+		MinWeightMag: 9,
+		Depth:        int64(giota.DefaultNumberOfWalks),
+		Tag:          "OYSTERGOLANG",
+		PowProvider:  PowProviderLocal,
+		PowProcs:     powProcs,
+	}
+}
+
+// IotaConfigFromEnv returns the config set in the environment. IRI nodes are
+// listed in IOTA_NODES, or HOST_IP for a single node on the IRI port.
+func IotaConfigFromEnv() (IotaConfig, error) {
+	if err := godotenv.Load(); err != nil {
+		log.Println("Error loading .env file")
 	}
 
-	provider := "http://" + host_ip + ":14265"
+	config := DefaultIotaConfig()
+	config.NodeURLs = splitEnvList("IOTA_NODES")
+	if hostIP := os.Getenv("HOST_IP"); len(config.NodeURLs) == 0 && hostIP != "" {
+		config.NodeURLs = []string{"http://" + hostIP + ":14265"}
+	}
+	if len(config.NodeURLs) == 0 {
+		return config, ErrNoIotaNodes
+	}
 
-	api = giota.NewAPI(provider, nil)
+	if seed := os.Getenv("IOTA_SEED"); seed != "" {
+		config.Seed = giota.Trytes(seed)
+	}
+	if mwm, err := strconv.ParseInt(os.Getenv("IOTA_MWM"), 10, 64); err == nil {
+		config.MinWeightMag = mwm
+	}
+	if depth, err := strconv.ParseInt(os.Getenv("IOTA_DEPTH"), 10, 64); err == nil {
+		config.Depth = depth
+	}
+	if tag := os.Getenv("IOTA_TAG"); tag != "" {
+		config.Tag = giota.Trytes(tag)
+	}
+	if provider := os.Getenv("POW_PROVIDER"); provider != "" {
+		config.PowProvider = provider
+	}
+	config.PowServers = splitEnvList("POW_SERVERS")
+	if powProcs, err := strconv.Atoi(os.Getenv("POW_PROCS")); err == nil && powProcs > 0 {
+		config.PowProcs = powProcs
+	}
 
-	seed = "OYSTERPRLOYSTERPRLOYSTERPRLOYSTERPRLOYSTERPRLOYSTERPRLOYSTERPRLOYSTERPRLOYSTERPRL"
+	return config, nil
+}
 
-	powName, bestPow = giota.GetBestPoW()
+// NewIotaService returns a service for config. Nothing is sent to the IRI
+// nodes or written to the database until it is started.
+func NewIotaService(config IotaConfig) (*IotaService, error) {
+	if len(config.NodeURLs) == 0 {
+		return nil, ErrNoIotaNodes
+	}
+	if config.PowProcs <= 0 {
+		config.PowProcs = DefaultIotaConfig().PowProcs
+	}
 
-	IotaWrapper = IotaService{
-		SendChunksToChannel:            sendChunksToChannel,
-		VerifyChunkMessagesMatchRecord: verifyChunkMessagesMatchRecord,
-		VerifyChunksMatchRecord:        verifyChunksMatchRecord,
-		ChunksMatch:                    chunksMatch,
+	s := &IotaService{
+		Channel: map[string]PowChannel{},
+		Nodes:   NewIotaNodePool(config.NodeURLs),
+		config:  config,
+		workers: &sync.WaitGroup{},
 	}
 
-	PowProcs = runtime.NumCPU()
-	if PowProcs != 1 {
-		PowProcs--
+	var err error
+	if s.pow, err = NewPowProvider(config.PowProvider, s.Nodes, config.PowServers); err != nil {
+		return nil, err
 	}
 
-	channels := []models.ChunkChannel{}
+	s.SendChunksToChannel = s.sendChunksToChannel
+	s.VerifyChunkMessagesMatchRecord = s.verifyChunkMessagesMatchRecord
+	s.VerifyChunksMatchRecord = s.verifyChunksMatchRecord
+	s.ChunksMatch = chunksMatch
+	s.BroadcastTransactions = s.broadcastTransactions
 
-	wg.Add(1)
-	go func(channels *[]models.ChunkChannel, err *error) {
-		defer wg.Done()
-		*channels, *err = models.MakeChannels(PowProcs)
-	}(&channels, &err)
+	return s, nil
+}
 
-	wg.Wait()
+// Start makes a chunk channel for every PoW process and starts its worker,
+// and starts health-checking the IRI nodes.
+func (s *IotaService) Start() error {
+	channels, err := models.MakeChannels(s.config.PowProcs)
+	if err != nil {
+		return err
+	}
 
-	for _, channel := range channels {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
 
-		chunkTracker := make([]ChunkTracker, 0)
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		s.checkNodeHealth(ctx.Done())
+	}()
 
-		Channel[channel.ChannelID] = PowChannel{
-			ChannelID:     channel.ChannelID,
-			Channel:       make(chan PowJob),
-			ChunkTrackers: &chunkTracker,
-		}
+	for _, channel := range channels {
+
+		s.Channel[channel.ChannelID] = PowChannel{ChannelID: channel.ChannelID}
 
 		// start the worker
-		go PowWorker(Channel[channel.ChannelID].Channel, channel.ChannelID, err)
+		s.workers.Add(1)
+		go func(channelID string) {
+			defer s.workers.Done()
+			s.PowWorker(channelID, ctx.Done())
+		}(channel.ChannelID)
 	}
+	return nil
 }
 
-func PowWorker(jobQueue <-chan PowJob, channelID string, err error) {
-	for powJobRequest := range jobQueue {
-		// this is where we would call methods to deal with each job request
-		fmt.Println("PowWorker: Starting")
+// Stop lets the workers finish the job they are on and waits for them. Jobs
+// that are still queued, or sent to a channel meanwhile, stay in the database
+// for the next start. Stopping again does nothing.
+func (s *IotaService) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.workers.Wait()
 
-		startTime := time.Now()
+	for channelID := range s.Channel {
+		delete(s.Channel, channelID)
+	}
+}
 
-		transfersArray := make([]giota.Transfer, len(powJobRequest.Chunks))
+func (s *IotaService) checkNodeHealth(stop <-chan struct{}) {
+	ticker := time.NewTicker(IotaNodeHealthCheckInterval)
+	defer ticker.Stop()
 
-		for i, chunk := range powJobRequest.Chunks {
-			transfersArray[i].Address = giota.Address(chunk.Address)
-			transfersArray[i].Value = int64(0)
-			transfersArray[i].Message = giota.Trytes(chunk.Message)
-			transfersArray[i].Tag = giota.Trytes("OYSTERGOLANG")
+	for {
+		s.Nodes.CheckHealth()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
 		}
+	}
+}
 
-		bdl, err := giota.PrepareTransfers(api, seed, transfersArray, nil, "", 1)
-
-		if err != nil {
-			raven.CaptureError(err, nil)
+func splitEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
 		}
+	}
+	return list
+}
 
-		transactions := []giota.Transaction(bdl)
+// PowWorker claims the PoW jobs of the channel with channelID and does them
+// one at a time, until stop is closed. It waits before claiming the next job
+// after one fails, so it does not run through the queue while IRI is down.
+func (s *IotaService) PowWorker(channelID string, stop <-chan struct{}) {
+	hostname, _ := os.Hostname()
+	workerID := fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), channelID)
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
 
-		transactionsToApprove, err := api.GetTransactionsToApprove(minDepth, giota.DefaultNumberOfWalks, "")
+		job, err := models.ClaimPowJob(workerID, channelID)
 		if err != nil {
 			raven.CaptureError(err, nil)
 		}
-
-		err = doPowAndBroadcast(
-			transactionsToApprove.BranchTransaction,
-			transactionsToApprove.TrunkTransaction,
-			minDepth,
-			transactions,
-			minWeightMag,
-			bestPow,
-			powJobRequest.BroadcastNodes)
-
-		channelToChange := Channel[channelID]
-
-		channelInDB := models.ChunkChannel{}
-		models.DB.RawQuery("SELECT * from chunk_channels where channel_id = ?", channelID).First(&channelInDB)
-		channelInDB.ChunksProcessed += len(powJobRequest.Chunks)
-		models.DB.ValidateAndSave(&channelInDB)
-
-		fmt.Println("PowWorker: Leaving")
-		TrackProcessingTime(startTime, len(powJobRequest.Chunks), &channelToChange)
+		if job != nil {
+			err = s.doPowJob(job, channelID)
+		}
+		if job == nil || err != nil {
+			select {
+			case <-stop:
+				return
+			case <-time.After(PowJobPollInterval):
+			}
+		}
 	}
 }
 
-func TrackProcessingTime(startTime time.Time, numChunks int, channel *PowChannel) {
+// doPowJob does the PoW for job on the channel with channelID and broadcasts
+// it. Returns why the job failed, if it did.
+func (s *IotaService) doPowJob(job *models.PowJob, channelID string) error {
+	// this is where we would call methods to deal with each job request
+	fmt.Println("PowWorker: Starting")
 
-	*(channel.ChunkTrackers) = append(*(channel.ChunkTrackers), ChunkTracker{
-		ChunkCount:  numChunks,
-		ElapsedTime: time.Since(startTime),
-	})
+	defer renewPowJobLease(job)()
 
-	if len(*(channel.ChunkTrackers)) > 10 {
-		*(channel.ChunkTrackers) = (*(channel.ChunkTrackers))[1:11]
+	chunks, err := job.DataMaps()
+	if err != nil {
+		return s.failPowJob(job, err)
 	}
-}
-
-func doPowAndBroadcast(branch giota.Trytes, trunk giota.Trytes, depth int64,
-	trytes []giota.Transaction, mwm int64, bestPow giota.PowFunc, broadcastNodes []string) error {
 
-	//defer oysterUtils.TimeTrack(time.Now(), "doPow_using_" + powName, analytics.NewProperties().
-	//	Set("addresses", oysterUtils.MapTransactionsToAddrs(trytes)))
+	transfersArray := make([]giota.Transfer, len(chunks))
 
-	var prev giota.Trytes
-	var err error
+	for i, chunk := range chunks {
+		transfersArray[i].Address = giota.Address(chunk.Address)
+		transfersArray[i].Value = int64(0)
+		transfersArray[i].Message = giota.Trytes(chunk.Message)
+		transfersArray[i].Tag = s.config.Tag
+	}
 
-	for i := len(trytes) - 1; i >= 0; i-- {
-		switch {
-		case i == len(trytes)-1:
-			trytes[i].TrunkTransaction = trunk
-			trytes[i].BranchTransaction = branch
-		default:
-			trytes[i].TrunkTransaction = prev
-			trytes[i].BranchTransaction = trunk
-		}
+	api, err := s.Nodes.Next()
+	if err != nil {
+		return s.failPowJob(job, err)
+	}
 
-		timestamp := giota.Int2Trits(time.Now().UnixNano()/1000000, giota.TimestampTrinarySize).Trytes()
-		trytes[i].AttachmentTimestamp = timestamp
-		trytes[i].AttachmentTimestampLowerBound = ""
-		trytes[i].AttachmentTimestampUpperBound = maxTimestampTrytes
+	bdl, err := giota.PrepareTransfers(api, s.config.Seed, transfersArray, nil, "", 1)
+	if err != nil {
+		return s.failPowJob(job, err)
+	}
 
-		// We customized this to lock here.
-		mutex.Lock()
-		trytes[i].Nonce, err = bestPow(trytes[i].Trytes(), int(mwm))
-		mutex.Unlock()
+	transactions := []giota.Transaction(bdl)
 
-		if err != nil {
-			raven.CaptureError(err, nil)
-			return err
-		}
+	transactionsToApprove, err := s.Nodes.GetTransactionsToApprove(s.config.Depth)
+	if err != nil {
+		return s.failPowJob(job, err)
+	}
 
-		prev = trytes[i].Hash()
+	attached, err := s.doPowAndBroadcast(
+		channelID,
+		transactionsToApprove.BranchTransaction,
+		transactionsToApprove.TrunkTransaction,
+		s.config.Depth,
+		transactions,
+		s.config.MinWeightMag,
+		s.pow,
+		job.Nodes(),
+		chunks)
+
+	if !attached {
+		return s.failPowJob(job, err)
 	}
 
-	go func(trytes []giota.Transaction) {
+	// The trytes are kept, so a failed broadcast is left to
+	// UpdateTimeOutDataMaps rather than the PoW being done again.
+	if completeErr := job.Complete(); completeErr != nil {
+		raven.CaptureError(completeErr, nil)
+	}
+	if err == nil {
+		SessionEvents.PublishChunkEvents(EventChunksAttached, chunks)
+	}
 
-		err = api.BroadcastTransactions(trytes)
+	channelInDB := models.ChunkChannel{}
+	models.DB.RawQuery("SELECT * from chunk_channels where channel_id = ?", channelID).First(&channelInDB)
+	channelInDB.ChunksProcessed += len(chunks)
+	models.DB.ValidateAndSave(&channelInDB)
 
-		if err != nil {
+	fmt.Println("PowWorker: Leaving")
 
-			// Async log
-			//go oysterUtils.SegmentClient.Enqueue(analytics.Track{
-			//	Event:  "broadcast_fail_redoing_pow",
-			//	UserId: oysterUtils.GetLocalIP(),
-			//	Properties: analytics.NewProperties().
-			//		Set("addresses", oysterUtils.MapTransactionsToAddrs(trytes)),
-			//})
+	// The broadcast is retried by UpdateTimeOutDataMaps, the job is done.
+	return nil
+}
 
-			fmt.Println(err)
-			raven.CaptureError(err, nil)
-		} else {
-
-			err = api.StoreTransactions(trytes)
-			fmt.Println("BROADCAST SUCCESS")
-
-			/*
-				TODO do we need this??
-			*/
-			//go BroadcastTxs(&trytes, broadcastNodes)
-
-			//go oysterUtils.SegmentClient.Enqueue(analytics.Track{
-			//	Event:  "broadcast_success",
-			//	UserId: oysterUtils.GetLocalIP(),
-			//	Properties: analytics.NewProperties().
-			//		Set("addresses", oysterUtils.MapTransactionsToAddrs(trytes)),
-			//})
+// renewPowJobLease renews the lease of job every third of
+// PowJobLeaseDuration until the returned func is called, so a slow PoW does
+// not lose the job to another worker.
+func renewPowJobLease(job *models.PowJob) (stop func()) {
+	lease := *job
+	done := make(chan struct{})
+	renewed := make(chan struct{})
+
+	go func() {
+		defer close(renewed)
+		ticker := time.NewTicker(models.PowJobLeaseDuration / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// A failed renewal is tried again on the next tick, the
+				// lease outlasts a few of them. Only a lost job stops it.
+				if err := lease.RenewLease(); err != nil {
+					raven.CaptureError(err, nil)
+					if err == models.ErrPowJobLeaseLost {
+						return
+					}
+				}
+			}
 		}
-	}(trytes)
+	}()
 
-	return nil
+	return func() {
+		close(done)
+		<-renewed
+	}
 }
 
-func sendChunksToChannel(chunks []models.DataMap, channel *models.ChunkChannel) {
-
-	for _, chunk := range chunks {
-		chunk.Status = models.Unverified
-		models.DB.ValidateAndSave(&chunk)
+// failPowJob queues job again after cause, or fails it once it has used up its
+// attempts. Returns cause.
+func (s *IotaService) failPowJob(job *models.PowJob, cause error) error {
+	raven.CaptureError(cause, nil)
+	if err := job.Fail(cause); err != nil {
+		raven.CaptureError(err, nil)
 	}
+	return cause
+}
 
-	channel.EstReadyTime = SetEstimatedReadyTime(Channel[channel.ChannelID], len(chunks))
-	models.DB.ValidateAndSave(channel)
+// doPowAndBroadcast attaches trytes, keeps what each chunk was attached with,
+// and broadcasts them. A failed broadcast is retried, and once the retries run
+// out UpdateTimeOutDataMaps broadcasts the kept trytes again. attached is
+// whether the PoW was done and kept, even if the broadcast failed. Only the
+// PoW is timed for the stats of the channel with channelID.
+func (s *IotaService) doPowAndBroadcast(channelID string, branch giota.Trytes, trunk giota.Trytes, depth int64,
+	trytes []giota.Transaction, mwm int64, pow PowProvider, broadcastNodes []string,
+	chunks []models.DataMap) (attached bool, err error) {
+
+	//defer oysterUtils.TimeTrack(time.Now(), "doPow_using_" + pow.Name(), analytics.NewProperties().
+	//	Set("addresses", oysterUtils.MapTransactionsToAddrs(trytes)))
+
+	startTime := time.Now()
+	trytes, err = pow.AttachToTangle(trunk, branch, mwm, trytes)
+	if runErr := models.RecordChannelPowRun(channelID, startTime, len(chunks), err != nil); runErr != nil {
+		raven.CaptureError(runErr, nil)
+	}
+	if err != nil {
+		raven.CaptureError(err, nil)
+		return false, err
+	}
 
-	powJob := PowJob{
-		Chunks:         chunks,
-		BroadcastNodes: make([]string, 1),
+	if err = keepAttachedTrytes(chunks, trytes); err != nil {
+		raven.CaptureError(err, nil)
+		return false, err
 	}
 
-	Channel[channel.ChannelID].Channel <- powJob
-}
+	if err = s.broadcastWithRetry(trytes, broadcastNodes); err != nil {
+
+		// Async log
+		//go oysterUtils.SegmentClient.Enqueue(analytics.Track{
+		//	Event:  "broadcast_fail_redoing_pow",
+		//	UserId: oysterUtils.GetLocalIP(),
+		//	Properties: analytics.NewProperties().
+		//		Set("addresses", oysterUtils.MapTransactionsToAddrs(trytes)),
+		//})
 
-func SetEstimatedReadyTime(channel PowChannel, numChunks int) time.Time {
+		fmt.Println(err)
+		raven.CaptureError(err, nil)
+		return true, err
+	}
 
-	var totalTime time.Duration = 0
-	chunksCount := 0
+	fmt.Println("BROADCAST SUCCESS")
 
-	if len(*(channel.ChunkTrackers)) != 0 {
+	//go oysterUtils.SegmentClient.Enqueue(analytics.Track{
+	//	Event:  "broadcast_success",
+	//	UserId: oysterUtils.GetLocalIP(),
+	//	Properties: analytics.NewProperties().
+	//		Set("addresses", oysterUtils.MapTransactionsToAddrs(trytes)),
+	//})
 
-		for _, timeRecord := range *(channel.ChunkTrackers) {
-			totalTime += timeRecord.ElapsedTime
-			chunksCount += timeRecord.ChunkCount
-		}
+	return true, nil
+}
 
-		avgTimePerChunk := int(totalTime) / chunksCount
-		expectedDelay := int(math.Floor((float64(avgTimePerChunk * numChunks))))
+func (s *IotaService) broadcastTransactions(trytes []giota.Transaction) error {
+	return s.Nodes.Broadcast(trytes, nil)
+}
 
-		return time.Now().Add(time.Duration(expectedDelay))
-	} else {
+// sendChunksToChannel queues chunks for PoW on channel. The job is stored, so
+// it is done even if the broker restarts before the channel gets to it.
+func (s *IotaService) sendChunksToChannel(chunks []models.DataMap, channel *models.ChunkChannel) {
+
+	channel.EstReadyTime = SetEstimatedReadyTime(channel.ChannelID, len(chunks))
+	models.DB.ValidateAndSave(channel)
 
-		// The application just started, we don't have any data yet,
-		// so just set est_ready_time to 10 seconds from now
+	if _, err := models.EnqueuePowJob(channel.ChannelID, chunks, s.Nodes.BroadcastNodes()); err != nil {
+		raven.CaptureError(err, nil)
+	}
+}
 
-		/*
-			TODO:  get a more precise estimate of what this default should be
-		*/
-		return time.Now().Add(10 * time.Second)
+// SetEstimatedReadyTime returns when the channel with channelID will have
+// done the PoW for numChunks chunks, going by its rolling PoW stats.
+func SetEstimatedReadyTime(channelID string, numChunks int) time.Time {
+	stats, err := models.GetChannelPowStats(channelID)
+	if err != nil {
+		raven.CaptureError(err, nil)
 	}
+
+	return time.Now().Add(stats.TimePerChunk() * time.Duration(numChunks))
 }
 
-func verifyChunkMessagesMatchRecord(chunks []models.DataMap) (filteredChunks FilteredChunk, err error) {
-	filteredChunks, err = verifyChunksMatchRecord(chunks, false)
+func (s *IotaService) verifyChunkMessagesMatchRecord(chunks []models.DataMap) (filteredChunks FilteredChunk, err error) {
+	filteredChunks, err = s.verifyChunksMatchRecord(chunks, false)
 	return filteredChunks, err
 }
 
-func verifyChunksMatchRecord(chunks []models.DataMap, checkChunkAndBranch bool) (filteredChunks FilteredChunk, err error) {
+func (s *IotaService) verifyChunksMatchRecord(chunks []models.DataMap, checkChunkAndBranch bool) (filteredChunks FilteredChunk, err error) {
 
 	addresses := make([]giota.Address, 0, len(chunks))
 
@@ -341,7 +491,7 @@ func verifyChunksMatchRecord(chunks []models.DataMap, checkChunkAndBranch bool)
 		Addresses: addresses,
 	}
 
-	response, err := api.FindTransactions(&request)
+	response, err := s.Nodes.FindTransactions(&request)
 
 	if err != nil {
 		raven.CaptureError(err, nil)
@@ -351,7 +501,7 @@ func verifyChunksMatchRecord(chunks []models.DataMap, checkChunkAndBranch bool)
 	filteredChunks = FilteredChunk{}
 
 	if response != nil && len(response.Hashes) > 0 {
-		trytesArray, err := api.GetTrytes(response.Hashes)
+		trytesArray, err := s.Nodes.GetTrytes(response.Hashes)
 		if err != nil {
 			raven.CaptureError(err, nil)
 			return filteredChunks, err
@@ -4,99 +4,161 @@ import (
 	"fmt"
 	"github.com/oysterprotocol/brokernode/models"
 	"github.com/oysterprotocol/brokernode/services"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
 	"time"
 )
 
-func Test_Init(t *testing.T) {
+// startTestIotaService starts a service with 2 PoW channels. Nothing is sent
+// to the IRI node unless chunks are sent to a channel.
+func startTestIotaService(t *testing.T) *services.IotaService {
+	config := services.DefaultIotaConfig()
+	config.NodeURLs = []string{"http://localhost:14265"}
+	config.PowProcs = 2
 
-	//it should have determined the number of PoW processes
-	if services.PowProcs == 0 {
-		t.Fatalf("init should have determined the PowProcs")
+	iotaService, err := services.NewIotaService(config)
+	if err != nil {
+		t.Fatal(err)
 	}
-
-	if len(services.Channel) != services.PowProcs {
-		t.Fatalf("init should have made 1 channel for each PowProc")
+	if err := iotaService.Start(); err != nil {
+		t.Fatal(err)
 	}
+	return iotaService
+}
 
-	channels := []models.ChunkChannel{}
+func Test_NewIotaService_NoNodes(t *testing.T) {
+	if _, err := services.NewIotaService(services.DefaultIotaConfig()); err != services.ErrNoIotaNodes {
+		t.Fatalf("NewIotaService: should refuse a config without IRI nodes, got %v", err)
+	}
+}
 
-	models.DB.RawQuery("Select * from chunk_channels").All(&channels)
+func Test_IotaConfigFromEnv(t *testing.T) {
+	os.Setenv("IOTA_NODES", "http://node1:14265, http://node2:14265")
+	os.Setenv("IOTA_MWM", "14")
+	defer os.Unsetenv("IOTA_NODES")
+	defer os.Unsetenv("IOTA_MWM")
 
-	for _, channel := range channels {
-		if _, ok := services.Channel[channel.ChannelID]; !ok {
-			t.Fatalf("after init, for every channel in chunk_channels there should be a corresponding "+
-				"channel in services.Channel with the same ChannelID, but ChannelID %s is missing from "+
-				"services.Channel or there is an extra channel in the DB.", channel.ChannelID)
-		}
+	config, err := services.IotaConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.NodeURLs) != 2 || config.NodeURLs[1] != "http://node2:14265" {
+		t.Fatalf("IotaConfigFromEnv: expected the 2 nodes of IOTA_NODES, got %v", config.NodeURLs)
+	}
+	if config.MinWeightMag != 14 {
+		t.Fatalf("IotaConfigFromEnv: expected the MWM of IOTA_MWM, got %d", config.MinWeightMag)
 	}
 }
 
-func Test_SetEstimatedReadyTime(t *testing.T) {
+func Test_IotaServiceStartAndStop(t *testing.T) {
+	iotaService := startTestIotaService(t)
 
-	chunkTracker := []services.ChunkTracker{
-		{ElapsedTime: 1 * time.Minute, ChunkCount: 6},
-		{ElapsedTime: 1 * time.Minute, ChunkCount: 5},
+	if len(iotaService.Channel) != 2 {
+		t.Fatalf("Start should have made 1 channel for each PowProc")
 	}
-	//this will yield an average time of 11 seconds per chunk
 
 	channels := []models.ChunkChannel{}
-	models.DB.RawQuery("Select * from chunk_channels").All(&channels)
-
-	*(services.Channel[channels[0].ChannelID].ChunkTrackers) = chunkTracker
 
-	currentTime := time.Now()
+	models.DB.RawQuery("Select * from chunk_channels").All(&channels)
 
-	channels[0].EstReadyTime = services.SetEstimatedReadyTime(
-		services.Channel[channels[0].ChannelID],
-		3)
+	for _, channel := range channels {
+		if _, ok := iotaService.Channel[channel.ChannelID]; !ok {
+			t.Fatalf("after Start, for every channel in chunk_channels there should be a corresponding "+
+				"channel in Channel with the same ChannelID, but ChannelID %s is missing from "+
+				"Channel or there is an extra channel in the DB.", channel.ChannelID)
+		}
+	}
 
-	models.DB.ValidateAndSave(&channels[0])
+	iotaService.Stop()
+	if len(iotaService.Channel) != 0 {
+		t.Fatalf("Stop should have closed every channel")
+	}
 
-	channel := models.ChunkChannel{}
+	// The app and the jobs may both stop it.
+	iotaService.Stop()
+}
 
-	_ = models.DB.Where("channel_id = ?", channels[0].ChannelID).First(&channel)
+func Test_IotaServiceRestartKeepsChannels(t *testing.T) {
+	iotaService := startTestIotaService(t)
+	channelIDs := map[string]bool{}
+	for channelID := range iotaService.Channel {
+		channelIDs[channelID] = true
+	}
+	iotaService.Stop()
 
-	result := channel.EstReadyTime.Sub(currentTime)
+	iotaService = startTestIotaService(t)
+	defer iotaService.Stop()
 
-	// With an average time of 11 seconds per chunk and 3 chunks passed in, we should expect
-	// EstReadyTime to be set about 33 seconds in the future
-	if result > time.Duration(35*time.Second) || result < time.Duration(31*time.Second) {
-		fmt.Println(result)
-		t.Fatalf("SetEstimatedReadyTime:  the average time per chunk was 11 seconds, so " +
-			"for 3 chunks our EstReadyTime should have been roughly 33 seconds from now")
+	for channelID := range iotaService.Channel {
+		if !channelIDs[channelID] {
+			t.Fatalf("Start should have kept the channels, so PoW jobs queued on them are still done, "+
+				"but channel %s is new", channelID)
+		}
 	}
 }
 
-func Test_TrackProcessingTime(t *testing.T) {
-
-	startTime := time.Now().Add(-1 * time.Minute)
-
-	channels := []models.ChunkChannel{}
-
-	models.DB.RawQuery("Select * from chunk_channels").All(&channels)
+func Test_DoPowJob_NoHealthyNodes(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
 
-	powChannel := services.Channel[channels[0].ChannelID]
-
-	initialLastChunkRecord := ((*(powChannel.ChunkTrackers))[len(*powChannel.ChunkTrackers)-1])
+	config := services.DefaultIotaConfig()
+	config.NodeURLs = []string{down.URL}
+	iotaService, err := services.NewIotaService(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iotaService.Nodes.CheckHealth()
 
-	services.TrackProcessingTime(startTime, 10, &powChannel)
+	channelID := "NOHEALTHYNODES"
+	models.DB.RawQuery("DELETE from pow_jobs").All(&[]models.PowJob{})
+	if _, err := models.EnqueuePowJob(channelID, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	job, err := models.ClaimPowJob("testWorker", channelID)
+	if err != nil || job == nil {
+		t.Fatalf("ClaimPowJob: expected the job, got %v", err)
+	}
 
-	newLastChunkRecord := ((*(powChannel.ChunkTrackers))[len(*powChannel.ChunkTrackers)-1])
+	// The worker is told, so it waits before claiming the job again.
+	if err := iotaService.DoPowJob(job, channelID); err != services.ErrNoHealthyIotaNodes {
+		t.Fatalf("DoPowJob: expected ErrNoHealthyIotaNodes, got %v", err)
+	}
 
-	// check that we have added a new record
-	if newLastChunkRecord == initialLastChunkRecord {
-		t.Fatalf("TrackProcessingTime:  should have added a new chunk record to the end of " +
-			"ChunkTrackers")
+	// Not a PoW run of the channel.
+	stats, err := models.GetChannelPowStats(channelID)
+	if err != nil || stats.Runs != 0 {
+		t.Fatalf("DoPowJob: IRI being down should not count as a PoW run, got %d runs, %v", stats.Runs, err)
 	}
+}
 
-	// call the method more than 10 times
-	for i := 0; i < 15; i++ {
-		services.TrackProcessingTime(startTime, 10, &powChannel)
+func Test_SetEstimatedReadyTime(t *testing.T) {
+	channelID := "ESTIMATECHANNEL"
+	models.DB.RawQuery("DELETE from pow_runs WHERE channel_id = ?", channelID).All(&[]models.PowRun{})
+
+	// Before any run the default time per chunk is used.
+	readyTime := services.SetEstimatedReadyTime(channelID, 3)
+	expected := time.Now().Add(3 * models.DefaultTimePerChunk)
+	if readyTime.Sub(expected) > time.Second || expected.Sub(readyTime) > time.Second {
+		t.Fatalf("SetEstimatedReadyTime: without runs, 3 chunks should take 3 times the default time per chunk")
 	}
 
-	// check that there are only 10 records
-	if len(*powChannel.ChunkTrackers) != 10 {
-		t.Fatalf("TrackProcessingTime:  only supposed to hold the last 10 records")
+	// 11 chunks in 2 minutes is 11 seconds per chunk. The failed run is
+	// redone, which makes it 22 seconds per chunk.
+	models.RecordChannelPowRun(channelID, time.Now().Add(-1*time.Minute), 6, false)
+	models.RecordChannelPowRun(channelID, time.Now().Add(-1*time.Minute), 5, false)
+	models.RecordChannelPowRun(channelID, time.Now().Add(-1*time.Minute), 6, true)
+	models.RecordChannelPowRun(channelID, time.Now().Add(-1*time.Minute), 5, true)
+
+	currentTime := time.Now()
+	result := services.SetEstimatedReadyTime(channelID, 3).Sub(currentTime)
+
+	// With 22 seconds per chunk and 3 chunks passed in, we should expect
+	// the channel to be ready about 66 seconds in the future
+	if result > time.Duration(68*time.Second) || result < time.Duration(64*time.Second) {
+		fmt.Println(result)
+		t.Fatalf("SetEstimatedReadyTime:  the time per chunk was 22 seconds, so " +
+			"for 3 chunks the channel should be ready roughly 66 seconds from now")
 	}
 }
@@ -0,0 +1,603 @@
+// Code generated - DO NOT EDIT.
+// This file is a generated binding and any manual changes will be lost.
+
+package services
+
+import (
+	"math/big"
+	"strings"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// OysterPearlABI is the input ABI used to generate the binding from.
+const OysterPearlABI = "[{\"constant\":true,\"inputs\":[{\"name\":\"_owner\",\"type\":\"address\"}],\"name\":\"balanceOf\",\"outputs\":[{\"name\":\"balance\",\"type\":\"uint256\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"},{\"constant\":false,\"inputs\":[{\"name\":\"_to\",\"type\":\"address\"},{\"name\":\"_value\",\"type\":\"uint256\"}],\"name\":\"transfer\",\"outputs\":[],\"payable\":false,\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"constant\":true,\"inputs\":[{\"name\":\"\",\"type\":\"address\"}],\"name\":\"buried\",\"outputs\":[{\"name\":\"\",\"type\":\"bool\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"},{\"constant\":true,\"inputs\":[],\"name\":\"claimAmount\",\"outputs\":[{\"name\":\"\",\"type\":\"uint256\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"},{\"constant\":false,\"inputs\":[],\"name\":\"bury\",\"outputs\":[{\"name\":\"success\",\"type\":\"bool\"}],\"payable\":false,\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"constant\":false,\"inputs\":[{\"name\":\"_payout\",\"type\":\"address\"},{\"name\":\"_fee\",\"type\":\"address\"}],\"name\":\"claim\",\"outputs\":[{\"name\":\"success\",\"type\":\"bool\"}],\"payable\":false,\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"constant\":true,\"inputs\":[],\"name\":\"storagePeg\",\"outputs\":[{\"name\":\"\",\"type\":\"uint256\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"},{\"anonymous\":false,\"inputs\":[{\"indexed\":true,\"name\":\"_from\",\"type\":\"address\"},{\"indexed\":true,\"name\":\"_to\",\"type\":\"address\"},{\"indexed\":false,\"name\":\"_value\",\"type\":\"uint256\"}],\"name\":\"Transfer\",\"type\":\"event\"},{\"anonymous\":false,\"inputs\":[{\"indexed\":true,\"name\":\"_target\",\"type\":\"address\"},{\"indexed\":false,\"name\":\"_value\",\"type\":\"uint256\"}],\"name\":\"Bury\",\"type\":\"event\"}]"
+
+// OysterPearl is an auto generated Go binding around an Ethereum contract.
+type OysterPearl struct {
+	OysterPearlCaller     // Read-only binding to the contract
+	OysterPearlTransactor // Write-only binding to the contract
+	OysterPearlFilterer   // Log filterer for contract events
+}
+
+// OysterPearlCaller is an auto generated read-only Go binding around an Ethereum contract.
+type OysterPearlCaller struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// OysterPearlTransactor is an auto generated write-only Go binding around an Ethereum contract.
+type OysterPearlTransactor struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// OysterPearlFilterer is an auto generated log filtering Go binding around an Ethereum contract events.
+type OysterPearlFilterer struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// OysterPearlSession is an auto generated Go binding around an Ethereum contract,
+// with pre-set call and transact options.
+type OysterPearlSession struct {
+	Contract     *OysterPearl      // Generic contract binding to set the session for
+	CallOpts     bind.CallOpts     // Call options to use throughout this session
+	TransactOpts bind.TransactOpts // Transaction auth options to use throughout this session
+}
+
+// OysterPearlCallerSession is an auto generated read-only Go binding around an Ethereum contract,
+// with pre-set call options.
+type OysterPearlCallerSession struct {
+	Contract *OysterPearlCaller // Generic contract caller binding to set the session for
+	CallOpts bind.CallOpts      // Call options to use throughout this session
+}
+
+// OysterPearlTransactorSession is an auto generated write-only Go binding around an Ethereum contract,
+// with pre-set transact options.
+type OysterPearlTransactorSession struct {
+	Contract     *OysterPearlTransactor // Generic contract transactor binding to set the session for
+	TransactOpts bind.TransactOpts      // Transaction auth options to use throughout this session
+}
+
+// OysterPearlRaw is an auto generated low-level Go binding around an Ethereum contract.
+type OysterPearlRaw struct {
+	Contract *OysterPearl // Generic contract binding to access the raw methods on
+}
+
+// OysterPearlCallerRaw is an auto generated low-level read-only Go binding around an Ethereum contract.
+type OysterPearlCallerRaw struct {
+	Contract *OysterPearlCaller // Generic read-only contract binding to access the raw methods on
+}
+
+// OysterPearlTransactorRaw is an auto generated low-level write-only Go binding around an Ethereum contract.
+type OysterPearlTransactorRaw struct {
+	Contract *OysterPearlTransactor // Generic write-only contract binding to access the raw methods on
+}
+
+// NewOysterPearl creates a new instance of OysterPearl, bound to a specific deployed contract.
+func NewOysterPearl(address common.Address, backend bind.ContractBackend) (*OysterPearl, error) {
+	contract, err := bindOysterPearl(address, backend, backend, backend)
+	if err != nil {
+		return nil, err
+	}
+	return &OysterPearl{OysterPearlCaller: OysterPearlCaller{contract: contract}, OysterPearlTransactor: OysterPearlTransactor{contract: contract}, OysterPearlFilterer: OysterPearlFilterer{contract: contract}}, nil
+}
+
+// NewOysterPearlCaller creates a new read-only instance of OysterPearl, bound to a specific deployed contract.
+func NewOysterPearlCaller(address common.Address, caller bind.ContractCaller) (*OysterPearlCaller, error) {
+	contract, err := bindOysterPearl(address, caller, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &OysterPearlCaller{contract: contract}, nil
+}
+
+// NewOysterPearlTransactor creates a new write-only instance of OysterPearl, bound to a specific deployed contract.
+func NewOysterPearlTransactor(address common.Address, transactor bind.ContractTransactor) (*OysterPearlTransactor, error) {
+	contract, err := bindOysterPearl(address, nil, transactor, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &OysterPearlTransactor{contract: contract}, nil
+}
+
+// NewOysterPearlFilterer creates a new log filterer instance of OysterPearl, bound to a specific deployed contract.
+func NewOysterPearlFilterer(address common.Address, filterer bind.ContractFilterer) (*OysterPearlFilterer, error) {
+	contract, err := bindOysterPearl(address, nil, nil, filterer)
+	if err != nil {
+		return nil, err
+	}
+	return &OysterPearlFilterer{contract: contract}, nil
+}
+
+// bindOysterPearl binds a generic wrapper to an already deployed contract.
+func bindOysterPearl(address common.Address, caller bind.ContractCaller, transactor bind.ContractTransactor, filterer bind.ContractFilterer) (*bind.BoundContract, error) {
+	parsed, err := abi.JSON(strings.NewReader(OysterPearlABI))
+	if err != nil {
+		return nil, err
+	}
+	return bind.NewBoundContract(address, parsed, caller, transactor, filterer), nil
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_OysterPearl *OysterPearlRaw) Call(opts *bind.CallOpts, result interface{}, method string, params ...interface{}) error {
+	return _OysterPearl.Contract.OysterPearlCaller.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_OysterPearl *OysterPearlRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _OysterPearl.Contract.OysterPearlTransactor.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_OysterPearl *OysterPearlRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _OysterPearl.Contract.OysterPearlTransactor.contract.Transact(opts, method, params...)
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_OysterPearl *OysterPearlCallerRaw) Call(opts *bind.CallOpts, result interface{}, method string, params ...interface{}) error {
+	return _OysterPearl.Contract.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_OysterPearl *OysterPearlTransactorRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _OysterPearl.Contract.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_OysterPearl *OysterPearlTransactorRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _OysterPearl.Contract.contract.Transact(opts, method, params...)
+}
+
+// BalanceOf is a free data retrieval call binding the contract method 0x70a08231.
+//
+// Solidity: function balanceOf(_owner address) constant returns(balance uint256)
+func (_OysterPearl *OysterPearlCaller) BalanceOf(opts *bind.CallOpts, _owner common.Address) (*big.Int, error) {
+	var (
+		ret0 = new(*big.Int)
+	)
+	out := ret0
+	err := _OysterPearl.contract.Call(opts, out, "balanceOf", _owner)
+	return *ret0, err
+}
+
+// BalanceOf is a free data retrieval call binding the contract method 0x70a08231.
+//
+// Solidity: function balanceOf(_owner address) constant returns(balance uint256)
+func (_OysterPearl *OysterPearlSession) BalanceOf(_owner common.Address) (*big.Int, error) {
+	return _OysterPearl.Contract.BalanceOf(&_OysterPearl.CallOpts, _owner)
+}
+
+// BalanceOf is a free data retrieval call binding the contract method 0x70a08231.
+//
+// Solidity: function balanceOf(_owner address) constant returns(balance uint256)
+func (_OysterPearl *OysterPearlCallerSession) BalanceOf(_owner common.Address) (*big.Int, error) {
+	return _OysterPearl.Contract.BalanceOf(&_OysterPearl.CallOpts, _owner)
+}
+
+// Buried is a free data retrieval call binding the contract method 0x3f1199e6.
+//
+// Solidity: function buried( address) constant returns(bool)
+func (_OysterPearl *OysterPearlCaller) Buried(opts *bind.CallOpts, arg0 common.Address) (bool, error) {
+	var (
+		ret0 = new(bool)
+	)
+	out := ret0
+	err := _OysterPearl.contract.Call(opts, out, "buried", arg0)
+	return *ret0, err
+}
+
+// Buried is a free data retrieval call binding the contract method 0x3f1199e6.
+//
+// Solidity: function buried( address) constant returns(bool)
+func (_OysterPearl *OysterPearlSession) Buried(arg0 common.Address) (bool, error) {
+	return _OysterPearl.Contract.Buried(&_OysterPearl.CallOpts, arg0)
+}
+
+// Buried is a free data retrieval call binding the contract method 0x3f1199e6.
+//
+// Solidity: function buried( address) constant returns(bool)
+func (_OysterPearl *OysterPearlCallerSession) Buried(arg0 common.Address) (bool, error) {
+	return _OysterPearl.Contract.Buried(&_OysterPearl.CallOpts, arg0)
+}
+
+// ClaimAmount is a free data retrieval call binding the contract method 0x830953ab.
+//
+// Solidity: function claimAmount() constant returns(uint256)
+func (_OysterPearl *OysterPearlCaller) ClaimAmount(opts *bind.CallOpts) (*big.Int, error) {
+	var (
+		ret0 = new(*big.Int)
+	)
+	out := ret0
+	err := _OysterPearl.contract.Call(opts, out, "claimAmount")
+	return *ret0, err
+}
+
+// ClaimAmount is a free data retrieval call binding the contract method 0x830953ab.
+//
+// Solidity: function claimAmount() constant returns(uint256)
+func (_OysterPearl *OysterPearlSession) ClaimAmount() (*big.Int, error) {
+	return _OysterPearl.Contract.ClaimAmount(&_OysterPearl.CallOpts)
+}
+
+// ClaimAmount is a free data retrieval call binding the contract method 0x830953ab.
+//
+// Solidity: function claimAmount() constant returns(uint256)
+func (_OysterPearl *OysterPearlCallerSession) ClaimAmount() (*big.Int, error) {
+	return _OysterPearl.Contract.ClaimAmount(&_OysterPearl.CallOpts)
+}
+
+// StoragePeg is a free data retrieval call binding the contract method 0x1652c573.
+//
+// Solidity: function storagePeg() constant returns(uint256)
+func (_OysterPearl *OysterPearlCaller) StoragePeg(opts *bind.CallOpts) (*big.Int, error) {
+	var (
+		ret0 = new(*big.Int)
+	)
+	out := ret0
+	err := _OysterPearl.contract.Call(opts, out, "storagePeg")
+	return *ret0, err
+}
+
+// StoragePeg is a free data retrieval call binding the contract method 0x1652c573.
+//
+// Solidity: function storagePeg() constant returns(uint256)
+func (_OysterPearl *OysterPearlSession) StoragePeg() (*big.Int, error) {
+	return _OysterPearl.Contract.StoragePeg(&_OysterPearl.CallOpts)
+}
+
+// StoragePeg is a free data retrieval call binding the contract method 0x1652c573.
+//
+// Solidity: function storagePeg() constant returns(uint256)
+func (_OysterPearl *OysterPearlCallerSession) StoragePeg() (*big.Int, error) {
+	return _OysterPearl.Contract.StoragePeg(&_OysterPearl.CallOpts)
+}
+
+// Bury is a paid mutator transaction binding the contract method 0x61161aae.
+//
+// Solidity: function bury() returns(success bool)
+func (_OysterPearl *OysterPearlTransactor) Bury(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _OysterPearl.contract.Transact(opts, "bury")
+}
+
+// Bury is a paid mutator transaction binding the contract method 0x61161aae.
+//
+// Solidity: function bury() returns(success bool)
+func (_OysterPearl *OysterPearlSession) Bury() (*types.Transaction, error) {
+	return _OysterPearl.Contract.Bury(&_OysterPearl.TransactOpts)
+}
+
+// Bury is a paid mutator transaction binding the contract method 0x61161aae.
+//
+// Solidity: function bury() returns(success bool)
+func (_OysterPearl *OysterPearlTransactorSession) Bury() (*types.Transaction, error) {
+	return _OysterPearl.Contract.Bury(&_OysterPearl.TransactOpts)
+}
+
+// Claim is a paid mutator transaction binding the contract method 0x21c0b342.
+//
+// Solidity: function claim(_payout address, _fee address) returns(success bool)
+func (_OysterPearl *OysterPearlTransactor) Claim(opts *bind.TransactOpts, _payout common.Address, _fee common.Address) (*types.Transaction, error) {
+	return _OysterPearl.contract.Transact(opts, "claim", _payout, _fee)
+}
+
+// Claim is a paid mutator transaction binding the contract method 0x21c0b342.
+//
+// Solidity: function claim(_payout address, _fee address) returns(success bool)
+func (_OysterPearl *OysterPearlSession) Claim(_payout common.Address, _fee common.Address) (*types.Transaction, error) {
+	return _OysterPearl.Contract.Claim(&_OysterPearl.TransactOpts, _payout, _fee)
+}
+
+// Claim is a paid mutator transaction binding the contract method 0x21c0b342.
+//
+// Solidity: function claim(_payout address, _fee address) returns(success bool)
+func (_OysterPearl *OysterPearlTransactorSession) Claim(_payout common.Address, _fee common.Address) (*types.Transaction, error) {
+	return _OysterPearl.Contract.Claim(&_OysterPearl.TransactOpts, _payout, _fee)
+}
+
+// Transfer is a paid mutator transaction binding the contract method 0xa9059cbb.
+//
+// Solidity: function transfer(_to address, _value uint256) returns()
+func (_OysterPearl *OysterPearlTransactor) Transfer(opts *bind.TransactOpts, _to common.Address, _value *big.Int) (*types.Transaction, error) {
+	return _OysterPearl.contract.Transact(opts, "transfer", _to, _value)
+}
+
+// Transfer is a paid mutator transaction binding the contract method 0xa9059cbb.
+//
+// Solidity: function transfer(_to address, _value uint256) returns()
+func (_OysterPearl *OysterPearlSession) Transfer(_to common.Address, _value *big.Int) (*types.Transaction, error) {
+	return _OysterPearl.Contract.Transfer(&_OysterPearl.TransactOpts, _to, _value)
+}
+
+// Transfer is a paid mutator transaction binding the contract method 0xa9059cbb.
+//
+// Solidity: function transfer(_to address, _value uint256) returns()
+func (_OysterPearl *OysterPearlTransactorSession) Transfer(_to common.Address, _value *big.Int) (*types.Transaction, error) {
+	return _OysterPearl.Contract.Transfer(&_OysterPearl.TransactOpts, _to, _value)
+}
+
+// OysterPearlBuryIterator is returned from FilterBury and is used to iterate over the raw logs and unpacked data for Bury events raised by the OysterPearl contract.
+type OysterPearlBuryIterator struct {
+	Event *OysterPearlBury // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *OysterPearlBuryIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(OysterPearlBury)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(OysterPearlBury)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *OysterPearlBuryIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *OysterPearlBuryIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// OysterPearlBury represents a Bury event raised by the OysterPearl contract.
+type OysterPearlBury struct {
+	Target common.Address
+	Value  *big.Int
+	Raw    types.Log // Blockchain specific contextual infos
+}
+
+// FilterBury is a free log retrieval operation binding the contract event 0xc96e8fee6eb65975d592ca9a340f33200433df4c42b2f623dd9fc6d22984d495.
+//
+// Solidity: e Bury(_target indexed address, _value uint256)
+func (_OysterPearl *OysterPearlFilterer) FilterBury(opts *bind.FilterOpts, _target []common.Address) (*OysterPearlBuryIterator, error) {
+
+	var _targetRule []interface{}
+	for _, _targetItem := range _target {
+		_targetRule = append(_targetRule, _targetItem)
+	}
+
+	logs, sub, err := _OysterPearl.contract.FilterLogs(opts, "Bury", _targetRule)
+	if err != nil {
+		return nil, err
+	}
+	return &OysterPearlBuryIterator{contract: _OysterPearl.contract, event: "Bury", logs: logs, sub: sub}, nil
+}
+
+// WatchBury is a free log subscription operation binding the contract event 0xc96e8fee6eb65975d592ca9a340f33200433df4c42b2f623dd9fc6d22984d495.
+//
+// Solidity: e Bury(_target indexed address, _value uint256)
+func (_OysterPearl *OysterPearlFilterer) WatchBury(opts *bind.WatchOpts, sink chan<- *OysterPearlBury, _target []common.Address) (event.Subscription, error) {
+
+	var _targetRule []interface{}
+	for _, _targetItem := range _target {
+		_targetRule = append(_targetRule, _targetItem)
+	}
+
+	logs, sub, err := _OysterPearl.contract.WatchLogs(opts, "Bury", _targetRule)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(OysterPearlBury)
+				if err := _OysterPearl.contract.UnpackLog(event, "Bury", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// OysterPearlTransferIterator is returned from FilterTransfer and is used to iterate over the raw logs and unpacked data for Transfer events raised by the OysterPearl contract.
+type OysterPearlTransferIterator struct {
+	Event *OysterPearlTransfer // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *OysterPearlTransferIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(OysterPearlTransfer)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(OysterPearlTransfer)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *OysterPearlTransferIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *OysterPearlTransferIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// OysterPearlTransfer represents a Transfer event raised by the OysterPearl contract.
+type OysterPearlTransfer struct {
+	From  common.Address
+	To    common.Address
+	Value *big.Int
+	Raw   types.Log // Blockchain specific contextual infos
+}
+
+// FilterTransfer is a free log retrieval operation binding the contract event 0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef.
+//
+// Solidity: e Transfer(_from indexed address, _to indexed address, _value uint256)
+func (_OysterPearl *OysterPearlFilterer) FilterTransfer(opts *bind.FilterOpts, _from []common.Address, _to []common.Address) (*OysterPearlTransferIterator, error) {
+
+	var _fromRule []interface{}
+	for _, _fromItem := range _from {
+		_fromRule = append(_fromRule, _fromItem)
+	}
+	var _toRule []interface{}
+	for _, _toItem := range _to {
+		_toRule = append(_toRule, _toItem)
+	}
+
+	logs, sub, err := _OysterPearl.contract.FilterLogs(opts, "Transfer", _fromRule, _toRule)
+	if err != nil {
+		return nil, err
+	}
+	return &OysterPearlTransferIterator{contract: _OysterPearl.contract, event: "Transfer", logs: logs, sub: sub}, nil
+}
+
+// WatchTransfer is a free log subscription operation binding the contract event 0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef.
+//
+// Solidity: e Transfer(_from indexed address, _to indexed address, _value uint256)
+func (_OysterPearl *OysterPearlFilterer) WatchTransfer(opts *bind.WatchOpts, sink chan<- *OysterPearlTransfer, _from []common.Address, _to []common.Address) (event.Subscription, error) {
+
+	var _fromRule []interface{}
+	for _, _fromItem := range _from {
+		_fromRule = append(_fromRule, _fromItem)
+	}
+	var _toRule []interface{}
+	for _, _toItem := range _to {
+		_toRule = append(_toRule, _toItem)
+	}
+
+	logs, sub, err := _OysterPearl.contract.WatchLogs(opts, "Transfer", _fromRule, _toRule)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(OysterPearlTransfer)
+				if err := _OysterPearl.contract.UnpackLog(event, "Transfer", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	raven "github.com/getsentry/raven-go"
+	"github.com/iotaledger/giota"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/pkg/errors"
+)
+
+/*
+A PowProvider does the proof of work for a bundle and returns it attached to
+the given trunk and branch. The provider is picked by POW_PROVIDER:
+
+	local   - PoW on this machine's CPU with giota's best PoW function, one
+	          transaction at a time however many channels there are
+	remote  - attachToTangle on the IRI nodes
+	pool    - attachToTangle on the PoW servers listed in POW_SERVERS
+
+Every provider records its PoW runs, which its rolling stats are worked out
+from. See models.PowRun.
+*/
+
+const (
+	PowProviderLocal  = "local"
+	PowProviderRemote = "remote"
+	PowProviderPool   = "pool"
+)
+
+type PowProvider interface {
+	Name() string
+	AttachToTangle(trunk giota.Trytes, branch giota.Trytes, mwm int64,
+		trytes []giota.Transaction) ([]giota.Transaction, error)
+}
+
+var ErrNoPowServers = errors.New("no PoW servers are configured")
+
+// giota's PoW functions signal their workers to stop through package level
+// flags, which every call resets, so two searches at once can stop or hang
+// each other. The local PoW of every channel takes turns; the remote and
+// pool providers are the ones to use for channels doing PoW side by side.
+var localPowMtx sync.Mutex
+
+// NewPowProvider returns the provider called name. servers are only used by
+// the pool provider.
+func NewPowProvider(name string, iri *IotaNodePool, servers []string) (PowProvider, error) {
+	switch name {
+	case "", PowProviderLocal:
+		powName, powFunc := giota.GetBestPoW()
+		return &localPowProvider{powName: powName, powFunc: powFunc}, nil
+	case PowProviderRemote:
+		return &remotePowProvider{name: PowProviderRemote, nodes: iri}, nil
+	case PowProviderPool:
+		return newPoolPowProvider(servers)
+	default:
+		return nil, errors.Errorf("unknown PoW provider %q", name)
+	}
+}
+
+// trackPowTime records that a provider did the PoW for numChunks chunks
+// since startTime, or failed to.
+func trackPowTime(provider string, startTime time.Time, numChunks int, failed bool) {
+	if err := models.RecordProviderPowRun(provider, startTime, numChunks, failed); err != nil {
+		raven.CaptureError(err, nil)
+	}
+}
+
+// PowThroughput returns how many chunks per second provider did the PoW for
+// over its last runs, 0 when it has not run yet.
+func PowThroughput(provider string) float64 {
+	stats, err := models.GetProviderPowStats(provider)
+	if err != nil {
+		raven.CaptureError(err, nil)
+	}
+	return stats.ChunksPerSecond
+}
+
+// localPowProvider does the PoW on this machine, one transaction at a time
+// across every channel.
+type localPowProvider struct {
+	powName string
+	powFunc giota.PowFunc
+}
+
+func (p *localPowProvider) Name() string {
+	return PowProviderLocal
+}
+
+func (p *localPowProvider) AttachToTangle(trunk giota.Trytes, branch giota.Trytes, mwm int64,
+	trytes []giota.Transaction) ([]giota.Transaction, error) {
+
+	startTime := time.Now()
+	var prev giota.Trytes
+	var err error
+
+	for i := len(trytes) - 1; i >= 0; i-- {
+		switch {
+		case i == len(trytes)-1:
+			trytes[i].TrunkTransaction = trunk
+			trytes[i].BranchTransaction = branch
+		default:
+			trytes[i].TrunkTransaction = prev
+			trytes[i].BranchTransaction = trunk
+		}
+
+		timestamp := giota.Int2Trits(time.Now().UnixNano()/1000000, giota.TimestampTrinarySize).Trytes()
+		trytes[i].AttachmentTimestamp = timestamp
+		trytes[i].AttachmentTimestampLowerBound = ""
+		trytes[i].AttachmentTimestampUpperBound = maxTimestampTrytes
+
+		localPowMtx.Lock()
+		trytes[i].Nonce, err = p.powFunc(trytes[i].Trytes(), int(mwm))
+		localPowMtx.Unlock()
+
+		if err != nil {
+			trackPowTime(p.Name(), startTime, len(trytes), true)
+			return nil, errors.Wrap(err, "PoW using "+p.powName+" failed")
+		}
+
+		prev = trytes[i].Hash()
+	}
+
+	trackPowTime(p.Name(), startTime, len(trytes), false)
+	return trytes, nil
+}
+
+// remotePowProvider has an IRI node, or a PoW server with the same API, do
+// the PoW with attachToTangle.
+type remotePowProvider struct {
+	name  string
+	nodes *IotaNodePool
+}
+
+func (p *remotePowProvider) Name() string {
+	return p.name
+}
+
+func (p *remotePowProvider) AttachToTangle(trunk giota.Trytes, branch giota.Trytes, mwm int64,
+	trytes []giota.Transaction) ([]giota.Transaction, error) {
+
+	api, err := p.nodes.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+	res, err := api.AttachToTangle(&giota.AttachToTangleRequest{
+		TrunkTransaction:   trunk,
+		BranchTransaction:  branch,
+		MinWeightMagnitude: mwm,
+		Trytes:             trytes,
+	})
+	if err == nil && len(res.Trytes) != len(trytes) {
+		err = errors.Errorf("%s attachToTangle returned %d transactions, expected %d",
+			p.name, len(res.Trytes), len(trytes))
+	}
+	if err != nil {
+		trackPowTime(p.name, startTime, len(trytes), true)
+		return nil, errors.Wrap(err, p.name+" attachToTangle failed")
+	}
+
+	trackPowTime(p.name, startTime, len(trytes), false)
+	return res.Trytes, nil
+}
+
+// poolPowProvider spreads the PoW over external PoW servers in turn, moving
+// on to the next server when one fails.
+type poolPowProvider struct {
+	servers []*remotePowProvider
+	next    int
+	mutex   sync.Mutex
+}
+
+func newPoolPowProvider(servers []string) (*poolPowProvider, error) {
+	if len(servers) == 0 {
+		return nil, ErrNoPowServers
+	}
+
+	pool := &poolPowProvider{}
+	for _, server := range servers {
+		if !strings.Contains(server, "://") {
+			server = "http://" + server
+		}
+		pool.servers = append(pool.servers, &remotePowProvider{
+			name:  fmt.Sprintf("%s %s", PowProviderPool, server),
+			nodes: NewIotaNodePool([]string{server}),
+		})
+	}
+	return pool, nil
+}
+
+func (p *poolPowProvider) Name() string {
+	return PowProviderPool
+}
+
+func (p *poolPowProvider) AttachToTangle(trunk giota.Trytes, branch giota.Trytes, mwm int64,
+	trytes []giota.Transaction) ([]giota.Transaction, error) {
+
+	p.mutex.Lock()
+	first := p.next
+	p.next = (p.next + 1) % len(p.servers)
+	p.mutex.Unlock()
+
+	startTime := time.Now()
+	var err error
+	for i := 0; i < len(p.servers); i++ {
+		server := p.servers[(first+i)%len(p.servers)]
+
+		var attached []giota.Transaction
+		attached, err = server.AttachToTangle(trunk, branch, mwm, trytes)
+		if err == nil {
+			trackPowTime(p.Name(), startTime, len(trytes), false)
+			return attached, nil
+		}
+	}
+	trackPowTime(p.Name(), startTime, len(trytes), true)
+	return nil, err
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iotaledger/giota"
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+// fakePowServer answers attachToTangle with the transactions it was sent.
+func fakePowServer(calls *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		req := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(map[string]interface{}{"trytes": req["trytes"]})
+	}))
+}
+
+func Test_NewPowProvider(t *testing.T) {
+	if _, err := NewPowProvider("gpu", nil, nil); err == nil {
+		t.Fatalf("NewPowProvider: an unknown provider should be refused")
+	}
+	if _, err := NewPowProvider(PowProviderPool, nil, nil); err != ErrNoPowServers {
+		t.Fatalf("NewPowProvider: the pool provider needs PoW servers, got %v", err)
+	}
+
+	pow, err := NewPowProvider("", nil, nil)
+	if err != nil || pow.Name() != PowProviderLocal {
+		t.Fatalf("NewPowProvider: should default to local PoW, got %v", err)
+	}
+}
+
+func Test_PoolPowProvider_FailsOver(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer down.Close()
+	calls := 0
+	up := fakePowServer(&calls)
+	defer up.Close()
+
+	pow, err := NewPowProvider(PowProviderPool, nil, []string{down.URL, up.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := giota.NewTransaction(giota.Trytes(strings.Repeat("9", 2673)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	attached, err := pow.AttachToTangle("", "", 9, []giota.Transaction{*tx})
+	if err != nil {
+		t.Fatalf("PoolPowProvider: should have moved on to the PoW server that is up, got %v", err)
+	}
+	if len(attached) != 1 || calls != 1 {
+		t.Fatalf("PoolPowProvider: expected 1 attached transaction from 1 call, got %d from %d",
+			len(attached), calls)
+	}
+	if stats, _ := models.GetProviderPowStats(PowProviderPool); stats.Runs == 0 {
+		t.Fatalf("PoolPowProvider: should have recorded its run")
+	}
+}
+
+func Test_PowThroughput(t *testing.T) {
+	models.DB.RawQuery("DELETE from pow_runs WHERE provider = ?", "test").All(&[]models.PowRun{})
+	if PowThroughput("test") != 0 {
+		t.Fatalf("PowThroughput: a provider that has not run has no throughput")
+	}
+
+	trackPowTime("test", time.Now().Add(-10*time.Second), 20, false)
+	trackPowTime("test", time.Now().Add(-10*time.Second), 20, true)
+	throughput := PowThroughput("test")
+	if throughput < 1.9 || throughput > 2.1 {
+		t.Fatalf("PowThroughput: 20 chunks in 10 seconds should be 2 chunks per second, got %f", throughput)
+	}
+}
+
+func Test_LocalPowProvider_OneAtATime(t *testing.T) {
+	var running, maxRunning int32
+	powFunc := func(trytes giota.Trytes, mwm int) (giota.Trytes, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return "", nil
+	}
+
+	tx, err := giota.NewTransaction(giota.Trytes(strings.Repeat("9", 2673)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every channel has its own provider.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pow := &localPowProvider{powName: "test", powFunc: powFunc}
+			if _, err := pow.AttachToTangle("", "", 9, []giota.Transaction{*tx, *tx}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxRunning != 1 {
+		t.Fatalf("LocalPowProvider: expected the PoW to run one at a time, %v ran at once", maxRunning)
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+/*
+SessionEvents is an in-process bus the jobs publish upload session state
+changes to, keyed by genesis hash. Publishing never blocks the jobs: a
+subscriber that falls SessionEventBufferSize events behind misses events.
+*/
+
+type SessionEventType string
+
+const (
+	EventPaymentReceived  SessionEventType = "payment_received"
+	EventTreasureBuried   SessionEventType = "treasure_buried"
+	EventChunksAttached   SessionEventType = "chunks_attached"
+	EventChunksVerified   SessionEventType = "chunks_verified"
+	EventSessionCompleted SessionEventType = "session_completed"
+)
+
+type SessionEvent struct {
+	Type          SessionEventType `json:"type"`
+	GenesisHash   string           `json:"genesisHash"`
+	NumChunks     int              `json:"numChunks,omitempty"`
+	PaymentStatus string           `json:"paymentStatus,omitempty"`
+	CreatedAt     time.Time        `json:"createdAt"`
+}
+
+type SessionEventBus struct {
+	mtx         sync.RWMutex
+	subscribers map[string]map[chan SessionEvent]bool
+}
+
+// How many events a subscriber can fall behind before it misses events.
+const SessionEventBufferSize = 64
+
+var SessionEvents = NewSessionEventBus()
+
+func NewSessionEventBus() *SessionEventBus {
+	return &SessionEventBus{
+		subscribers: map[string]map[chan SessionEvent]bool{},
+	}
+}
+
+// Subscribe returns a channel of the events published for genesisHash, and a
+// func that unsubscribes and closes it.
+func (b *SessionEventBus) Subscribe(genesisHash string) (<-chan SessionEvent, func()) {
+	events := make(chan SessionEvent, SessionEventBufferSize)
+
+	b.mtx.Lock()
+	if b.subscribers[genesisHash] == nil {
+		b.subscribers[genesisHash] = map[chan SessionEvent]bool{}
+	}
+	b.subscribers[genesisHash][events] = true
+	b.mtx.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mtx.Lock()
+			delete(b.subscribers[genesisHash], events)
+			if len(b.subscribers[genesisHash]) == 0 {
+				delete(b.subscribers, genesisHash)
+			}
+			b.mtx.Unlock()
+			close(events)
+		})
+	}
+
+	return events, unsubscribe
+}
+
+// Publish sends event to everyone subscribed to its genesis hash.
+func (b *SessionEventBus) Publish(event SessionEvent) {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	for events := range b.subscribers[event.GenesisHash] {
+		select {
+		case events <- event:
+		default:
+			// The subscriber is not keeping up.
+		}
+	}
+}
+
+// PublishChunkEvents publishes an event of eventType for every genesis hash
+// the chunks belong to, with how many of its chunks there were.
+func (b *SessionEventBus) PublishChunkEvents(eventType SessionEventType, chunks []models.DataMap) {
+	numChunks := map[string]int{}
+	for _, chunk := range chunks {
+		numChunks[chunk.GenesisHash]++
+	}
+
+	for genesisHash, count := range numChunks {
+		b.Publish(SessionEvent{
+			Type:        eventType,
+			GenesisHash: genesisHash,
+			NumChunks:   count,
+		})
+	}
+}
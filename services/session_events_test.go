@@ -0,0 +1,67 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+func Test_SessionEventBus_PublishToSubscribers(t *testing.T) {
+	bus := NewSessionEventBus()
+	events, unsubscribe := bus.Subscribe("genHash1")
+	defer unsubscribe()
+	otherEvents, unsubscribeOther := bus.Subscribe("genHash2")
+	defer unsubscribeOther()
+
+	bus.Publish(SessionEvent{Type: EventTreasureBuried, GenesisHash: "genHash1"})
+
+	event := <-events
+	if event.Type != EventTreasureBuried || event.CreatedAt.IsZero() {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if len(otherEvents) != 0 {
+		t.Fatal("event should only go to subscribers of its genesis hash")
+	}
+}
+
+func Test_SessionEventBus_Unsubscribe(t *testing.T) {
+	bus := NewSessionEventBus()
+	events, unsubscribe := bus.Subscribe("genHash1")
+	unsubscribe()
+	unsubscribe() // Safe to call twice
+
+	bus.Publish(SessionEvent{Type: EventTreasureBuried, GenesisHash: "genHash1"})
+	if _, open := <-events; open {
+		t.Fatal("events should be closed once unsubscribed")
+	}
+}
+
+func Test_SessionEventBus_PublishDoesNotBlock(t *testing.T) {
+	bus := NewSessionEventBus()
+	events, unsubscribe := bus.Subscribe("genHash1")
+	defer unsubscribe()
+
+	for i := 0; i < SessionEventBufferSize+10; i++ {
+		bus.Publish(SessionEvent{Type: EventChunksVerified, GenesisHash: "genHash1"})
+	}
+	if len(events) != SessionEventBufferSize {
+		t.Fatalf("expected %v buffered events but got %v", SessionEventBufferSize, len(events))
+	}
+}
+
+func Test_SessionEventBus_PublishChunkEvents(t *testing.T) {
+	bus := NewSessionEventBus()
+	events, unsubscribe := bus.Subscribe("genHash1")
+	defer unsubscribe()
+
+	bus.PublishChunkEvents(EventChunksAttached, []models.DataMap{
+		{GenesisHash: "genHash1"},
+		{GenesisHash: "genHash2"},
+		{GenesisHash: "genHash1"},
+	})
+
+	event := <-events
+	if event.Type != EventChunksAttached || event.NumChunks != 2 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+}
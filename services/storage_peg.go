@@ -0,0 +1,104 @@
+package services
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/getsentry/raven-go"
+	"github.com/oysterprotocol/brokernode/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+The storage peg is the price, in PRL, of storing one GB for one year. It is
+read from the Oyster Pearl contract and cached for StoragePegTTL. While the
+contract cannot be read the last peg read is used, or StoragePegFallback if
+none has been read yet.
+*/
+
+var (
+	// How long a peg read from the contract is used for.
+	StoragePegTTL = 10 * time.Minute
+
+	// Used until the peg can be read from the contract, set by STORAGE_PEG.
+	StoragePegFallback = oyster_utils.AmountFromUnits(1)
+
+	// How long to wait before reading the contract again after a failed read.
+	storagePegRetryInterval = 1 * time.Minute
+
+	storagePegMtx       sync.Mutex
+	storagePeg          oyster_utils.Amount
+	storagePegRead      bool
+	storagePegReading   bool
+	storagePegExpiresAt time.Time
+)
+
+var ErrInvalidStoragePeg = errors.New("storage peg read from the contract is not positive")
+
+func init() {
+	if peg, err := oyster_utils.ParseAmount(os.Getenv("STORAGE_PEG")); err == nil && peg.Sign() > 0 {
+		StoragePegFallback = peg
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("STORAGE_PEG_TTL")); err == nil {
+		StoragePegTTL = ttl
+	}
+}
+
+// getStoragePeg returns the current storage peg. It never fails, falling
+// back on the last known or the configured peg. The contract is read without
+// holding the lock, callers arriving during a read get the peg it replaces.
+func getStoragePeg() oyster_utils.Amount {
+	storagePegMtx.Lock()
+	if storagePegReading || time.Now().Before(storagePegExpiresAt) {
+		defer storagePegMtx.Unlock()
+		return currentStoragePeg()
+	}
+	storagePegReading = true
+	storagePegMtx.Unlock()
+
+	peg, err := readStoragePeg()
+
+	storagePegMtx.Lock()
+	defer storagePegMtx.Unlock()
+	storagePegReading = false
+
+	if err != nil {
+		raven.CaptureError(err, nil)
+		storagePegExpiresAt = time.Now().Add(storagePegRetryInterval)
+		return currentStoragePeg()
+	}
+
+	storagePeg = peg
+	storagePegRead = true
+	storagePegExpiresAt = time.Now().Add(StoragePegTTL)
+	return storagePeg
+}
+
+func currentStoragePeg() oyster_utils.Amount {
+	if storagePegRead {
+		return storagePeg
+	}
+	return StoragePegFallback
+}
+
+// readStoragePeg reads the storage peg from the Oyster Pearl contract.
+func readStoragePeg() (oyster_utils.Amount, error) {
+	contract, err := oysterPearlContract()
+	if err != nil {
+		return oyster_utils.Amount{}, err
+	}
+
+	ctx, cancel := ethCallContext()
+	defer cancel()
+
+	pegWei, err := contract.StoragePeg(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return oyster_utils.Amount{}, errors.Wrap(handleCallError(err), "could not read storage peg")
+	}
+	if pegWei.Sign() <= 0 {
+		return oyster_utils.Amount{}, ErrInvalidStoragePeg
+	}
+	return oyster_utils.AmountFromWei(pegWei), nil
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+func resetStoragePegCache() {
+	storagePeg = oyster_utils.Amount{}
+	storagePegRead = false
+	storagePegExpiresAt = time.Time{}
+}
+
+func Test_GetStoragePeg_Fallback(t *testing.T) {
+	setUpSimulatedChain(t)
+	defer tearDownSimulatedChain()
+	defer resetStoragePegCache()
+	resetStoragePegCache()
+
+	// No contract address is configured, so the peg cannot be read.
+	if peg := getStoragePeg(); peg.Cmp(StoragePegFallback) != 0 {
+		t.Fatalf("expected the fallback peg %v but got %v", StoragePegFallback, peg)
+	}
+}
+
+func Test_GetStoragePeg_Cached(t *testing.T) {
+	setUpSimulatedChain(t)
+	defer tearDownSimulatedChain()
+	defer resetStoragePegCache()
+
+	cached := oyster_utils.AmountFromUnits(3)
+	storagePeg = cached
+	storagePegRead = true
+	storagePegExpiresAt = time.Now().Add(time.Minute)
+
+	if peg := getStoragePeg(); peg.Cmp(cached) != 0 {
+		t.Fatalf("expected the cached peg %v but got %v", cached, peg)
+	}
+
+	// After the TTL the contract is read again, the failed read keeps the
+	// last known peg rather than the fallback.
+	storagePegExpiresAt = time.Now().Add(-time.Second)
+	if peg := getStoragePeg(); peg.Cmp(cached) != 0 {
+		t.Fatalf("expected the last known peg %v but got %v", cached, peg)
+	}
+	if !storagePegExpiresAt.After(time.Now()) {
+		t.Fatalf("a failed read should wait before reading the contract again")
+	}
+}
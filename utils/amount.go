@@ -0,0 +1,209 @@
+package oyster_utils
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+/*
+Amount is an exact amount of ETH or PRL, both of which have 18 decimals.
+It is stored as a whole number of wei, so no precision is ever lost to
+floating point. Amounts are immutable, arithmetic returns a new Amount.
+
+Amounts are written to DECIMAL(28, 18) columns and to JSON as decimal
+strings, e.g. "1.5".
+*/
+type Amount struct {
+	wei *big.Int
+}
+
+// Number of decimals of ETH and PRL.
+const AmountDecimals = 18
+
+var weiPerUnit = new(big.Int).Exp(big.NewInt(10), big.NewInt(AmountDecimals), nil)
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// AmountFromWei returns the amount of wei given.
+func AmountFromWei(wei *big.Int) Amount {
+	if wei == nil {
+		return Amount{}
+	}
+	return Amount{wei: new(big.Int).Set(wei)}
+}
+
+// AmountFromUnits returns an amount of whole ETH or PRL.
+func AmountFromUnits(units int64) Amount {
+	return Amount{wei: new(big.Int).Mul(big.NewInt(units), weiPerUnit)}
+}
+
+// ParseAmount parses a decimal string such as "12", "0.5" or "-1.25" with
+// at most 18 decimals.
+func ParseAmount(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, fraction = s[:i], s[i+1:]
+	}
+	if whole == "" && fraction == "" || len(fraction) > AmountDecimals ||
+		!isDigits(whole) || !isDigits(fraction) {
+		return Amount{}, ErrInvalidAmount
+	}
+
+	wei, _ := new(big.Int).SetString(whole+fraction+strings.Repeat("0", AmountDecimals-len(fraction)), 10)
+	if negative {
+		wei.Neg(wei)
+	}
+	return Amount{wei: wei}, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Wei returns the amount in wei.
+func (a Amount) Wei() *big.Int {
+	if a.wei == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(a.wei)
+}
+
+// String returns the amount as a decimal string without trailing zeros.
+func (a Amount) String() string {
+	wei := a.Wei()
+	sign := ""
+	if wei.Sign() < 0 {
+		sign = "-"
+		wei.Neg(wei)
+	}
+
+	whole, fraction := new(big.Int).QuoRem(wei, weiPerUnit, new(big.Int))
+	if fraction.Sign() == 0 {
+		return sign + whole.String()
+	}
+	fractionDigits := fmt.Sprintf("%0*s", AmountDecimals, fraction.String())
+	return sign + whole.String() + "." + strings.TrimRight(fractionDigits, "0")
+}
+
+// Add returns a + b.
+func (a Amount) Add(b Amount) Amount {
+	return Amount{wei: new(big.Int).Add(a.Wei(), b.raw())}
+}
+
+// Sub returns a - b.
+func (a Amount) Sub(b Amount) Amount {
+	return Amount{wei: new(big.Int).Sub(a.Wei(), b.raw())}
+}
+
+// Mul returns a * n.
+func (a Amount) Mul(n int64) Amount {
+	return Amount{wei: new(big.Int).Mul(a.Wei(), big.NewInt(n))}
+}
+
+// Div returns a / n, rounded down to the wei.
+func (a Amount) Div(n int64) Amount {
+	return Amount{wei: new(big.Int).Quo(a.Wei(), big.NewInt(n))}
+}
+
+// Cmp returns -1, 0 or +1 as a is less than, equal to or greater than b.
+func (a Amount) Cmp(b Amount) int {
+	return a.raw().Cmp(b.raw())
+}
+
+// Sign returns -1, 0 or +1 as a is negative, zero or positive.
+func (a Amount) Sign() int {
+	return a.raw().Sign()
+}
+
+// raw returns the amount in wei without copying it, for read only use.
+func (a Amount) raw() *big.Int {
+	if a.wei == nil {
+		return new(big.Int)
+	}
+	return a.wei
+}
+
+// MarshalJSON writes the amount as a decimal string.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON reads a decimal string. Plain JSON numbers are accepted too,
+// as brokers that predate Amount send them.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*a = Amount{}
+		return nil
+	}
+
+	s := string(data)
+	if strings.HasPrefix(s, `"`) {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+	parsed, err := parseNumber(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner.
+func (a *Amount) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case nil:
+		*a = Amount{}
+	case []byte:
+		*a, err = parseNumber(string(v))
+	case string:
+		*a, err = parseNumber(v)
+	case int64:
+		*a = AmountFromUnits(v)
+	case float64:
+		*a, err = parseNumber(strconv.FormatFloat(v, 'g', -1, 64))
+	default:
+		err = fmt.Errorf("cannot scan %T into an Amount", src)
+	}
+	return err
+}
+
+// Value implements driver.Valuer.
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// parseNumber is ParseAmount but also accepts exponents, such as "1e-18",
+// which JSON numbers and some drivers produce.
+func parseNumber(s string) (Amount, error) {
+	if !strings.ContainsAny(s, "eE") {
+		return ParseAmount(s)
+	}
+
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return Amount{}, ErrInvalidAmount
+	}
+	r.Mul(r, new(big.Rat).SetInt(weiPerUnit))
+	if !r.IsInt() {
+		return Amount{}, ErrInvalidAmount
+	}
+	return Amount{wei: new(big.Int).Set(r.Num())}, nil
+}
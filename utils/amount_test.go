@@ -0,0 +1,76 @@
+package oyster_utils
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func Test_ParseAmount(t *testing.T) {
+	cases := map[string]string{
+		"1":                    "1000000000000000000",
+		"1.5":                  "1500000000000000000",
+		".5":                   "500000000000000000",
+		"0.000000000000000001": "1",
+		"-2.25":                "-2250000000000000000",
+	}
+	for s, wei := range cases {
+		amount, err := ParseAmount(s)
+		assertTrue(err == nil, t, "ParseAmount should not error on "+s)
+		assertStringEqual(amount.Wei().String(), wei, t)
+	}
+}
+
+func Test_ParseAmount_Invalid(t *testing.T) {
+	for _, s := range []string{"", ".", "abc", "1.2.3", "1e5", "0.0000000000000000001"} {
+		_, err := ParseAmount(s)
+		assertTrue(err == ErrInvalidAmount, t, "ParseAmount should reject "+s)
+	}
+}
+
+func Test_Amount_String(t *testing.T) {
+	assertStringEqual(Amount{}.String(), "0", t)
+	assertStringEqual(AmountFromUnits(3).String(), "3", t)
+	assertStringEqual(AmountFromWei(big.NewInt(1)).String(), "0.000000000000000001", t)
+	assertStringEqual(AmountFromWei(big.NewInt(-1500)).String(), "-0.0000000000000015", t)
+}
+
+func Test_Amount_Arithmetic(t *testing.T) {
+	one := AmountFromUnits(1)
+	third := one.Div(3)
+
+	assertStringEqual(third.String(), "0.333333333333333333", t)
+	assertStringEqual(one.Sub(third.Mul(3)).Wei().String(), "1", t)
+	assertStringEqual(third.Add(third).String(), "0.666666666666666666", t)
+	assertTrue(third.Cmp(one) < 0, t, "a third should be less than one")
+	assertStringEqual(one.String(), "1", t) // Unchanged
+}
+
+func Test_Amount_JSON(t *testing.T) {
+	data, err := json.Marshal(struct {
+		Cost Amount `json:"cost"`
+	}{AmountFromUnits(2)})
+	assertTrue(err == nil, t, "Marshal should not error")
+	assertStringEqual(string(data), `{"cost":"2"}`, t)
+
+	for _, data := range []string{`{"cost":"2.5"}`, `{"cost":2.5}`, `{"cost":2.5e0}`} {
+		parsed := struct {
+			Cost Amount `json:"cost"`
+		}{}
+		assertTrue(json.Unmarshal([]byte(data), &parsed) == nil, t, "Unmarshal should not error on "+data)
+		assertStringEqual(parsed.Cost.String(), "2.5", t)
+	}
+}
+
+func Test_Amount_ScanValue(t *testing.T) {
+	var amount Amount
+	assertTrue(amount.Scan([]byte("1.250000000000000000")) == nil, t, "Scan should not error")
+	assertStringEqual(amount.String(), "1.25", t)
+
+	value, err := amount.Value()
+	assertTrue(err == nil, t, "Value should not error")
+	assertTrue(value == "1.25", t, "Value should be a decimal string")
+
+	assertTrue(amount.Scan(nil) == nil, t, "Scan should not error on NULL")
+	assertTrue(amount.Sign() == 0, t, "NULL should scan to zero")
+}
@@ -20,10 +20,14 @@ type dbUpdateOperation interface {
 	GetColumns() string
 	// Get columns new value in string format and separated by ", "
 	GetNewUpdateValue(ValueT) string
+	// Same as GetNewUpdateValue but keeps the value's own id, for upserting an existing record
+	GetUpsertValue(ValueT) string
 }
 
 const COLUMNS_SEPARATOR = ", "
 
+var sqlStringEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
 // Private data structure
 type dbUpdateModel struct {
 	columns  columns.Columns
@@ -68,14 +72,25 @@ func (s *dbUpdateModel) GetColumns() string {
 }
 
 func (s *dbUpdateModel) GetNewUpdateValue(v ValueT) string {
+	return s.getValues(v, false)
+}
+
+func (s *dbUpdateModel) GetUpsertValue(v ValueT) string {
+	return s.getValues(v, true)
+}
+
+func (s *dbUpdateModel) getValues(v ValueT, keepID bool) string {
 	cols := getSortedColumns(s.columns)
 	var columnValues []string
 	stValue := reflect.Indirect(reflect.ValueOf(v))
 
 	for _, t := range cols {
-		// Generated UUID for 'id' column
+		// Generated UUID for 'id' column, unless upserting
 		if t == "id" {
 			u, _ := uuid.NewV4()
+			if f := s.fieldMap[t]; keepID && len(f) > 0 {
+				u = stValue.FieldByName(f).Interface().(uuid.UUID)
+			}
 			columnValues = append(columnValues, fmt.Sprintf("'%s'", u.String()))
 			continue
 		}
@@ -103,12 +118,13 @@ func getSortedColumns(cols columns.Columns) []string {
 }
 
 // Returns string presentation of underlying value for both int and string. String will include single quote (')
+// and have its quotes and backslashes escaped.
 func getStringPresentation(v reflect.Value) string {
 	switch v.Type().Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return strconv.FormatInt(v.Int(), 10)
 	case reflect.String:
-		return fmt.Sprintf("'%v'", v.String())
+		return fmt.Sprintf("'%v'", sqlStringEscaper.Replace(v.String()))
 	default:
 		panic(errors.Errorf("No implemented type %v", v.String()))
 	}
@@ -54,3 +54,18 @@ func Test_GetNewUpdateValue_testingC(t *testing.T) {
 	st := testingC{a: "a", b: "b", c: "c", e: 123}
 	assertContainString(v.GetNewUpdateValue(st), "'a', 'b', 'c', '', 123", t)
 }
+
+func Test_GetUpsertValue_testingC(t *testing.T) {
+	v, _ := CreateDbUpdateOperation(&testingC{})
+
+	id, _ := uuid.NewV4()
+	st := testingC{ID: id, a: "a", e: 123}
+	assertStringEqual(v.GetUpsertValue(st), "'a', '', '', '', 123, '"+id.String()+"'", t)
+}
+
+func Test_GetNewUpdateValue_EscapesStrings(t *testing.T) {
+	v, _ := CreateDbUpdateOperation(&testingC{})
+
+	st := testingC{a: `it's`, b: `back\slash`}
+	assertContainString(v.GetNewUpdateValue(st), `'it\'s', 'back\\slash'`, t)
+}
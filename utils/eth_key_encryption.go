@@ -0,0 +1,264 @@
+package oyster_utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+/*
+ETH private keys are stored with envelope encryption. Every key is sealed
+with its own random data key, and the data key is sealed with the broker's
+master key. Rotating the master key only means re-sealing the data keys.
+
+An encrypted key looks like
+	enc1-<master key id>-<sealed data key>-<sealed private key>
+with every part hex encoded, matching the format Encrypt uses.
+
+The master key is a 32 byte hex string read from ETH_KEY_MASTER_KEY, or from
+the file named by ETH_KEY_MASTER_KEY_FILE. Master keys that were rotated out
+go in ETH_KEY_PREVIOUS_MASTER_KEYS, comma separated, so rows sealed with them
+can still be read until they are rotated.
+*/
+
+const encryptedEthKeyPrefix = "enc1"
+
+var (
+	ErrNoMasterKey            = errors.New("no ETH key master key configured")
+	ErrInvalidMasterKey       = errors.New("ETH key master key must be 32 hex encoded bytes")
+	ErrUnknownMasterKey       = errors.New("ETH key was encrypted with an unknown master key")
+	ErrInvalidEncryptedKey    = errors.New("malformed encrypted ETH key")
+	ErrEthKeyNotEncrypted     = errors.New("ETH key is not encrypted")
+	ErrEthKeyAlreadyEncrypted = errors.New("ETH key is already encrypted")
+)
+
+type masterKey struct {
+	id  string
+	key []byte
+}
+
+var (
+	masterKeysMtx    sync.Mutex
+	masterKeysLoaded bool
+	currentMasterKey *masterKey
+	masterKeysByID   map[string]*masterKey
+	masterKeysErr    error
+)
+
+// SetEthKeyMasterKeys replaces the master keys read from the environment.
+// current seals new keys; previous are only used to open existing ones.
+func SetEthKeyMasterKeys(current string, previous ...string) error {
+	masterKeysMtx.Lock()
+	defer masterKeysMtx.Unlock()
+
+	masterKeysLoaded = true
+	currentMasterKey, masterKeysByID, masterKeysErr = parseMasterKeys(current, previous)
+	return masterKeysErr
+}
+
+// IsEncryptedEthKey reports whether ethKey was sealed by EncryptEthKey.
+func IsEncryptedEthKey(ethKey string) bool {
+	return strings.HasPrefix(ethKey, encryptedEthKeyPrefix+"-")
+}
+
+// EncryptEthKey seals a hex encoded ETH private key under the current
+// master key.
+func EncryptEthKey(plainKey string) (string, error) {
+	if IsEncryptedEthKey(plainKey) {
+		return "", ErrEthKeyAlreadyEncrypted
+	}
+
+	current, _, err := masterKeys()
+	if err != nil {
+		return "", err
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err = io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+
+	sealedDataKey, err := seal(current.key, dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealedKey, err := seal(dataKey, []byte(plainKey))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join([]string{encryptedEthKeyPrefix, current.id,
+		hex.EncodeToString(sealedDataKey), hex.EncodeToString(sealedKey)}, "-"), nil
+}
+
+// DecryptEthKey opens a key sealed by EncryptEthKey.
+func DecryptEthKey(encryptedKey string) (string, error) {
+	dataKey, sealedKey, _, err := openDataKey(encryptedKey)
+	if err != nil {
+		return "", err
+	}
+
+	plainKey, err := open(dataKey, sealedKey)
+	if err != nil {
+		return "", ErrInvalidEncryptedKey
+	}
+	return string(plainKey), nil
+}
+
+// RewrapEthKey re-seals the data key of encryptedKey under the current
+// master key. The private key itself is not decrypted. changed is false if
+// the key was already sealed under the current master key.
+func RewrapEthKey(encryptedKey string) (rewrapped string, changed bool, err error) {
+	dataKey, sealedKey, keyID, err := openDataKey(encryptedKey)
+	if err != nil {
+		return "", false, err
+	}
+
+	current, _, err := masterKeys()
+	if err != nil {
+		return "", false, err
+	}
+	if keyID == current.id {
+		return encryptedKey, false, nil
+	}
+
+	sealedDataKey, err := seal(current.key, dataKey)
+	if err != nil {
+		return "", false, err
+	}
+
+	return strings.Join([]string{encryptedEthKeyPrefix, current.id,
+		hex.EncodeToString(sealedDataKey), hex.EncodeToString(sealedKey)}, "-"), true, nil
+}
+
+func openDataKey(encryptedKey string) (dataKey []byte, sealedKey []byte, keyID string, err error) {
+	if !IsEncryptedEthKey(encryptedKey) {
+		return nil, nil, "", ErrEthKeyNotEncrypted
+	}
+
+	arr := strings.Split(encryptedKey, "-")
+	if len(arr) != 4 {
+		return nil, nil, "", ErrInvalidEncryptedKey
+	}
+	keyID = arr[1]
+	sealedDataKey, err := hex.DecodeString(arr[2])
+	if err != nil {
+		return nil, nil, "", ErrInvalidEncryptedKey
+	}
+	sealedKey, err = hex.DecodeString(arr[3])
+	if err != nil {
+		return nil, nil, "", ErrInvalidEncryptedKey
+	}
+
+	_, byID, err := masterKeys()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	master, ok := byID[keyID]
+	if !ok {
+		return nil, nil, "", ErrUnknownMasterKey
+	}
+
+	dataKey, err = open(master.key, sealedDataKey)
+	if err != nil {
+		return nil, nil, "", ErrInvalidEncryptedKey
+	}
+	return dataKey, sealedKey, keyID, nil
+}
+
+// masterKeys lazily loads the master keys from the environment.
+func masterKeys() (*masterKey, map[string]*masterKey, error) {
+	masterKeysMtx.Lock()
+	defer masterKeysMtx.Unlock()
+
+	if !masterKeysLoaded {
+		masterKeysLoaded = true
+		currentMasterKey, masterKeysByID, masterKeysErr = loadMasterKeys()
+	}
+	return currentMasterKey, masterKeysByID, masterKeysErr
+}
+
+func loadMasterKeys() (*masterKey, map[string]*masterKey, error) {
+	current := os.Getenv("ETH_KEY_MASTER_KEY")
+	if keyFile := os.Getenv("ETH_KEY_MASTER_KEY_FILE"); current == "" && keyFile != "" {
+		contents, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		current = string(contents)
+	}
+
+	var previous []string
+	if prev := os.Getenv("ETH_KEY_PREVIOUS_MASTER_KEYS"); prev != "" {
+		previous = strings.Split(prev, ",")
+	}
+
+	return parseMasterKeys(current, previous)
+}
+
+func parseMasterKeys(current string, previous []string) (*masterKey, map[string]*masterKey, error) {
+	if strings.TrimSpace(current) == "" {
+		return nil, nil, ErrNoMasterKey
+	}
+
+	byID := map[string]*masterKey{}
+	var currentKey *masterKey
+	for i, hexKey := range append([]string{current}, previous...) {
+		key, err := hex.DecodeString(strings.TrimSpace(hexKey))
+		if err != nil || len(key) != 32 {
+			return nil, nil, ErrInvalidMasterKey
+		}
+
+		// The id only has to tell master keys apart, it does not leak the key.
+		sum := sha256.Sum256(key)
+		mk := &masterKey{id: hex.EncodeToString(sum[:4]), key: key}
+		byID[mk.id] = mk
+		if i == 0 {
+			currentKey = mk
+		}
+	}
+	return currentKey, byID, nil
+}
+
+// seal encrypts plaintext with AES-256-GCM and prepends the nonce.
+func seal(key []byte, plaintext []byte) ([]byte, error) {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aesgcm, err := cipher.NewGCM(b)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aesgcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aesgcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key []byte, sealed []byte) ([]byte, error) {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aesgcm, err := cipher.NewGCM(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aesgcm.NonceSize() {
+		return nil, ErrInvalidEncryptedKey
+	}
+	nonce, data := sealed[:aesgcm.NonceSize()], sealed[aesgcm.NonceSize():]
+	return aesgcm.Open(nil, nonce, data, nil)
+}
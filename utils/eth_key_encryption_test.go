@@ -0,0 +1,87 @@
+package oyster_utils
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	testMasterKey    = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	testNewMasterKey = "1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100"
+	testEthKey       = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+)
+
+func Test_EncryptEthKey_RoundTrip(t *testing.T) {
+	SetEthKeyMasterKeys(testMasterKey)
+
+	encrypted, err := EncryptEthKey(testEthKey)
+	assertTrue(err == nil, t, "EncryptEthKey should not error")
+	assertTrue(IsEncryptedEthKey(encrypted), t, "result should be marked as encrypted")
+	assertTrue(!strings.Contains(encrypted, testEthKey), t, "result should not contain the plain key")
+
+	decrypted, err := DecryptEthKey(encrypted)
+	assertTrue(err == nil, t, "DecryptEthKey should not error")
+	assertStringEqual(decrypted, testEthKey, t)
+}
+
+func Test_EncryptEthKey_UsesFreshDataKeys(t *testing.T) {
+	SetEthKeyMasterKeys(testMasterKey)
+
+	first, _ := EncryptEthKey(testEthKey)
+	second, _ := EncryptEthKey(testEthKey)
+	assertTrue(first != second, t, "encrypting the same key twice should not give the same result")
+}
+
+func Test_EncryptEthKey_NoMasterKey(t *testing.T) {
+	SetEthKeyMasterKeys("")
+
+	_, err := EncryptEthKey(testEthKey)
+	assertTrue(err == ErrNoMasterKey, t, "expected ErrNoMasterKey")
+
+	assertTrue(SetEthKeyMasterKeys("tooshort") == ErrInvalidMasterKey, t, "expected ErrInvalidMasterKey")
+}
+
+func Test_EncryptEthKey_AlreadyEncrypted(t *testing.T) {
+	SetEthKeyMasterKeys(testMasterKey)
+
+	encrypted, _ := EncryptEthKey(testEthKey)
+	_, err := EncryptEthKey(encrypted)
+	assertTrue(err == ErrEthKeyAlreadyEncrypted, t, "expected ErrEthKeyAlreadyEncrypted")
+}
+
+func Test_DecryptEthKey_Errors(t *testing.T) {
+	SetEthKeyMasterKeys(testMasterKey)
+
+	_, err := DecryptEthKey(testEthKey)
+	assertTrue(err == ErrEthKeyNotEncrypted, t, "expected ErrEthKeyNotEncrypted")
+
+	encrypted, _ := EncryptEthKey(testEthKey)
+	tampered := encrypted[:len(encrypted)-2] + "00"
+	if tampered == encrypted {
+		tampered = encrypted[:len(encrypted)-2] + "ff"
+	}
+	_, err = DecryptEthKey(tampered)
+	assertTrue(err == ErrInvalidEncryptedKey, t, "expected ErrInvalidEncryptedKey for a tampered key")
+
+	SetEthKeyMasterKeys(testNewMasterKey)
+	_, err = DecryptEthKey(encrypted)
+	assertTrue(err == ErrUnknownMasterKey, t, "expected ErrUnknownMasterKey")
+}
+
+func Test_RewrapEthKey(t *testing.T) {
+	SetEthKeyMasterKeys(testMasterKey)
+	encrypted, _ := EncryptEthKey(testEthKey)
+
+	_, changed, err := RewrapEthKey(encrypted)
+	assertTrue(err == nil && !changed, t, "a key under the current master key should not be rewrapped")
+
+	SetEthKeyMasterKeys(testNewMasterKey, testMasterKey)
+	rewrapped, changed, err := RewrapEthKey(encrypted)
+	assertTrue(err == nil && changed, t, "a key under an old master key should be rewrapped")
+
+	// Only the new master key is needed from now on.
+	SetEthKeyMasterKeys(testNewMasterKey)
+	decrypted, err := DecryptEthKey(rewrapped)
+	assertTrue(err == nil, t, "rewrapped key should decrypt with the new master key")
+	assertStringEqual(decrypted, testEthKey, t)
+}
@@ -0,0 +1,108 @@
+package oyster_utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+	"math/big"
+)
+
+/*
+Where the treasure is buried in each sector is settled by the alpha and beta
+brokers with commit-reveal. Each broker draws a random secret and sends the
+other a commitment, the sha256 of the secret. Only once both commitments are
+exchanged are the secrets revealed and checked against them. The index in
+sector i is sha256(alphaSecret || betaSecret || i) modulo the sector length,
+so neither broker can predict or steer it without the other's secret, and
+neither can change its secret after seeing the other's. The beta broker reveals
+last, so it could still refuse to reveal a secret that buries the treasure
+where it does not want it. The alpha broker then fails the session and the
+beta loses reputation, see SelectBetaBrokernode.
+*/
+
+const TreasureSecretSize = 32
+
+var ErrInvalidTreasureSecret = errors.New("treasure secret must be 32 hex encoded bytes")
+
+// NewTreasureSecret returns a random hex encoded secret.
+func NewTreasureSecret() (string, error) {
+	secret := make([]byte, TreasureSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// TreasureCommitment returns the commitment to send for secret.
+func TreasureCommitment(secret string) string {
+	secretBytes, _ := hex.DecodeString(secret)
+	hash := sha256.Sum256(secretBytes)
+	return hex.EncodeToString(hash[:])
+}
+
+// VerifyTreasureReveal checks secret is the one commitment was made to.
+func VerifyTreasureReveal(secret string, commitment string) bool {
+	if _, err := decodeTreasureSecret(secret); err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(TreasureCommitment(secret)), []byte(commitment)) == 1
+}
+
+// TreasureIndexesFromSecrets returns the index of the treasure in every sector
+// of a file, from the revealed secrets of the alpha and then beta broker.
+func TreasureIndexesFromSecrets(fileSizeInByte int, secrets ...string) ([]int, error) {
+	var seed []byte
+	for _, secret := range secrets {
+		secretBytes, err := decodeTreasureSecret(secret)
+		if err != nil {
+			return nil, err
+		}
+		seed = append(seed, secretBytes...)
+	}
+	if len(seed) == 0 {
+		return nil, ErrInvalidTreasureSecret
+	}
+
+	var indexes []int
+	for sector, sectorLength := range TreasureSectorLengths(fileSizeInByte) {
+		sectorBytes := make([]byte, 8)
+		binary.BigEndian.PutUint64(sectorBytes, uint64(sector))
+		hash := sha256.Sum256(append(append([]byte{}, seed...), sectorBytes...))
+
+		index := new(big.Int).SetBytes(hash[:])
+		index.Mod(index, big.NewInt(int64(sectorLength)))
+		indexes = append(indexes, int(index.Int64()))
+	}
+	return indexes, nil
+}
+
+// TreasureSectorLengths returns how many chunks, treasure included, each
+// sector of a file has. A treasure is buried somewhere in every sector.
+func TreasureSectorLengths(fileSizeInByte int) []int {
+	var lengths []int
+	if fileSizeInByte <= 0 {
+		return lengths
+	}
+
+	fileSectorInByte := FileChunkSizeInByte * (FileSectorInChunkSize - 1)
+	numOfSectors := int(math.Ceil(float64(fileSizeInByte) / float64(fileSectorInByte)))
+	remainderOfChunks := math.Ceil(float64(fileSizeInByte)/FileChunkSizeInByte) + float64(numOfSectors)
+
+	for i := 0; i < numOfSectors; i++ {
+		lengths = append(lengths, int(math.Min(FileSectorInChunkSize, remainderOfChunks)))
+		remainderOfChunks = remainderOfChunks - FileSectorInChunkSize
+	}
+	return lengths
+}
+
+func decodeTreasureSecret(secret string) ([]byte, error) {
+	secretBytes, err := hex.DecodeString(secret)
+	if err != nil || len(secretBytes) != TreasureSecretSize {
+		return nil, ErrInvalidTreasureSecret
+	}
+	return secretBytes, nil
+}
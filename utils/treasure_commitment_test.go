@@ -0,0 +1,91 @@
+package oyster_utils
+
+import (
+	"testing"
+)
+
+// A file of 9 chunks has a single sector of 10, treasure included.
+const testTreasureFileSize = 9 * FileChunkSizeInByte
+
+func mustTreasureSecret(t *testing.T) string {
+	secret, err := NewTreasureSecret()
+	assertTrue(err == nil, t, "NewTreasureSecret should not error")
+	return secret
+}
+
+func Test_VerifyTreasureReveal(t *testing.T) {
+	secret := mustTreasureSecret(t)
+	commitment := TreasureCommitment(secret)
+
+	assertTrue(VerifyTreasureReveal(secret, commitment), t, "The committed secret must verify")
+	assertTrue(commitment != secret, t, "The commitment must not give the secret away")
+}
+
+func Test_VerifyTreasureReveal_Binding(t *testing.T) {
+	secret := mustTreasureSecret(t)
+	commitment := TreasureCommitment(secret)
+
+	// A broker cannot reveal another secret than it committed to.
+	assertTrue(!VerifyTreasureReveal(mustTreasureSecret(t), commitment), t, "Another secret must not verify")
+	assertTrue(!VerifyTreasureReveal("", TreasureCommitment("")), t, "An empty secret must not verify")
+	assertTrue(!VerifyTreasureReveal("abcd", TreasureCommitment("abcd")), t, "A short secret must not verify")
+}
+
+func Test_TreasureIndexesFromSecrets(t *testing.T) {
+	alphaSecret := mustTreasureSecret(t)
+	betaSecret := mustTreasureSecret(t)
+	fileSize := int(2.6 * FileSectorInChunkSize * FileChunkSizeInByte)
+
+	indexes, err := TreasureIndexesFromSecrets(fileSize, alphaSecret, betaSecret)
+	assertTrue(err == nil, t, "TreasureIndexesFromSecrets should not error")
+
+	lengths := TreasureSectorLengths(fileSize)
+	assertTrue(len(indexes) == len(lengths), t, "Must have an index for every sector")
+	for i := range indexes {
+		assertTrue(indexes[i] >= 0 && indexes[i] < lengths[i], t, "Must be within its sector")
+	}
+
+	// Both brokers arrive at the same indexes.
+	again, _ := TreasureIndexesFromSecrets(fileSize, alphaSecret, betaSecret)
+	assertTrue(IntsJoin(indexes, IntsJoinDelim) == IntsJoin(again, IntsJoinDelim), t, "Must be deterministic")
+
+	_, err = TreasureIndexesFromSecrets(fileSize, alphaSecret, "notASecret")
+	assertTrue(err == ErrInvalidTreasureSecret, t, "Must reject invalid secrets")
+}
+
+// Whatever secret one broker picks, the other's random secret spreads the
+// index evenly over the sector.
+func Test_TreasureIndexesFromSecrets_UniformWithOneRandomSecret(t *testing.T) {
+	const draws = 2000
+	sectorLength := TreasureSectorLengths(testTreasureFileSize)[0]
+	assertTrue(sectorLength == 10, t, "Test file must have a sector of 10")
+
+	fixedSecret := mustTreasureSecret(t)
+	for _, alphaIsFixed := range []bool{true, false} {
+		counts := make([]int, sectorLength)
+		for i := 0; i < draws; i++ {
+			alphaSecret, betaSecret := fixedSecret, mustTreasureSecret(t)
+			if !alphaIsFixed {
+				alphaSecret, betaSecret = betaSecret, fixedSecret
+			}
+
+			indexes, err := TreasureIndexesFromSecrets(testTreasureFileSize, alphaSecret, betaSecret)
+			assertTrue(err == nil, t, "TreasureIndexesFromSecrets should not error")
+			counts[indexes[0]]++
+		}
+
+		// Expect 200 per index, a biased index would be far outside this.
+		for _, count := range counts {
+			assertTrue(count > 120 && count < 280, t, "Index must be uniform whatever one broker picks")
+		}
+	}
+}
+
+func Test_TreasureSectorLengths(t *testing.T) {
+	assertTrue(len(TreasureSectorLengths(-1)) == 0, t, "Len must equal to 0")
+
+	lengths := TreasureSectorLengths(int(2.6 * FileSectorInChunkSize * FileChunkSizeInByte))
+	assertTrue(len(lengths) == 3, t, "")
+	assertTrue(lengths[0] == FileSectorInChunkSize && lengths[1] == FileSectorInChunkSize, t, "")
+	assertTrue(lengths[2] == int(0.6*FileSectorInChunkSize)+3, t, "")
+}
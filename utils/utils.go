@@ -3,8 +3,6 @@ package oyster_utils
 import (
 	"bytes"
 	"encoding/json"
-	"errors"
-	"github.com/gobuffalo/pop/nulls"
 	"io/ioutil"
 	"log"
 	"math"
@@ -101,43 +99,12 @@ func TransformIndexWithBuriedIndexes(index int, treasureIdxMap []int) int {
 // Randomly generate a set of indexes in each sector
 func GenerateInsertedIndexesForPearl(fileSizeInByte int) []int {
 	var indexes []int
-	if fileSizeInByte <= 0 {
-		return indexes
-	}
-
-	fileSectorInByte := FileChunkSizeInByte * (FileSectorInChunkSize - 1)
-	numOfSectors := int(math.Ceil(float64(fileSizeInByte) / float64(fileSectorInByte)))
-	remainderOfChunks := math.Ceil(float64(fileSizeInByte)/FileChunkSizeInByte) + float64(numOfSectors)
-
-	for i := 0; i < numOfSectors; i++ {
-		rang := int(math.Min(FileSectorInChunkSize, remainderOfChunks))
-		indexes = append(indexes, rand.Intn(rang))
-		remainderOfChunks = remainderOfChunks - FileSectorInChunkSize
+	for _, sectorLength := range TreasureSectorLengths(fileSizeInByte) {
+		indexes = append(indexes, rand.Intn(sectorLength))
 	}
 	return indexes
 }
 
-// Return the IdxMap for treasure to burried
-func GetTreasureIdxMap(alphaIndexes []int, betaIndexs []int) nulls.String {
-	mergedIndexes, err := mergeIndexes(alphaIndexes, betaIndexs)
-	var idxMap nulls.String
-	if err == nil {
-		idxMap = nulls.NewString(IntsJoin(mergedIndexes, IntsJoinDelim))
-	} else {
-		idxMap = nulls.String{"", false}
-	}
-	return idxMap
-}
-
-// Returns int[] for serialized nulls.String
-func GetTreasureIdxIndexes(idxMap nulls.String) []int {
-	if !idxMap.Valid {
-		// TODO(pzhao5): add some logging here
-		return []int{}
-	}
-	return IntsSplit(idxMap.String, IntsJoinDelim)
-}
-
 // Convert an []string array to a string.
 func StringsJoin(A []string, delim string) string {
 	var buffer bytes.Buffer
@@ -175,18 +142,3 @@ func IntsSplit(a string, delim string) []int {
 	}
 	return ints
 }
-
-// Private methods
-// Merge 2 different indexes into 1 indexes. Computed Merged indexes
-func mergeIndexes(a []int, b []int) ([]int, error) {
-	var merged []int
-	if len(a) == 0 && len(b) == 0 || len(a) != len(b) {
-		return nil, errors.New("Invalid input")
-	}
-
-	for i := 0; i < len(a); i++ {
-		// TODO(pzhao5): figure a better way to hash it.
-		merged = append(merged, (a[i]+b[i])/2)
-	}
-	return merged, nil
-}
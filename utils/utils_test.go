@@ -1,7 +1,6 @@
 package oyster_utils
 
 import (
-	"github.com/gobuffalo/pop/nulls"
 	"testing"
 )
 
@@ -148,52 +147,6 @@ func Test_GenerateInsertIndexesForPearl_NotNeedToExtendedToNextSector(t *testing
 	assertTrue(indexes[2] >= 0 && indexes[2] < FileSectorInChunkSize, t, "Must within range of [0, FileSectorInChunkSize)")
 }
 
-func Test_MergedIndexes_EmptyIndexes(t *testing.T) {
-	_, err := mergeIndexes([]int{}, nil)
-
-	assertTrue(err != nil, t, "")
-}
-
-func Test_MergedIndexes_OneNonEmptyIndexes(t *testing.T) {
-	_, err := mergeIndexes(nil, []int{1, 2})
-
-	assertTrue(err != nil, t, "Must result an error")
-}
-
-func Test_MergeIndexes_SameSize(t *testing.T) {
-	indexes, _ := mergeIndexes([]int{1, 2, 3}, []int{1, 2, 3})
-
-	assertTrue(len(indexes) == 3, t, "Must result an error")
-}
-
-func Test_GetTreasureIdxMap_ValidInput(t *testing.T) {
-	idxMap := GetTreasureIdxMap([]int{1}, []int{2})
-
-	assertTrue(idxMap.Valid, t, "")
-}
-
-func Test_GetTreasureIdxMap_InvalidInput(t *testing.T) {
-	idxMap := GetTreasureIdxMap([]int{1}, []int{1, 2})
-
-	assertTrue(idxMap.String == "", t, "")
-	assertTrue(!idxMap.Valid, t, "")
-}
-
-func Test_GetTreasureIdxIndexes_InvalidInput(t *testing.T) {
-	indexes := GetTreasureIdxIndexes(nulls.String{"", false})
-
-	assertTrue(len(indexes) == 0, t, "")
-}
-
-func Test_GetTreasureIdxIndexes_ValidInput(t *testing.T) {
-	indexes := GetTreasureIdxIndexes(nulls.String{"1_1_1", true})
-
-	assertTrue(len(indexes) == 3, t, "")
-	assertTrue(indexes[0] == 1, t, "")
-	assertTrue(indexes[1] == 1, t, "")
-	assertTrue(indexes[2] == 1, t, "")
-}
-
 func Test_IntsJoin_NoInts(t *testing.T) {
 	v := IntsJoin(nil, " ")
 